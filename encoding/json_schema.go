@@ -0,0 +1,347 @@
+package encoding
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// JSONSchema is a JSON schema that requests or responses can be validated
+// against. It supports the JSON Schema draft 7 keywords that constrain a
+// single value: type, enum, const, properties, required,
+// additionalProperties, items, pattern, minLength, maxLength, minimum,
+// maximum, exclusiveMinimum, exclusiveMaximum, minItems and maxItems.
+// Other keywords, including $ref, are ignored.
+type JSONSchema struct {
+	node *schemaNode
+}
+
+// rawSchema is a schema as written, before its patterns are compiled.
+type rawSchema struct {
+	Type                 json.RawMessage      `json:"type"`
+	Enum                 []json.RawMessage    `json:"enum"`
+	Const                json.RawMessage      `json:"const"`
+	Properties           map[string]rawSchema `json:"properties"`
+	Required             []string             `json:"required"`
+	AdditionalProperties json.RawMessage      `json:"additionalProperties"`
+	Items                *rawSchema           `json:"items"`
+	Pattern              *string              `json:"pattern"`
+	MinLength            *int                 `json:"minLength"`
+	MaxLength            *int                 `json:"maxLength"`
+	Minimum              *float64             `json:"minimum"`
+	Maximum              *float64             `json:"maximum"`
+	ExclusiveMinimum     *float64             `json:"exclusiveMinimum"`
+	ExclusiveMaximum     *float64             `json:"exclusiveMaximum"`
+	MinItems             *int                 `json:"minItems"`
+	MaxItems             *int                 `json:"maxItems"`
+}
+
+type schemaNode struct {
+	raw rawSchema
+
+	types      []string
+	enum       []interface{}
+	constValue interface{}
+	hasConst   bool
+	properties map[string]*schemaNode
+	pattern    *regexp.Regexp
+	items      *schemaNode
+
+	// additionalProperties is nil if any property is allowed, and
+	// noAdditional is set if none are.
+	additionalProperties *schemaNode
+	noAdditional         bool
+}
+
+// ParseJSONSchema parses a JSON schema.
+func ParseJSONSchema(schema []byte) (*JSONSchema, error) {
+	var raw rawSchema
+	if err := json.Unmarshal(schema, &raw); err != nil {
+		return nil, fmt.Errorf("could not parse JSON schema: %v", err)
+	}
+	node, err := compileSchema(raw, "$")
+	if err != nil {
+		return nil, err
+	}
+	return &JSONSchema{node: node}, nil
+}
+
+func compileSchema(raw rawSchema, path string) (*schemaNode, error) {
+	node := &schemaNode{raw: raw}
+
+	if len(raw.Type) > 0 {
+		var single string
+		if err := json.Unmarshal(raw.Type, &single); err == nil {
+			node.types = []string{single}
+		} else if err := json.Unmarshal(raw.Type, &node.types); err != nil {
+			return nil, fmt.Errorf("invalid JSON schema type at %v: %s", path, raw.Type)
+		}
+	}
+
+	for _, v := range raw.Enum {
+		value, err := decodeJSONValue(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid JSON schema enum at %v: %v", path, err)
+		}
+		node.enum = append(node.enum, value)
+	}
+	if len(raw.Const) > 0 {
+		value, err := decodeJSONValue(raw.Const)
+		if err != nil {
+			return nil, fmt.Errorf("invalid JSON schema const at %v: %v", path, err)
+		}
+		node.constValue, node.hasConst = value, true
+	}
+
+	if raw.Pattern != nil {
+		pattern, err := regexp.Compile(*raw.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid JSON schema pattern at %v: %v", path, err)
+		}
+		node.pattern = pattern
+	}
+
+	if len(raw.Properties) > 0 {
+		node.properties = make(map[string]*schemaNode, len(raw.Properties))
+		for name, prop := range raw.Properties {
+			propNode, err := compileSchema(prop, childPath(path, name))
+			if err != nil {
+				return nil, err
+			}
+			node.properties[name] = propNode
+		}
+	}
+
+	if len(raw.AdditionalProperties) > 0 {
+		var allowed bool
+		if err := json.Unmarshal(raw.AdditionalProperties, &allowed); err == nil {
+			node.noAdditional = !allowed
+		} else {
+			var additional rawSchema
+			if err := json.Unmarshal(raw.AdditionalProperties, &additional); err != nil {
+				return nil, fmt.Errorf("invalid JSON schema additionalProperties at %v: %v", path, err)
+			}
+			additionalNode, err := compileSchema(additional, path+".*")
+			if err != nil {
+				return nil, err
+			}
+			node.additionalProperties = additionalNode
+		}
+	}
+
+	if raw.Items != nil {
+		items, err := compileSchema(*raw.Items, path+"[*]")
+		if err != nil {
+			return nil, err
+		}
+		node.items = items
+	}
+
+	return node, nil
+}
+
+// SchemaViolation is a value that doesn't match a JSON schema.
+type SchemaViolation struct {
+	// Path is the location of the value, such as $.users[0].name.
+	Path    string
+	Message string
+}
+
+// SchemaViolationError is returned when a value doesn't match a JSON schema,
+// and lists every violation found.
+type SchemaViolationError struct {
+	Violations []SchemaViolation
+}
+
+func (e *SchemaViolationError) Error() string {
+	lines := make([]string, len(e.Violations))
+	for i, v := range e.Violations {
+		lines[i] = fmt.Sprintf("  %v: %v", v.Path, v.Message)
+	}
+	return "JSON does not match schema:\n" + strings.Join(lines, "\n")
+}
+
+// Validate checks that the JSON value in data matches the schema, returning
+// a *SchemaViolationError if it doesn't.
+func (s *JSONSchema) Validate(data []byte) error {
+	value, err := decodeJSONValue(data)
+	if err != nil {
+		return fmt.Errorf("could not parse JSON to validate against schema: %v", err)
+	}
+
+	var violations []SchemaViolation
+	s.node.validate("$", value, &violations)
+	if len(violations) > 0 {
+		return &SchemaViolationError{Violations: violations}
+	}
+	return nil
+}
+
+func (n *schemaNode) validate(path string, value interface{}, violations *[]SchemaViolation) {
+	fail := func(format string, args ...interface{}) {
+		*violations = append(*violations, SchemaViolation{
+			Path:    path,
+			Message: fmt.Sprintf(format, args...),
+		})
+	}
+
+	if len(n.types) > 0 && !matchesAnyType(value, n.types) {
+		fail("expected type %v, got %v", strings.Join(n.types, " or "), jsonType(value))
+		// The remaining checks depend on the type.
+		return
+	}
+
+	if len(n.enum) > 0 {
+		var found bool
+		for _, v := range n.enum {
+			if jsonEqual(v, value) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			fail("value is not one of the allowed values")
+		}
+	}
+	if n.hasConst && !jsonEqual(n.constValue, value) {
+		fail("value does not equal the required constant")
+	}
+
+	switch v := value.(type) {
+	case string:
+		length := utf8.RuneCountInString(v)
+		if n.raw.MinLength != nil && length < *n.raw.MinLength {
+			fail("string is shorter than the minimum length of %v", *n.raw.MinLength)
+		}
+		if n.raw.MaxLength != nil && length > *n.raw.MaxLength {
+			fail("string is longer than the maximum length of %v", *n.raw.MaxLength)
+		}
+		if n.pattern != nil && !n.pattern.MatchString(v) {
+			fail("string %q does not match pattern %q", v, n.pattern.String())
+		}
+
+	case json.Number:
+		f, _ := v.Float64()
+		if n.raw.Minimum != nil && f < *n.raw.Minimum {
+			fail("%v is less than the minimum of %v", v, *n.raw.Minimum)
+		}
+		if n.raw.Maximum != nil && f > *n.raw.Maximum {
+			fail("%v is greater than the maximum of %v", v, *n.raw.Maximum)
+		}
+		if n.raw.ExclusiveMinimum != nil && f <= *n.raw.ExclusiveMinimum {
+			fail("%v is not greater than the exclusive minimum of %v", v, *n.raw.ExclusiveMinimum)
+		}
+		if n.raw.ExclusiveMaximum != nil && f >= *n.raw.ExclusiveMaximum {
+			fail("%v is not less than the exclusive maximum of %v", v, *n.raw.ExclusiveMaximum)
+		}
+
+	case []interface{}:
+		if n.raw.MinItems != nil && len(v) < *n.raw.MinItems {
+			fail("array has fewer than the minimum of %v items", *n.raw.MinItems)
+		}
+		if n.raw.MaxItems != nil && len(v) > *n.raw.MaxItems {
+			fail("array has more than the maximum of %v items", *n.raw.MaxItems)
+		}
+		if n.items != nil {
+			for i, item := range v {
+				n.items.validate(fmt.Sprintf("%v[%v]", path, i), item, violations)
+			}
+		}
+
+	case map[string]interface{}:
+		for _, name := range n.raw.Required {
+			if _, ok := v[name]; !ok {
+				fail("missing required property %q", name)
+			}
+		}
+
+		// Sort the properties so violations are reported in a stable order.
+		names := make([]string, 0, len(v))
+		for name := range v {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			if prop, ok := n.properties[name]; ok {
+				prop.validate(childPath(path, name), v[name], violations)
+				continue
+			}
+			if n.noAdditional {
+				fail("property %q is not allowed", name)
+			} else if n.additionalProperties != nil {
+				n.additionalProperties.validate(childPath(path, name), v[name], violations)
+			}
+		}
+	}
+}
+
+func childPath(path, name string) string {
+	return path + "." + name
+}
+
+// decodeJSONValue decodes data, keeping numbers as json.Number so integers
+// can be told apart from other numbers.
+func decodeJSONValue(data []byte) (interface{}, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil {
+		return nil, err
+	}
+	return value, nil
+}
+
+func jsonType(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case string:
+		return "string"
+	case json.Number:
+		if isJSONInteger(v) {
+			return "integer"
+		}
+		return "number"
+	case []interface{}:
+		return "array"
+	default:
+		return "object"
+	}
+}
+
+func matchesAnyType(value interface{}, types []string) bool {
+	actual := jsonType(value)
+	for _, t := range types {
+		// Integers are also numbers.
+		if t == actual || (t == "number" && actual == "integer") {
+			return true
+		}
+	}
+	return false
+}
+
+func isJSONInteger(n json.Number) bool {
+	f, err := n.Float64()
+	return err == nil && f == math.Trunc(f)
+}
+
+// jsonEqual compares decoded JSON values, treating numbers as equal if they
+// have the same value, such as 1 and 1.0.
+func jsonEqual(a, b interface{}) bool {
+	an, aok := a.(json.Number)
+	bn, bok := b.(json.Number)
+	if aok && bok {
+		af, _ := an.Float64()
+		bf, _ := bn.Float64()
+		return af == bf
+	}
+	return reflect.DeepEqual(a, b)
+}
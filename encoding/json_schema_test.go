@@ -0,0 +1,192 @@
+package encoding
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/jhump/protoreflect/dynamic"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/yarpc/yab/protobuf"
+	"github.com/yarpc/yab/transport"
+)
+
+const testUserSchema = `{
+	"type": "object",
+	"required": ["name"],
+	"additionalProperties": false,
+	"properties": {
+		"name": {"type": "string", "pattern": "^[a-z]+$", "maxLength": 8},
+		"limit": {"type": "integer", "minimum": 1, "exclusiveMaximum": 100},
+		"verbose": {"type": "boolean"},
+		"tags": {"type": "array", "maxItems": 2, "items": {"enum": ["a", "b"]}}
+	}
+}`
+
+func TestJSONSchemaValidate(t *testing.T) {
+	schema, err := ParseJSONSchema([]byte(testUserSchema))
+	require.NoError(t, err)
+
+	tests := []struct {
+		msg  string
+		json string
+		want []SchemaViolation
+	}{
+		{
+			msg:  "valid",
+			json: `{"name": "alice", "limit": 10, "verbose": true, "tags": ["a"]}`,
+		},
+		{
+			msg:  "integer written as float",
+			json: `{"name": "alice", "limit": 10.0}`,
+		},
+		{
+			msg:  "missing required property",
+			json: `{"limit": 10}`,
+			want: []SchemaViolation{{Path: "$", Message: `missing required property "name"`}},
+		},
+		{
+			msg:  "pattern and length",
+			json: `{"name": "Alice-Smith"}`,
+			want: []SchemaViolation{
+				{Path: "$.name", Message: "string is longer than the maximum length of 8"},
+				{Path: "$.name", Message: `string "Alice-Smith" does not match pattern "^[a-z]+$"`},
+			},
+		},
+		{
+			msg:  "numbers out of range",
+			json: `{"name": "alice", "limit": 100}`,
+			want: []SchemaViolation{{Path: "$.limit", Message: "100 is not less than the exclusive maximum of 100"}},
+		},
+		{
+			msg:  "wrong types",
+			json: `{"name": "alice", "limit": 1.5, "verbose": "yes"}`,
+			want: []SchemaViolation{
+				{Path: "$.limit", Message: "expected type integer, got number"},
+				{Path: "$.verbose", Message: "expected type boolean, got string"},
+			},
+		},
+		{
+			msg:  "array items",
+			json: `{"name": "alice", "tags": ["a", "c", "b"]}`,
+			want: []SchemaViolation{
+				{Path: "$.tags", Message: "array has more than the maximum of 2 items"},
+				{Path: "$.tags[1]", Message: "value is not one of the allowed values"},
+			},
+		},
+		{
+			msg:  "additional property",
+			json: `{"name": "alice", "extra": 1}`,
+			want: []SchemaViolation{{Path: "$", Message: `property "extra" is not allowed`}},
+		},
+		{
+			msg:  "not an object",
+			json: `[]`,
+			want: []SchemaViolation{{Path: "$", Message: "expected type object, got array"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.msg, func(t *testing.T) {
+			err := schema.Validate([]byte(tt.json))
+			if tt.want == nil {
+				assert.NoError(t, err)
+				return
+			}
+
+			var violationErr *SchemaViolationError
+			require.True(t, errors.As(err, &violationErr), "unexpected error: %v", err)
+			assert.Equal(t, tt.want, violationErr.Violations)
+		})
+	}
+}
+
+func TestParseJSONSchemaErrors(t *testing.T) {
+	tests := []struct {
+		msg     string
+		schema  string
+		wantErr string
+	}{
+		{
+			msg:     "invalid JSON",
+			schema:  `{`,
+			wantErr: "could not parse JSON schema: unexpected end of JSON input",
+		},
+		{
+			msg:     "invalid type",
+			schema:  `{"properties": {"name": {"type": 1}}}`,
+			wantErr: "invalid JSON schema type at $.name: 1",
+		},
+		{
+			msg:     "invalid pattern",
+			schema:  `{"items": {"pattern": "("}}`,
+			wantErr: "invalid JSON schema pattern at $[*]: error parsing regexp: missing closing ): `(`",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.msg, func(t *testing.T) {
+			_, err := ParseJSONSchema([]byte(tt.schema))
+			assert.EqualError(t, err, tt.wantErr)
+		})
+	}
+}
+
+func TestProtobufJSONSchema(t *testing.T) {
+	source, err := protobuf.NewDescriptorProviderProtoFiles(protobuf.ProtoFilesArgs{
+		Dir: "../testdata/protobuf/defaults",
+	})
+	require.NoError(t, err)
+	schema, err := ParseJSONSchema([]byte(`{
+		"properties": {"name": {"type": "string", "pattern": "^user-[0-9]+$"}}
+	}`))
+	require.NoError(t, err)
+
+	serializer, err := NewProtobufWithOptions("defaults.Lookup/Get", source, ProtobufOptions{
+		RequestSchema:  schema,
+		ResponseSchema: schema,
+	})
+	require.NoError(t, err)
+
+	t.Run("valid request", func(t *testing.T) {
+		_, err := serializer.Request([]byte(`{"name": "user-1"}`))
+		assert.NoError(t, err)
+	})
+
+	t.Run("empty request", func(t *testing.T) {
+		_, err := serializer.Request(nil)
+		assert.NoError(t, err)
+	})
+
+	t.Run("invalid request", func(t *testing.T) {
+		_, err := serializer.Request([]byte(`name: bob`))
+		assert.EqualError(t, err, "request does not match schema: JSON does not match schema:\n"+
+			`  $.name: string "bob" does not match pattern "^user-[0-9]+$"`)
+	})
+
+	svc, err := source.FindService("defaults.Lookup")
+	require.NoError(t, err)
+	response := func(name string) *transport.Response {
+		msg := dynamic.NewMessage(svc.FindMethodByName("Get").GetOutputType())
+		msg.SetFieldByName("name", name)
+		body, err := proto.Marshal(msg)
+		require.NoError(t, err)
+		return &transport.Response{Body: body}
+	}
+
+	t.Run("valid response", func(t *testing.T) {
+		_, err := serializer.Response(response("user-2"))
+		assert.NoError(t, err)
+	})
+
+	t.Run("invalid response", func(t *testing.T) {
+		_, err := serializer.Response(response("bob"))
+		require.Error(t, err)
+		var violationErr *SchemaViolationError
+		require.True(t, errors.As(err, &violationErr))
+		assert.Equal(t, []SchemaViolation{
+			{Path: "$.name", Message: `string "bob" does not match pattern "^user-[0-9]+$"`},
+		}, violationErr.Violations)
+	})
+}
@@ -26,6 +26,10 @@ type protoSerializer struct {
 	methodName  string
 	method      *desc.MethodDescriptor
 	anyResolver anyResolver
+
+	populateDefaults bool
+	requestSchema    *JSONSchema
+	responseSchema   *JSONSchema
 }
 
 // bytesMsg wraps a raw byte slice for serialization purposes. Especially
@@ -77,8 +81,32 @@ func (r anyResolver) Resolve(typeUrl string) (proto.Message, error) {
 	return &bytesMsg{}, nil
 }
 
+// ProtobufOptions configures how a protobuf serializer encodes requests.
+type ProtobufOptions struct {
+	// PopulateDefaults explicitly sets fields that are omitted from a request
+	// to the default value declared for them, so proto2 fields with a
+	// non-zero default are sent on the wire. Fields without a declared
+	// default are left unset.
+	PopulateDefaults bool
+
+	// RequestSchema, if set, is a JSON schema that each request must match
+	// before it's marshaled, which can check constraints the proto types
+	// can't express, such as a field's format.
+	RequestSchema *JSONSchema
+
+	// ResponseSchema, if set, is a JSON schema that each response must
+	// match, in the JSON form it's printed in.
+	ResponseSchema *JSONSchema
+}
+
 // NewProtobuf returns a protobuf serializer.
 func NewProtobuf(fullMethodName string, source protobuf.DescriptorProvider) (Serializer, error) {
+	return NewProtobufWithOptions(fullMethodName, source, ProtobufOptions{})
+}
+
+// NewProtobufWithOptions is like NewProtobuf, but allows customizing how
+// requests are encoded.
+func NewProtobufWithOptions(fullMethodName string, source protobuf.DescriptorProvider, opts ProtobufOptions) (Serializer, error) {
 	serviceName, methodName, err := splitMethod(fullMethodName)
 	if err != nil {
 		return nil, err
@@ -101,6 +129,9 @@ func NewProtobuf(fullMethodName string, source protobuf.DescriptorProvider) (Ser
 		anyResolver: anyResolver{
 			source: source,
 		},
+		populateDefaults: opts.PopulateDefaults,
+		requestSchema:    opts.RequestSchema,
+		responseSchema:   opts.ResponseSchema,
 	}, nil
 }
 
@@ -199,6 +230,11 @@ func (p protoSerializer) Response(body *transport.Response) (interface{}, error)
 	if err = json.Unmarshal(str, &unmarshaledJSON); err != nil {
 		return nil, err
 	}
+	if p.responseSchema != nil {
+		if err := p.responseSchema.Validate(str); err != nil {
+			return nil, fmt.Errorf("response does not match schema: %w", err)
+		}
+	}
 	return unmarshaledJSON, nil
 }
 
@@ -236,11 +272,24 @@ func (p protoSerializer) encode(yamlBytes []byte) ([]byte, error) {
 	if err != nil {
 		return nil, err
 	}
+	if p.requestSchema != nil {
+		// An empty body is sent as an empty message.
+		requestJSON := jsonBytes
+		if string(requestJSON) == "null" {
+			requestJSON = []byte("{}")
+		}
+		if err := p.requestSchema.Validate(requestJSON); err != nil {
+			return nil, fmt.Errorf("request does not match schema: %w", err)
+		}
+	}
 
 	req := dynamic.NewMessage(p.method.GetInputType())
 	if err := req.UnmarshalJSON(jsonBytes); err != nil {
 		return nil, fmt.Errorf("could not parse given request body as message of type %q: %v", p.method.GetInputType().GetFullyQualifiedName(), err)
 	}
+	if p.populateDefaults {
+		populateDefaults(req)
+	}
 
 	bytes, err := proto.Marshal(req)
 	if err != nil {
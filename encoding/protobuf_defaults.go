@@ -0,0 +1,37 @@
+package encoding
+
+import (
+	"github.com/jhump/protoreflect/dynamic"
+)
+
+// populateDefaults sets each field of msg that isn't set, and declares a
+// default value, to that default. Messages that are set in msg are
+// populated in the same way. Fields in a oneof are skipped, since setting
+// one would clear the field that was chosen.
+func populateDefaults(msg *dynamic.Message) {
+	for _, fd := range msg.GetMessageDescriptor().GetFields() {
+		if msg.HasField(fd) {
+			if fd.GetMessageType() != nil && !fd.IsMap() {
+				populateNestedDefaults(msg.GetField(fd))
+			}
+			continue
+		}
+		if fd.GetOneOf() != nil || fd.AsFieldDescriptorProto().DefaultValue == nil {
+			continue
+		}
+		msg.SetField(fd, fd.GetDefaultValue())
+	}
+}
+
+// populateNestedDefaults populates the defaults of v, which is the value of
+// a singular or repeated message field.
+func populateNestedDefaults(v interface{}) {
+	switch v := v.(type) {
+	case *dynamic.Message:
+		populateDefaults(v)
+	case []interface{}:
+		for _, item := range v {
+			populateNestedDefaults(item)
+		}
+	}
+}
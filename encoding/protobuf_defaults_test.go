@@ -0,0 +1,100 @@
+package encoding
+
+import (
+	"testing"
+
+	"github.com/yarpc/yab/protobuf"
+
+	"github.com/jhump/protoreflect/dynamic"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProtobufPopulateDefaults(t *testing.T) {
+	source, err := protobuf.NewDescriptorProviderProtoFiles(protobuf.ProtoFilesArgs{
+		Dir: "../testdata/protobuf/defaults",
+	})
+	require.NoError(t, err)
+	svc, err := source.FindService("defaults.Lookup")
+	require.NoError(t, err)
+	requestType := svc.FindMethodByName("Get").GetInputType()
+
+	tests := []struct {
+		msg              string
+		body             string
+		populateDefaults bool
+		want             map[string]interface{}
+	}{
+		{
+			msg:  "defaults not populated",
+			body: `{"nested": {}}`,
+			want: map[string]interface{}{"nested": map[string]interface{}{}},
+		},
+		{
+			msg:              "defaults populated",
+			body:             `{}`,
+			populateDefaults: true,
+			want:             map[string]interface{}{"name": "anonymous", "limit": int32(10)},
+		},
+		{
+			msg:              "set fields are kept",
+			body:             `{"name": "alice", "limit": 0, "verbose": false}`,
+			populateDefaults: true,
+			want:             map[string]interface{}{"name": "alice", "limit": int32(0), "verbose": false},
+		},
+		{
+			msg:              "nested messages populated",
+			body:             `{"nested": {}, "items": [{"retries": 1}, {}]}`,
+			populateDefaults: true,
+			want: map[string]interface{}{
+				"name":   "anonymous",
+				"limit":  int32(10),
+				"nested": map[string]interface{}{"retries": int32(3)},
+				"items": []interface{}{
+					map[string]interface{}{"retries": int32(1)},
+					map[string]interface{}{"retries": int32(3)},
+				},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.msg, func(t *testing.T) {
+			serializer, err := NewProtobufWithOptions("defaults.Lookup/Get", source, ProtobufOptions{
+				PopulateDefaults: tt.populateDefaults,
+			})
+			require.NoError(t, err)
+			req, err := serializer.Request([]byte(tt.body))
+			require.NoError(t, err)
+
+			// Only read fields that were set on the wire, rather than the
+			// defaults that are returned for unset fields.
+			got := dynamic.NewMessage(requestType)
+			require.NoError(t, got.Unmarshal(req.Body))
+			assert.Equal(t, tt.want, setFields(got))
+		})
+	}
+}
+
+func setFields(msg *dynamic.Message) map[string]interface{} {
+	fields := make(map[string]interface{})
+	for _, fd := range msg.GetKnownFields() {
+		if !msg.HasField(fd) {
+			continue
+		}
+		v := msg.GetField(fd)
+		switch v := v.(type) {
+		case *dynamic.Message:
+			fields[fd.GetName()] = setFields(v)
+		case []interface{}:
+			items := make([]interface{}, len(v))
+			for i, item := range v {
+				items[i] = setFields(item.(*dynamic.Message))
+			}
+			fields[fd.GetName()] = items
+		default:
+			fields[fd.GetName()] = v
+		}
+	}
+	return fields
+}
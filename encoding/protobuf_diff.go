@@ -0,0 +1,233 @@
+package encoding
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+
+	"github.com/jhump/protoreflect/desc"
+	"github.com/jhump/protoreflect/dynamic"
+	"github.com/yarpc/yab/transport"
+)
+
+// FieldDiffKind is the kind of difference found in a field.
+type FieldDiffKind int
+
+const (
+	// FieldChanged means the field is set in both responses with different values.
+	FieldChanged FieldDiffKind = iota + 1
+	// FieldAdded means the field is only set in the second response.
+	FieldAdded
+	// FieldRemoved means the field is only set in the first response.
+	FieldRemoved
+)
+
+func (k FieldDiffKind) String() string {
+	switch k {
+	case FieldChanged:
+		return "changed"
+	case FieldAdded:
+		return "added"
+	case FieldRemoved:
+		return "removed"
+	default:
+		return fmt.Sprintf("FieldDiffKind(%d)", int(k))
+	}
+}
+
+// FieldDiff is a difference in a single field between two responses.
+type FieldDiff struct {
+	// Path is the location of the field, in the syntax used by ExtractField,
+	// such as "items[0].id". Map entries are indexed by their key.
+	Path string
+	Kind FieldDiffKind
+
+	// Old and New are the values in the first and second response. Old is
+	// nil for added fields, and New is nil for removed fields.
+	Old interface{}
+	New interface{}
+}
+
+func (d FieldDiff) String() string {
+	switch d.Kind {
+	case FieldAdded:
+		return fmt.Sprintf("%v: added %v", d.Path, d.New)
+	case FieldRemoved:
+		return fmt.Sprintf("%v: removed %v", d.Path, d.Old)
+	default:
+		return fmt.Sprintf("%v: changed from %v to %v", d.Path, d.Old, d.New)
+	}
+}
+
+// DiffOptions controls how DiffResponsesWithOptions compares responses.
+type DiffOptions struct {
+	// IgnoreFields are dotted field paths without indexes, such as
+	// "items.updated_at", that aren't compared. Ignoring a message field
+	// also ignores everything within it.
+	IgnoreFields []string
+}
+
+// DiffResponses decodes the bodies of a and b as the output type of method
+// and returns their differences, ordered by field number.
+func DiffResponses(method *desc.MethodDescriptor, a, b *transport.Response) ([]FieldDiff, error) {
+	return DiffResponsesWithOptions(method, a, b, DiffOptions{})
+}
+
+// DiffResponsesWithOptions is DiffResponses with options to control the
+// comparison.
+func DiffResponsesWithOptions(method *desc.MethodDescriptor, a, b *transport.Response, opts DiffOptions) ([]FieldDiff, error) {
+	outputType := method.GetOutputType()
+	decode := func(res *transport.Response) (*dynamic.Message, error) {
+		msg := dynamic.NewMessage(outputType)
+		if err := msg.Unmarshal(res.Body); err != nil {
+			return nil, fmt.Errorf("could not parse given response body as message of type %q: %v", outputType.GetFullyQualifiedName(), err)
+		}
+		return msg, nil
+	}
+	msgA, err := decode(a)
+	if err != nil {
+		return nil, err
+	}
+	msgB, err := decode(b)
+	if err != nil {
+		return nil, err
+	}
+
+	d := &responseDiffer{ignore: make(map[string]struct{}, len(opts.IgnoreFields))}
+	for _, f := range opts.IgnoreFields {
+		d.ignore[f] = struct{}{}
+	}
+	if err := d.diffMessage("", "", msgA, msgB); err != nil {
+		return nil, err
+	}
+	return d.diffs, nil
+}
+
+type responseDiffer struct {
+	ignore map[string]struct{}
+	diffs  []FieldDiff
+}
+
+func (d *responseDiffer) add(path string, kind FieldDiffKind, oldValue, newValue interface{}) {
+	d.diffs = append(d.diffs, FieldDiff{Path: path, Kind: kind, Old: oldValue, New: newValue})
+}
+
+// diffMessage compares a and b, where path is the location of the message and
+// fieldPath is the same location without indexes, used to match ignored fields.
+func (d *responseDiffer) diffMessage(path, fieldPath string, a, b *dynamic.Message) error {
+	for _, fd := range a.GetMessageDescriptor().GetFields() {
+		childPath := joinFieldPath(path, fd.GetName())
+		childFieldPath := joinFieldPath(fieldPath, fd.GetName())
+		if _, ok := d.ignore[childFieldPath]; ok {
+			continue
+		}
+
+		inA, inB := a.HasField(fd), b.HasField(fd)
+		if !inA && !inB {
+			continue
+		}
+		va, err := a.TryGetField(fd)
+		if err != nil {
+			return fmt.Errorf("could not read field %q: %v", childPath, err)
+		}
+		vb, err := b.TryGetField(fd)
+		if err != nil {
+			return fmt.Errorf("could not read field %q: %v", childPath, err)
+		}
+
+		switch {
+		case fd.IsMap():
+			err = d.diffMap(childPath, childFieldPath, fd, va.(map[interface{}]interface{}), vb.(map[interface{}]interface{}))
+		case fd.IsRepeated():
+			err = d.diffList(childPath, childFieldPath, fd, va.([]interface{}), vb.([]interface{}))
+		case !inA:
+			d.add(childPath, FieldAdded, nil, vb)
+		case !inB:
+			d.add(childPath, FieldRemoved, va, nil)
+		default:
+			err = d.diffValue(childPath, childFieldPath, fd, va, vb)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (d *responseDiffer) diffList(path, fieldPath string, fd *desc.FieldDescriptor, a, b []interface{}) error {
+	for i := 0; i < len(a) || i < len(b); i++ {
+		elemPath := fmt.Sprintf("%v[%v]", path, i)
+		switch {
+		case i >= len(a):
+			d.add(elemPath, FieldAdded, nil, b[i])
+		case i >= len(b):
+			d.add(elemPath, FieldRemoved, a[i], nil)
+		default:
+			if err := d.diffValue(elemPath, fieldPath, fd, a[i], b[i]); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (d *responseDiffer) diffMap(path, fieldPath string, fd *desc.FieldDescriptor, a, b map[interface{}]interface{}) error {
+	// Sort the keys so differences are reported in a stable order.
+	keys := make([]interface{}, 0, len(a)+len(b))
+	for k := range a {
+		keys = append(keys, k)
+	}
+	for k := range b {
+		if _, ok := a[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return fmt.Sprint(keys[i]) < fmt.Sprint(keys[j])
+	})
+
+	valueField := fd.GetMapValueType()
+	for _, k := range keys {
+		entryPath := fmt.Sprintf("%v[%q]", path, fmt.Sprint(k))
+		va, inA := a[k]
+		vb, inB := b[k]
+		switch {
+		case !inA:
+			d.add(entryPath, FieldAdded, nil, vb)
+		case !inB:
+			d.add(entryPath, FieldRemoved, va, nil)
+		default:
+			if err := d.diffValue(entryPath, fieldPath, valueField, va, vb); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// diffValue compares a single value of fd, recursing into messages.
+func (d *responseDiffer) diffValue(path, fieldPath string, fd *desc.FieldDescriptor, a, b interface{}) error {
+	if fd.GetMessageType() == nil {
+		if !reflect.DeepEqual(a, b) {
+			d.add(path, FieldChanged, a, b)
+		}
+		return nil
+	}
+
+	msgA, err := asDynamicMessage(fd, a)
+	if err != nil {
+		return err
+	}
+	msgB, err := asDynamicMessage(fd, b)
+	if err != nil {
+		return err
+	}
+	return d.diffMessage(path, fieldPath, msgA, msgB)
+}
+
+func joinFieldPath(path, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
@@ -0,0 +1,87 @@
+package encoding
+
+import (
+	"testing"
+
+	"github.com/jhump/protoreflect/dynamic"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/yarpc/yab/transport"
+)
+
+func TestDiffResponses(t *testing.T) {
+	method := extractTestMethod(t)
+	respType := method.GetOutputType()
+	itemType := respType.FindFieldByName("items").GetMessageType()
+	innerType := respType.FindFieldByName("inner").GetMessageType()
+
+	response := func(name string, nestedValue int64, itemIDs ...string) *transport.Response {
+		nested := dynamic.NewMessage(itemType)
+		nested.SetFieldByName("id", "nested")
+		nested.SetFieldByName("value", nestedValue)
+		inner := dynamic.NewMessage(innerType)
+		inner.SetFieldByName("count", int32(7))
+		inner.SetFieldByName("item", nested)
+
+		resp := dynamic.NewMessage(respType)
+		resp.SetFieldByName("name", name)
+		resp.SetFieldByName("inner", inner)
+		var items []interface{}
+		for _, id := range itemIDs {
+			item := dynamic.NewMessage(itemType)
+			item.SetFieldByName("id", id)
+			items = append(items, item)
+		}
+		resp.SetFieldByName("items", items)
+		body, err := resp.Marshal()
+		require.NoError(t, err)
+		return &transport.Response{Body: body}
+	}
+
+	t.Run("equal", func(t *testing.T) {
+		diffs, err := DiffResponses(method, response("a", 1, "x"), response("a", 1, "x"))
+		require.NoError(t, err)
+		assert.Empty(t, diffs)
+	})
+
+	t.Run("changed nested field", func(t *testing.T) {
+		diffs, err := DiffResponses(method, response("a", 1, "x"), response("a", 2, "x"))
+		require.NoError(t, err)
+		assert.Equal(t, []FieldDiff{
+			{Path: "inner.item.value", Kind: FieldChanged, Old: int64(1), New: int64(2)},
+		}, diffs)
+		assert.Equal(t, "inner.item.value: changed from 1 to 2", diffs[0].String())
+	})
+
+	t.Run("added and removed", func(t *testing.T) {
+		diffs, err := DiffResponses(method, response("a", 1, "x", "y"), response("", 0, "z"))
+		require.NoError(t, err)
+		require.Len(t, diffs, 4)
+		assert.Equal(t, FieldDiff{Path: "name", Kind: FieldRemoved, Old: "a"}, diffs[0])
+		assert.Equal(t, FieldDiff{Path: "inner.item.value", Kind: FieldRemoved, Old: int64(1)}, diffs[1])
+		assert.Equal(t, FieldDiff{Path: "items[0].id", Kind: FieldChanged, Old: "x", New: "z"}, diffs[2])
+		assert.Equal(t, "items[1]", diffs[3].Path)
+		assert.Equal(t, FieldRemoved, diffs[3].Kind)
+	})
+
+	t.Run("ignored fields", func(t *testing.T) {
+		diffs, err := DiffResponsesWithOptions(method, response("a", 1, "x"), response("b", 2, "y"), DiffOptions{
+			IgnoreFields: []string{"name", "items.id"},
+		})
+		require.NoError(t, err)
+		assert.Equal(t, []FieldDiff{
+			{Path: "inner.item.value", Kind: FieldChanged, Old: int64(1), New: int64(2)},
+		}, diffs)
+
+		diffs, err = DiffResponsesWithOptions(method, response("a", 1, "x"), response("a", 2, "x"), DiffOptions{
+			IgnoreFields: []string{"inner"},
+		})
+		require.NoError(t, err)
+		assert.Empty(t, diffs)
+	})
+
+	t.Run("invalid body", func(t *testing.T) {
+		_, err := DiffResponses(method, response("a", 1), &transport.Response{Body: []byte{0xff}})
+		assert.Contains(t, err.Error(), `could not parse given response body as message of type "extract.Response"`)
+	})
+}
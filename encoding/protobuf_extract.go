@@ -0,0 +1,132 @@
+package encoding
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/jhump/protoreflect/desc"
+	"github.com/jhump/protoreflect/dynamic"
+)
+
+var errEmptyFieldPath = errors.New("field path must not be empty")
+
+// ExtractField decodes body as the output type of method and returns the
+// value at fieldPath, a dotted list of field names where repeated fields
+// may be indexed with [i], such as "items[0].id".
+// Scalar values are returned as their Go types (int32, string, ...),
+// messages as *dynamic.Message and unindexed repeated fields as []interface{}.
+func ExtractField(method *desc.MethodDescriptor, body []byte, fieldPath string) (interface{}, error) {
+	if fieldPath == "" {
+		return nil, errEmptyFieldPath
+	}
+	msg := dynamic.NewMessage(method.GetOutputType())
+	if err := msg.Unmarshal(body); err != nil {
+		return nil, fmt.Errorf("could not parse given response body as message of type %q: %v", method.GetOutputType().GetFullyQualifiedName(), err)
+	}
+
+	var cur interface{} = msg
+	var path string
+	for _, segment := range strings.Split(fieldPath, ".") {
+		name, indexes, err := parseFieldSegment(segment)
+		if err != nil {
+			return nil, fmt.Errorf("invalid field path %q: %v", fieldPath, err)
+		}
+
+		m, ok := cur.(*dynamic.Message)
+		if !ok {
+			return nil, fmt.Errorf("cannot access field %q: %q is not a message", name, path)
+		}
+		fd := m.FindFieldDescriptorByName(name)
+		if fd == nil {
+			fd = m.FindFieldDescriptorByJSONName(name)
+		}
+		if fd == nil {
+			return nil, fmt.Errorf("no such field %q in message %q", name, m.GetMessageDescriptor().GetFullyQualifiedName())
+		}
+		if path != "" {
+			path += "."
+		}
+		path += name
+
+		if cur, err = extractFieldValue(m, fd); err != nil {
+			return nil, fmt.Errorf("could not read field %q: %v", path, err)
+		}
+		for _, i := range indexes {
+			list, ok := cur.([]interface{})
+			if !ok {
+				return nil, fmt.Errorf("cannot index field %q: not a repeated field", path)
+			}
+			if i >= len(list) {
+				return nil, fmt.Errorf("index %v out of range for field %q with %v elements", i, path, len(list))
+			}
+			path += fmt.Sprintf("[%v]", i)
+			cur = list[i]
+		}
+	}
+	return cur, nil
+}
+
+// parseFieldSegment splits a path segment such as "items[1]" into the field
+// name and any indexes.
+func parseFieldSegment(segment string) (name string, indexes []int, err error) {
+	name = segment
+	if i := strings.IndexByte(segment, '['); i >= 0 {
+		name = segment[:i]
+		rest := segment[i:]
+		for rest != "" {
+			end := strings.IndexByte(rest, ']')
+			if rest[0] != '[' || end < 0 {
+				return "", nil, fmt.Errorf("malformed index in %q", segment)
+			}
+			idx, err := strconv.Atoi(rest[1:end])
+			if err != nil || idx < 0 {
+				return "", nil, fmt.Errorf("invalid index %q in %q", rest[1:end], segment)
+			}
+			indexes = append(indexes, idx)
+			rest = rest[end+1:]
+		}
+	}
+	if name == "" {
+		return "", nil, fmt.Errorf("missing field name in %q", segment)
+	}
+	return name, indexes, nil
+}
+
+// extractFieldValue returns the value of the given field, with unset
+// messages returned as empty messages so that their fields read as defaults.
+func extractFieldValue(m *dynamic.Message, fd *desc.FieldDescriptor) (interface{}, error) {
+	v, err := m.TryGetField(fd)
+	if err != nil {
+		return nil, err
+	}
+	if fd.GetMessageType() == nil || fd.IsMap() {
+		return v, nil
+	}
+	if fd.IsRepeated() {
+		list := v.([]interface{})
+		for i, elem := range list {
+			if list[i], err = asDynamicMessage(fd, elem); err != nil {
+				return nil, err
+			}
+		}
+		return list, nil
+	}
+	if !m.HasField(fd) {
+		return dynamic.NewMessage(fd.GetMessageType()), nil
+	}
+	return asDynamicMessage(fd, v)
+}
+
+func asDynamicMessage(fd *desc.FieldDescriptor, v interface{}) (*dynamic.Message, error) {
+	switch msg := v.(type) {
+	case *dynamic.Message:
+		return msg, nil
+	case proto.Message:
+		return dynamic.AsDynamicMessage(msg)
+	default:
+		return nil, fmt.Errorf("unexpected value %T for message field %q", v, fd.GetName())
+	}
+}
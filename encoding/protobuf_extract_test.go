@@ -0,0 +1,115 @@
+package encoding
+
+import (
+	"testing"
+
+	"github.com/yarpc/yab/protobuf"
+
+	"github.com/jhump/protoreflect/desc"
+	"github.com/jhump/protoreflect/dynamic"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func extractTestMethod(t *testing.T) *desc.MethodDescriptor {
+	source, err := protobuf.NewDescriptorProviderProtoFiles(protobuf.ProtoFilesArgs{
+		Dir: "../testdata/protobuf/extract",
+	})
+	require.NoError(t, err)
+	svc, err := source.FindService("extract.Lookup")
+	require.NoError(t, err)
+	return svc.FindMethodByName("Get")
+}
+
+func TestExtractField(t *testing.T) {
+	method := extractTestMethod(t)
+	respType := method.GetOutputType()
+	itemType := respType.FindFieldByName("items").GetMessageType()
+	innerType := respType.FindFieldByName("inner").GetMessageType()
+
+	newItem := func(id string, value int64) *dynamic.Message {
+		item := dynamic.NewMessage(itemType)
+		item.SetFieldByName("id", id)
+		item.SetFieldByName("value", value)
+		return item
+	}
+	inner := dynamic.NewMessage(innerType)
+	inner.SetFieldByName("count", int32(7))
+	inner.SetFieldByName("item", newItem("nested", 3))
+
+	resp := dynamic.NewMessage(respType)
+	resp.SetFieldByName("name", "resp")
+	resp.SetFieldByName("inner", inner)
+	resp.SetFieldByName("items", []interface{}{newItem("a", 1), newItem("b", 2)})
+	resp.SetFieldByName("tags", []interface{}{"x", "y"})
+	body, err := resp.Marshal()
+	require.NoError(t, err)
+
+	tests := []struct {
+		path    string
+		want    interface{}
+		wantErr string
+	}{
+		{path: "name", want: "resp"},
+		{path: "inner.count", want: int32(7)},
+		{path: "inner.item.id", want: "nested"},
+		{path: "items[1].id", want: "b"},
+		{path: "items[0].value", want: int64(1)},
+		{path: "tags[1]", want: "y"},
+		{path: "tags", want: []interface{}{"x", "y"}},
+		{
+			path:    "inner.missing",
+			wantErr: `no such field "missing" in message "extract.Inner"`,
+		},
+		{
+			path:    "items[2].id",
+			wantErr: `index 2 out of range for field "items" with 2 elements`,
+		},
+		{
+			path:    "name[0]",
+			wantErr: `cannot index field "name": not a repeated field`,
+		},
+		{
+			path:    "name.id",
+			wantErr: `cannot access field "id": "name" is not a message`,
+		},
+		{
+			path:    "items[x]",
+			wantErr: `invalid field path "items[x]": invalid index "x" in "items[x]"`,
+		},
+		{
+			path:    "",
+			wantErr: "field path must not be empty",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			got, err := ExtractField(method, body, tt.path)
+			if tt.wantErr != "" {
+				assert.EqualError(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+
+	t.Run("unset message reads defaults", func(t *testing.T) {
+		got, err := ExtractField(method, nil, "inner.item.value")
+		require.NoError(t, err)
+		assert.Equal(t, int64(0), got)
+	})
+
+	t.Run("message value", func(t *testing.T) {
+		got, err := ExtractField(method, body, "inner.item")
+		require.NoError(t, err)
+		require.IsType(t, &dynamic.Message{}, got)
+		assert.Equal(t, "nested", got.(*dynamic.Message).GetFieldByName("id"))
+	})
+
+	t.Run("invalid body", func(t *testing.T) {
+		_, err := ExtractField(method, []byte{0xff}, "name")
+		assert.Contains(t, err.Error(), `could not parse given response body as message of type "extract.Response"`)
+	})
+}
@@ -0,0 +1,115 @@
+package encoding
+
+import (
+	"fmt"
+
+	"github.com/yarpc/yab/protobuf"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/protoc-gen-go/descriptor"
+	"github.com/jhump/protoreflect/desc"
+	"github.com/jhump/protoreflect/dynamic"
+)
+
+// Protobuf wire types.
+const (
+	wireVarint  = 0
+	wireFixed64 = 1
+	wireBytes   = 2
+	wireFixed32 = 5
+)
+
+// GuessMethod returns the methods of the given service whose input type
+// matches every field in body, as a debugging aid for raw protobuf bodies
+// that don't come with a method. A body matches if all of its fields are
+// defined by the input type, recursively, using the wire types those
+// fields are encoded with.
+//
+// This is a heuristic: protobuf messages aren't self-describing, so an
+// empty body or one that uses only common field numbers and types can match
+// several methods, and a match doesn't guarantee the body was meant for it.
+// Bodies with groups never match.
+func GuessMethod(provider protobuf.DescriptorProvider, service string, body []byte) ([]*desc.MethodDescriptor, error) {
+	serviceDescriptor, err := provider.FindService(service)
+	if err != nil {
+		return nil, err
+	}
+
+	var candidates []*desc.MethodDescriptor
+	for _, method := range serviceDescriptor.GetMethods() {
+		if !wireMatches(method.GetInputType(), body) {
+			continue
+		}
+		if err := dynamic.NewMessage(method.GetInputType()).Unmarshal(body); err != nil {
+			continue
+		}
+		candidates = append(candidates, method)
+	}
+
+	if len(candidates) == 0 {
+		return nil, fmt.Errorf("body does not match the input type of any method in service %q", service)
+	}
+	return candidates, nil
+}
+
+// wireMatches reports whether every field encoded in body is defined in md
+// with a type that uses the field's wire type.
+func wireMatches(md *desc.MessageDescriptor, body []byte) bool {
+	buf := proto.NewBuffer(body)
+	for len(buf.Unread()) > 0 {
+		key, err := buf.DecodeVarint()
+		if err != nil {
+			return false
+		}
+		fd := md.FindFieldByNumber(int32(key >> 3))
+		if fd == nil {
+			return false
+		}
+
+		wireType := key & 7
+		switch wireType {
+		case wireVarint:
+			_, err = buf.DecodeVarint()
+		case wireFixed64:
+			_, err = buf.DecodeFixed64()
+		case wireFixed32:
+			_, err = buf.DecodeFixed32()
+		case wireBytes:
+			var b []byte
+			if b, err = buf.DecodeRawBytes(false); err == nil && fd.GetMessageType() != nil && !wireMatches(fd.GetMessageType(), b) {
+				return false
+			}
+		default:
+			return false
+		}
+		if err != nil {
+			return false
+		}
+
+		expected := fieldWireType(fd)
+		packed := wireType == wireBytes && fd.IsRepeated() && expected != wireBytes
+		if wireType != expected && !packed {
+			return false
+		}
+	}
+	return true
+}
+
+func fieldWireType(fd *desc.FieldDescriptor) uint64 {
+	switch fd.GetType() {
+	case descriptor.FieldDescriptorProto_TYPE_DOUBLE,
+		descriptor.FieldDescriptorProto_TYPE_FIXED64,
+		descriptor.FieldDescriptorProto_TYPE_SFIXED64:
+		return wireFixed64
+	case descriptor.FieldDescriptorProto_TYPE_FLOAT,
+		descriptor.FieldDescriptorProto_TYPE_FIXED32,
+		descriptor.FieldDescriptorProto_TYPE_SFIXED32:
+		return wireFixed32
+	case descriptor.FieldDescriptorProto_TYPE_STRING,
+		descriptor.FieldDescriptorProto_TYPE_BYTES,
+		descriptor.FieldDescriptorProto_TYPE_MESSAGE:
+		return wireBytes
+	default:
+		return wireVarint
+	}
+}
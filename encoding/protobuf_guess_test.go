@@ -0,0 +1,84 @@
+package encoding
+
+import (
+	"testing"
+
+	"github.com/yarpc/yab/protobuf"
+
+	"github.com/jhump/protoreflect/desc"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGuessMethod(t *testing.T) {
+	source, err := protobuf.NewDescriptorProviderProtoFiles(protobuf.ProtoFilesArgs{
+		Dir: "../testdata/protobuf/guess",
+	})
+	require.NoError(t, err)
+
+	methodNames := func(methods []*desc.MethodDescriptor) []string {
+		var names []string
+		for _, m := range methods {
+			names = append(names, m.GetName())
+		}
+		return names
+	}
+
+	tests := []struct {
+		msg     string
+		service string
+		body    []byte
+		want    []string
+		wantErr string
+	}{
+		{
+			msg:     "string field 1 matches one method",
+			service: "guess.Lookup",
+			body:    []byte{0x0a, 0x02, 'h', 'i'},
+			want:    []string{"FindByName"},
+		},
+		{
+			msg:     "varint field 1 matches one method",
+			service: "guess.Lookup",
+			body:    []byte{0x08, 0x07},
+			want:    []string{"FindByID"},
+		},
+		{
+			msg:     "varint field 5 matches one method",
+			service: "guess.Lookup",
+			body:    []byte{0x28, 0x07},
+			want:    []string{"FindByCode"},
+		},
+		{
+			msg:     "empty body matches every method",
+			service: "guess.Lookup",
+			body:    nil,
+			want:    []string{"FindByName", "FindByID", "FindByCode"},
+		},
+		{
+			msg:     "no match",
+			service: "guess.Lookup",
+			body:    []byte{0x50, 0x01},
+			wantErr: `body does not match the input type of any method in service "guess.Lookup"`,
+		},
+		{
+			msg:     "unknown service",
+			service: "guess.Missing",
+			body:    nil,
+			wantErr: "guess.Missing",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.msg, func(t *testing.T) {
+			got, err := GuessMethod(source, tt.service, tt.body)
+			if tt.wantErr != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, methodNames(got))
+		})
+	}
+}
@@ -0,0 +1,48 @@
+package encoding
+
+import (
+	"fmt"
+
+	"github.com/jhump/protoreflect/desc"
+	"github.com/jhump/protoreflect/dynamic"
+)
+
+// MarshalTextToProto parses text, a message in the protobuf text format such
+// as `name: "foo" items { id: 1 }`, as the input type of method and returns
+// it in the protobuf wire format. Parse errors include the line and column of
+// the problem.
+func MarshalTextToProto(method *desc.MethodDescriptor, text []byte) ([]byte, error) {
+	inputType := method.GetInputType()
+	msg := dynamic.NewMessage(inputType)
+	if err := msg.UnmarshalText(text); err != nil {
+		return nil, fmt.Errorf("could not parse given text as message of type %q: %v", inputType.GetFullyQualifiedName(), err)
+	}
+	return msg.Marshal()
+}
+
+// TextOptions controls how UnmarshalProtoToTextWithOptions renders messages.
+type TextOptions struct {
+	// Expanded puts each field on its own line, indenting nested messages,
+	// rather than rendering the message on a single line.
+	Expanded bool
+}
+
+// UnmarshalProtoToText decodes body as the output type of method and renders
+// it in the compact protobuf text format.
+func UnmarshalProtoToText(method *desc.MethodDescriptor, body []byte) ([]byte, error) {
+	return UnmarshalProtoToTextWithOptions(method, body, TextOptions{})
+}
+
+// UnmarshalProtoToTextWithOptions is UnmarshalProtoToText with options to
+// control the rendering.
+func UnmarshalProtoToTextWithOptions(method *desc.MethodDescriptor, body []byte, opts TextOptions) ([]byte, error) {
+	outputType := method.GetOutputType()
+	msg := dynamic.NewMessage(outputType)
+	if err := msg.Unmarshal(body); err != nil {
+		return nil, fmt.Errorf("could not parse given response body as message of type %q: %v", outputType.GetFullyQualifiedName(), err)
+	}
+	if opts.Expanded {
+		return msg.MarshalTextIndent()
+	}
+	return msg.MarshalText()
+}
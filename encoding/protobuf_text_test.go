@@ -0,0 +1,122 @@
+package encoding
+
+import (
+	"testing"
+
+	"github.com/yarpc/yab/protobuf"
+
+	"github.com/jhump/protoreflect/desc"
+	"github.com/jhump/protoreflect/dynamic"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func textTestMethod(t *testing.T) *desc.MethodDescriptor {
+	source, err := protobuf.NewDescriptorProviderProtoFiles(protobuf.ProtoFilesArgs{
+		Dir: "../testdata/protobuf/defaults",
+	})
+	require.NoError(t, err)
+	svc, err := source.FindService("defaults.Lookup")
+	require.NoError(t, err)
+	return svc.FindMethodByName("Get")
+}
+
+func TestMarshalTextToProto(t *testing.T) {
+	method := textTestMethod(t)
+
+	t.Run("round trip", func(t *testing.T) {
+		const text = `name: "alice" limit: 5 nested { retries: 1 } items { retries: 2 } items { retries: 3 }`
+		body, err := MarshalTextToProto(method, []byte(text))
+		require.NoError(t, err)
+
+		msg := dynamic.NewMessage(method.GetInputType())
+		require.NoError(t, msg.Unmarshal(body))
+		assert.Equal(t, "alice", msg.GetFieldByName("name"))
+		assert.Equal(t, int32(5), msg.GetFieldByName("limit"))
+		assert.Len(t, msg.GetFieldByName("items"), 2)
+
+		back, err := msg.MarshalText()
+		require.NoError(t, err)
+		roundTripped, err := MarshalTextToProto(method, back)
+		require.NoError(t, err)
+		assert.Equal(t, body, roundTripped)
+	})
+
+	t.Run("empty", func(t *testing.T) {
+		body, err := MarshalTextToProto(method, nil)
+		require.NoError(t, err)
+		assert.Empty(t, body)
+	})
+
+	tests := []struct {
+		msg     string
+		text    string
+		wantErr string
+	}{
+		{
+			msg:     "unknown field",
+			text:    "name: \"alice\"\nunknown: 1",
+			wantErr: `could not parse given text as message of type "defaults.Request": Line 2, col 1: "unknown" is not a recognized field name of "defaults.Request"`,
+		},
+		{
+			msg:     "wrong type",
+			text:    `limit: "ten"`,
+			wantErr: `could not parse given text as message of type "defaults.Request": Line 1, col 8: Expecting an int`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.msg, func(t *testing.T) {
+			_, err := MarshalTextToProto(method, []byte(tt.text))
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.wantErr)
+		})
+	}
+}
+
+func TestUnmarshalProtoToText(t *testing.T) {
+	method := extractTestMethod(t)
+	respType := method.GetOutputType()
+	itemType := respType.FindFieldByName("items").GetMessageType()
+	innerType := respType.FindFieldByName("inner").GetMessageType()
+
+	item := dynamic.NewMessage(itemType)
+	item.SetFieldByName("id", "a")
+	item.SetFieldByName("value", int64(1))
+	inner := dynamic.NewMessage(innerType)
+	inner.SetFieldByName("count", int32(2))
+	inner.SetFieldByName("item", item)
+	resp := dynamic.NewMessage(respType)
+	resp.SetFieldByName("name", "resp")
+	resp.SetFieldByName("inner", inner)
+	resp.SetFieldByName("tags", []string{"x", "y"})
+	body, err := resp.Marshal()
+	require.NoError(t, err)
+
+	t.Run("compact", func(t *testing.T) {
+		text, err := UnmarshalProtoToText(method, body)
+		require.NoError(t, err)
+		assert.Equal(t, `name:"resp" inner:<count:2 item:<id:"a" value:1>> tags:"x" tags:"y"`, string(text))
+	})
+
+	t.Run("expanded", func(t *testing.T) {
+		text, err := UnmarshalProtoToTextWithOptions(method, body, TextOptions{Expanded: true})
+		require.NoError(t, err)
+		assert.Equal(t, `name: "resp"
+inner: <
+  count: 2
+  item: <
+    id: "a"
+    value: 1
+  >
+>
+tags: "x"
+tags: "y"`, string(text))
+	})
+
+	t.Run("invalid body", func(t *testing.T) {
+		_, err := UnmarshalProtoToText(method, []byte{0xff})
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), `could not parse given response body as message of type "extract.Response"`)
+	})
+}
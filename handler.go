@@ -97,7 +97,7 @@ func (r requestHandler) handleStreamRequest() {
 
 	if r.shouldMakeInitialRequest() {
 		if err = makeStreamRequest(r.transport, streamReq, r.serializer, streamIO, r.opts.ROpts.StreamRequestOptions); err != nil {
-			r.out.Fatalf("%v\n", err)
+			r.out.Fatalf("%s\n", errorWithDetails(r.out, r.serializer, err))
 		}
 	}
 
@@ -310,12 +310,13 @@ func receiveStreamMessage(ctx context.Context, stream *yarpctransport.ClientStre
 		return nil, err
 	}
 	if err != nil {
-		return nil, fmt.Errorf("Failed while receiving stream response: %v", err)
+		// Wrap the error so that the status and its details are preserved.
+		return nil, fmt.Errorf("Failed while receiving stream response: %w", err)
 	}
 
 	bytes, err := ioutil.ReadAll(msg.Body)
 	if err != nil {
-		return nil, fmt.Errorf("Failed while reading stream response: %v", err)
+		return nil, fmt.Errorf("Failed while reading stream response: %w", err)
 	}
 	return bytes, err
 }
@@ -379,7 +380,7 @@ func (s *streamIOInitializer) NextRequest() ([]byte, error) {
 func (s *streamIOInitializer) HandleResponse(body []byte) error {
 	res, err := s.serializer.Response(&transport.Response{Body: body})
 	if err != nil {
-		return fmt.Errorf("Failed while serializing stream response: %v", err)
+		return fmt.Errorf("Failed while serializing stream response: %w", err)
 	}
 
 	bs, err := json.MarshalIndent(res, "", "  ")
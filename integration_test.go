@@ -39,6 +39,7 @@ import (
 	yintegration "github.com/yarpc/yab/testdata/yarpc/integration"
 	"github.com/yarpc/yab/testdata/yarpc/integration/fooserver"
 
+	"github.com/golang/protobuf/proto"
 	"github.com/opentracing/opentracing-go"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -478,6 +479,15 @@ func (s *simpleService) BidiStream(stream simple.Bar_BidiStreamServer) error {
 	return s.returnError
 }
 
+// statusWithDetails returns a gRPC status error with the given details.
+func statusWithDetails(code codes.Code, msg string, details ...proto.Message) error {
+	st, err := status.New(code, msg).WithDetails(details...)
+	if err != nil {
+		panic(fmt.Sprintf("Unexpected error: %v", err))
+	}
+	return st.Err()
+}
+
 func setupGRPCServer(t *testing.T, svc *simpleService) (net.Addr, *grpc.Server) {
 	ln, err := net.Listen("tcp", "127.0.0.1:0")
 	require.NoError(t, err)
@@ -878,6 +888,41 @@ test: 10
 			expectedInput: []simple.Foo{{Test: 2}},
 			returnOutput:  []simple.Foo{{Test: 1}, {Test: 2}},
 		},
+		{
+			desc: "server streaming with error details after two messages",
+			opts: Options{
+				ROpts: RequestOptions{
+					FileDescriptorSet: []string{"testdata/protobuf/simple/simple.proto.bin"},
+					Procedure:         "Bar/ServerStream",
+					Timeout:           timeMillisFlag(time.Second),
+					RequestJSON:       `{"test":2}`,
+				},
+				TOpts: TransportOptions{
+					ServiceName: "foo",
+				},
+			},
+			wantRes: `{
+  "test": 1
+}
+
+{
+  "test": 2
+}`,
+			wantErr: `Failed while receiving stream response: code:failed-precondition message:stream aborted
+{
+  "details": [
+    {
+      "type.googleapis.com/Foo": {
+        "test": 7
+      }
+    }
+  ]
+}
+`,
+			expectedInput: []simple.Foo{{Test: 2}},
+			returnOutput:  []simple.Foo{{Test: 1}, {Test: 2}},
+			returnError:   statusWithDetails(codes.FailedPrecondition, "stream aborted", &simple.Foo{Test: 7}),
+		},
 		{
 			desc: "server streaming with YAML input",
 			opts: Options{
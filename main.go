@@ -473,29 +473,35 @@ func makeContextWithTrace(ctx context.Context, t transport.Transport, request *t
 	return ctx
 }
 
-func makeInitialRequest(out output, transport transport.Transport, serializer encoding.Serializer, req *transport.Request) {
-	response, err := makeRequestWithTracePriority(transport, req, 1)
-	if err != nil {
-		buffer := bytes.NewBufferString(err.Error())
-
-		if errorSerializer, ok := serializer.(encoding.ProtoErrorDeserializer); ok {
-			details, derr := errorSerializer.ErrorDetails(err)
-			if derr != nil {
-				out.Fatalf("Failed to get protobuf error details %s", derr.Error())
-			}
+// errorWithDetails returns the error message followed by any protobuf
+// error details carried in the error's status, formatted as JSON.
+func errorWithDetails(out output, serializer encoding.Serializer, err error) string {
+	buffer := bytes.NewBufferString(err.Error())
+
+	if errorSerializer, ok := serializer.(encoding.ProtoErrorDeserializer); ok {
+		details, derr := errorSerializer.ErrorDetails(err)
+		if derr != nil {
+			out.Fatalf("Failed to get protobuf error details %s", derr.Error())
+		}
 
-			if len(details) > 0 {
-				bs, merr := json.MarshalIndent(map[string]interface{}{"details": details}, "", "  ")
-				if merr != nil {
-					out.Fatalf("Failed to convert protobuf error details to JSON: %v\nMap: %+v\n", merr, details)
-				}
-				buffer.WriteString("\n")
-				buffer.Write(bs)
-				buffer.WriteString("\n")
+		if len(details) > 0 {
+			bs, merr := json.MarshalIndent(map[string]interface{}{"details": details}, "", "  ")
+			if merr != nil {
+				out.Fatalf("Failed to convert protobuf error details to JSON: %v\nMap: %+v\n", merr, details)
 			}
+			buffer.WriteString("\n")
+			buffer.Write(bs)
+			buffer.WriteString("\n")
 		}
+	}
+
+	return buffer.String()
+}
 
-		out.Fatalf("Failed while making call: %s\n", buffer.String())
+func makeInitialRequest(out output, transport transport.Transport, serializer encoding.Serializer, req *transport.Request) {
+	response, err := makeRequestWithTracePriority(transport, req, 1)
+	if err != nil {
+		out.Fatalf("Failed while making call: %s\n", errorWithDetails(out, serializer, err))
 	}
 
 	// responseMap converts the Thrift bytes response to a map.
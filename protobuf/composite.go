@@ -0,0 +1,115 @@
+package protobuf
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/protoc-gen-go/descriptor"
+	"github.com/jhump/protoreflect/desc"
+	"github.com/yarpc/yab/encoding/encodingerror"
+)
+
+// NewDescriptorProviderComposite returns a DescriptorProvider that looks up
+// descriptors in each of the given providers in order, using the first one
+// that has them. This allows a local FileDescriptorSet to be checked first,
+// falling back to reflection for types it doesn't define.
+// Closing the returned provider closes all of the given providers.
+func NewDescriptorProviderComposite(providers ...DescriptorProvider) DescriptorProvider {
+	return compositeSource(providers)
+}
+
+type compositeSource []DescriptorProvider
+
+func (s compositeSource) FindService(fullyQualifiedName string) (*desc.ServiceDescriptor, error) {
+	return s.FindServiceCtx(context.Background(), fullyQualifiedName)
+}
+
+func (s compositeSource) FindServiceCtx(ctx context.Context, fullyQualifiedName string) (*desc.ServiceDescriptor, error) {
+	notFound := encodingerror.NotFound{
+		Encoding:   "gRPC",
+		SearchType: "service",
+		Search:     fullyQualifiedName,
+	}
+	for _, provider := range s {
+		service, err := FindServiceCtx(ctx, provider, fullyQualifiedName)
+		if err == nil {
+			return service, nil
+		}
+
+		var providerNotFound encodingerror.NotFound
+		if !errors.As(err, &providerNotFound) {
+			return nil, err
+		}
+		if providerNotFound.Example != "" {
+			notFound.Example = providerNotFound.Example
+		}
+		notFound.Available = append(notFound.Available, providerNotFound.Available...)
+	}
+	return nil, notFound
+}
+
+func (s compositeSource) FindMessage(messageType string) (*desc.MessageDescriptor, error) {
+	return s.FindMessageCtx(context.Background(), messageType)
+}
+
+func (s compositeSource) FindMessageCtx(ctx context.Context, messageType string) (*desc.MessageDescriptor, error) {
+	for _, provider := range s {
+		msg, err := FindMessageCtx(ctx, provider, messageType)
+		if err != nil || msg != nil {
+			return msg, err
+		}
+	}
+	return nil, nil
+}
+
+// Export writes the descriptors exported by each of the providers as a single
+// set. If more than one provider has a file with the same name, the file from
+// the first provider is used, matching how descriptors are looked up. It fails
+// if any of the providers isn't a DescriptorExporter.
+func (s compositeSource) Export(w io.Writer) error {
+	set := &descriptor.FileDescriptorSet{}
+	added := make(map[string]struct{})
+	for _, provider := range s {
+		exporter, ok := provider.(DescriptorExporter)
+		if !ok {
+			return fmt.Errorf("descriptor provider %T does not support exporting descriptors", provider)
+		}
+		var buf bytes.Buffer
+		if err := exporter.Export(&buf); err != nil {
+			return err
+		}
+		var providerSet descriptor.FileDescriptorSet
+		if err := proto.Unmarshal(buf.Bytes(), &providerSet); err != nil {
+			return fmt.Errorf("could not parse exported descriptor set: %v", err)
+		}
+		for _, fd := range providerSet.File {
+			if _, ok := added[fd.GetName()]; ok {
+				continue
+			}
+			added[fd.GetName()] = struct{}{}
+			set.File = append(set.File, fd)
+		}
+	}
+
+	return writeDescriptorSet(w, set)
+}
+
+func (s compositeSource) Warnings() []string {
+	var warnings []string
+	for _, provider := range s {
+		if reporter, ok := provider.(WarningReporter); ok {
+			warnings = append(warnings, reporter.Warnings()...)
+		}
+	}
+	return warnings
+}
+
+func (s compositeSource) Close() {
+	for _, provider := range s {
+		provider.Close()
+	}
+}
@@ -0,0 +1,127 @@
+package protobuf
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/jhump/protoreflect/desc"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/reflection"
+)
+
+type closeCountingSource struct {
+	DescriptorProvider
+
+	closed int
+}
+
+func (s *closeCountingSource) Close() {
+	s.closed++
+	s.DescriptorProvider.Close()
+}
+
+type failingSource struct {
+	DescriptorProvider
+}
+
+func (failingSource) FindService(string) (*desc.ServiceDescriptor, error) {
+	return nil, errors.New("lookup failed")
+}
+
+func TestComposite(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer ln.Close()
+
+	s := grpc.NewServer()
+	reflection.Register(s)
+	go s.Serve(ln)
+	defer s.GracefulStop()
+
+	reflectionSource, err := NewDescriptorProviderReflection(ReflectionArgs{
+		Timeout: time.Second,
+		Peers:   []string{ln.Addr().String()},
+	})
+	require.NoError(t, err)
+	localSource, err := NewDescriptorProviderFileDescriptorSetBins("../testdata/protobuf/simple/simple.proto.bin")
+	require.NoError(t, err)
+
+	local := &closeCountingSource{DescriptorProvider: localSource}
+	remote := &closeCountingSource{DescriptorProvider: reflectionSource}
+	source := NewDescriptorProviderComposite(local, remote)
+
+	t.Run("service only in local set", func(t *testing.T) {
+		result, err := source.FindService("Bar")
+		require.NoError(t, err)
+		assert.Equal(t, "Bar", result.GetFullyQualifiedName())
+	})
+
+	t.Run("service only via reflection", func(t *testing.T) {
+		result, err := source.FindService("grpc.reflection.v1alpha.ServerReflection")
+		require.NoError(t, err)
+		assert.Equal(t, "grpc.reflection.v1alpha.ServerReflection", result.GetFullyQualifiedName())
+	})
+
+	t.Run("service not found lists all services", func(t *testing.T) {
+		_, err := source.FindService("Baq")
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), `could not find gRPC service "Baq"`)
+		assert.Contains(t, err.Error(), "\tBar")
+		assert.Contains(t, err.Error(), "\tgrpc.reflection.v1alpha.ServerReflection")
+	})
+
+	t.Run("message only in local set", func(t *testing.T) {
+		msg, err := source.FindMessage("Foo")
+		require.NoError(t, err)
+		require.NotNil(t, msg)
+		assert.Equal(t, "Foo", msg.GetFullyQualifiedName())
+	})
+
+	t.Run("message only via reflection", func(t *testing.T) {
+		msg, err := source.FindMessage("grpc.reflection.v1alpha.ServerReflectionRequest")
+		require.NoError(t, err)
+		require.NotNil(t, msg)
+		assert.Equal(t, "grpc.reflection.v1alpha.ServerReflectionRequest", msg.GetFullyQualifiedName())
+	})
+
+	t.Run("message not found", func(t *testing.T) {
+		msg, err := source.FindMessage("not-to-be-found")
+		assert.NoError(t, err)
+		assert.Nil(t, msg)
+	})
+
+	t.Run("errors are not treated as not found", func(t *testing.T) {
+		_, err := NewDescriptorProviderComposite(failingSource{localSource}, remote).FindService("grpc.reflection.v1alpha.ServerReflection")
+		assert.EqualError(t, err, "lookup failed")
+	})
+
+	source.Close()
+	assert.Equal(t, 1, local.closed, "local set should be closed")
+	assert.Equal(t, 1, remote.closed, "reflection source should be closed")
+}
+
+func TestFindCtxFallback(t *testing.T) {
+	source, err := NewDescriptorProviderFileDescriptorSetBins("../testdata/protobuf/simple/simple.proto.bin")
+	require.NoError(t, err)
+	_, ok := source.(ContextDescriptorProvider)
+	require.False(t, ok, "file sources can't block, so don't take a context")
+
+	svc, err := FindServiceCtx(context.Background(), source, "Bar")
+	require.NoError(t, err)
+	assert.Equal(t, "Bar", svc.GetFullyQualifiedName())
+	msg, err := FindMessageCtx(context.Background(), source, "Foo")
+	require.NoError(t, err)
+	assert.Equal(t, "Foo", msg.GetFullyQualifiedName())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = FindServiceCtx(ctx, source, "Bar")
+	assert.Equal(t, context.Canceled, err)
+	_, err = FindMessageCtx(ctx, source, "Foo")
+	assert.Equal(t, context.Canceled, err)
+}
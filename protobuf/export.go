@@ -0,0 +1,57 @@
+package protobuf
+
+import (
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/protoc-gen-go/descriptor"
+	"github.com/jhump/protoreflect/desc"
+)
+
+// DescriptorExporter is implemented by DescriptorProviders that can write
+// out the descriptors they know.
+type DescriptorExporter interface {
+	// Export writes the descriptors known to the provider to w as an encoded
+	// FileDescriptorSet, so they can be reused without the original source.
+	Export(w io.Writer) error
+}
+
+// writeFileDescriptorSet writes files and all of their dependencies to w as
+// an encoded FileDescriptorSet, which can be loaded using
+// NewDescriptorProviderFileDescriptorSetBins. Files are sorted by name, with
+// each file's dependencies written before it.
+func writeFileDescriptorSet(w io.Writer, files []*desc.FileDescriptor) error {
+	sorted := append([]*desc.FileDescriptor(nil), files...)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].GetName() < sorted[j].GetName()
+	})
+
+	set := &descriptor.FileDescriptorSet{}
+	added := make(map[string]struct{}, len(sorted))
+	var add func(fd *desc.FileDescriptor)
+	add = func(fd *desc.FileDescriptor) {
+		if _, ok := added[fd.GetName()]; ok {
+			return
+		}
+		added[fd.GetName()] = struct{}{}
+		for _, dep := range fd.GetDependencies() {
+			add(dep)
+		}
+		set.File = append(set.File, fd.AsFileDescriptorProto())
+	}
+	for _, fd := range sorted {
+		add(fd)
+	}
+	return writeDescriptorSet(w, set)
+}
+
+func writeDescriptorSet(w io.Writer, set *descriptor.FileDescriptorSet) error {
+	b, err := proto.Marshal(set)
+	if err != nil {
+		return fmt.Errorf("could not encode descriptor set: %v", err)
+	}
+	_, err = w.Write(b)
+	return err
+}
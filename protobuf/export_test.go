@@ -0,0 +1,143 @@
+package protobuf
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/reflection"
+)
+
+// reimport exports provider to a file, and loads the file as a new provider.
+func reimport(t *testing.T, provider DescriptorProvider) DescriptorProvider {
+	exporter, ok := provider.(DescriptorExporter)
+	require.True(t, ok, "%T should export descriptors", provider)
+	var buf bytes.Buffer
+	require.NoError(t, exporter.Export(&buf))
+
+	fileName := filepath.Join(t.TempDir(), "exported.bin")
+	require.NoError(t, ioutil.WriteFile(fileName, buf.Bytes(), 0644))
+	imported, err := NewDescriptorProviderFileDescriptorSetBins(fileName)
+	require.NoError(t, err)
+	return imported
+}
+
+func TestExportFileDescriptorSet(t *testing.T) {
+	tests := []struct {
+		name      string
+		fileNames []string
+	}{
+		{
+			name:      "simple",
+			fileNames: []string{"../testdata/protobuf/simple/simple.proto.bin"},
+		},
+		{
+			name: "multiple dependencies",
+			fileNames: []string{
+				"../testdata/protobuf/dependencies/main.proto.bin",
+				"../testdata/protobuf/dependencies/dep.proto.bin",
+			},
+		},
+		{
+			name:      "nested",
+			fileNames: []string{"../testdata/protobuf/nested/combined.bin"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			source, err := NewDescriptorProviderFileDescriptorSetBins(tt.fileNames...)
+			require.NoError(t, err)
+
+			imported := reimport(t, source)
+			want, err := source.FindService("Bar")
+			require.NoError(t, err)
+			got, err := imported.FindService("Bar")
+			require.NoError(t, err)
+			assert.Equal(t, want.AsServiceDescriptorProto().String(), got.AsServiceDescriptorProto().String())
+
+			// Exporting the imported provider should give the same set.
+			var exported, reexported bytes.Buffer
+			require.NoError(t, source.(DescriptorExporter).Export(&exported))
+			require.NoError(t, imported.(DescriptorExporter).Export(&reexported))
+			assert.Equal(t, exported.Bytes(), reexported.Bytes())
+		})
+	}
+}
+
+func TestExportProtoFiles(t *testing.T) {
+	source, err := NewDescriptorProviderProtoFiles(ProtoFilesArgs{Dir: "../testdata/protobuf/simple"})
+	require.NoError(t, err)
+
+	imported := reimport(t, source)
+	svc, err := imported.FindService("Bar")
+	require.NoError(t, err)
+	assert.Equal(t, "Bar", svc.GetFullyQualifiedName())
+}
+
+func TestExportReflection(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer ln.Close()
+
+	s := grpc.NewServer()
+	reflection.Register(s)
+	go s.Serve(ln)
+	defer s.GracefulStop()
+
+	source, err := NewDescriptorProviderReflection(ReflectionArgs{
+		Timeout: time.Second,
+		Peers:   []string{ln.Addr().String()},
+	})
+	require.NoError(t, err)
+	defer source.Close()
+
+	// Nothing has been fetched yet, so the export is empty.
+	empty := reimport(t, source)
+	_, err = empty.FindService("grpc.reflection.v1alpha.ServerReflection")
+	assert.Error(t, err)
+
+	_, err = source.FindService("grpc.reflection.v1alpha.ServerReflection")
+	require.NoError(t, err)
+
+	imported := reimport(t, source)
+	svc, err := imported.FindService("grpc.reflection.v1alpha.ServerReflection")
+	require.NoError(t, err)
+	assert.Len(t, svc.GetMethods(), 1)
+	msg, err := imported.FindMessage("grpc.reflection.v1alpha.ServerReflectionRequest")
+	require.NoError(t, err)
+	assert.NotNil(t, msg)
+}
+
+func TestExportComposite(t *testing.T) {
+	simple, err := NewDescriptorProviderFileDescriptorSetBins("../testdata/protobuf/simple/simple.proto.bin")
+	require.NoError(t, err)
+	options, err := NewDescriptorProviderFileDescriptorSetBins("../testdata/protobuf/options/options.proto.bin")
+	require.NoError(t, err)
+
+	imported := reimport(t, NewDescriptorProviderComposite(simple, options))
+	for _, name := range []string{"Bar", "options.Bar"} {
+		_, err := imported.FindService(name)
+		assert.NoError(t, err, "find service %v", name)
+	}
+}
+
+// lookupOnlyProvider is a DescriptorProvider that can't export descriptors.
+type lookupOnlyProvider struct {
+	DescriptorProvider
+}
+
+func TestExportCompositeUnsupported(t *testing.T) {
+	simple, err := NewDescriptorProviderFileDescriptorSetBins("../testdata/protobuf/simple/simple.proto.bin")
+	require.NoError(t, err)
+
+	composite := NewDescriptorProviderComposite(simple, lookupOnlyProvider{simple})
+	err = composite.(DescriptorExporter).Export(&bytes.Buffer{})
+	assert.EqualError(t, err, "descriptor provider protobuf.lookupOnlyProvider does not support exporting descriptors")
+}
@@ -1,7 +1,10 @@
 package protobuf
 
 import (
+	"bytes"
+	"compress/gzip"
 	"fmt"
+	"io"
 	"io/ioutil"
 
 	"github.com/golang/protobuf/proto"
@@ -10,15 +13,38 @@ import (
 	"github.com/yarpc/yab/encoding/encodingerror"
 )
 
+// FileDescriptorSetOptions configures a DescriptorProvider backed by FileDescriptorSets.
+type FileDescriptorSetOptions struct {
+	// AllowMissingImports skips files whose imports are not present in the set,
+	// rather than failing. Services defined in skipped files still fail when
+	// they are looked up.
+	AllowMissingImports bool
+
+	// Lenient skips files that can't be resolved for any reason, such as a
+	// reference to a type that isn't defined, as well as files with missing
+	// imports. Each skipped file is reported by the provider's Warnings, and
+	// services defined in skipped files still fail when they are looked up.
+	Lenient bool
+}
+
 // NewDescriptorProviderFileDescriptorSetBins creates a DescriptorSource that is backed by the named files, whose contents
-// are encoded FileDescriptorSet protos.
+// are encoded FileDescriptorSet protos. Files may be gzip-compressed.
 func NewDescriptorProviderFileDescriptorSetBins(fileNames ...string) (DescriptorProvider, error) {
+	return NewDescriptorProviderFileDescriptorSetBinsWithOptions(FileDescriptorSetOptions{}, fileNames...)
+}
+
+// NewDescriptorProviderFileDescriptorSetBinsWithOptions is like NewDescriptorProviderFileDescriptorSetBins,
+// but allows customizing how the descriptors are resolved.
+func NewDescriptorProviderFileDescriptorSetBinsWithOptions(opts FileDescriptorSetOptions, fileNames ...string) (DescriptorProvider, error) {
 	files := &descriptor.FileDescriptorSet{}
 	for _, fileName := range fileNames {
 		b, err := ioutil.ReadFile(fileName)
 		if err != nil {
 			return nil, fmt.Errorf("could not load protoset file %q: %v", fileName, err)
 		}
+		if b, err = gunzipIfCompressed(b); err != nil {
+			return nil, fmt.Errorf("could not decompress protoset file %q: %v", fileName, err)
+		}
 		var fs descriptor.FileDescriptorSet
 		err = proto.Unmarshal(b, &fs)
 		if err != nil {
@@ -26,22 +52,72 @@ func NewDescriptorProviderFileDescriptorSetBins(fileNames ...string) (Descriptor
 		}
 		files.File = append(files.File, fs.File...)
 	}
-	return NewDescriptorProviderFileDescriptorSet(files)
+	return NewDescriptorProviderFileDescriptorSetWithOptions(files, opts)
+}
+
+// gzipMagic is the header that starts gzip-compressed data.
+var gzipMagic = []byte{0x1f, 0x8b}
+
+// gunzipIfCompressed decompresses b if it's gzip-compressed, and otherwise
+// returns it unchanged. An encoded FileDescriptorSet can't start with the
+// gzip header, since 0x1f is not a valid field tag for it.
+func gunzipIfCompressed(b []byte) ([]byte, error) {
+	if !bytes.HasPrefix(b, gzipMagic) {
+		return b, nil
+	}
+	r, err := gzip.NewReader(bytes.NewReader(b))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return ioutil.ReadAll(r)
 }
 
 // NewDescriptorProviderFileDescriptorSet creates a DescriptorSource that is backed by the FileDescriptorSet.
 func NewDescriptorProviderFileDescriptorSet(files *descriptor.FileDescriptorSet) (DescriptorProvider, error) {
+	return NewDescriptorProviderFileDescriptorSetWithOptions(files, FileDescriptorSetOptions{})
+}
+
+// NewDescriptorProviderFileDescriptorSetWithOptions is like NewDescriptorProviderFileDescriptorSet,
+// but allows customizing how the descriptors are resolved.
+func NewDescriptorProviderFileDescriptorSetWithOptions(files *descriptor.FileDescriptorSet, opts FileDescriptorSetOptions) (DescriptorProvider, error) {
 	unresolved := make(map[string]*descriptor.FileDescriptorProto, len(files.File))
 	for _, fd := range files.File {
 		unresolved[fd.GetName()] = fd
 	}
 	resolved := map[string]*desc.FileDescriptor{}
+	skippedServices := map[string]error{}
+	var warnings []string
 	for _, fd := range files.File {
-		if _, err := resolveFileDescriptor(unresolved, resolved, fd.GetName()); err != nil {
+		_, err := resolveFileDescriptor(unresolved, resolved, fd.GetName())
+		if err == nil {
+			continue
+		}
+		if _, ok := err.(missingImportError); !opts.Lenient && (!ok || !opts.AllowMissingImports) {
 			return nil, err
 		}
+		warnings = append(warnings, fmt.Sprintf("skipped %v: %v", fd.GetName(), err))
+		for _, svc := range fd.GetService() {
+			skippedServices[qualifiedName(fd.GetPackage(), svc.GetName())] = fmt.Errorf("could not resolve gRPC service %q from %q: %v", qualifiedName(fd.GetPackage(), svc.GetName()), fd.GetName(), err)
+		}
 	}
-	return &fileSource{files: resolved}, nil
+	return &fileSource{files: resolved, skippedServices: skippedServices, skipWarnings: warnings}, nil
+}
+
+// missingImportError is returned when a file imports a file that is not part of the set.
+type missingImportError struct {
+	filename string
+}
+
+func (e missingImportError) Error() string {
+	return fmt.Sprintf("no descriptor found for %q", e.filename)
+}
+
+func qualifiedName(pkg, name string) string {
+	if pkg == "" {
+		return name
+	}
+	return pkg + "." + name
 }
 
 func resolveFileDescriptor(unresolved map[string]*descriptor.FileDescriptorProto, resolved map[string]*desc.FileDescriptor, filename string) (*desc.FileDescriptor, error) {
@@ -50,7 +126,7 @@ func resolveFileDescriptor(unresolved map[string]*descriptor.FileDescriptorProto
 	}
 	fd, ok := unresolved[filename]
 	if !ok {
-		return nil, fmt.Errorf("no descriptor found for %q", filename)
+		return nil, missingImportError{filename}
 	}
 	deps := make([]*desc.FileDescriptor, 0, len(fd.GetDependency()))
 	for _, dep := range fd.GetDependency() {
@@ -70,9 +146,20 @@ func resolveFileDescriptor(unresolved map[string]*descriptor.FileDescriptorProto
 
 type fileSource struct {
 	files map[string]*desc.FileDescriptor
+
+	// skippedServices holds the resolution error for services in files
+	// that were skipped due to missing imports.
+	skippedServices map[string]error
+
+	// skipWarnings describes each file that was skipped.
+	skipWarnings []string
 }
 
 func (fs *fileSource) FindService(fullyQualifiedName string) (*desc.ServiceDescriptor, error) {
+	if err, ok := fs.skippedServices[fullyQualifiedName]; ok {
+		return nil, err
+	}
+
 	var available []string
 
 	for _, fd := range fs.files {
@@ -102,4 +189,16 @@ func (fs *fileSource) FindMessage(messageType string) (*desc.MessageDescriptor,
 	return nil, nil
 }
 
+func (fs *fileSource) Export(w io.Writer) error {
+	files := make([]*desc.FileDescriptor, 0, len(fs.files))
+	for _, fd := range fs.files {
+		files = append(files, fd)
+	}
+	return writeFileDescriptorSet(w, files)
+}
+
+func (fs *fileSource) Warnings() []string {
+	return append(append([]string(nil), fs.skipWarnings...), descriptorWarnings(fs.files)...)
+}
+
 func (fs *fileSource) Close() {}
@@ -1,8 +1,15 @@
 package protobuf
 
 import (
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"path/filepath"
 	"testing"
 
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/protoc-gen-go/descriptor"
+
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -101,3 +108,167 @@ func TestNewDescriptorProviderFileDescriptorSetBins(t *testing.T) {
 		})
 	}
 }
+
+func TestNewDescriptorProviderFileDescriptorSetBinsGzip(t *testing.T) {
+	dir := t.TempDir()
+	writeGzipped := func(t *testing.T, fileName string) string {
+		b, err := ioutil.ReadFile(fileName)
+		require.NoError(t, err)
+
+		var buf bytes.Buffer
+		w := gzip.NewWriter(&buf)
+		_, err = w.Write(b)
+		require.NoError(t, err)
+		require.NoError(t, w.Close())
+
+		gzipped := filepath.Join(dir, filepath.Base(fileName)+".gz")
+		require.NoError(t, ioutil.WriteFile(gzipped, buf.Bytes(), 0644))
+		return gzipped
+	}
+
+	corrupt := filepath.Join(dir, "corrupt.pb.gz")
+	require.NoError(t, ioutil.WriteFile(corrupt, append(append([]byte(nil), gzipMagic...), "not gzip"...), 0644))
+
+	tests := []struct {
+		name      string
+		fileNames []string
+		errMsg    string
+	}{
+		{
+			name:      "gzipped",
+			fileNames: []string{writeGzipped(t, "../testdata/protobuf/simple/simple.proto.bin")},
+		},
+		{
+			name: "gzipped and plain",
+			fileNames: []string{
+				writeGzipped(t, "../testdata/protobuf/dependencies/main.proto.bin"),
+				"../testdata/protobuf/dependencies/dep.proto.bin",
+			},
+		},
+		{
+			name:      "corrupt gzip",
+			fileNames: []string{corrupt},
+			errMsg:    `could not decompress protoset file "` + corrupt + `"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := NewDescriptorProviderFileDescriptorSetBins(tt.fileNames...)
+			if tt.errMsg != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.errMsg)
+				return
+			}
+			require.NoError(t, err)
+			defer got.Close()
+
+			s, err := got.FindService("Bar")
+			require.NoError(t, err)
+			assert.Equal(t, "Bar", s.GetFullyQualifiedName())
+		})
+	}
+}
+
+func TestFileDescriptorSetAllowMissingImports(t *testing.T) {
+	loadSet := func(t *testing.T, fileNames ...string) *descriptor.FileDescriptorSet {
+		files := &descriptor.FileDescriptorSet{}
+		for _, fileName := range fileNames {
+			b, err := ioutil.ReadFile(fileName)
+			require.NoError(t, err)
+			var fs descriptor.FileDescriptorSet
+			require.NoError(t, proto.Unmarshal(b, &fs))
+			files.File = append(files.File, fs.File...)
+		}
+		return files
+	}
+
+	// unrelated.proto imports a file that is not part of the set.
+	unrelated := &descriptor.FileDescriptorProto{
+		Name:       proto.String("unrelated.proto"),
+		Package:    proto.String("unrelated"),
+		Dependency: []string{"missing.proto"},
+		Service: []*descriptor.ServiceDescriptorProto{{
+			Name: proto.String("Unrelated"),
+		}},
+	}
+
+	tests := []struct {
+		name          string
+		fileNames     []string
+		opts          FileDescriptorSetOptions
+		errMsg        string
+		lookupSymbol  string
+		lookupErrMsg  string
+		skippedSymbol string
+		skippedErrMsg string
+	}{
+		{
+			name:      "missing unrelated import fails by default",
+			fileNames: []string{"../testdata/protobuf/dependencies/main.proto.bin", "../testdata/protobuf/dependencies/dep.proto.bin"},
+			errMsg:    `no descriptor found for "missing.proto"`,
+		},
+		{
+			name:          "missing unrelated import allowed",
+			fileNames:     []string{"../testdata/protobuf/dependencies/main.proto.bin", "../testdata/protobuf/dependencies/dep.proto.bin"},
+			opts:          FileDescriptorSetOptions{AllowMissingImports: true},
+			lookupSymbol:  "Bar",
+			skippedSymbol: "unrelated.Unrelated",
+			skippedErrMsg: `could not resolve gRPC service "unrelated.Unrelated" from "unrelated.proto": no descriptor found for "missing.proto"`,
+		},
+		{
+			name:          "service with missing import allowed but unresolvable",
+			fileNames:     []string{"../testdata/protobuf/dependencies/main.proto.bin"},
+			opts:          FileDescriptorSetOptions{AllowMissingImports: true},
+			skippedSymbol: "Bar",
+			skippedErrMsg: `could not resolve gRPC service "Bar" from "main.proto": no descriptor found for "dep.proto"`,
+		},
+		{
+			name: "unresolvable reference is still fatal",
+			fileNames: []string{
+				"../testdata/protobuf/dependencies/main.proto.bin",
+				"../testdata/protobuf/dependencies/other.bin",
+			},
+			opts:   FileDescriptorSetOptions{AllowMissingImports: true},
+			errMsg: `included an unresolvable reference`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			files := loadSet(t, tt.fileNames...)
+			files.File = append(files.File, unrelated)
+
+			got, err := NewDescriptorProviderFileDescriptorSetWithOptions(files, tt.opts)
+			if tt.errMsg != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.errMsg)
+				return
+			}
+			require.NoError(t, err)
+			defer got.Close()
+
+			if tt.lookupSymbol != "" {
+				s, err := got.FindService(tt.lookupSymbol)
+				require.NoError(t, err)
+				assert.Equal(t, tt.lookupSymbol, s.GetFullyQualifiedName())
+				assert.NotNil(t, s.FindMethodByName("Baz").GetInputType())
+			}
+
+			_, err = got.FindService(tt.skippedSymbol)
+			assert.EqualError(t, err, tt.skippedErrMsg)
+		})
+	}
+}
+
+func TestNewDescriptorProviderFileDescriptorSetBinsWithOptions(t *testing.T) {
+	got, err := NewDescriptorProviderFileDescriptorSetBinsWithOptions(
+		FileDescriptorSetOptions{AllowMissingImports: true},
+		"../testdata/protobuf/dependencies/main.proto.bin",
+	)
+	require.NoError(t, err)
+	defer got.Close()
+
+	_, err = got.FindService("Bar")
+	assert.EqualError(t, err, `could not resolve gRPC service "Bar" from "main.proto": no descriptor found for "dep.proto"`)
+}
@@ -0,0 +1,119 @@
+package protobuf
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/protoc-gen-go/descriptor"
+)
+
+// protosetContentTypes are the content types accepted for a FileDescriptorSet
+// fetched over HTTP.
+var protosetContentTypes = map[string]struct{}{
+	"application/octet-stream":        {},
+	"application/protobuf":            {},
+	"application/x-protobuf":          {},
+	"application/vnd.google.protobuf": {},
+}
+
+// FileDescriptorSetURLArgs are args for constructing a DescriptorProvider
+// from an encoded FileDescriptorSet served over HTTP.
+type FileDescriptorSetURLArgs struct {
+	// URL is the http or https URL of the FileDescriptorSet.
+	URL string
+
+	// AuthHeader, if set, is sent as the Authorization header.
+	AuthHeader string
+
+	// Timeout limits how long fetching the FileDescriptorSet can take.
+	// Zero means no timeout.
+	Timeout time.Duration
+
+	Options FileDescriptorSetOptions
+}
+
+// NewDescriptorProviderFileDescriptorSetURL creates a DescriptorProvider that is backed by the
+// encoded FileDescriptorSet fetched from args.URL, which may be gzip-compressed.
+func NewDescriptorProviderFileDescriptorSetURL(args FileDescriptorSetURLArgs) (DescriptorProvider, error) {
+	b, err := fetchProtoset(args)
+	if err != nil {
+		return nil, err
+	}
+	if b, err = gunzipIfCompressed(b); err != nil {
+		return nil, fmt.Errorf("could not decompress protoset from %q: %v", args.URL, err)
+	}
+
+	var files descriptor.FileDescriptorSet
+	if err := proto.Unmarshal(b, &files); err != nil {
+		return nil, fmt.Errorf("could not parse contents of protoset from %q: %v", args.URL, err)
+	}
+	source, err := NewDescriptorProviderFileDescriptorSetWithOptions(&files, args.Options)
+	if err != nil {
+		return nil, err
+	}
+	return &urlSource{DescriptorProvider: source}, nil
+}
+
+func fetchProtoset(args FileDescriptorSetURLArgs) ([]byte, error) {
+	u, err := url.Parse(args.URL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid protoset URL %q: %v", args.URL, err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("protoset URL %q must use http or https", args.URL)
+	}
+
+	req, err := http.NewRequest("GET", args.URL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("invalid protoset URL %q: %v", args.URL, err)
+	}
+	if args.AuthHeader != "" {
+		req.Header.Set("Authorization", args.AuthHeader)
+	}
+
+	client := &http.Client{Timeout: args.Timeout}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("could not fetch protoset from %q: %v", args.URL, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("could not fetch protoset from %q: unexpected status %v", args.URL, resp.Status)
+	}
+	if ct := resp.Header.Get("Content-Type"); ct != "" {
+		mediaType, _, err := mime.ParseMediaType(ct)
+		if _, ok := protosetContentTypes[mediaType]; err != nil || !ok {
+			return nil, fmt.Errorf("could not fetch protoset from %q: unexpected content type %q", args.URL, ct)
+		}
+	}
+
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("could not read protoset from %q: %v", args.URL, err)
+	}
+	return b, nil
+}
+
+// urlSource is a DescriptorProvider for a FileDescriptorSet fetched over
+// HTTP. It forwards the optional interfaces of the file source it wraps.
+type urlSource struct {
+	DescriptorProvider
+}
+
+// Export forwards to the file source, which always supports exporting.
+func (s *urlSource) Export(w io.Writer) error {
+	return s.DescriptorProvider.(DescriptorExporter).Export(w)
+}
+
+// Warnings forwards to the file source, which reports skipped files and
+// unrecognized options.
+func (s *urlSource) Warnings() []string {
+	return s.DescriptorProvider.(WarningReporter).Warnings()
+}
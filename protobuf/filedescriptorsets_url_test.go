@@ -0,0 +1,150 @@
+package protobuf
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewDescriptorProviderFileDescriptorSetURL(t *testing.T) {
+	protoset, err := ioutil.ReadFile("../testdata/protobuf/simple/simple.proto.bin")
+	require.NoError(t, err)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/protoset", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.Write(protoset)
+	})
+	mux.HandleFunc("/auth", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Header().Set("Content-Type", "application/x-protobuf")
+		w.Write(protoset)
+	})
+	mux.HandleFunc("/html", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write([]byte("<html>login</html>"))
+	})
+	var gzipped bytes.Buffer
+	gz := gzip.NewWriter(&gzipped)
+	_, err = gz.Write(protoset)
+	require.NoError(t, err)
+	require.NoError(t, gz.Close())
+	mux.HandleFunc("/gzipped", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.Write(gzipped.Bytes())
+	})
+	mux.HandleFunc("/corrupt-gzip", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.Write(append(append([]byte(nil), gzipMagic...), "not gzip"...))
+	})
+	mux.HandleFunc("/garbage", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.Write([]byte("not a protoset"))
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	tests := []struct {
+		name       string
+		url        string
+		authHeader string
+		errMsg     string
+	}{
+		{
+			name: "pass",
+			url:  server.URL + "/protoset",
+		},
+		{
+			name:       "pass with auth header",
+			url:        server.URL + "/auth",
+			authHeader: "Bearer token",
+		},
+		{
+			name:   "fail missing auth header",
+			url:    server.URL + "/auth",
+			errMsg: "unexpected status 401 Unauthorized",
+		},
+		{
+			name:   "fail not found",
+			url:    server.URL + "/missing",
+			errMsg: "unexpected status 404 Not Found",
+		},
+		{
+			name:   "fail content type",
+			url:    server.URL + "/html",
+			errMsg: `unexpected content type "text/html; charset=utf-8"`,
+		},
+		{
+			name: "pass gzipped",
+			url:  server.URL + "/gzipped",
+		},
+		{
+			name:   "fail corrupt gzip",
+			url:    server.URL + "/corrupt-gzip",
+			errMsg: "could not decompress protoset from",
+		},
+		{
+			name:   "fail is not protoset",
+			url:    server.URL + "/garbage",
+			errMsg: "could not parse contents of protoset from",
+		},
+		{
+			name:   "fail unsupported scheme",
+			url:    "file:///etc/passwd",
+			errMsg: "must use http or https",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := NewDescriptorProviderFileDescriptorSetURL(FileDescriptorSetURLArgs{
+				URL:        tt.url,
+				AuthHeader: tt.authHeader,
+			})
+			if tt.errMsg != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.errMsg)
+				return
+			}
+			require.NoError(t, err)
+
+			s, err := got.FindService("Bar")
+			require.NoError(t, err)
+			assert.Equal(t, "Bar", s.GetFullyQualifiedName())
+
+			_, err = reimport(t, got).FindService("Bar")
+			assert.NoError(t, err, "exported descriptors should include Bar")
+			got.Close()
+		})
+	}
+}
+
+func TestDescriptorProviderFileDescriptorSetURLWarnings(t *testing.T) {
+	protoset, err := proto.Marshal(warningsTestSet(t))
+	require.NoError(t, err)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(protoset)
+	}))
+	defer server.Close()
+
+	source, err := NewDescriptorProviderFileDescriptorSetURL(FileDescriptorSetURLArgs{
+		URL:     server.URL,
+		Options: FileDescriptorSetOptions{Lenient: true},
+	})
+	require.NoError(t, err)
+	defer source.Close()
+
+	require.Implements(t, (*WarningReporter)(nil), source)
+	warnings := source.(WarningReporter).Warnings()
+	require.Len(t, warnings, 3)
+	assert.Contains(t, warnings[0], "skipped broken.proto: ")
+}
@@ -0,0 +1,74 @@
+package protobuf
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/jhump/protoreflect/desc"
+	"github.com/jhump/protoreflect/desc/protoparse"
+)
+
+// ProtoFilesArgs are args for constructing a DescriptorProvider that compiles .proto source files.
+type ProtoFilesArgs struct {
+	// Dir is the directory that is searched recursively for .proto files to compile.
+	Dir string
+
+	// ImportPaths are additional directories used to resolve imports.
+	// Dir is always used to resolve imports.
+	ImportPaths []string
+}
+
+// NewDescriptorProviderProtoFiles returns a DescriptorProvider backed by the
+// .proto files in a directory, which are compiled when the provider is created.
+func NewDescriptorProviderProtoFiles(args ProtoFilesArgs) (DescriptorProvider, error) {
+	var fileNames []string
+	err := filepath.Walk(args.Dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() || filepath.Ext(path) != ".proto" {
+			return nil
+		}
+		rel, err := filepath.Rel(args.Dir, path)
+		if err != nil {
+			return err
+		}
+		fileNames = append(fileNames, filepath.ToSlash(rel))
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("could not find proto files in %q: %v", args.Dir, err)
+	}
+	if len(fileNames) == 0 {
+		return nil, fmt.Errorf("no proto files found in %q", args.Dir)
+	}
+	sort.Strings(fileNames)
+
+	parser := protoparse.Parser{
+		ImportPaths: append([]string{args.Dir}, args.ImportPaths...),
+	}
+	fds, err := parser.ParseFiles(fileNames...)
+	if err != nil {
+		// Errors from the parser include the file and line that failed.
+		return nil, fmt.Errorf("could not compile proto files in %q: %v", args.Dir, err)
+	}
+
+	files := make(map[string]*desc.FileDescriptor)
+	for _, fd := range fds {
+		addFileDescriptor(files, fd)
+	}
+	return &fileSource{files: files}, nil
+}
+
+// addFileDescriptor adds fd and all of its dependencies to files.
+func addFileDescriptor(files map[string]*desc.FileDescriptor, fd *desc.FileDescriptor) {
+	if _, ok := files[fd.GetName()]; ok {
+		return
+	}
+	files[fd.GetName()] = fd
+	for _, dep := range fd.GetDependencies() {
+		addFileDescriptor(files, dep)
+	}
+}
@@ -0,0 +1,86 @@
+package protobuf
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewDescriptorProviderProtoFiles(t *testing.T) {
+	badDir, err := ioutil.TempDir("", "protofiles")
+	require.NoError(t, err)
+	defer os.RemoveAll(badDir)
+	require.NoError(t, ioutil.WriteFile(filepath.Join(badDir, "bad.proto"), []byte("syntax = \"proto3\";\n\nmessage Foo {\n  int32 test = ;\n}\n"), 0644))
+
+	emptyDir, err := ioutil.TempDir("", "protofiles")
+	require.NoError(t, err)
+	defer os.RemoveAll(emptyDir)
+
+	tests := []struct {
+		name         string
+		args         ProtoFilesArgs
+		errMsg       string
+		lookupSymbol string
+	}{
+		{
+			name:         "pass",
+			args:         ProtoFilesArgs{Dir: "../testdata/protobuf/simple"},
+			lookupSymbol: "Bar",
+		},
+		{
+			name: "pass with import path",
+			args: ProtoFilesArgs{
+				Dir:         "../testdata/protobuf/multiroot/root",
+				ImportPaths: []string{"../testdata/protobuf/multiroot/other"},
+			},
+			lookupSymbol: "Bar",
+		},
+		{
+			name:   "fail missing import path",
+			args:   ProtoFilesArgs{Dir: "../testdata/protobuf/multiroot/root"},
+			errMsg: `dep.proto`,
+		},
+		{
+			name:   "fail compile error with position",
+			args:   ProtoFilesArgs{Dir: badDir},
+			errMsg: `bad.proto:4:16: syntax error`,
+		},
+		{
+			name:   "fail no proto files",
+			args:   ProtoFilesArgs{Dir: emptyDir},
+			errMsg: `no proto files found in`,
+		},
+		{
+			name:   "fail directory doesn't exist",
+			args:   ProtoFilesArgs{Dir: "../testdata/protobuf/not_existing"},
+			errMsg: `no such file or directory`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := NewDescriptorProviderProtoFiles(tt.args)
+			if tt.errMsg != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.errMsg)
+				return
+			}
+			require.NoError(t, err)
+			defer got.Close()
+
+			s, err := got.FindService(tt.lookupSymbol)
+			require.NoError(t, err)
+			assert.Equal(t, tt.lookupSymbol, s.GetFullyQualifiedName())
+
+			// Messages from imports should also be available.
+			md, err := got.FindMessage("Foo")
+			require.NoError(t, err)
+			require.NotNil(t, md)
+			assert.Equal(t, "Foo", md.GetFullyQualifiedName())
+		})
+	}
+}
@@ -0,0 +1,75 @@
+package protobuf
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+var errResolutionNoNames = errors.New("must specify names to resolve")
+
+// ResolutionStats describes how long a DescriptorProvider took to resolve
+// a set of names.
+type ResolutionStats struct {
+	Count int
+	Min   time.Duration
+	Max   time.Duration
+	Avg   time.Duration
+
+	// Slowest is the name that took the longest to resolve.
+	Slowest string
+}
+
+// MeasureResolution times how long provider takes to resolve each of
+// names, which are fully-qualified service names, or methods in the form
+// "Service/Method". This helps decide whether caching descriptors is worth
+// it for large descriptor sets. It fails if any name can't be resolved.
+//
+// Providers backed by files resolve names locally, while reflection-backed
+// providers may make a network call for names they haven't fetched yet.
+func MeasureResolution(provider DescriptorProvider, names []string) (ResolutionStats, error) {
+	if len(names) == 0 {
+		return ResolutionStats{}, errResolutionNoNames
+	}
+
+	var (
+		stats ResolutionStats
+		total time.Duration
+	)
+	for _, name := range names {
+		start := time.Now()
+		if err := resolveName(provider, name); err != nil {
+			return ResolutionStats{}, err
+		}
+		elapsed := time.Since(start)
+
+		if stats.Count == 0 || elapsed < stats.Min {
+			stats.Min = elapsed
+		}
+		if stats.Count == 0 || elapsed > stats.Max {
+			stats.Max = elapsed
+			stats.Slowest = name
+		}
+		stats.Count++
+		total += elapsed
+	}
+	stats.Avg = total / time.Duration(stats.Count)
+	return stats, nil
+}
+
+func resolveName(provider DescriptorProvider, name string) error {
+	serviceName, methodName := name, ""
+	if i := strings.LastIndex(name, "/"); i >= 0 {
+		serviceName, methodName = name[:i], name[i+1:]
+	}
+
+	svc, err := provider.FindService(serviceName)
+	if err != nil {
+		return err
+	}
+	if methodName != "" && svc.FindMethodByName(methodName) == nil {
+		return fmt.Errorf("could not find method %q in service %q", methodName, serviceName)
+	}
+	return nil
+}
@@ -0,0 +1,59 @@
+package protobuf
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMeasureResolution(t *testing.T) {
+	source, err := NewDescriptorProviderFileDescriptorSetBins(
+		"../testdata/protobuf/simple/simple.proto.bin",
+		"../testdata/protobuf/options/options.proto.bin",
+	)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name    string
+		names   []string
+		wantErr string
+	}{
+		{
+			name:  "services and methods",
+			names: []string{"Bar", "Bar/Baz", "options.Bar", "Bar/ServerStream"},
+		},
+		{
+			name:    "no names",
+			wantErr: errResolutionNoNames.Error(),
+		},
+		{
+			name:    "unknown service",
+			names:   []string{"Bar", "Unknown"},
+			wantErr: `could not find gRPC service "Unknown"`,
+		},
+		{
+			name:    "unknown method",
+			names:   []string{"Bar/Qux"},
+			wantErr: `could not find method "Qux" in service "Bar"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stats, err := MeasureResolution(source, tt.names)
+			if tt.wantErr != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+
+			assert.Equal(t, len(tt.names), stats.Count)
+			assert.Positive(t, stats.Max)
+			assert.True(t, stats.Min <= stats.Avg && stats.Avg <= stats.Max,
+				"expected min %v <= avg %v <= max %v", stats.Min, stats.Avg, stats.Max)
+			assert.Contains(t, tt.names, stats.Slowest)
+		})
+	}
+}
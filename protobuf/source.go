@@ -1,6 +1,8 @@
 package protobuf
 
 import (
+	"context"
+
 	"github.com/jhump/protoreflect/desc"
 )
 
@@ -15,3 +17,38 @@ type DescriptorProvider interface {
 
 	Close()
 }
+
+// ContextDescriptorProvider is implemented by DescriptorProviders whose
+// lookups make requests, such as to a reflection server, so they can be
+// bounded by a context.
+type ContextDescriptorProvider interface {
+	// FindServiceCtx is FindService, but gives up when ctx is done.
+	FindServiceCtx(ctx context.Context, fullyQualifiedName string) (*desc.ServiceDescriptor, error)
+
+	// FindMessageCtx is FindMessage, but gives up when ctx is done.
+	FindMessageCtx(ctx context.Context, messageType string) (*desc.MessageDescriptor, error)
+}
+
+// FindServiceCtx looks up a service using provider's FindServiceCtx if it's a
+// ContextDescriptorProvider, and FindService otherwise.
+func FindServiceCtx(ctx context.Context, provider DescriptorProvider, fullyQualifiedName string) (*desc.ServiceDescriptor, error) {
+	if p, ok := provider.(ContextDescriptorProvider); ok {
+		return p.FindServiceCtx(ctx, fullyQualifiedName)
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return provider.FindService(fullyQualifiedName)
+}
+
+// FindMessageCtx looks up a message using provider's FindMessageCtx if it's a
+// ContextDescriptorProvider, and FindMessage otherwise.
+func FindMessageCtx(ctx context.Context, provider DescriptorProvider, messageType string) (*desc.MessageDescriptor, error) {
+	if p, ok := provider.(ContextDescriptorProvider); ok {
+		return p.FindMessageCtx(ctx, messageType)
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return provider.FindMessage(messageType)
+}
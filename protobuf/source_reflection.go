@@ -3,8 +3,10 @@ package protobuf
 import (
 	"context"
 	"fmt"
+	"io"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/jhump/protoreflect/desc"
@@ -68,18 +70,50 @@ func NewDescriptorProviderReflection(args ReflectionArgs) (DescriptorProvider, e
 	ctx, cancel := context.WithTimeout(context.Background(), args.Timeout)
 	metadataContext := metadata.NewOutgoingContext(ctx, routingHeaders)
 	return &grpcreflectSource{
+		ctx:        metadataContext,
+		stub:       pbClient,
 		client:     grpcreflect.NewClient(metadataContext, pbClient),
 		cancelFunc: cancel,
 	}, nil
 }
 
 type grpcreflectSource struct {
+	// ctx holds the routing headers, and is the parent of every stream.
+	ctx        context.Context
+	stub       rpb.ServerReflectionClient
 	client     *grpcreflect.Client
 	cancelFunc context.CancelFunc
+
+	// fetched holds the files of the services and messages that have been
+	// resolved, which is what Export writes.
+	fetchedMu sync.Mutex
+	fetched   map[string]*desc.FileDescriptor
+}
+
+func (s *grpcreflectSource) addFetched(fd *desc.FileDescriptor) {
+	s.fetchedMu.Lock()
+	defer s.fetchedMu.Unlock()
+	if s.fetched == nil {
+		s.fetched = make(map[string]*desc.FileDescriptor)
+	}
+	s.fetched[fd.GetName()] = fd
 }
 
 func (s *grpcreflectSource) FindMessage(messageType string) (*desc.MessageDescriptor, error) {
-	msg, err := s.client.ResolveMessage(messageType)
+	return s.findMessage(s.client, messageType)
+}
+
+func (s *grpcreflectSource) FindMessageCtx(ctx context.Context, messageType string) (*desc.MessageDescriptor, error) {
+	var msg *desc.MessageDescriptor
+	err := s.runWithContext(ctx, func(client *grpcreflect.Client) (err error) {
+		msg, err = s.findMessage(client, messageType)
+		return err
+	})
+	return msg, err
+}
+
+func (s *grpcreflectSource) findMessage(client *grpcreflect.Client, messageType string) (*desc.MessageDescriptor, error) {
+	msg, err := client.ResolveMessage(messageType)
 
 	if grpcreflect.IsElementNotFoundError(err) {
 		// If we couldn't find the message through the client,
@@ -91,17 +125,31 @@ func (s *grpcreflectSource) FindMessage(messageType string) (*desc.MessageDescri
 		return nil, wrapReflectionError(err)
 	}
 
+	s.addFetched(msg.GetFile())
 	return msg, err
 }
 
 func (s *grpcreflectSource) FindService(fullyQualifiedName string) (*desc.ServiceDescriptor, error) {
-	service, err := s.client.ResolveService(fullyQualifiedName)
+	return s.findService(s.client, fullyQualifiedName)
+}
+
+func (s *grpcreflectSource) FindServiceCtx(ctx context.Context, fullyQualifiedName string) (*desc.ServiceDescriptor, error) {
+	var service *desc.ServiceDescriptor
+	err := s.runWithContext(ctx, func(client *grpcreflect.Client) (err error) {
+		service, err = s.findService(client, fullyQualifiedName)
+		return err
+	})
+	return service, err
+}
+
+func (s *grpcreflectSource) findService(client *grpcreflect.Client, fullyQualifiedName string) (*desc.ServiceDescriptor, error) {
+	service, err := client.ResolveService(fullyQualifiedName)
 	if err != nil {
 		if !grpcreflect.IsElementNotFoundError(err) {
 			return nil, wrapReflectionError(err)
 		}
 
-		available, availableErr := s.client.ListServices()
+		available, availableErr := client.ListServices()
 		if availableErr != nil && !grpcreflect.IsElementNotFoundError(availableErr) {
 			return nil, wrapReflectionError(availableErr)
 		}
@@ -115,16 +163,54 @@ func (s *grpcreflectSource) FindService(fullyQualifiedName string) (*desc.Servic
 		}
 	}
 
+	s.addFetched(service.GetFile())
 	return service, nil
 }
 
+// Export writes the files of the services and messages that have been
+// looked up so far, along with their dependencies.
+func (s *grpcreflectSource) Export(w io.Writer) error {
+	s.fetchedMu.Lock()
+	files := make([]*desc.FileDescriptor, 0, len(s.fetched))
+	for _, fd := range s.fetched {
+		files = append(files, fd)
+	}
+	s.fetchedMu.Unlock()
+	return writeFileDescriptorSet(w, files)
+}
+
 func (s *grpcreflectSource) Close() {
 	s.cancelFunc()
 	s.client.Reset()
 }
 
+// runWithContext runs f with a reflection client whose stream is cancelled
+// when ctx is done, returning ctx's error if that's before f returns. The
+// client is only used by f, as the cancelled stream can't be reused.
+func (s *grpcreflectSource) runWithContext(ctx context.Context, f func(*grpcreflect.Client) error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	streamCtx, cancel := context.WithCancel(s.ctx)
+	defer cancel()
+	client := grpcreflect.NewClient(streamCtx, s.stub)
+
+	done := make(chan error, 1)
+	go func() {
+		defer client.Reset()
+		done <- f(client)
+	}()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
 func wrapReflectionError(err error) error {
-	return fmt.Errorf("error in protobuf reflection: %v", err)
+	return fmt.Errorf("error in protobuf reflection: %w", err)
 }
 
 func GenerateAndRegisterManualResolver() (*manual.Resolver, func()) {
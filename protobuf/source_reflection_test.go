@@ -1,6 +1,7 @@
 package protobuf
 
 import (
+	"context"
 	"errors"
 	"net"
 	"testing"
@@ -248,3 +249,65 @@ func (s *dummyReflectionServer) ServerReflectionInfo(r rpb.ServerReflection_Serv
 	}
 	return assert.AnError
 }
+
+// blockingReflectionServer receives requests, but never responds to them.
+// Streams that are cancelled by the client are sent to cancelled.
+type blockingReflectionServer struct {
+	unblock   chan struct{}
+	cancelled chan struct{}
+}
+
+func (s *blockingReflectionServer) ServerReflectionInfo(r rpb.ServerReflection_ServerReflectionInfoServer) error {
+	select {
+	case <-s.unblock:
+	case <-r.Context().Done():
+		s.cancelled <- struct{}{}
+	}
+	return r.Context().Err()
+}
+
+func TestReflectionContext(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer ln.Close()
+
+	s := grpc.NewServer()
+	server := &blockingReflectionServer{unblock: make(chan struct{}), cancelled: make(chan struct{}, 2)}
+	rpb.RegisterServerReflectionServer(s, server)
+	go s.Serve(ln)
+	defer s.Stop()
+
+	source, err := NewDescriptorProviderReflection(ReflectionArgs{
+		Timeout: 5 * time.Second,
+		Peers:   []string{ln.Addr().String()},
+	})
+	require.NoError(t, err)
+	defer source.Close()
+	defer close(server.unblock)
+
+	t.Run("cancelled", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		_, err := FindServiceCtx(ctx, source, "test.Service")
+		assert.True(t, errors.Is(err, context.Canceled), "unexpected error: %v", err)
+	})
+
+	t.Run("cancelled during lookup", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+
+		start := time.Now()
+		_, err := FindServiceCtx(ctx, source, "test.Service")
+		assert.True(t, errors.Is(err, context.DeadlineExceeded), "unexpected error: %v", err)
+		assert.True(t, time.Since(start) < time.Second, "lookup should stop when the context is done")
+
+		select {
+		case <-server.cancelled:
+		case <-time.After(time.Second):
+			t.Fatal("reflection stream was not cancelled with the lookup")
+		}
+
+		_, err = source.(ContextDescriptorProvider).FindMessageCtx(ctx, "test.Message")
+		assert.True(t, errors.Is(err, context.DeadlineExceeded), "unexpected error: %v", err)
+	})
+}
@@ -0,0 +1,146 @@
+package protobuf
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/jhump/protoreflect/desc"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// WarningReporter is implemented by DescriptorProviders that can report
+// issues with their descriptors that didn't stop them from being loaded.
+type WarningReporter interface {
+	// Warnings returns a description of each issue, in a stable order.
+	Warnings() []string
+}
+
+// extensionKey identifies an extension by the message it extends and its
+// field number.
+type extensionKey struct {
+	extendee string
+	number   int32
+}
+
+// descriptorWarnings returns warnings for custom options in files that
+// aren't defined by any of the files, and for deprecated services and
+// methods.
+func descriptorWarnings(files map[string]*desc.FileDescriptor) []string {
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	extensions := make(map[extensionKey]struct{})
+	for _, name := range names {
+		addExtensions(extensions, files[name].GetExtensions())
+		for _, md := range files[name].GetMessageTypes() {
+			addMessageExtensions(extensions, md)
+		}
+	}
+
+	var warnings []string
+	check := func(d desc.Descriptor) {
+		for _, number := range unrecognizedOptions(d.GetOptions(), extensions) {
+			warnings = append(warnings, fmt.Sprintf("%v: %v has unrecognized option %v",
+				d.GetFile().GetName(), d.GetFullyQualifiedName(), number))
+		}
+	}
+	for _, name := range names {
+		fd := files[name]
+		check(fd)
+		for _, md := range fd.GetMessageTypes() {
+			checkMessage(md, check)
+		}
+		for _, ed := range fd.GetEnumTypes() {
+			checkEnum(ed, check)
+		}
+		for _, ext := range fd.GetExtensions() {
+			check(ext)
+		}
+		for _, svc := range fd.GetServices() {
+			check(svc)
+			if svc.GetServiceOptions().GetDeprecated() {
+				warnings = append(warnings, fmt.Sprintf("%v: service %v is deprecated", fd.GetName(), svc.GetFullyQualifiedName()))
+			}
+			for _, method := range svc.GetMethods() {
+				check(method)
+				if method.GetMethodOptions().GetDeprecated() {
+					warnings = append(warnings, fmt.Sprintf("%v: method %v is deprecated", fd.GetName(), method.GetFullyQualifiedName()))
+				}
+			}
+		}
+	}
+	return warnings
+}
+
+func addExtensions(extensions map[extensionKey]struct{}, fields []*desc.FieldDescriptor) {
+	for _, ext := range fields {
+		extensions[extensionKey{ext.GetOwner().GetFullyQualifiedName(), ext.GetNumber()}] = struct{}{}
+	}
+}
+
+func addMessageExtensions(extensions map[extensionKey]struct{}, md *desc.MessageDescriptor) {
+	addExtensions(extensions, md.GetNestedExtensions())
+	for _, nested := range md.GetNestedMessageTypes() {
+		addMessageExtensions(extensions, nested)
+	}
+}
+
+func checkMessage(md *desc.MessageDescriptor, check func(desc.Descriptor)) {
+	check(md)
+	for _, field := range md.GetFields() {
+		check(field)
+	}
+	for _, oneOf := range md.GetOneOfs() {
+		check(oneOf)
+	}
+	for _, ext := range md.GetNestedExtensions() {
+		check(ext)
+	}
+	for _, nested := range md.GetNestedMessageTypes() {
+		checkMessage(nested, check)
+	}
+	for _, ed := range md.GetNestedEnumTypes() {
+		checkEnum(ed, check)
+	}
+}
+
+func checkEnum(ed *desc.EnumDescriptor, check func(desc.Descriptor)) {
+	check(ed)
+	for _, value := range ed.GetValues() {
+		check(value)
+	}
+}
+
+// unrecognizedOptions returns the field numbers of the options set in opts
+// that are neither known to the options message, nor an extension in
+// extensions.
+func unrecognizedOptions(opts proto.Message, extensions map[extensionKey]struct{}) []protowire.Number {
+	if opts == nil || reflect.ValueOf(opts).IsNil() {
+		return nil
+	}
+
+	msg := proto.MessageReflect(opts)
+	extendee := string(msg.Descriptor().FullName())
+	var numbers []protowire.Number
+	unknown := msg.GetUnknown()
+	for len(unknown) > 0 {
+		number, _, n := protowire.ConsumeField(unknown)
+		if n < 0 {
+			break
+		}
+		unknown = unknown[n:]
+		if _, ok := extensions[extensionKey{extendee, int32(number)}]; ok {
+			continue
+		}
+		// Repeated options are only reported once.
+		if len(numbers) == 0 || numbers[len(numbers)-1] != number {
+			numbers = append(numbers, number)
+		}
+	}
+	return numbers
+}
@@ -0,0 +1,109 @@
+package protobuf
+
+import (
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/protoc-gen-go/descriptor"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// methodOptionsWithUnknown returns MethodOptions holding an option with the
+// given field number that isn't defined anywhere.
+func methodOptionsWithUnknown(t *testing.T, deprecated bool, number protowire.Number) *descriptor.MethodOptions {
+	b, err := proto.Marshal(&descriptor.MethodOptions{Deprecated: proto.Bool(deprecated)})
+	require.NoError(t, err)
+	b = protowire.AppendTag(b, number, protowire.VarintType)
+	b = protowire.AppendVarint(b, 1)
+
+	opts := &descriptor.MethodOptions{}
+	require.NoError(t, proto.Unmarshal(b, opts))
+	return opts
+}
+
+func warningsTestSet(t *testing.T) *descriptor.FileDescriptorSet {
+	method := func(name, input string, opts *descriptor.MethodOptions) *descriptor.MethodDescriptorProto {
+		return &descriptor.MethodDescriptorProto{
+			Name:       proto.String(name),
+			InputType:  proto.String(input),
+			OutputType: proto.String(input),
+			Options:    opts,
+		}
+	}
+	return &descriptor.FileDescriptorSet{
+		File: []*descriptor.FileDescriptorProto{
+			{
+				Name:        proto.String("valid.proto"),
+				Package:     proto.String("valid"),
+				Syntax:      proto.String("proto3"),
+				MessageType: []*descriptor.DescriptorProto{{Name: proto.String("Msg")}},
+				Service: []*descriptor.ServiceDescriptorProto{{
+					Name: proto.String("Svc"),
+					Method: []*descriptor.MethodDescriptorProto{
+						method("Custom", ".valid.Msg", methodOptionsWithUnknown(t, false, 50001)),
+						method("Old", ".valid.Msg", &descriptor.MethodOptions{Deprecated: proto.Bool(true)}),
+						method("Plain", ".valid.Msg", nil),
+					},
+				}},
+			},
+			{
+				Name:    proto.String("broken.proto"),
+				Package: proto.String("broken"),
+				Syntax:  proto.String("proto3"),
+				Service: []*descriptor.ServiceDescriptorProto{{
+					Name:   proto.String("Svc"),
+					Method: []*descriptor.MethodDescriptorProto{method("Get", ".broken.Missing", nil)},
+				}},
+			},
+		},
+	}
+}
+
+func TestDescriptorWarnings(t *testing.T) {
+	t.Run("not lenient", func(t *testing.T) {
+		_, err := NewDescriptorProviderFileDescriptorSet(warningsTestSet(t))
+		assert.Error(t, err)
+	})
+
+	t.Run("lenient", func(t *testing.T) {
+		source, err := NewDescriptorProviderFileDescriptorSetWithOptions(warningsTestSet(t), FileDescriptorSetOptions{
+			Lenient: true,
+		})
+		require.NoError(t, err)
+
+		svc, err := source.FindService("valid.Svc")
+		require.NoError(t, err)
+		assert.NotNil(t, svc.FindMethodByName("Custom"), "the service with an unrecognized option should be usable")
+		_, err = source.FindService("broken.Svc")
+		assert.Error(t, err, "services in skipped files should fail")
+
+		require.Implements(t, (*WarningReporter)(nil), source)
+		warnings := source.(WarningReporter).Warnings()
+		require.Len(t, warnings, 3)
+		assert.Contains(t, warnings[0], "skipped broken.proto: ")
+		assert.Equal(t, []string{
+			"valid.proto: valid.Svc.Custom has unrecognized option 50001",
+			"valid.proto: method valid.Svc.Old is deprecated",
+		}, warnings[1:])
+	})
+
+	t.Run("defined custom options", func(t *testing.T) {
+		source, err := NewDescriptorProviderFileDescriptorSetBins("../testdata/protobuf/options/options.proto.bin")
+		require.NoError(t, err)
+		assert.Empty(t, source.(WarningReporter).Warnings())
+	})
+
+	t.Run("composite", func(t *testing.T) {
+		lenient, err := NewDescriptorProviderFileDescriptorSetWithOptions(warningsTestSet(t), FileDescriptorSetOptions{
+			Lenient: true,
+		})
+		require.NoError(t, err)
+		simple, err := NewDescriptorProviderFileDescriptorSetBins("../testdata/protobuf/simple/simple.proto.bin")
+		require.NoError(t, err)
+
+		composite := NewDescriptorProviderComposite(simple, lenient)
+		assert.Equal(t, lenient.(WarningReporter).Warnings(), composite.(WarningReporter).Warnings())
+	})
+}
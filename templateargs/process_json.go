@@ -0,0 +1,55 @@
+package templateargs
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"gopkg.in/yaml.v2"
+)
+
+var errInvalidJSONTemplate = errors.New("request template is not valid JSON")
+
+// ProcessJSON takes a JSON request whose string values may contain values
+// like ${name:prashant} and returns the JSON with template arguments replaced
+// by those specified in args. As with ProcessMap, a string that consists only
+// of a template argument takes the type of its value, so "${count}" with a
+// count of 10 becomes the number 10, and quoting the value keeps it a string.
+func ProcessJSON(template []byte, args map[string]string) ([]byte, error) {
+	if !json.Valid(template) {
+		return nil, errInvalidJSONTemplate
+	}
+
+	// JSON is valid YAML, which lets us reuse the YAML processing.
+	var req interface{}
+	if err := yaml.Unmarshal(template, &req); err != nil {
+		return nil, err
+	}
+
+	processed, err := processValue(req, args)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(toJSONValue(processed))
+}
+
+// toJSONValue converts the maps produced by YAML unmarshalling into maps
+// that can be marshalled as JSON.
+func toJSONValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for k, val := range v {
+			m[fmt.Sprint(k)] = toJSONValue(val)
+		}
+		return m
+	case []interface{}:
+		l := make([]interface{}, len(v))
+		for i, val := range v {
+			l[i] = toJSONValue(val)
+		}
+		return l
+	default:
+		return v
+	}
+}
@@ -0,0 +1,84 @@
+package templateargs
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProcessJSON(t *testing.T) {
+	args := Args{
+		"user":   "prashant",
+		"id":     "42",
+		"quoted": `"42"`,
+		"quote":  `say "hi"`,
+		"ids":    "[1, 2]",
+		"nested": "{a: 1}",
+	}
+	tests := []struct {
+		msg      string
+		template string
+		want     string
+		wantErr  string
+	}{
+		{
+			msg:      "string",
+			template: `{"user": "${user}"}`,
+			want:     `{"user":"prashant"}`,
+		},
+		{
+			msg:      "string with quotes is escaped",
+			template: `{"msg": "${quote}"}`,
+			want:     `{"msg":"say \"hi\""}`,
+		},
+		{
+			msg:      "numeric",
+			template: `{"id": "${id}", "limit": 10}`,
+			want:     `{"id":42,"limit":10}`,
+		},
+		{
+			msg:      "quoted numeric stays a string",
+			template: `{"id": "${quoted}"}`,
+			want:     `{"id":"42"}`,
+		},
+		{
+			msg:      "partial substitution is a string",
+			template: `{"key": "user-${id}"}`,
+			want:     `{"key":"user-42"}`,
+		},
+		{
+			msg:      "default value",
+			template: `{"user": "${missing:moe}"}`,
+			want:     `{"user":"moe"}`,
+		},
+		{
+			msg:      "lists and maps",
+			template: `{"ids": "${ids}", "nested": ["${nested}"]}`,
+			want:     `{"ids":[1,2],"nested":[{"a":1}]}`,
+		},
+		{
+			msg:      "missing variable",
+			template: `{"user": "${missing}"}`,
+			wantErr:  `unknown variable "missing" does not have a value or a default`,
+		},
+		{
+			msg:      "invalid JSON",
+			template: `{"user": ${user}}`,
+			wantErr:  "request template is not valid JSON",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.msg, func(t *testing.T) {
+			got, err := ProcessJSON([]byte(tt.template), args)
+			if tt.wantErr != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.JSONEq(t, tt.want, string(got))
+		})
+	}
+}
@@ -48,3 +48,10 @@ THIS_DIR="$(cd -P -- "$(dirname -- "$0")" && pwd -P)"
     --include_imports \
     --descriptor_set_out=any.proto.bin \
     any.proto)
+
+## options
+# as expected
+(cd "$THIS_DIR/options" && protoc \
+    --include_imports \
+    --descriptor_set_out=options.proto.bin \
+    options.proto)
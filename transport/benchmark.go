@@ -0,0 +1,180 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package transport
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"go.uber.org/atomic"
+	"go.uber.org/yarpc/yarpcerrors"
+)
+
+var (
+	errBenchmarkNoTransport = errors.New("must specify a transport to benchmark")
+	errBenchmarkNoRequest   = errors.New("must specify a request to benchmark with")
+	errBenchmarkNoLimit     = errors.New("must specify a positive Duration or Count for the benchmark")
+)
+
+// BenchmarkSpec configures a benchmark run by RunBenchmark.
+type BenchmarkSpec struct {
+	// Transport is used to make the calls.
+	Transport Transport
+
+	// Request is sent repeatedly for the benchmark.
+	Request *Request
+
+	// Concurrency is the number of calls in flight. Defaults to 1.
+	Concurrency int
+
+	// Duration limits how long new calls are started for, and Count limits
+	// the total number of calls. At least one must be set, and the run ends
+	// when either is reached.
+	Duration time.Duration
+	Count    int
+}
+
+// BenchmarkResult summarizes the calls made by a benchmark.
+type BenchmarkResult struct {
+	Requests  int64
+	Successes int64
+	Failures  int64
+
+	// Codes counts the calls by their status code, with successful calls
+	// counted as yarpcerrors.CodeOK.
+	Codes map[yarpcerrors.Code]int64
+
+	// Latency holds percentiles of the latency of all calls.
+	Latency LatencyPercentiles
+
+	// Elapsed is how long the benchmark ran for, and RequestsPerSecond the
+	// rate at which calls completed.
+	Elapsed           time.Duration
+	RequestsPerSecond float64
+
+	// RequestBytes and ResponseBytes are the total sizes of the request and
+	// response bodies of the calls.
+	RequestBytes  int64
+	ResponseBytes int64
+}
+
+// LatencyPercentiles are the latencies below which a percentage of calls
+// completed. They are read from an HDR histogram, so are accurate to 3
+// significant figures.
+type LatencyPercentiles struct {
+	P50  time.Duration
+	P90  time.Duration
+	P99  time.Duration
+	P999 time.Duration
+	Max  time.Duration
+}
+
+// RunBenchmark sends spec.Request using spec.Transport from spec.Concurrency
+// goroutines until spec.Duration has passed or spec.Count calls have been
+// made, and returns a summary of the calls. If ctx is done first, no more
+// calls are started and the summary of the calls made so far is returned
+// along with ctx's error.
+func RunBenchmark(ctx context.Context, spec BenchmarkSpec) (*BenchmarkResult, error) {
+	if spec.Transport == nil {
+		return nil, errBenchmarkNoTransport
+	}
+	if spec.Request == nil {
+		return nil, errBenchmarkNoRequest
+	}
+	if spec.Duration <= 0 && spec.Count <= 0 {
+		return nil, errBenchmarkNoLimit
+	}
+	concurrency := spec.Concurrency
+	if concurrency <= 0 {
+		concurrency = 1
+	}
+
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		started  atomic.Int64
+		deadline time.Time
+
+		latencies = newHDRHistogram()
+		result    = &BenchmarkResult{Codes: make(map[yarpcerrors.Code]int64)}
+	)
+	start := time.Now()
+	if spec.Duration > 0 {
+		deadline = start.Add(spec.Duration)
+	}
+	next := func() bool {
+		if ctx.Err() != nil || (!deadline.IsZero() && !time.Now().Before(deadline)) {
+			return false
+		}
+		return spec.Count <= 0 || started.Inc() <= int64(spec.Count)
+	}
+
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for next() {
+				callStart := time.Now()
+				res, err := spec.Transport.Call(ctx, spec.Request)
+				latency := time.Since(callStart)
+
+				code := yarpcerrors.CodeOK
+				if err != nil {
+					code = yarpcerrors.FromError(err).Code()
+				}
+				var responseBytes int
+				if res != nil {
+					responseBytes = len(res.Body)
+					res.Release()
+				}
+
+				mu.Lock()
+				recordHDRLatency(latencies, latency)
+				result.Requests++
+				result.Codes[code]++
+				if err == nil {
+					result.Successes++
+				} else {
+					result.Failures++
+				}
+				result.RequestBytes += int64(len(spec.Request.Body))
+				result.ResponseBytes += int64(responseBytes)
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	result.Elapsed = time.Since(start)
+	if result.Elapsed > 0 {
+		result.RequestsPerSecond = float64(result.Requests) / result.Elapsed.Seconds()
+	}
+	result.Latency = LatencyPercentiles{
+		P50:  time.Duration(latencies.ValueAtQuantile(50)),
+		P90:  time.Duration(latencies.ValueAtQuantile(90)),
+		P99:  time.Duration(latencies.ValueAtQuantile(99)),
+		P999: time.Duration(latencies.ValueAtQuantile(99.9)),
+		Max:  time.Duration(latencies.Max()),
+	}
+	return result, ctx.Err()
+}
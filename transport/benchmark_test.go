@@ -0,0 +1,155 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package transport
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/yarpc/yab/testdata/protobuf/simple"
+	"go.uber.org/atomic"
+	"go.uber.org/yarpc/yarpcerrors"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// everyThirdFailsSvc fails every third call to Baz, and counts the calls it
+// has seen.
+type everyThirdFailsSvc struct {
+	simpleSvc
+
+	calls    atomic.Int64
+	failures atomic.Int64
+}
+
+func (s *everyThirdFailsSvc) Baz(ctx context.Context, in *simple.Foo) (*simple.Foo, error) {
+	if s.calls.Inc()%3 == 0 {
+		s.failures.Inc()
+		return nil, status.Error(codes.NotFound, "every third call fails")
+	}
+	return in, nil
+}
+
+func TestRunBenchmark(t *testing.T) {
+	request := &Request{
+		TargetService: "foo",
+		Method:        "Bar::Baz",
+		Timeout:       time.Second,
+		Body:          []byte{0x08, 0x01},
+	}
+
+	t.Run("count", func(t *testing.T) {
+		svc := &everyThirdFailsSvc{}
+		client, cleanup := newSimpleGRPCClient(t, svc, GRPCOptions{})
+		defer cleanup()
+
+		result, err := RunBenchmark(context.Background(), BenchmarkSpec{
+			Transport:   client,
+			Request:     request,
+			Concurrency: 4,
+			Count:       30,
+		})
+		require.NoError(t, err)
+
+		assert.Equal(t, int64(30), svc.calls.Load())
+		assert.Equal(t, svc.calls.Load(), result.Requests)
+		assert.Equal(t, svc.failures.Load(), result.Failures)
+		assert.Equal(t, result.Requests-result.Failures, result.Successes)
+		assert.Equal(t, map[yarpcerrors.Code]int64{
+			yarpcerrors.CodeOK:       result.Successes,
+			yarpcerrors.CodeNotFound: result.Failures,
+		}, result.Codes)
+		assert.Equal(t, int64(60), result.RequestBytes)
+		assert.Equal(t, 2*result.Successes, result.ResponseBytes)
+
+		assert.True(t, result.Latency.P50 > 0, "latencies should be recorded")
+		assert.True(t, result.Latency.P50 <= result.Latency.P99 && result.Latency.P99 <= result.Latency.Max,
+			"percentiles should be ordered: %+v", result.Latency)
+		assert.True(t, result.RequestsPerSecond > 0)
+	})
+
+	t.Run("duration", func(t *testing.T) {
+		svc := &everyThirdFailsSvc{}
+		client, cleanup := newSimpleGRPCClient(t, svc, GRPCOptions{})
+		defer cleanup()
+
+		result, err := RunBenchmark(context.Background(), BenchmarkSpec{
+			Transport:   client,
+			Request:     request,
+			Concurrency: 2,
+			Duration:    100 * time.Millisecond,
+		})
+		require.NoError(t, err)
+		assert.True(t, result.Requests > 0, "no calls were made")
+		assert.Equal(t, svc.calls.Load(), result.Requests)
+		assert.True(t, result.Elapsed >= 100*time.Millisecond, "benchmark ended after %v", result.Elapsed)
+	})
+
+	t.Run("cancelled", func(t *testing.T) {
+		client, cleanup := newSimpleGRPCClient(t, &everyThirdFailsSvc{}, GRPCOptions{})
+		defer cleanup()
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		result, err := RunBenchmark(ctx, BenchmarkSpec{
+			Transport: client,
+			Request:   request,
+			Count:     10,
+		})
+		assert.Equal(t, context.Canceled, err)
+		require.NotNil(t, result)
+		assert.Zero(t, result.Requests)
+	})
+}
+
+func TestRunBenchmarkInvalidSpec(t *testing.T) {
+	tests := []struct {
+		msg     string
+		spec    BenchmarkSpec
+		wantErr error
+	}{
+		{
+			msg:     "no transport",
+			spec:    BenchmarkSpec{Request: &Request{}, Count: 1},
+			wantErr: errBenchmarkNoTransport,
+		},
+		{
+			msg:     "no request",
+			spec:    BenchmarkSpec{Transport: &grpcTransport{}, Count: 1},
+			wantErr: errBenchmarkNoRequest,
+		},
+		{
+			msg:     "no limit",
+			spec:    BenchmarkSpec{Transport: &grpcTransport{}, Request: &Request{}},
+			wantErr: errBenchmarkNoLimit,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.msg, func(t *testing.T) {
+			_, err := RunBenchmark(context.Background(), tt.spec)
+			assert.Equal(t, tt.wantErr, err)
+		})
+	}
+}
@@ -0,0 +1,63 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package transport
+
+import (
+	"io"
+	"time"
+
+	"go.uber.org/atomic"
+	"go.uber.org/yarpc/yarpcerrors"
+)
+
+// timeoutBody fails reads of a response body once its timeout has passed,
+// by closing the body to unblock any read that's waiting for data.
+type timeoutBody struct {
+	io.ReadCloser
+
+	timeout  time.Duration
+	timer    *time.Timer
+	timedOut atomic.Bool
+}
+
+// withBodyReadTimeout bounds how long reading body can take, if the
+// transport has a BodyReadTimeout. The returned function must be called
+// once the body has been read.
+func (t *grpcTransport) withBodyReadTimeout(body io.ReadCloser) (io.ReadCloser, func()) {
+	if t.bodyReadTimeout <= 0 {
+		return body, func() {}
+	}
+
+	b := &timeoutBody{ReadCloser: body, timeout: t.bodyReadTimeout}
+	b.timer = time.AfterFunc(t.bodyReadTimeout, func() {
+		b.timedOut.Store(true)
+		body.Close()
+	})
+	return b, func() { b.timer.Stop() }
+}
+
+func (b *timeoutBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if err != nil && b.timedOut.Load() {
+		err = yarpcerrors.DeadlineExceededErrorf("timed out reading response body after %v", b.timeout)
+	}
+	return n, err
+}
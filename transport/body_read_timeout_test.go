@@ -0,0 +1,142 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package transport
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/opentracing/opentracing-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/yarpc/yarpcerrors"
+)
+
+// slowBody returns a body that sends chunks bytes, one every interval.
+func slowBody(chunks int, interval time.Duration) io.ReadCloser {
+	r, w := io.Pipe()
+	go func() {
+		for i := 0; i < chunks; i++ {
+			time.Sleep(interval)
+			if _, err := w.Write([]byte{byte(i)}); err != nil {
+				return
+			}
+		}
+		w.Close()
+	}()
+	return r
+}
+
+func TestBodyReadTimeout(t *testing.T) {
+	tests := []struct {
+		msg     string
+		timeout time.Duration
+		chunks  int
+		wantErr bool
+	}{
+		{
+			msg:    "no timeout",
+			chunks: 5,
+		},
+		{
+			msg:     "body read within timeout",
+			timeout: time.Second,
+			chunks:  5,
+		},
+		{
+			msg:     "slow body",
+			timeout: 50 * time.Millisecond,
+			chunks:  50,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.msg, func(t *testing.T) {
+			tr := &grpcTransport{bodyReadTimeout: tt.timeout}
+			body, stop := tr.withBodyReadTimeout(slowBody(tt.chunks, 10*time.Millisecond))
+			got, err := ioutil.ReadAll(body)
+			stop()
+			if tt.wantErr {
+				require.Error(t, err)
+				assert.Equal(t, yarpcerrors.CodeDeadlineExceeded, yarpcerrors.FromError(err).Code())
+				assert.Contains(t, err.Error(), "timed out reading response body after 50ms")
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Len(t, got, tt.chunks)
+		})
+	}
+}
+
+func TestBodyReadTimeoutRequiresGRPCWeb(t *testing.T) {
+	_, err := newGRPC(GRPCOptions{
+		Addresses:       []string{"127.0.0.1:0"},
+		Tracer:          opentracing.NoopTracer{},
+		Caller:          "test",
+		BodyReadTimeout: time.Second,
+	})
+	assert.Equal(t, errBodyTimeoutNoWeb, err)
+}
+
+func TestBodyReadTimeoutGRPCWeb(t *testing.T) {
+	webServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/grpc-web+proto")
+		w.Write(grpcWebFrame(0, []byte{0x08, 0x01}))
+		w.(http.Flusher).Flush()
+
+		select {
+		case <-time.After(time.Second):
+		case <-r.Context().Done():
+			return
+		}
+		w.Write(grpcWebFrame(0x80, []byte("grpc-status: 0\r\ngrpc-message: \r\n")))
+	}))
+	defer webServer.Close()
+
+	client, err := newGRPC(GRPCOptions{
+		Addresses:         []string{webServer.Listener.Addr().String()},
+		Tracer:            opentracing.NoopTracer{},
+		Caller:            "test",
+		Encoding:          "proto",
+		GRPCWebAutoDetect: true,
+		BodyReadTimeout:   100 * time.Millisecond,
+	})
+	require.NoError(t, err)
+	defer client.Close()
+
+	start := time.Now()
+	_, err = client.Call(context.Background(), &Request{
+		TargetService: "Bar",
+		Method:        "Bar::Baz",
+		Timeout:       5 * time.Second,
+		Body:          []byte{0x08, 0x01},
+	})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "timed out reading response body after 100ms")
+	assert.True(t, time.Since(start) < time.Second, "body read should be bounded by BodyReadTimeout")
+}
@@ -0,0 +1,79 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package transport
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGRPCPauseResume(t *testing.T) {
+	client, cleanup := newSimpleGRPCClient(t, &simpleSvc{}, GRPCOptions{})
+	defer cleanup()
+
+	call := func(ctx context.Context) error {
+		_, err := client.Call(ctx, &Request{
+			TargetService: "foo",
+			Method:        "Bar::Baz",
+			Timeout:       time.Second,
+		})
+		return err
+	}
+	require.NoError(t, call(context.Background()), "calls should succeed before pausing")
+
+	t.Run("calls block while paused", func(t *testing.T) {
+		client.Pause()
+		client.Pause() // pausing twice has no extra effect
+
+		done := make(chan error, 1)
+		go func() { done <- call(context.Background()) }()
+
+		select {
+		case err := <-done:
+			t.Fatalf("call finished while paused: %v", err)
+		case <-time.After(50 * time.Millisecond):
+		}
+
+		client.Resume()
+		select {
+		case err := <-done:
+			assert.NoError(t, err)
+		case <-time.After(time.Second):
+			t.Fatal("call did not proceed after resume")
+		}
+
+		client.Resume() // resuming when not paused is a no-op
+		assert.NoError(t, call(context.Background()))
+	})
+
+	t.Run("paused call is cancelled", func(t *testing.T) {
+		client.Pause()
+		defer client.Resume()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		defer cancel()
+		assert.Equal(t, context.DeadlineExceeded, call(ctx))
+	})
+}
@@ -0,0 +1,56 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package transport
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+var errCallWeightedNoWeight = errors.New("must specify call specs with a positive total weight")
+
+// CallSpec is a request made by CallWeighted, along with its share of calls.
+type CallSpec struct {
+	Request *Request
+	Weight  int
+}
+
+// CallWeighted picks one of specs at random in proportion to their weights,
+// and calls it. It returns the index of the spec that was called along with
+// the result of the call, so mixed workloads can be broken down by spec.
+func (t *grpcTransport) CallWeighted(ctx context.Context, specs []CallSpec) (*Response, int, error) {
+	weights := make([]int, len(specs))
+	for i, spec := range specs {
+		if spec.Weight < 0 {
+			return nil, -1, fmt.Errorf("call spec %v has negative weight %v", i, spec.Weight)
+		}
+		weights[i] = spec.Weight
+	}
+	cumulative := newCumulativeWeights(weights)
+	if cumulative.total() == 0 {
+		return nil, -1, errCallWeightedNoWeight
+	}
+
+	i := t.pickWeighted(cumulative)
+	res, err := t.Call(ctx, specs[i].Request)
+	return res, i, err
+}
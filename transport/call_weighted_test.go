@@ -0,0 +1,103 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package transport
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/yarpc/api/transport"
+)
+
+func TestGRPCCallWeighted(t *testing.T) {
+	echo := func(ctx context.Context, request *testBarRequest) (*testBarResponse, error) {
+		return &testBarResponse{One: request.One}, nil
+	}
+
+	doWithGRPCTestEnvOptions(t, 1, []transport.Procedure{
+		newTestJSONProcedure("example", "Foo::Bar", echo),
+		newTestJSONProcedure("other", "Other::Baz", echo),
+	}, GRPCOptions{Caller: "example-caller"}, func(t *testing.T, grpcTestEnv *grpcTestEnv) {
+		caller := grpcTestEnv.Transport.(WeightedCaller)
+
+		newSpec := func(service, method, one string, weight int) CallSpec {
+			request, err := newTestJSONRequest(service, method, &testBarRequest{One: one})
+			require.NoError(t, err)
+			return CallSpec{Request: request, Weight: weight}
+		}
+		specs := []CallSpec{
+			newSpec("example", "Foo::Bar", "foo", 3),
+			newSpec("other", "Other::Baz", "baz", 1),
+			newSpec("example", "Foo::Bar", "unused", 0),
+		}
+
+		const calls = 1000
+		counts := make([]int, len(specs))
+		for i := 0; i < calls; i++ {
+			res, spec, err := caller.CallWeighted(context.Background(), specs)
+			require.NoError(t, err)
+			counts[spec]++
+
+			// The response should match the spec that was called.
+			want := map[int]string{0: `{"One":"foo"}`, 1: `{"One":"baz"}`}[spec]
+			assert.JSONEq(t, want, string(res.Body), "response for spec %v", spec)
+		}
+		assert.InDelta(t, 0.75*calls, counts[0], 0.05*calls, "spec 0 calls")
+		assert.InDelta(t, 0.25*calls, counts[1], 0.05*calls, "spec 1 calls")
+		assert.Zero(t, counts[2], "spec with no weight should not be called")
+	})
+}
+
+func TestGRPCCallWeightedInvalid(t *testing.T) {
+	client := &grpcTransport{}
+	request := &Request{TargetService: "svc", Method: "Svc::Method"}
+
+	tests := []struct {
+		msg     string
+		specs   []CallSpec
+		wantErr string
+	}{
+		{
+			msg:     "no specs",
+			wantErr: errCallWeightedNoWeight.Error(),
+		},
+		{
+			msg:     "no weight",
+			specs:   []CallSpec{{Request: request}},
+			wantErr: errCallWeightedNoWeight.Error(),
+		},
+		{
+			msg:     "negative weight",
+			specs:   []CallSpec{{Request: request, Weight: 1}, {Request: request, Weight: -1}},
+			wantErr: "call spec 1 has negative weight -1",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.msg, func(t *testing.T) {
+			_, i, err := client.CallWeighted(context.Background(), tt.specs)
+			assert.EqualError(t, err, tt.wantErr)
+			assert.Equal(t, -1, i)
+		})
+	}
+}
@@ -0,0 +1,237 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package transport
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"sync"
+
+	"go.uber.org/multierr"
+)
+
+// The capture format is a sequence of records, one per request. Every field
+// of a record is written as a 4-byte big-endian length followed by that many
+// bytes, in the order: service, method, number of headers (as a decimal
+// string), each header name and value sorted by name, and the body.
+
+// maxCaptureField bounds the size of a single field read from a capture, so
+// a corrupt length can't cause a huge allocation.
+const maxCaptureField = 64 * 1024 * 1024
+
+// CaptureWriter writes requests to a capture that can be replayed later.
+type CaptureWriter struct {
+	w io.Writer
+}
+
+// NewCaptureWriter returns a CaptureWriter that writes to w.
+func NewCaptureWriter(w io.Writer) *CaptureWriter {
+	return &CaptureWriter{w: w}
+}
+
+// Write appends a record for the request's service, method, headers and body.
+func (c *CaptureWriter) Write(request *Request) error {
+	names := make([]string, 0, len(request.Headers))
+	for k := range request.Headers {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+
+	fields := [][]byte{
+		[]byte(request.TargetService),
+		[]byte(request.Method),
+		[]byte(fmt.Sprint(len(names))),
+	}
+	for _, k := range names {
+		fields = append(fields, []byte(k), []byte(request.Headers[k]))
+	}
+	fields = append(fields, request.Body)
+
+	for _, f := range fields {
+		var size [4]byte
+		binary.BigEndian.PutUint32(size[:], uint32(len(f)))
+		if _, err := c.w.Write(size[:]); err != nil {
+			return err
+		}
+		if _, err := c.w.Write(f); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CaptureReader reads requests written by a CaptureWriter.
+type CaptureReader struct {
+	r io.Reader
+}
+
+// NewCaptureReader returns a CaptureReader that reads from r.
+func NewCaptureReader(r io.Reader) *CaptureReader {
+	return &CaptureReader{r: r}
+}
+
+// Next returns the next request in the capture, or io.EOF once all requests
+// have been read.
+func (c *CaptureReader) Next() (*Request, error) {
+	service, err := c.readField()
+	if err != nil {
+		// A capture may only end between records.
+		return nil, err
+	}
+
+	method, err := c.readRecordField()
+	if err != nil {
+		return nil, err
+	}
+	countField, err := c.readRecordField()
+	if err != nil {
+		return nil, err
+	}
+	var count int
+	if _, err := fmt.Sscan(string(countField), &count); err != nil || count < 0 {
+		return nil, fmt.Errorf("invalid capture header count %q", countField)
+	}
+
+	request := &Request{
+		TargetService: string(service),
+		Method:        string(method),
+	}
+	if count > 0 {
+		request.Headers = make(map[string]string, count)
+	}
+	for i := 0; i < count; i++ {
+		k, err := c.readRecordField()
+		if err != nil {
+			return nil, err
+		}
+		v, err := c.readRecordField()
+		if err != nil {
+			return nil, err
+		}
+		request.Headers[string(k)] = string(v)
+	}
+
+	if request.Body, err = c.readRecordField(); err != nil {
+		return nil, err
+	}
+	return request, nil
+}
+
+// readRecordField reads a field within a record, where io.EOF means the
+// capture was truncated.
+func (c *CaptureReader) readRecordField() ([]byte, error) {
+	f, err := c.readField()
+	if err == io.EOF {
+		return nil, io.ErrUnexpectedEOF
+	}
+	return f, err
+}
+
+func (c *CaptureReader) readField() ([]byte, error) {
+	var size [4]byte
+	if _, err := io.ReadFull(c.r, size[:]); err != nil {
+		return nil, err
+	}
+	n := binary.BigEndian.Uint32(size[:])
+	if n > maxCaptureField {
+		return nil, fmt.Errorf("capture field of %v bytes exceeds the limit of %v bytes", n, maxCaptureField)
+	}
+	f := make([]byte, n)
+	if _, err := io.ReadFull(c.r, f); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	return f, nil
+}
+
+// ReadCapture reads all of the requests in the capture file at path.
+func ReadCapture(path string) ([]*Request, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	r := NewCaptureReader(bufio.NewReader(f))
+	var requests []*Request
+	for {
+		request, err := r.Next()
+		if err == io.EOF {
+			return requests, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("could not read capture %q: %v", path, err)
+		}
+		requests = append(requests, request)
+	}
+}
+
+// Replay makes the calls for the requests in the capture file at path,
+// using up to concurrency calls at a time. Requests are sent in the order
+// they were captured when concurrency is 1 or less. Response i is the
+// response to the i-th captured request, and is nil if that call failed.
+// The returned error combines the errors of all failed calls.
+func (t *grpcTransport) Replay(ctx context.Context, path string, concurrency int) ([]*Response, error) {
+	requests, err := ReadCapture(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	if concurrency > len(requests) {
+		concurrency = len(requests)
+	}
+
+	responses := make([]*Response, len(requests))
+	errs := make([]error, len(requests))
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+	wg.Add(concurrency)
+	for w := 0; w < concurrency; w++ {
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				res, err := t.Call(ctx, requests[i])
+				if err != nil {
+					errs[i] = fmt.Errorf("request %v (%v): %v", i, requests[i].Method, err)
+					continue
+				}
+				responses[i] = res
+			}
+		}()
+	}
+	for i := range requests {
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+
+	return responses, multierr.Combine(errs...)
+}
@@ -0,0 +1,116 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package transport
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/yarpc/yab/testdata/protobuf/simple"
+)
+
+func TestCaptureRoundTrip(t *testing.T) {
+	requests := []*Request{
+		{
+			TargetService: "Bar",
+			Method:        "Bar::Baz",
+			Headers:       map[string]string{"b": "2", "a": "1"},
+			Body:          []byte{0x08, 0x01},
+		},
+		{
+			TargetService: "Bar",
+			Method:        "Bar::Baz",
+			Body:          []byte{},
+		},
+	}
+
+	var buf bytes.Buffer
+	w := NewCaptureWriter(&buf)
+	for _, r := range requests {
+		require.NoError(t, w.Write(r))
+	}
+	captured := buf.Bytes()
+
+	r := NewCaptureReader(bytes.NewReader(captured))
+	for _, want := range requests {
+		got, err := r.Next()
+		require.NoError(t, err)
+		assert.Equal(t, want, got)
+	}
+	_, err := r.Next()
+	assert.Equal(t, io.EOF, err)
+
+	t.Run("truncated", func(t *testing.T) {
+		r := NewCaptureReader(bytes.NewReader(captured[:len(captured)-1]))
+		_, err := r.Next()
+		require.NoError(t, err)
+		_, err = r.Next()
+		assert.Equal(t, io.ErrUnexpectedEOF, err)
+	})
+}
+
+func TestGRPCReplay(t *testing.T) {
+	client, cleanup := newSimpleGRPCClient(t, &simpleSvc{}, GRPCOptions{})
+	defer cleanup()
+
+	path := filepath.Join(t.TempDir(), "requests.capture")
+	f, err := os.Create(path)
+	require.NoError(t, err)
+	w := NewCaptureWriter(f)
+	var want [][]byte
+	for i := 1; i <= 10; i++ {
+		body, err := proto.Marshal(&simple.Foo{Test: int32(i)})
+		require.NoError(t, err)
+		want = append(want, body)
+		require.NoError(t, w.Write(&Request{
+			TargetService: "Bar",
+			Method:        "Bar::Baz",
+			Headers:       map[string]string{"seq": strconv.Itoa(i)},
+			Body:          body,
+		}))
+	}
+	require.NoError(t, f.Close())
+
+	for _, concurrency := range []int{1, 4} {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		responses, err := client.Replay(ctx, path, concurrency)
+		cancel()
+		require.NoError(t, err, "concurrency %v", concurrency)
+		require.Len(t, responses, len(want))
+		for i, res := range responses {
+			assert.Equal(t, want[i], res.Body, "concurrency %v response %v", concurrency, i)
+		}
+	}
+
+	t.Run("missing file", func(t *testing.T) {
+		_, err := client.Replay(context.Background(), filepath.Join(t.TempDir(), "missing"), 1)
+		assert.Error(t, err)
+	})
+}
@@ -0,0 +1,218 @@
+// Copyright (c) 2021 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package transport
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	apipeer "go.uber.org/yarpc/api/peer"
+	"go.uber.org/yarpc/api/transport"
+	"go.uber.org/yarpc/yarpcerrors"
+)
+
+const defaultCooldown = 5 * time.Second
+
+// ErrCircuitOpen is returned by calls made while every peer has been ejected
+// for failing, if GRPCOptions.FailFastWhenOpen is set.
+var ErrCircuitOpen = errors.New("circuit open: every peer has been ejected after failing")
+
+// transportErrorMessages are in the messages of internal and unknown errors
+// that gRPC's transport fails calls with, rather than the server's handler.
+var transportErrorMessages = []string{
+	"transport: ",
+	"stream terminated by RST_STREAM",
+}
+
+// circuitBreakerList wraps a peer list and removes peers from it after a
+// number of consecutive failed calls, adding them back after a cooldown.
+type circuitBreakerList struct {
+	apipeer.ChooserList
+
+	threshold int
+	cooldown  time.Duration
+	failFast  bool
+	logger    Logger
+
+	mu      sync.Mutex
+	peers   map[string]*breakerPeer
+	stopped bool
+}
+
+type breakerPeer struct {
+	id       apipeer.Identifier
+	failures int
+	timer    *time.Timer // non-nil while the peer is ejected
+}
+
+func newCircuitBreakerList(list apipeer.ChooserList, threshold int, cooldown time.Duration, failFast bool, logger Logger) *circuitBreakerList {
+	if cooldown <= 0 {
+		cooldown = defaultCooldown
+	}
+	return &circuitBreakerList{
+		ChooserList: list,
+		threshold:   threshold,
+		cooldown:    cooldown,
+		failFast:    failFast,
+		logger:      logger,
+		peers:       make(map[string]*breakerPeer),
+	}
+}
+
+func (l *circuitBreakerList) Update(updates apipeer.ListUpdates) error {
+	l.mu.Lock()
+	for _, id := range updates.Additions {
+		l.peers[id.Identifier()] = &breakerPeer{id: id}
+	}
+	removals := updates.Removals[:0:0]
+	for _, id := range updates.Removals {
+		p, ok := l.peers[id.Identifier()]
+		delete(l.peers, id.Identifier())
+		if ok && p.timer != nil {
+			// Ejected peers have already been removed from the list.
+			p.timer.Stop()
+			continue
+		}
+		removals = append(removals, id)
+	}
+	l.mu.Unlock()
+
+	return l.ChooserList.Update(apipeer.ListUpdates{
+		Additions: updates.Additions,
+		Removals:  removals,
+	})
+}
+
+func (l *circuitBreakerList) Choose(ctx context.Context, req *transport.Request) (apipeer.Peer, func(error), error) {
+	if l.failFast && l.allEjected() {
+		return nil, nil, ErrCircuitOpen
+	}
+
+	p, onFinish, err := l.ChooserList.Choose(ctx, req)
+	if err != nil {
+		return p, onFinish, err
+	}
+
+	id := p.Identifier()
+	return p, func(err error) {
+		onFinish(err)
+		l.recordResult(id, err)
+	}, nil
+}
+
+// allEjected returns whether the list has peers, and all of them have been
+// ejected.
+func (l *circuitBreakerList) allEjected() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for _, p := range l.peers {
+		if p.timer == nil {
+			return false
+		}
+	}
+	return len(l.peers) > 0
+}
+
+func (l *circuitBreakerList) Stop() error {
+	l.mu.Lock()
+	l.stopped = true
+	for _, p := range l.peers {
+		if p.timer != nil {
+			p.timer.Stop()
+		}
+	}
+	l.mu.Unlock()
+	return l.ChooserList.Stop()
+}
+
+func (l *circuitBreakerList) recordResult(id string, err error) {
+	l.mu.Lock()
+	p, ok := l.peers[id]
+	if !ok || p.timer != nil {
+		l.mu.Unlock()
+		return
+	}
+	if !isPeerFailure(err) {
+		p.failures = 0
+		l.mu.Unlock()
+		return
+	}
+
+	p.failures++
+	if p.failures < l.threshold || l.stopped {
+		l.mu.Unlock()
+		return
+	}
+	p.timer = time.AfterFunc(l.cooldown, func() { l.restore(p) })
+	l.mu.Unlock()
+
+	l.logger.Warn("ejecting failing peer", "peer", id, "failures", p.failures, "cooldown", l.cooldown)
+	if err := l.ChooserList.Update(apipeer.ListUpdates{Removals: []apipeer.Identifier{p.id}}); err != nil {
+		l.logger.Error("failed to eject peer", "peer", id, "error", err)
+	}
+}
+
+func (l *circuitBreakerList) restore(p *breakerPeer) {
+	l.mu.Lock()
+	if l.stopped || l.peers[p.id.Identifier()] != p {
+		l.mu.Unlock()
+		return
+	}
+	p.failures = 0
+	p.timer = nil
+	l.mu.Unlock()
+
+	l.logger.Info("restoring peer after cooldown", "peer", p.id.Identifier())
+	if err := l.ChooserList.Update(apipeer.ListUpdates{Additions: []apipeer.Identifier{p.id}}); err != nil {
+		l.logger.Error("failed to restore peer", "peer", p.id.Identifier(), "error", err)
+	}
+}
+
+// isPeerFailure returns whether a call that failed with err, or succeeded if
+// err is nil, counts as a failure of its peer. Errors returned by the
+// server's handler, such as NotFound or InvalidArgument, mean the peer is
+// working, so only failures to reach the peer or get a response from it
+// count.
+func isPeerFailure(err error) bool {
+	if err == nil {
+		return false
+	}
+	if !yarpcerrors.IsStatus(err) {
+		return true
+	}
+
+	status := yarpcerrors.FromError(err)
+	switch status.Code() {
+	case yarpcerrors.CodeUnavailable, yarpcerrors.CodeDeadlineExceeded:
+		return true
+	case yarpcerrors.CodeInternal, yarpcerrors.CodeUnknown:
+		for _, msg := range transportErrorMessages {
+			if strings.Contains(status.Message(), msg) {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,232 @@
+// Copyright (c) 2021 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package transport
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/opentracing/opentracing-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/yarpc/yab/testdata/protobuf/simple"
+	"go.uber.org/atomic"
+	"go.uber.org/yarpc/yarpcerrors"
+	googlegrpc "google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// failingSimpleSvc fails every call with code, or Unavailable if it's unset.
+type failingSimpleSvc struct {
+	simpleSvc
+
+	code  codes.Code
+	calls atomic.Int32
+}
+
+func (s *failingSimpleSvc) Baz(c context.Context, in *simple.Foo) (*simple.Foo, error) {
+	s.calls.Inc()
+	code := s.code
+	if code == codes.OK {
+		code = codes.Unavailable
+	}
+	return nil, status.Error(code, "failing peer")
+}
+
+func TestGRPCCircuitBreaker(t *testing.T) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	failing := &failingSimpleSvc{}
+	server := googlegrpc.NewServer()
+	simple.RegisterBarServer(server, failing)
+	go server.Serve(lis)
+	defer server.Stop()
+
+	good, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	goodServer := googlegrpc.NewServer()
+	simple.RegisterBarServer(goodServer, &simpleSvc{})
+	go goodServer.Serve(good)
+	defer goodServer.Stop()
+
+	const cooldown = 500 * time.Millisecond
+	logger := &recordingLogger{}
+	client, err := newGRPC(GRPCOptions{
+		Addresses:        []string{good.Addr().String(), lis.Addr().String()},
+		Tracer:           opentracing.NoopTracer{},
+		Caller:           "test",
+		Encoding:         "proto",
+		FailureThreshold: 2,
+		Cooldown:         cooldown,
+		Logger:           logger,
+	})
+	require.NoError(t, err)
+	defer client.Close()
+
+	call := func() error {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		_, err := client.Call(ctx, &Request{
+			TargetService: "Bar",
+			Method:        "Bar::Baz",
+			Body:          []byte{},
+		})
+		return err
+	}
+
+	var failures int
+	for i := 0; i < 20; i++ {
+		if call() != nil {
+			failures++
+		}
+	}
+	assert.Equal(t, 2, failures, "failing peer should be skipped after the threshold")
+	assert.EqualValues(t, 2, failing.calls.Load())
+	assert.Len(t, logger.find("warn", "ejecting failing peer"), 1)
+
+	time.Sleep(cooldown + 100*time.Millisecond)
+	require.Eventually(t, func() bool {
+		call()
+		return failing.calls.Load() > 2
+	}, 2*time.Second, 10*time.Millisecond, "failing peer should be re-added after the cooldown")
+	assert.Len(t, logger.find("info", "restoring peer after cooldown"), 1)
+}
+
+func TestGRPCCircuitBreakerFailFast(t *testing.T) {
+	failing := &failingSimpleSvc{}
+	var addresses []string
+	for i := 0; i < 2; i++ {
+		lis, err := net.Listen("tcp", "127.0.0.1:0")
+		require.NoError(t, err)
+		server := googlegrpc.NewServer()
+		simple.RegisterBarServer(server, failing)
+		go server.Serve(lis)
+		defer server.Stop()
+		addresses = append(addresses, lis.Addr().String())
+	}
+
+	client, err := newGRPC(GRPCOptions{
+		Addresses:        addresses,
+		Tracer:           opentracing.NoopTracer{},
+		Caller:           "test",
+		Encoding:         "proto",
+		FailureThreshold: 2,
+		Cooldown:         time.Minute,
+		FailFastWhenOpen: true,
+	})
+	require.NoError(t, err)
+	defer client.Close()
+
+	call := func() error {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		_, err := client.Call(ctx, &Request{
+			TargetService: "Bar",
+			Method:        "Bar::Baz",
+			Body:          []byte{},
+		})
+		return err
+	}
+
+	for i := 0; i < 4; i++ {
+		err := call()
+		require.Error(t, err)
+		assert.False(t, errors.Is(err, ErrCircuitOpen), "call %v should reach a peer: %v", i, err)
+	}
+	assert.EqualValues(t, 4, failing.calls.Load())
+
+	start := time.Now()
+	err = call()
+	assert.True(t, errors.Is(err, ErrCircuitOpen), "unexpected error: %v", err)
+	assert.True(t, time.Since(start) < 100*time.Millisecond, "call should fail immediately, took %v", time.Since(start))
+	assert.EqualValues(t, 4, failing.calls.Load(), "no calls should reach the peers")
+}
+
+func TestGRPCCircuitBreakerIgnoresApplicationErrors(t *testing.T) {
+	for _, code := range []codes.Code{codes.NotFound, codes.InvalidArgument, codes.Internal} {
+		t.Run(code.String(), func(t *testing.T) {
+			lis, err := net.Listen("tcp", "127.0.0.1:0")
+			require.NoError(t, err)
+			failing := &failingSimpleSvc{code: code}
+			server := googlegrpc.NewServer()
+			simple.RegisterBarServer(server, failing)
+			go server.Serve(lis)
+			defer server.Stop()
+
+			logger := &recordingLogger{}
+			client, err := newGRPC(GRPCOptions{
+				Addresses:        []string{lis.Addr().String()},
+				Tracer:           opentracing.NoopTracer{},
+				Caller:           "test",
+				Encoding:         "proto",
+				FailureThreshold: 2,
+				Cooldown:         time.Minute,
+				FailFastWhenOpen: true,
+				Logger:           logger,
+			})
+			require.NoError(t, err)
+			defer client.Close()
+
+			for i := 0; i < 5; i++ {
+				ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+				_, err := client.Call(ctx, &Request{
+					TargetService: "Bar",
+					Method:        "Bar::Baz",
+					Body:          []byte{},
+				})
+				cancel()
+				require.Error(t, err)
+				assert.False(t, errors.Is(err, ErrCircuitOpen), "call %v should reach the peer: %v", i, err)
+			}
+			assert.EqualValues(t, 5, failing.calls.Load())
+			assert.Empty(t, logger.find("warn", "ejecting failing peer"))
+		})
+	}
+}
+
+func TestIsPeerFailure(t *testing.T) {
+	tests := []struct {
+		msg  string
+		err  error
+		want bool
+	}{
+		{msg: "success"},
+		{msg: "not a status", err: errors.New("dial failed"), want: true},
+		{msg: "unavailable", err: yarpcerrors.UnavailableErrorf("server down"), want: true},
+		{msg: "deadline exceeded", err: yarpcerrors.DeadlineExceededErrorf("too slow"), want: true},
+		{msg: "transport internal", err: yarpcerrors.InternalErrorf("stream terminated by RST_STREAM with error code: PROTOCOL_ERROR"), want: true},
+		{msg: "transport unknown", err: yarpcerrors.UnknownErrorf("transport: malformed grpc-status"), want: true},
+		{msg: "application internal", err: yarpcerrors.InternalErrorf("database failed")},
+		{msg: "application unknown", err: yarpcerrors.UnknownErrorf("panic in handler")},
+		{msg: "not found", err: yarpcerrors.NotFoundErrorf("no such bar")},
+		{msg: "invalid argument", err: yarpcerrors.InvalidArgumentErrorf("bad bar")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.msg, func(t *testing.T) {
+			assert.Equal(t, tt.want, isPeerFailure(tt.err))
+		})
+	}
+}
@@ -0,0 +1,107 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package transport
+
+import (
+	"context"
+	"crypto/sha256"
+	"sync"
+)
+
+// callCoalescer shares the result of an in-flight call to an allowlisted
+// method with identical calls made while it's in flight.
+type callCoalescer struct {
+	methods map[string]struct{}
+
+	mu    sync.Mutex
+	calls map[responseCacheKey]*coalescedCall
+}
+
+type coalescedCall struct {
+	done chan struct{}
+	res  *Response
+	err  error
+}
+
+func newCallCoalescer(methods []string) *callCoalescer {
+	c := &callCoalescer{
+		methods: make(map[string]struct{}, len(methods)),
+		calls:   make(map[responseCacheKey]*coalescedCall),
+	}
+	for _, m := range methods {
+		c.methods[m] = struct{}{}
+	}
+	return c
+}
+
+// key returns the key that identical calls share, and false if request
+// shouldn't be coalesced. Calls are identical if they have the same service,
+// method and body.
+func (c *callCoalescer) key(request *Request) (responseCacheKey, bool) {
+	if c == nil {
+		return responseCacheKey{}, false
+	}
+	if _, ok := c.methods[request.Method]; !ok {
+		return responseCacheKey{}, false
+	}
+	return responseCacheKey{
+		service:  request.TargetService,
+		method:   request.Method,
+		bodyHash: sha256.Sum256(request.Body),
+	}, true
+}
+
+// do calls f, unless a call with the same key is in flight, in which case it
+// waits for that call and returns a copy of its result. Callers waiting on
+// another call stop waiting when ctx is done.
+func (c *callCoalescer) do(ctx context.Context, key responseCacheKey, f func() (*Response, error)) (*Response, error) {
+	c.mu.Lock()
+	if call, ok := c.calls[key]; ok {
+		c.mu.Unlock()
+		select {
+		case <-call.done:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		if call.err != nil {
+			return nil, call.err
+		}
+		return copyResponse(call.res), nil
+	}
+
+	call := &coalescedCall{done: make(chan struct{})}
+	c.calls[key] = call
+	c.mu.Unlock()
+
+	res, err := f()
+	// The caller owns res and may release its body to a pool, so waiting
+	// callers copy from a copy of it.
+	if err == nil {
+		call.res = copyResponse(res)
+	}
+	call.err = err
+
+	c.mu.Lock()
+	delete(c.calls, key)
+	c.mu.Unlock()
+	close(call.done)
+	return res, err
+}
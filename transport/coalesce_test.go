@@ -0,0 +1,108 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package transport
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/yarpc/yab/testdata/protobuf/simple"
+	"go.uber.org/atomic"
+)
+
+// blockingSvc counts calls, and holds each of them until release is closed.
+type blockingSvc struct {
+	simpleSvc
+
+	calls   atomic.Int32
+	release chan struct{}
+}
+
+func (s *blockingSvc) Baz(ctx context.Context, in *simple.Foo) (*simple.Foo, error) {
+	s.calls.Inc()
+	<-s.release
+	return in, nil
+}
+
+func TestGRPCCoalesceIdempotent(t *testing.T) {
+	const calls = 10
+
+	tests := []struct {
+		msg       string
+		methods   []string
+		wantCalls int32
+	}{
+		{
+			msg:       "coalesced method",
+			methods:   []string{"Bar::Baz"},
+			wantCalls: 1,
+		},
+		{
+			msg:       "other method",
+			methods:   []string{"Bar::Other"},
+			wantCalls: calls,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.msg, func(t *testing.T) {
+			svc := &blockingSvc{release: make(chan struct{})}
+			client, cleanup := newSimpleGRPCClient(t, svc, GRPCOptions{
+				CoalesceIdempotent: true,
+				CoalesceMethods:    tt.methods,
+			})
+			defer cleanup()
+
+			body := []byte{0x08, 0x2a} // Foo{Test: 42}
+			var wg sync.WaitGroup
+			responses := make([]*Response, calls)
+			errs := make([]error, calls)
+			for i := 0; i < calls; i++ {
+				wg.Add(1)
+				go func(i int) {
+					defer wg.Done()
+					responses[i], errs[i] = client.Call(context.Background(), &Request{
+						TargetService: "Bar",
+						Method:        "Bar::Baz",
+						Timeout:       time.Second,
+						Body:          body,
+					})
+				}(i)
+			}
+
+			require.Eventually(t, func() bool { return svc.calls.Load() >= tt.wantCalls }, time.Second, time.Millisecond)
+			// Give the other calls time to start before releasing the server.
+			time.Sleep(50 * time.Millisecond)
+			close(svc.release)
+			wg.Wait()
+
+			assert.Equal(t, tt.wantCalls, svc.calls.Load(), "server calls")
+			for i := 0; i < calls; i++ {
+				require.NoError(t, errs[i], "call %v", i)
+				assert.Equal(t, body, responses[i].Body, "call %v", i)
+			}
+		})
+	}
+}
@@ -0,0 +1,112 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package transport
+
+import "sync"
+
+// connectionEvent is a peer connection being established or lost.
+type connectionEvent struct {
+	addr      string
+	connected bool
+}
+
+// connectionNotifier calls the OnConnect and OnDisconnect callbacks from a
+// dedicated goroutine. Events are queued without limit, so a slow callback
+// delays later callbacks but never blocks the transport.
+type connectionNotifier struct {
+	onConnect    func(addr string)
+	onDisconnect func(addr string)
+
+	mu      sync.Mutex
+	pending []connectionEvent
+	wake    chan struct{}
+	stop    chan struct{}
+}
+
+// newConnectionNotifier returns nil if neither callback is set, in which
+// case events are ignored.
+func newConnectionNotifier(onConnect, onDisconnect func(addr string)) *connectionNotifier {
+	if onConnect == nil && onDisconnect == nil {
+		return nil
+	}
+	n := &connectionNotifier{
+		onConnect:    onConnect,
+		onDisconnect: onDisconnect,
+		wake:         make(chan struct{}, 1),
+		stop:         make(chan struct{}),
+	}
+	go n.run()
+	return n
+}
+
+func (n *connectionNotifier) notify(addr string, connected bool) {
+	if n == nil {
+		return
+	}
+	n.mu.Lock()
+	n.pending = append(n.pending, connectionEvent{addr: addr, connected: connected})
+	n.mu.Unlock()
+
+	select {
+	case n.wake <- struct{}{}:
+	default:
+		// The goroutine is already due to drain pending events.
+	}
+}
+
+func (n *connectionNotifier) run() {
+	for {
+		select {
+		case <-n.wake:
+			n.deliver()
+		case <-n.stop:
+			// Deliver events from the transport stopping before exiting.
+			n.deliver()
+			return
+		}
+	}
+}
+
+func (n *connectionNotifier) deliver() {
+	n.mu.Lock()
+	events := n.pending
+	n.pending = nil
+	n.mu.Unlock()
+
+	for _, e := range events {
+		callback := n.onDisconnect
+		if e.connected {
+			callback = n.onConnect
+		}
+		if callback != nil {
+			callback(e.addr)
+		}
+	}
+}
+
+// close stops the goroutine once pending events are delivered, without
+// waiting for it. Later events are dropped.
+func (n *connectionNotifier) close() {
+	if n == nil {
+		return
+	}
+	close(n.stop)
+}
@@ -0,0 +1,161 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package transport
+
+import (
+	"context"
+	"net"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc/credentials"
+)
+
+// ConnectionTiming is how long each step of setting up a connection to a
+// peer took. Steps that weren't needed, such as DNS for an IP address or
+// TLS for a plaintext connection, are zero.
+type ConnectionTiming struct {
+	DNS time.Duration
+	TCP time.Duration
+	TLS time.Duration
+}
+
+// connectionTimings records the timing of the first connection to each peer.
+type connectionTimings struct {
+	mu     sync.Mutex
+	byPeer map[string]ConnectionTiming
+
+	// pending holds the timings of connections waiting for their TLS
+	// handshake, keyed by the connection's local address.
+	pending map[string]pendingTiming
+}
+
+type pendingTiming struct {
+	peer   string
+	timing ConnectionTiming
+}
+
+func newConnectionTimings() *connectionTimings {
+	return &connectionTimings{
+		byPeer:  make(map[string]ConnectionTiming),
+		pending: make(map[string]pendingTiming),
+	}
+}
+
+// dialed records that conn to peer was set up, and is waiting for its TLS
+// handshake to be timed by handshakeDone.
+func (c *connectionTimings) dialed(conn net.Conn, peer string, timing ConnectionTiming) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.pending[conn.LocalAddr().String()] = pendingTiming{peer: peer, timing: timing}
+}
+
+// handshakeDone records the timing of conn, whose TLS handshake took d, if
+// the handshake succeeded.
+func (c *connectionTimings) handshakeDone(conn net.Conn, d time.Duration, ok bool) {
+	c.mu.Lock()
+	key := conn.LocalAddr().String()
+	p, found := c.pending[key]
+	delete(c.pending, key)
+	c.mu.Unlock()
+
+	if found && ok {
+		p.timing.TLS = d
+		c.record(p.peer, p.timing)
+	}
+}
+
+func (c *connectionTimings) record(peer string, timing ConnectionTiming) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, ok := c.byPeer[peer]; !ok {
+		c.byPeer[peer] = timing
+	}
+}
+
+func (c *connectionTimings) snapshot() map[string]ConnectionTiming {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	timings := make(map[string]ConnectionTiming, len(c.byPeer))
+	for peer, timing := range c.byPeer {
+		timings[peer] = timing
+	}
+	return timings
+}
+
+// newTimingDialer returns a dialFunc that looks up host names using r, or
+// the default resolver if r is nil, and connects. The time spent on each
+// step of the first successful connection to each address is recorded in
+// timings. If useTLS is set, the timing is only recorded once the handshake
+// has been timed by credentials from newTimingCredentials.
+func newTimingDialer(r Resolver, useTLS bool, timings *connectionTimings) dialFunc {
+	if r == nil {
+		r = net.DefaultResolver
+	}
+
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		var timing ConnectionTiming
+		conn, err := resolveAndDial(ctx, r, network, addr, &timing)
+		if err != nil {
+			return nil, err
+		}
+
+		if useTLS {
+			timings.dialed(conn, addr, timing)
+		} else {
+			timings.record(addr, timing)
+		}
+		return conn, nil
+	}
+}
+
+// timingCredentials times the client handshakes of the credentials it wraps.
+type timingCredentials struct {
+	credentials.TransportCredentials
+
+	timings *connectionTimings
+}
+
+// newTimingCredentials returns creds, recording how long the handshake of
+// each connection from a timing dialer takes in timings.
+func newTimingCredentials(creds credentials.TransportCredentials, timings *connectionTimings) credentials.TransportCredentials {
+	return timingCredentials{TransportCredentials: creds, timings: timings}
+}
+
+func (c timingCredentials) ClientHandshake(ctx context.Context, authority string, rawConn net.Conn) (net.Conn, credentials.AuthInfo, error) {
+	start := time.Now()
+	conn, info, err := c.TransportCredentials.ClientHandshake(ctx, authority, rawConn)
+	c.timings.handshakeDone(rawConn, time.Since(start), err == nil)
+	return conn, info, err
+}
+
+func (c timingCredentials) Clone() credentials.TransportCredentials {
+	return timingCredentials{TransportCredentials: c.TransportCredentials.Clone(), timings: c.timings}
+}
+
+// ConnectionTimings returns how long setting up the first connection to
+// each peer took, keyed by the peer's address. Peers that haven't been
+// connected to yet are not included.
+func (t *grpcTransport) ConnectionTimings() map[string]ConnectionTiming {
+	return t.connTimings.snapshot()
+}
@@ -0,0 +1,114 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package transport
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// slowResolver delays each lookup so it's visible in the timings.
+type slowResolver struct {
+	Resolver
+	delay time.Duration
+}
+
+func (r slowResolver) LookupHost(ctx context.Context, host string) ([]string, error) {
+	time.Sleep(r.delay)
+	return r.Resolver.LookupHost(ctx, host)
+}
+
+func TestConnectionTimings(t *testing.T) {
+	files := writeTestTLSFiles(t)
+
+	t.Run("IP address", func(t *testing.T) {
+		addr, handshakes := startTLSStub(t, &tls.Config{Certificates: []tls.Certificate{files.cert}})
+		client := newTLSTestClient(t, addr, files, GRPCOptions{})
+		assert.Empty(t, client.ConnectionTimings(), "no timings before connecting")
+		require.NoError(t, dialTLSStub(t, client, handshakes))
+
+		timings := client.ConnectionTimings()
+		require.Contains(t, timings, addr)
+		assert.Zero(t, timings[addr].DNS, "no lookup for an IP address")
+		assert.NotZero(t, timings[addr].TCP, "TCP")
+		assert.NotZero(t, timings[addr].TLS, "TLS")
+	})
+
+	t.Run("host name", func(t *testing.T) {
+		stubAddr, handshakes := startTLSStub(t, &tls.Config{Certificates: []tls.Certificate{files.cert}})
+		_, port, err := net.SplitHostPort(stubAddr)
+		require.NoError(t, err)
+
+		addr := net.JoinHostPort("stub.fake", port)
+		client := newTLSTestClient(t, addr, files, GRPCOptions{
+			Resolver: slowResolver{
+				Resolver: &fakeResolver{hosts: map[string][]string{"stub.fake": {"127.0.0.1"}}},
+				delay:    10 * time.Millisecond,
+			},
+		})
+		require.NoError(t, dialTLSStub(t, client, handshakes))
+
+		timing := client.ConnectionTimings()[addr]
+		assert.True(t, timing.DNS >= 10*time.Millisecond, "DNS should include the lookup, got %v", timing.DNS)
+		assert.NotZero(t, timing.TCP, "TCP")
+		assert.NotZero(t, timing.TLS, "TLS")
+
+	})
+}
+
+func TestConnectionTimingsTLSCredentials(t *testing.T) {
+	files := writeTestTLSFiles(t)
+
+	// The stub requires what gRPC's TLS credentials send: ALPN h2, and the
+	// host name being dialed as the SNI server name.
+	serverNames := make(chan string, 16)
+	stubAddr, handshakes := startTLSStub(t, &tls.Config{
+		Certificates: []tls.Certificate{files.cert},
+		NextProtos:   []string{"h2"},
+		VerifyConnection: func(cs tls.ConnectionState) error {
+			serverNames <- cs.ServerName
+			if cs.NegotiatedProtocol != "h2" {
+				return fmt.Errorf("client did not negotiate h2, got %q", cs.NegotiatedProtocol)
+			}
+			return nil
+		},
+	})
+	_, port, err := net.SplitHostPort(stubAddr)
+	require.NoError(t, err)
+
+	addr := net.JoinHostPort("stub.fake", port)
+	client := newTLSTestClient(t, addr, files, GRPCOptions{
+		Resolver: &fakeResolver{hosts: map[string][]string{"stub.fake": {"127.0.0.1"}}},
+	})
+	require.NoError(t, dialTLSStub(t, client, handshakes))
+	assert.Equal(t, "stub.fake", <-serverNames, "SNI server name")
+
+	timing := client.ConnectionTimings()[addr]
+	assert.NotZero(t, timing.TCP, "TCP")
+	assert.NotZero(t, timing.TLS, "TLS")
+}
@@ -0,0 +1,172 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package transport
+
+import (
+	"fmt"
+	"hash/crc32"
+	"sort"
+	"strconv"
+
+	apipeer "go.uber.org/yarpc/api/peer"
+	"go.uber.org/yarpc/api/transport"
+	"go.uber.org/yarpc/peer/abstractlist"
+	"go.uber.org/yarpc/peer/roundrobin"
+)
+
+// BalancerType is how calls are spread across peers.
+type BalancerType int
+
+// The balancers supported by the gRPC transport.
+const (
+	// RoundRobin sends calls to each available peer in turn.
+	RoundRobin BalancerType = iota
+	// ConsistentHash sends calls with the same ShardKey to the same peer,
+	// moving as few keys as possible when peers are added or removed. Calls
+	// without a ShardKey are sent round-robin.
+	ConsistentHash
+)
+
+// newBalancer returns the constructor for the peer list used by balancer,
+// which is overridden by affinity if it's set.
+func newBalancer(balancer BalancerType, affinity PeerAffinity) (func(apipeer.Transport) apipeer.ChooserList, error) {
+	var fallback func() abstractlist.Implementation
+	switch balancer {
+	case RoundRobin:
+		if affinity == nil {
+			return func(t apipeer.Transport) apipeer.ChooserList { return roundrobin.New(t) }, nil
+		}
+		fallback = func() abstractlist.Implementation { return &roundRobinPeers{} }
+	case ConsistentHash:
+		if affinity == nil {
+			return func(t apipeer.Transport) apipeer.ChooserList { return newConsistentHashList(t) }, nil
+		}
+		fallback = func() abstractlist.Implementation { return &consistentHashRing{} }
+	default:
+		return nil, fmt.Errorf("unknown balancer type %v", balancer)
+	}
+
+	return func(t apipeer.Transport) apipeer.ChooserList {
+		return newAffinityList(t, affinity, fallback())
+	}, nil
+}
+
+// consistentHashReplicas is the number of points each peer has on the ring,
+// which keeps keys evenly spread across a small number of peers.
+const consistentHashReplicas = 100
+
+type ringPoint struct {
+	hash uint32
+	peer apipeer.StatusPeer
+}
+
+// consistentHashRing is an abstractlist.Implementation that hashes shard
+// keys onto a ring of the available peers. The abstractlist serializes calls
+// to it, so it does no locking of its own.
+type consistentHashRing struct {
+	points []ringPoint // sorted by hash
+	// roundRobin chooses the peers for calls without a shard key.
+	roundRobin roundRobinPeers
+}
+
+func newConsistentHashList(t apipeer.Transport) *abstractlist.List {
+	return abstractlist.New("consistent-hash", t, &consistentHashRing{})
+}
+
+type nopListSubscriber struct{}
+
+func (nopListSubscriber) UpdatePendingRequestCount(int) {}
+
+func hashKey(key string) uint32 {
+	return crc32.ChecksumIEEE([]byte(key))
+}
+
+func (r *consistentHashRing) Add(p apipeer.StatusPeer, id apipeer.Identifier) abstractlist.Subscriber {
+	r.roundRobin.Add(p, id)
+	for i := 0; i < consistentHashReplicas; i++ {
+		r.points = append(r.points, ringPoint{
+			hash: hashKey(id.Identifier() + "#" + strconv.Itoa(i)),
+			peer: p,
+		})
+	}
+	sort.Slice(r.points, func(i, j int) bool {
+		return r.points[i].hash < r.points[j].hash
+	})
+	return nopListSubscriber{}
+}
+
+func (r *consistentHashRing) Remove(p apipeer.StatusPeer, id apipeer.Identifier, sub abstractlist.Subscriber) {
+	r.roundRobin.Remove(p, id, sub)
+	points := r.points[:0]
+	for _, point := range r.points {
+		if point.peer != p {
+			points = append(points, point)
+		}
+	}
+	r.points = points
+}
+
+func (r *consistentHashRing) Choose(req *transport.Request) apipeer.StatusPeer {
+	if len(r.points) == 0 {
+		return nil
+	}
+	if req.ShardKey == "" {
+		return r.roundRobin.Choose(req)
+	}
+
+	h := hashKey(req.ShardKey)
+	i := sort.Search(len(r.points), func(i int) bool {
+		return r.points[i].hash >= h
+	})
+	if i == len(r.points) {
+		i = 0
+	}
+	return r.points[i].peer
+}
+
+// roundRobinPeers is an abstractlist.Implementation that chooses each of
+// the available peers in turn.
+type roundRobinPeers struct {
+	peers []apipeer.StatusPeer
+	next  int
+}
+
+func (r *roundRobinPeers) Add(p apipeer.StatusPeer, _ apipeer.Identifier) abstractlist.Subscriber {
+	r.peers = append(r.peers, p)
+	return nopListSubscriber{}
+}
+
+func (r *roundRobinPeers) Remove(p apipeer.StatusPeer, _ apipeer.Identifier, _ abstractlist.Subscriber) {
+	for i, peer := range r.peers {
+		if peer == p {
+			r.peers = append(r.peers[:i], r.peers[i+1:]...)
+			return
+		}
+	}
+}
+
+func (r *roundRobinPeers) Choose(*transport.Request) apipeer.StatusPeer {
+	if len(r.peers) == 0 {
+		return nil
+	}
+	r.next = (r.next + 1) % len(r.peers)
+	return r.peers[r.next]
+}
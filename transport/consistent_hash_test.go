@@ -0,0 +1,116 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package transport
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/opentracing/opentracing-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/yarpc/yab/testdata/protobuf/simple"
+	googlegrpc "google.golang.org/grpc"
+)
+
+// startBarServers starts n servers for the Bar service, and returns their
+// addresses.
+func startBarServers(t *testing.T, n int) []string {
+	var addresses []string
+	for i := 0; i < n; i++ {
+		lis, err := net.Listen("tcp", "127.0.0.1:0")
+		require.NoError(t, err)
+		server := googlegrpc.NewServer()
+		simple.RegisterBarServer(server, &simpleSvc{})
+		go server.Serve(lis)
+		t.Cleanup(server.Stop)
+		addresses = append(addresses, lis.Addr().String())
+	}
+	return addresses
+}
+
+func TestGRPCConsistentHash(t *testing.T) {
+	addresses := startBarServers(t, 3)
+
+	client, err := newGRPC(GRPCOptions{
+		Addresses:             addresses,
+		Tracer:                opentracing.NoopTracer{},
+		Caller:                "test",
+		Balancer:              ConsistentHash,
+		IncludePeerInResponse: true,
+	})
+	require.NoError(t, err)
+	defer client.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	require.NoError(t, client.WaitForPeers(ctx, len(addresses)))
+
+	call := func(shardKey string) string {
+		res, err := client.Call(ctx, &Request{
+			TargetService: "foo",
+			Method:        "Bar::Baz",
+			Timeout:       time.Second,
+			ShardKey:      shardKey,
+		})
+		require.NoError(t, err)
+		return res.PeerAddress
+	}
+
+	t.Run("same shard key", func(t *testing.T) {
+		for i := 0; i < 20; i++ {
+			key := fmt.Sprint("key-", i)
+			peer := call(key)
+			for j := 0; j < 5; j++ {
+				assert.Equal(t, peer, call(key), "shard key %v moved peers", key)
+			}
+		}
+	})
+
+	t.Run("different shard keys", func(t *testing.T) {
+		seen := make(map[string]struct{})
+		for i := 0; i < 50; i++ {
+			seen[call(fmt.Sprint("key-", i))] = struct{}{}
+		}
+		assert.Len(t, seen, len(addresses), "shard keys should spread across peers")
+	})
+
+	t.Run("no shard key", func(t *testing.T) {
+		seen := make(map[string]struct{})
+		for range addresses {
+			seen[call("")] = struct{}{}
+		}
+		assert.Len(t, seen, len(addresses), "calls without a shard key should be round-robin")
+	})
+}
+
+func TestNewGRPCUnknownBalancer(t *testing.T) {
+	_, err := newGRPC(GRPCOptions{
+		Addresses: []string{"127.0.0.1:0"},
+		Tracer:    opentracing.NoopTracer{},
+		Caller:    "test",
+		Balancer:  BalancerType(10),
+	})
+	assert.EqualError(t, err, "unknown balancer type 10")
+}
@@ -0,0 +1,67 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package transport
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+var (
+	errSplitNoDeadline = errors.New("cannot split a context without a deadline")
+	errSplitCount      = errors.New("must split the deadline into at least one context")
+)
+
+// SplitDeadline divides the time remaining before ctx's deadline, less
+// buffer, into n equal slices for n dependent calls made one after another.
+// The i-th returned context expires i+1 slices from now, so each call gets
+// at least its own slice regardless of how quickly earlier calls complete,
+// and the last call doesn't inherit a nearly expired deadline.
+// The returned cancel function releases all of the child contexts.
+func SplitDeadline(ctx context.Context, n int, buffer time.Duration) ([]context.Context, context.CancelFunc, error) {
+	if n <= 0 {
+		return nil, nil, errSplitCount
+	}
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		return nil, nil, errSplitNoDeadline
+	}
+
+	now := time.Now()
+	budget := deadline.Sub(now) - buffer
+	if budget <= 0 {
+		return nil, nil, fmt.Errorf("no time left to split after reserving %v before the deadline", buffer)
+	}
+
+	slice := budget / time.Duration(n)
+	ctxs := make([]context.Context, n)
+	cancels := make([]context.CancelFunc, n)
+	for i := range ctxs {
+		ctxs[i], cancels[i] = context.WithDeadline(ctx, now.Add(time.Duration(i+1)*slice))
+	}
+	return ctxs, func() {
+		for _, cancel := range cancels {
+			cancel()
+		}
+	}, nil
+}
@@ -0,0 +1,100 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package transport
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSplitDeadline(t *testing.T) {
+	const buffer = 100 * time.Millisecond
+	parent, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	parentDeadline, _ := parent.Deadline()
+
+	start := time.Now()
+	ctxs, cancelAll, err := SplitDeadline(parent, 3, buffer)
+	require.NoError(t, err)
+	defer cancelAll()
+	require.Len(t, ctxs, 3)
+
+	var total time.Duration
+	prev := start
+	for i, ctx := range ctxs {
+		deadline, ok := ctx.Deadline()
+		require.True(t, ok, "context %v should have a deadline", i)
+		assert.True(t, deadline.After(prev), "context %v should expire after the previous one", i)
+		total += deadline.Sub(prev)
+		prev = deadline
+	}
+	assert.True(t, total <= parentDeadline.Sub(start)-buffer, "budgets %v should fit within the parent deadline minus the buffer", total)
+	assert.True(t, total > 800*time.Millisecond, "budgets %v should use most of the available time", total)
+
+	cancelAll()
+	for _, ctx := range ctxs {
+		assert.Error(t, ctx.Err())
+	}
+	assert.NoError(t, parent.Err(), "cancelling children should not cancel the parent")
+}
+
+func TestSplitDeadlineErrors(t *testing.T) {
+	withDeadline, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	tests := []struct {
+		msg     string
+		ctx     context.Context
+		n       int
+		buffer  time.Duration
+		wantErr string
+	}{
+		{
+			msg:     "no deadline",
+			ctx:     context.Background(),
+			n:       2,
+			wantErr: "cannot split a context without a deadline",
+		},
+		{
+			msg:     "zero count",
+			ctx:     withDeadline,
+			wantErr: "must split the deadline into at least one context",
+		},
+		{
+			msg:     "buffer exceeds deadline",
+			ctx:     withDeadline,
+			n:       2,
+			buffer:  time.Second,
+			wantErr: "no time left to split after reserving 1s before the deadline",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.msg, func(t *testing.T) {
+			_, _, err := SplitDeadline(tt.ctx, tt.n, tt.buffer)
+			assert.EqualError(t, err, tt.wantErr)
+		})
+	}
+}
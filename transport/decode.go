@@ -0,0 +1,99 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package transport
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/golang/protobuf/proto"
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+var errDecodeNilResponse = errors.New("cannot decode a nil response")
+
+// DecodeResponse unmarshals the protobuf-encoded body of resp into out,
+// for callers that have the generated Go type for the response.
+func DecodeResponse(resp *Response, out proto.Message) error {
+	if resp == nil {
+		return errDecodeNilResponse
+	}
+	if err := proto.Unmarshal(resp.Body, out); err != nil {
+		return fmt.Errorf("could not decode response body as message of type %q: %v", proto.MessageName(out), err)
+	}
+	return nil
+}
+
+// DecodeResponseStrict is like DecodeResponse, but fails if the body has
+// fields that are not in the definition of out, such as fields added by a
+// newer version of the server. The error lists the unknown field numbers,
+// prefixed by the path to the message holding them.
+func DecodeResponseStrict(resp *Response, out proto.Message) error {
+	if err := DecodeResponse(resp, out); err != nil {
+		return err
+	}
+	if unknown := unknownFields(proto.MessageReflect(out), ""); len(unknown) > 0 {
+		return fmt.Errorf("response body of type %q has unknown fields: %v", proto.MessageName(out), strings.Join(unknown, ", "))
+	}
+	return nil
+}
+
+// unknownFields returns the numbers of the unknown fields in m and the
+// messages it contains, each prefixed by the path to its message.
+func unknownFields(m protoreflect.Message, prefix string) []string {
+	var unknown []string
+	for b := m.GetUnknown(); len(b) > 0; {
+		num, _, n := protowire.ConsumeField(b)
+		if n < 0 {
+			// The body was already parsed, so this shouldn't happen.
+			break
+		}
+		unknown = append(unknown, prefix+strconv.Itoa(int(num)))
+		b = b[n:]
+	}
+
+	m.Range(func(fd protoreflect.FieldDescriptor, v protoreflect.Value) bool {
+		path := prefix + string(fd.Name())
+		switch {
+		case fd.IsMap():
+			if fd.MapValue().Message() == nil {
+				return true
+			}
+			v.Map().Range(func(k protoreflect.MapKey, v protoreflect.Value) bool {
+				unknown = append(unknown, unknownFields(v.Message(), path+"["+k.String()+"].")...)
+				return true
+			})
+		case fd.Message() == nil:
+		case fd.IsList():
+			list := v.List()
+			for i := 0; i < list.Len(); i++ {
+				unknown = append(unknown, unknownFields(list.Get(i).Message(), path+"["+strconv.Itoa(i)+"].")...)
+			}
+		default:
+			unknown = append(unknown, unknownFields(v.Message(), path+".")...)
+		}
+		return true
+	})
+	return unknown
+}
@@ -0,0 +1,83 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package transport
+
+import (
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/yarpc/yab/testdata/protobuf/simple"
+)
+
+func TestDecodeResponse(t *testing.T) {
+	body, err := proto.Marshal(&simple.Foo{Test: 5, Nested: &simple.Nested{Value: 6}})
+	require.NoError(t, err)
+
+	var out simple.Foo
+	require.NoError(t, DecodeResponse(&Response{Body: body}, &out))
+	assert.Equal(t, int32(5), out.Test)
+	assert.Equal(t, int32(6), out.Nested.GetValue())
+
+	t.Run("invalid wire format", func(t *testing.T) {
+		// Field 2 claims more bytes than the body contains.
+		err := DecodeResponse(&Response{Body: []byte{0x12, 0x05, 0x08}}, &simple.Foo{})
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), `could not decode response body as message of type "Foo"`)
+	})
+
+	t.Run("nil response", func(t *testing.T) {
+		assert.EqualError(t, DecodeResponse(nil, &simple.Foo{}), "cannot decode a nil response")
+	})
+}
+
+func TestDecodeResponseStrict(t *testing.T) {
+	body, err := proto.Marshal(&simple.Foo{Test: 5, Nested: &simple.Nested{Value: 6}})
+	require.NoError(t, err)
+
+	t.Run("known fields", func(t *testing.T) {
+		var out simple.Foo
+		require.NoError(t, DecodeResponseStrict(&Response{Body: body}, &out))
+		assert.Equal(t, int32(5), out.Test)
+	})
+
+	t.Run("unknown fields", func(t *testing.T) {
+		// Add field 7 (varint 1) to Foo, and fields 9 (varint 2) and
+		// 10 (length-delimited "x") to the nested message.
+		nested := []byte{0x08, 0x06, 0x48, 0x02, 0x52, 0x01, 'x'}
+		withExtra := []byte{0x08, 0x05, 0x38, 0x01, 0x12, byte(len(nested))}
+		withExtra = append(withExtra, nested...)
+
+		var lenient simple.Foo
+		require.NoError(t, DecodeResponse(&Response{Body: withExtra}, &lenient), "unknown fields are ignored by default")
+
+		var out simple.Foo
+		err := DecodeResponseStrict(&Response{Body: withExtra}, &out)
+		assert.EqualError(t, err, `response body of type "Foo" has unknown fields: 7, nested.9, nested.10`)
+	})
+
+	t.Run("invalid wire format", func(t *testing.T) {
+		err := DecodeResponseStrict(&Response{Body: []byte{0x12, 0x05, 0x08}}, &simple.Foo{})
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), `could not decode response body as message of type "Foo"`)
+	})
+}
@@ -0,0 +1,61 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package transport
+
+import (
+	"go.uber.org/yarpc/yarpcerrors"
+	"google.golang.org/grpc/codes"
+)
+
+// expectedCodeResponse returns the response for a call that failed with
+// err, if its code is one of the transport's expected codes. The response
+// has no body, and its "code" and "message" transport fields hold the
+// status the call failed with.
+func (t *grpcTransport) expectedCodeResponse(err error) (*Response, bool) {
+	if len(t.expectedCodes) == 0 {
+		return nil, false
+	}
+
+	status := yarpcerrors.FromError(err)
+	// yarpc uses the same values as gRPC for its codes.
+	code := codes.Code(status.Code())
+	if _, ok := t.expectedCodes[code]; !ok {
+		return nil, false
+	}
+	return &Response{
+		TransportFields: map[string]interface{}{
+			"code":    code.String(),
+			"message": status.Message(),
+		},
+	}, true
+}
+
+// codeSet returns a set of the given codes, or nil if there are none.
+func codeSet(list []codes.Code) map[codes.Code]struct{} {
+	if len(list) == 0 {
+		return nil
+	}
+	set := make(map[codes.Code]struct{}, len(list))
+	for _, c := range list {
+		set[c] = struct{}{}
+	}
+	return set
+}
@@ -0,0 +1,81 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package transport
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/yarpc/yab/testdata/protobuf/simple"
+	"go.uber.org/yarpc/yarpcerrors"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// codeSvc fails calls to Baz with the code in the request's test field.
+type codeSvc struct {
+	simpleSvc
+}
+
+func (s *codeSvc) Baz(ctx context.Context, in *simple.Foo) (*simple.Foo, error) {
+	if code := codes.Code(in.Test); code != codes.OK {
+		return nil, status.Errorf(code, "failed with %v", code)
+	}
+	return in, nil
+}
+
+func TestGRPCExpectedCodes(t *testing.T) {
+	client, cleanup := newSimpleGRPCClient(t, &codeSvc{}, GRPCOptions{
+		ExpectedCodes: []codes.Code{codes.NotFound, codes.AlreadyExists},
+	})
+	defer cleanup()
+
+	call := func(code codes.Code) (*Response, error) {
+		return client.Call(context.Background(), &Request{
+			TargetService: "Bar",
+			Method:        "Bar::Baz",
+			Timeout:       time.Second,
+			Body:          []byte{0x08, byte(code)},
+		})
+	}
+
+	res, err := call(codes.NotFound)
+	require.NoError(t, err, "expected code should not fail the call")
+	assert.Empty(t, res.Body)
+	assert.Equal(t, map[string]interface{}{
+		"code":    "NotFound",
+		"message": "failed with NotFound",
+	}, res.TransportFields)
+
+	_, err = call(codes.Internal)
+	assert.Equal(t, yarpcerrors.CodeInternal, yarpcerrors.FromError(err).Code(), "unexpected error: %v", err)
+
+	_, err = call(codes.OK)
+	require.NoError(t, err)
+
+	stats := client.Stats()
+	require.Len(t, stats, 1)
+	assert.Equal(t, int64(3), stats[0].Calls)
+	assert.Equal(t, int64(1), stats[0].Errors, "only the unexpected code should count as an error")
+}
@@ -0,0 +1,218 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package transport
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/yarpc/yab/ratelimit"
+)
+
+const (
+	defaultProbeConcurrency = 64
+
+	// minSustainedFraction is the fraction of the target QPS that must be
+	// completed within a step for the rate to be considered sustained.
+	minSustainedFraction = 0.9
+)
+
+var (
+	errProbeNoRequest = errors.New("must specify a request to probe with")
+	errProbeQPS       = errors.New("StartQPS, StepQPS and MaxQPS must be positive, with StartQPS at most MaxQPS")
+	errProbeDuration  = errors.New("StepDuration must be positive")
+)
+
+// Criteria configures how FindMaxQPS ramps up load, and the thresholds a
+// rate must stay within to be considered sustainable.
+type Criteria struct {
+	// Request is sent repeatedly at each rate.
+	Request *Request
+
+	// StartQPS is the first rate tried, which is increased by StepQPS after
+	// every sustainable step, up to MaxQPS.
+	StartQPS int
+	StepQPS  int
+	MaxQPS   int
+
+	// StepDuration is how long each rate is sent for.
+	StepDuration time.Duration
+
+	// MaxErrorRate is the highest fraction of calls that can fail. Zero
+	// means no calls can fail.
+	MaxErrorRate float64
+
+	// MaxP99Latency is the highest p99 latency allowed. Zero means latency
+	// is not checked.
+	MaxP99Latency time.Duration
+
+	// Concurrency limits the number of calls in flight. Defaults to 64.
+	Concurrency int
+}
+
+func (c Criteria) validate() error {
+	if c.Request == nil {
+		return errProbeNoRequest
+	}
+	if c.StartQPS <= 0 || c.StepQPS <= 0 || c.MaxQPS <= 0 || c.StartQPS > c.MaxQPS {
+		return errProbeQPS
+	}
+	if c.StepDuration <= 0 {
+		return errProbeDuration
+	}
+	return nil
+}
+
+// qpsStep is the result of sending a fixed rate for one step.
+type qpsStep struct {
+	qps    int
+	calls  int64
+	errors int64
+	p99    time.Duration
+}
+
+// failure returns why the step did not meet target, or an empty string.
+func (s qpsStep) failure(target Criteria) string {
+	if float64(s.calls) < minSustainedFraction*float64(s.qps)*target.StepDuration.Seconds() {
+		return fmt.Sprintf("only completed %v calls", s.calls)
+	}
+	if errorRate := float64(s.errors) / float64(s.calls); errorRate > target.MaxErrorRate {
+		return fmt.Sprintf("error rate %.3f exceeds %.3f", errorRate, target.MaxErrorRate)
+	}
+	if target.MaxP99Latency > 0 && s.p99 > target.MaxP99Latency {
+		return fmt.Sprintf("p99 latency %v exceeds %v", s.p99, target.MaxP99Latency)
+	}
+	return ""
+}
+
+// FindMaxQPS sends target.Request at increasing rates, and returns the
+// highest rate whose calls stayed within the error rate and latency
+// thresholds in target. It fails if even target.StartQPS is not sustainable.
+func (t *grpcTransport) FindMaxQPS(ctx context.Context, target Criteria) (int, error) {
+	if err := target.validate(); err != nil {
+		return 0, err
+	}
+	if target.Concurrency <= 0 {
+		target.Concurrency = defaultProbeConcurrency
+	}
+
+	best := 0
+	for qps := target.StartQPS; qps <= target.MaxQPS; qps += target.StepQPS {
+		step, err := t.runQPSStep(ctx, target, qps)
+		if err != nil {
+			return best, err
+		}
+
+		failure := step.failure(target)
+		t.logger.Info("probed qps",
+			"qps", qps,
+			"calls", step.calls,
+			"errors", step.errors,
+			"p99", step.p99,
+			"sustained", failure == "")
+		if failure != "" {
+			if best == 0 {
+				return 0, fmt.Errorf("could not sustain %v QPS: %v", qps, failure)
+			}
+			return best, nil
+		}
+		best = qps
+	}
+	return best, nil
+}
+
+// runQPSStep sends target.Request at qps for target.StepDuration. The step's
+// calls are counted here rather than read from Stats, which may hold calls
+// made outside the probe.
+func (t *grpcTransport) runQPSStep(ctx context.Context, target Criteria, qps int) (qpsStep, error) {
+	var (
+		wg        sync.WaitGroup
+		mu        sync.Mutex
+		failed    int64
+		latencies []time.Duration
+	)
+	inflight := make(chan struct{}, target.Concurrency)
+	limiter := ratelimit.New(qps)
+	deadline := time.Now().Add(target.StepDuration)
+	for time.Now().Before(deadline) {
+		if !limiter.Take(ctx.Done()) {
+			break
+		}
+		select {
+		case inflight <- struct{}{}:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			break
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-inflight }()
+
+			start := time.Now()
+			res, err := t.Call(ctx, target.Request)
+			latency := time.Since(start)
+			if res != nil {
+				res.Release()
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				failed++
+			}
+			latencies = append(latencies, latency)
+		}()
+	}
+	wg.Wait()
+	if err := ctx.Err(); err != nil {
+		return qpsStep{}, err
+	}
+
+	return qpsStep{
+		qps:    qps,
+		calls:  int64(len(latencies)),
+		errors: failed,
+		p99:    percentile(latencies, 0.99),
+	}, nil
+}
+
+// percentile returns the latency below which the fraction p of latencies fall.
+func percentile(latencies []time.Duration, p float64) time.Duration {
+	if len(latencies) == 0 {
+		return 0
+	}
+	sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+	i := int(float64(len(latencies))*p+0.5) - 1
+	if i < 0 {
+		i = 0
+	}
+	if i >= len(latencies) {
+		i = len(latencies) - 1
+	}
+	return latencies[i]
+}
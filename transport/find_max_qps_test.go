@@ -0,0 +1,159 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package transport
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/yarpc/api/transport"
+)
+
+// capacityLimiter fails calls once more than capacity calls per second
+// arrive, measured over a sliding window.
+type capacityLimiter struct {
+	capacity int
+	window   time.Duration
+
+	mu    sync.Mutex
+	calls []time.Time
+}
+
+func (l *capacityLimiter) allow() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	for len(l.calls) > 0 && now.Sub(l.calls[0]) > l.window {
+		l.calls = l.calls[1:]
+	}
+	l.calls = append(l.calls, now)
+	return float64(len(l.calls)) <= float64(l.capacity)*l.window.Seconds()
+}
+
+func (l *capacityLimiter) reset() {
+	l.mu.Lock()
+	l.calls = nil
+	l.mu.Unlock()
+}
+
+func TestGRPCFindMaxQPS(t *testing.T) {
+	limiter := &capacityLimiter{capacity: 350, window: 200 * time.Millisecond}
+	handler := func(ctx context.Context, request *testBarRequest) (*testBarResponse, error) {
+		if !limiter.allow() {
+			return nil, errors.New("over capacity")
+		}
+		return &testBarResponse{One: request.One}, nil
+	}
+
+	doWithGRPCTestEnvOptions(t, 1, []transport.Procedure{
+		newTestJSONProcedure("example", "Foo::Bar", handler),
+	}, GRPCOptions{Caller: "example-caller"}, func(t *testing.T, grpcTestEnv *grpcTestEnv) {
+		request, err := newTestJSONRequest("example", "Foo::Bar", &testBarRequest{One: "hello"})
+		require.NoError(t, err)
+		client := grpcTestEnv.Transport.(*grpcTransport)
+
+		target := Criteria{
+			Request:      request,
+			StartQPS:     100,
+			StepQPS:      100,
+			MaxQPS:       1000,
+			StepDuration: 500 * time.Millisecond,
+			MaxErrorRate: 0.05,
+		}
+		qps, err := client.FindMaxQPS(context.Background(), target)
+		require.NoError(t, err)
+		assert.Equal(t, 300, qps)
+		for _, stats := range client.Stats() {
+			assert.Empty(t, stats.Labels, "probe steps should not be labeled in Stats")
+		}
+
+		t.Run("start rate not sustainable", func(t *testing.T) {
+			target := target
+			target.StartQPS = 500
+			limiter.reset()
+			_, err := client.FindMaxQPS(context.Background(), target)
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), "could not sustain 500 QPS: error rate")
+		})
+
+		t.Run("stops at max", func(t *testing.T) {
+			target := target
+			target.MaxQPS = 200
+			limiter.reset()
+			qps, err := client.FindMaxQPS(context.Background(), target)
+			require.NoError(t, err)
+			assert.Equal(t, 200, qps)
+		})
+	})
+}
+
+func TestCriteriaValidate(t *testing.T) {
+	valid := Criteria{
+		Request:      &Request{},
+		StartQPS:     10,
+		StepQPS:      10,
+		MaxQPS:       100,
+		StepDuration: time.Second,
+	}
+	assert.NoError(t, valid.validate())
+
+	tests := []struct {
+		msg     string
+		modify  func(*Criteria)
+		wantErr error
+	}{
+		{"no request", func(c *Criteria) { c.Request = nil }, errProbeNoRequest},
+		{"no start", func(c *Criteria) { c.StartQPS = 0 }, errProbeQPS},
+		{"start above max", func(c *Criteria) { c.StartQPS = 200 }, errProbeQPS},
+		{"no step duration", func(c *Criteria) { c.StepDuration = 0 }, errProbeDuration},
+	}
+	for _, tt := range tests {
+		t.Run(tt.msg, func(t *testing.T) {
+			c := valid
+			tt.modify(&c)
+			assert.Equal(t, tt.wantErr, c.validate())
+		})
+	}
+}
+
+func TestQPSStepFailure(t *testing.T) {
+	target := Criteria{StepDuration: time.Second, MaxErrorRate: 0.1, MaxP99Latency: 10 * time.Millisecond}
+	assert.Empty(t, qpsStep{qps: 100, calls: 100, errors: 5, p99: time.Millisecond}.failure(target))
+	assert.Equal(t, "only completed 50 calls", qpsStep{qps: 100, calls: 50}.failure(target))
+	assert.Equal(t, "error rate 0.200 exceeds 0.100", qpsStep{qps: 100, calls: 100, errors: 20}.failure(target))
+	assert.Equal(t, "p99 latency 20ms exceeds 10ms", qpsStep{qps: 100, calls: 100, p99: 20 * time.Millisecond}.failure(target))
+}
+
+func TestPercentile(t *testing.T) {
+	assert.Zero(t, percentile(nil, 0.99))
+	latencies := make([]time.Duration, 100)
+	for i := range latencies {
+		latencies[i] = time.Duration(100-i) * time.Millisecond
+	}
+	assert.Equal(t, 99*time.Millisecond, percentile(latencies, 0.99))
+	assert.Equal(t, 50*time.Millisecond, percentile(latencies, 0.5))
+}
@@ -0,0 +1,158 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package transport
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net"
+	"sync"
+)
+
+var errSendFrameSizeTLS = errors.New("SendFrameSize is not supported with TLS")
+
+const (
+	http2ClientPreface  = "PRI * HTTP/2.0\r\n\r\nSM\r\n\r\n"
+	http2FrameHeaderLen = 9
+	http2FrameTypeData  = 0x0
+	http2FlagEndStream  = 0x1
+	http2FlagPadded     = 0x8
+)
+
+// newFrameSplittingDialer returns a dialFunc that wraps the connections made
+// by dial, or the default dialer if it's nil, to send HTTP/2 DATA frames
+// with payloads of at most size bytes.
+func newFrameSplittingDialer(dial dialFunc, size int) dialFunc {
+	if dial == nil {
+		var dialer net.Dialer
+		dial = dialer.DialContext
+	}
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		conn, err := dial(ctx, network, addr)
+		if err != nil {
+			return nil, err
+		}
+		return &frameSplittingConn{Conn: conn, size: size}, nil
+	}
+}
+
+// frameSplittingConn splits the DATA frames written to an HTTP/2 connection
+// into frames of at most size bytes, so a single message is sent as several
+// frames for the server to reassemble. Connections that don't start with
+// the HTTP/2 client preface, such as gRPC-Web, are left unchanged.
+type frameSplittingConn struct {
+	net.Conn
+
+	size int
+
+	mu          sync.Mutex
+	http2       bool
+	passthrough bool
+	// pending holds the start of a frame that hasn't been fully written.
+	pending []byte
+}
+
+func (c *frameSplittingConn) Write(p []byte) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.passthrough {
+		return c.Conn.Write(p)
+	}
+
+	c.pending = append(c.pending, p...)
+	out := c.splitPending()
+	if len(out) > 0 {
+		if _, err := c.Conn.Write(out); err != nil {
+			return 0, err
+		}
+	}
+	return len(p), nil
+}
+
+// splitPending returns the bytes ready to be written for the complete
+// frames in pending, leaving any partial frame in pending.
+func (c *frameSplittingConn) splitPending() []byte {
+	var out []byte
+	if !c.http2 {
+		preface := []byte(http2ClientPreface)
+		switch {
+		case len(c.pending) < len(preface) && bytes.HasPrefix(preface, c.pending):
+			// Wait for the rest of the preface.
+			return nil
+		case !bytes.HasPrefix(c.pending, preface):
+			c.passthrough = true
+			out, c.pending = c.pending, nil
+			return out
+		}
+		c.http2 = true
+		out = append(out, preface...)
+		c.pending = c.pending[len(preface):]
+	}
+
+	for len(c.pending) >= http2FrameHeaderLen {
+		length := int(c.pending[0])<<16 | int(c.pending[1])<<8 | int(c.pending[2])
+		if len(c.pending) < http2FrameHeaderLen+length {
+			break
+		}
+		frame := c.pending[:http2FrameHeaderLen+length]
+		c.pending = c.pending[len(frame):]
+
+		frameType, flags := frame[3], frame[4]
+		if frameType != http2FrameTypeData || flags&http2FlagPadded != 0 || length <= c.size {
+			out = append(out, frame...)
+			continue
+		}
+		out = appendSplitDataFrame(out, frame, c.size)
+	}
+	// Don't hold on to the buffer of frames that have been written.
+	c.pending = append([]byte(nil), c.pending...)
+	return out
+}
+
+// appendSplitDataFrame appends the DATA frame in frame to out as frames
+// with payloads of at most size bytes. Only the last frame ends the stream
+// if the original frame did.
+func appendSplitDataFrame(out, frame []byte, size int) []byte {
+	flags, streamID := frame[4], frame[5:http2FrameHeaderLen]
+	payload := frame[http2FrameHeaderLen:]
+	for len(payload) > 0 {
+		n := size
+		if n > len(payload) {
+			n = len(payload)
+		}
+		chunkFlags := flags &^ http2FlagEndStream
+		if n == len(payload) {
+			chunkFlags = flags
+		}
+
+		var header [http2FrameHeaderLen]byte
+		header[0], header[1], header[2] = byte(n>>16), byte(n>>8), byte(n)
+		header[3] = http2FrameTypeData
+		header[4] = chunkFlags
+		copy(header[5:], streamID)
+		out = append(out, header[:]...)
+		out = append(out, payload[:n]...)
+		payload = payload[n:]
+	}
+	return out
+}
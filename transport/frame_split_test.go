@@ -0,0 +1,168 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package transport
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/opentracing/opentracing-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/http2"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// writeInChunks writes data to w in chunks of n bytes, so frames are split
+// across writes.
+func writeInChunks(t *testing.T, w io.Writer, data []byte, n int) {
+	for len(data) > 0 {
+		chunk := data
+		if len(chunk) > n {
+			chunk = chunk[:n]
+		}
+		_, err := w.Write(chunk)
+		require.NoError(t, err)
+		data = data[len(chunk):]
+	}
+}
+
+func TestFrameSplittingConn(t *testing.T) {
+	payload := bytes.Repeat([]byte("0123456789"), 1000)
+
+	var stream bytes.Buffer
+	stream.WriteString(http2ClientPreface)
+	framer := http2.NewFramer(&stream, nil)
+	require.NoError(t, framer.WriteSettings())
+	require.NoError(t, framer.WriteData(1, true, payload))
+	require.NoError(t, framer.WritePing(false, [8]byte{1}))
+
+	client, server := net.Pipe()
+	defer server.Close()
+	conn := &frameSplittingConn{Conn: client, size: 1000}
+	go func() {
+		defer conn.Close()
+		writeInChunks(t, conn, stream.Bytes(), 7)
+	}()
+
+	preface := make([]byte, len(http2ClientPreface))
+	_, err := io.ReadFull(server, preface)
+	require.NoError(t, err)
+	assert.Equal(t, http2ClientPreface, string(preface))
+
+	reader := http2.NewFramer(nil, server)
+	frame, err := reader.ReadFrame()
+	require.NoError(t, err)
+	assert.IsType(t, &http2.SettingsFrame{}, frame)
+
+	var (
+		received   []byte
+		dataFrames int
+	)
+	for {
+		frame, err := reader.ReadFrame()
+		require.NoError(t, err)
+		if _, ok := frame.(*http2.PingFrame); ok {
+			break
+		}
+
+		data, ok := frame.(*http2.DataFrame)
+		require.True(t, ok, "unexpected frame %v", frame)
+		dataFrames++
+		assert.Equal(t, uint32(1), data.StreamID)
+		assert.True(t, len(data.Data()) <= 1000, "DATA frame of %v bytes is too large", len(data.Data()))
+		received = append(received, data.Data()...)
+		assert.Equal(t, len(received) == len(payload), data.StreamEnded(), "only the last frame should end the stream")
+	}
+	assert.Equal(t, payload, received)
+	assert.Equal(t, 10, dataFrames)
+}
+
+func TestFrameSplittingConnPassthrough(t *testing.T) {
+	request := []byte("POST /Bar/Baz HTTP/1.1\r\nHost: localhost\r\n\r\n")
+
+	client, server := net.Pipe()
+	defer server.Close()
+	conn := &frameSplittingConn{Conn: client, size: 1}
+	go func() {
+		defer conn.Close()
+		writeInChunks(t, conn, request, 3)
+	}()
+
+	got, err := ioutil.ReadAll(server)
+	require.NoError(t, err)
+	assert.Equal(t, request, got)
+}
+
+func TestGRPCSendFrameSize(t *testing.T) {
+	client, cleanup := newSimpleGRPCClient(t, &codeSvc{}, GRPCOptions{SendFrameSize: 512})
+	defer cleanup()
+
+	// An unknown field large enough to span many frames, which the server
+	// echoes back once it has reassembled the message.
+	body := protowire.AppendTag(nil, 100, protowire.BytesType)
+	body = protowire.AppendBytes(body, bytes.Repeat([]byte{'a'}, 64*1024))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	res, err := client.Call(ctx, &Request{
+		TargetService: "foo",
+		Method:        "Bar::Baz",
+		Timeout:       5 * time.Second,
+		Body:          body,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, body, res.Body)
+}
+
+func TestGRPCSendFrameSizeInvalid(t *testing.T) {
+	tests := []struct {
+		msg     string
+		options GRPCOptions
+		wantErr string
+	}{
+		{
+			msg:     "negative",
+			options: GRPCOptions{SendFrameSize: -1},
+			wantErr: "SendFrameSize must not be negative, got -1",
+		},
+		{
+			msg:     "with TLS",
+			options: GRPCOptions{SendFrameSize: 1024, CAPath: "ca.pem"},
+			wantErr: errSendFrameSizeTLS.Error(),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.msg, func(t *testing.T) {
+			tt.options.Addresses = []string{"127.0.0.1:0"}
+			tt.options.Tracer = opentracing.NoopTracer{}
+			tt.options.Caller = "test"
+			_, err := newGRPC(tt.options)
+			assert.EqualError(t, err, tt.wantErr)
+		})
+	}
+}
@@ -24,30 +24,60 @@ import (
 	"bytes"
 	"crypto/tls"
 	"crypto/x509"
+	"encoding/binary"
 	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
+	"math/rand"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/opentracing/opentracing-go"
+	"github.com/yarpc/yab/protobuf"
+	"github.com/yarpc/yab/ratelimit"
+	"go.opentelemetry.io/otel/propagation"
+	oteltrace "go.opentelemetry.io/otel/trace"
+	"go.uber.org/atomic"
 	"go.uber.org/multierr"
 	apipeer "go.uber.org/yarpc/api/peer"
 	"go.uber.org/yarpc/api/transport"
 	"go.uber.org/yarpc/peer"
 	"go.uber.org/yarpc/peer/hostport"
-	"go.uber.org/yarpc/peer/roundrobin"
 	"go.uber.org/yarpc/transport/grpc"
+	"go.uber.org/yarpc/yarpcerrors"
 	"golang.org/x/net/context"
+	"golang.org/x/oauth2"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
 )
 
 var (
-	errGRPCNoAddresses = errors.New("must specify at least one grpc address")
-	errGRPCNoTracer    = errors.New("must specify grpc tracer")
-	errGRPCNoCaller    = errors.New("must specify grpc caller")
-	errGRPCNoService   = errors.New("must specify grpc service")
-	errGRPCNoProcedure = errors.New("must specify grpc procedure")
+	errGRPCNoAddresses  = errors.New("must specify at least one grpc address")
+	errGRPCNoTracer     = errors.New("must specify grpc tracer")
+	errGRPCNoCaller     = errors.New("must specify grpc caller")
+	errGRPCNoService    = errors.New("must specify grpc service")
+	errGRPCNoProcedure  = errors.New("must specify grpc procedure")
+	errGRPCWebTLS       = errors.New("gRPC-Web auto-detection is not supported with TLS")
+	errRawFrameNoWeb    = errors.New("IncludeRawFrame is only supported for gRPC-Web peers, and requires GRPCWebAutoDetect")
+	errBodyTimeoutNoWeb = errors.New("BodyReadTimeout is only supported for gRPC-Web peers, and requires GRPCWebAutoDetect")
+	errGRPCNoAddress    = errors.New("must specify grpc peer address")
 )
 
+// systemCertPool is used to load the system's trusted roots, and can be
+// replaced in tests.
+var systemCertPool = x509.SystemCertPool
+
+// deadlineHeader is a request header some callers use to set the timeout, in
+// milliseconds, for requests that don't specify one.
+const deadlineHeader = "x-deadline-ms"
+
 // GRPCOptions are used to create a GRPC transport.
 type GRPCOptions struct {
 	Addresses       []string
@@ -60,6 +90,332 @@ type GRPCOptions struct {
 	CAPath          string
 	CertPath        string
 	PrivateKeyPath  string
+
+	// MaxBufferedResponse limits the size of a response body that will be
+	// buffered in memory, independent of MaxResponseSize. Zero means no limit.
+	MaxBufferedResponse int
+
+	// ExpandEnv expands environment variables such as ${SERVICE_HOST} in
+	// Addresses. Referencing an unset variable is an error.
+	ExpandEnv bool
+
+	// Logger is used to log connection events and failed calls.
+	// If nil, nothing is logged.
+	Logger Logger
+
+	// ResponseHeaderAllowlist restricts the response headers returned to
+	// the listed names, compared case-insensitively. If empty, all response
+	// headers are returned.
+	ResponseHeaderAllowlist []string
+
+	// DescriptorProvider is used to look up the protobuf definitions of
+	// called methods, for options that depend on them.
+	DescriptorProvider protobuf.DescriptorProvider
+
+	// TimeoutOption is the fully-qualified name of an integer extension of
+	// google.protobuf.MethodOptions holding a method's timeout in milliseconds.
+	// When set along with DescriptorProvider, it is used as the timeout for
+	// requests that don't specify one.
+	TimeoutOption string
+
+	// TimeoutJitter randomly adjusts each request's timeout by up to this
+	// much in either direction, to avoid synchronized deadline expiries.
+	TimeoutJitter time.Duration
+
+	// FailureThreshold is the number of consecutive failed calls after which
+	// a peer stops receiving requests until Cooldown has passed. Only
+	// failures to reach the peer or get a response from it count, not
+	// errors returned by the server, such as NotFound.
+	// Zero disables this.
+	FailureThreshold int
+
+	// Cooldown is how long a peer is skipped once FailureThreshold is
+	// reached. Defaults to 5 seconds.
+	Cooldown time.Duration
+
+	// FailFastWhenOpen makes calls fail immediately with ErrCircuitOpen
+	// while every peer has been ejected by FailureThreshold, rather than
+	// waiting until a peer is restored or the call times out.
+	FailFastWhenOpen bool
+
+	// TLSMinVersion and TLSMaxVersion restrict the TLS versions used when
+	// TLS is enabled, using the crypto/tls version constants such as
+	// tls.VersionTLS12. TLSMinVersion defaults to TLS 1.2 and
+	// TLSMaxVersion to the highest version supported.
+	TLSMinVersion uint16
+	TLSMaxVersion uint16
+
+	// CipherSuites restricts the cipher suites offered for TLS 1.2 and
+	// earlier, using the crypto/tls cipher suite constants. TLS 1.3 suites
+	// are not configurable. If empty, Go's defaults are used.
+	CipherSuites []uint16
+
+	// MaxQPS limits the rate of unary calls made by the transport across all
+	// goroutines. Zero means no limit.
+	MaxQPS int
+
+	// ResponseBufferPool is a pool of *bytes.Buffer that response bodies are
+	// read into, to reduce allocations. When it is set, callers should call
+	// Release on each Response once they're done with its Body. The pool's
+	// New function must return a *bytes.Buffer.
+	ResponseBufferPool *sync.Pool
+
+	// ShardKeyFunc is called for the shard key of each request that does
+	// not specify one, so calls can be spread across shards.
+	ShardKeyFunc func() string
+
+	// CacheIdempotent serves repeated identical requests to CacheMethods
+	// from a cache of earlier responses instead of calling the server, to
+	// isolate network cost from server compute in benchmarks. This changes
+	// the semantics of calls: the server only sees the first request with a
+	// given service, method and body, so it must only be used for methods
+	// that are idempotent and whose responses don't change.
+	CacheIdempotent bool
+
+	// CacheMethods lists the methods whose responses are cached when
+	// CacheIdempotent is set. Other methods are never cached.
+	CacheMethods []string
+
+	// IncludePeerInResponse sets the PeerAddress of each Response to the
+	// address of the peer that handled the call.
+	IncludePeerInResponse bool
+
+	// GRPCWebAutoDetect checks whether each peer accepts HTTP/2 the first
+	// time it's called, and makes unary calls to peers that only accept
+	// HTTP/1.1 using gRPC-Web. The detected protocol is cached per peer.
+	// It cannot be used with TLS.
+	GRPCWebAutoDetect bool
+
+	// TruncateResponseAt limits response bodies to their first
+	// TruncateResponseAt bytes, discarding the rest and setting Truncated on
+	// the Response. Zero means bodies are read fully.
+	TruncateResponseAt int
+
+	// TokenSource, if set, is used to get an OAuth2 token for each call,
+	// which is sent in the authorization header. Tokens are reused until
+	// they expire.
+	TokenSource oauth2.TokenSource
+
+	// Signer, if set, is called with the serialized body of each unary
+	// request, and returns headers such as a signature to add to the
+	// request. An error from Signer fails the call.
+	Signer func(body []byte) (map[string]string, error)
+
+	// UseSystemCertPool adds the CA from CAPath to the system's trusted
+	// roots, rather than trusting only that CA. If the system roots can't
+	// be loaded, only the CA from CAPath is trusted.
+	UseSystemCertPool bool
+
+	// DisableIdleReconnect stops calls to a peer whose connection was
+	// closed, such as by a server with a short idle timeout, from waiting
+	// for a new connection before the request is sent, and stops unary
+	// calls that fail because their connection closed from being retried
+	// once. Calls that may have reached the server before their connection
+	// closed are only retried if they have an idempotency key, so
+	// non-idempotent calls aren't made twice.
+	DisableIdleReconnect bool
+
+	// DeadlineHeader, if set, is a request header that the deadline of each
+	// unary call is sent in, in addition to grpc-timeout, for servers that
+	// read the deadline from a custom header.
+	DeadlineHeader string
+
+	// DeadlineHeaderFormat is the format of the DeadlineHeader value, one of
+	// "epoch-millis" (the default), "epoch-seconds" or "rfc3339".
+	DeadlineHeaderFormat string
+
+	// IncludeRawFrame sets the RawFrame of each Response from a gRPC-Web
+	// peer to the response message frame as it was received, to debug
+	// compression and framing issues. Native gRPC responses are decoded
+	// before the transport sees them, so this requires GRPCWebAutoDetect.
+	IncludeRawFrame bool
+
+	// RequestBodyPool is a pool of *bytes.Reader used to pass request
+	// bodies to the outbound, to avoid allocating a reader for every unary
+	// call at high QPS. Readers are returned to the pool once the call
+	// completes. The pool's New function must return a *bytes.Reader.
+	RequestBodyPool *sync.Pool
+
+	// RoutingDelegateSplit splits calls across routing delegates, such as
+	// {"v1": 90, "v2": 10}, picking the delegate for each call at random in
+	// proportion to its weight. It cannot be used with RoutingDelegate.
+	RoutingDelegateSplit map[string]int
+
+	// Resolver, if set, is used to look up the addresses of peers that are
+	// specified by host name, instead of the system resolver.
+	Resolver Resolver
+
+	// InjectLatency delays each unary call by this long before it's sent,
+	// to simulate a slow network. The delay counts towards the call's
+	// timeout, and the call fails if its context ends during the delay.
+	InjectLatency time.Duration
+
+	// MaxConcurrentStreams limits how many streams opened by CallStream can
+	// be open at once. A stream stays open until it's closed, a receive on
+	// it fails or its context ends. By default, streams are unlimited.
+	MaxConcurrentStreams int
+
+	// FailOnMaxConcurrentStreams makes CallStream fail immediately with
+	// ResourceExhausted when MaxConcurrentStreams streams are open, instead
+	// of waiting for one of them to close.
+	FailOnMaxConcurrentStreams bool
+
+	// ChecksumTrailer, if set, is a trailer that the server sends a hex
+	// encoded checksum of each unary response body in. Responses are
+	// verified against it, and fail with a *ChecksumMismatchError if they
+	// differ. Truncated responses are not verified.
+	ChecksumTrailer string
+
+	// ChecksumAlgorithm is the algorithm used for ChecksumTrailer, one of
+	// "crc32" (the default) or "sha256".
+	ChecksumAlgorithm string
+
+	// GenerateIdempotencyKeys sends a random UUID in the IdempotencyKeyHeader
+	// header of each unary call that doesn't set Request.IdempotencyKey. The
+	// same key is sent if the call is retried.
+	GenerateIdempotencyKeys bool
+
+	// OnConnect and OnDisconnect, if set, are called with the address of a
+	// peer when a connection to it is established or lost. They're called in
+	// order from a dedicated goroutine, so they don't block the transport.
+	OnConnect    func(addr string)
+	OnDisconnect func(addr string)
+
+	// RetryableCodes are the names of gRPC codes, such as "UNAVAILABLE" or
+	// "ABORTED", that unary calls are retried once on, in the same way as
+	// calls whose connection was closed.
+	RetryableCodes []string
+
+	// HedgeAfter, if set, sends another copy of a unary call to one of
+	// HedgeMethods whenever it has gone this long without a response,
+	// using the first successful response and cancelling the other copies.
+	// Hedging should only be used for idempotent methods.
+	HedgeAfter time.Duration
+
+	// MaxHedges is the most copies sent for each call in addition to the
+	// first, which defaults to 1.
+	MaxHedges int
+
+	// HedgeMethods lists the methods whose calls are hedged when HedgeAfter
+	// is set. Other methods are never hedged.
+	HedgeMethods []string
+
+	// ExpectedCodes are codes that unary calls are expected to fail with,
+	// such as NotFound in negative tests. Calls that fail with one of them
+	// return a Response instead of an error, and count as successes in
+	// Stats. The code and message are in the "code" and "message"
+	// TransportFields of the Response.
+	ExpectedCodes []codes.Code
+
+	// BodyReadTimeout, if set, bounds how long reading the body of a unary
+	// response from a gRPC-Web peer can take, separately from the call's
+	// timeout, so a server that responds quickly but sends its body slowly
+	// can be detected. It requires GRPCWebAutoDetect, since native gRPC
+	// responses are fully read before they're returned.
+	BodyReadTimeout time.Duration
+
+	// Balancer is how calls are spread across peers, RoundRobin by default.
+	Balancer BalancerType
+
+	// CADir is a directory of trusted CAs, one per .pem or .crt file, such
+	// as /etc/ssl/certs. Files that don't hold a certificate are skipped
+	// with a warning. It can be used instead of, or as well as, CAPath.
+	CADir string
+
+	// SendFrameSize, if set, splits each HTTP/2 DATA frame sent into frames
+	// of at most this many bytes, so a message is sent as several frames,
+	// exercising the server's reassembly. It isn't supported with TLS.
+	SendFrameSize int
+
+	// PeerAffinity, if set, chooses the peer for each call based on its
+	// shard key, overriding Balancer for calls it picks a peer for.
+	PeerAffinity PeerAffinity
+
+	// PriorityHeader is the request header that the priority of each call
+	// is sent in, DefaultPriorityHeader if empty.
+	PriorityHeader string
+
+	// Priority is the priority of calls that don't set Request.Priority.
+	// Calls without a priority don't send the priority header.
+	Priority int
+
+	// MaxPriority is the highest priority allowed, DefaultMaxPriority if
+	// zero. Priorities must be between 0 and MaxPriority.
+	MaxPriority int
+
+	// TimeoutLatencyMultiplier, if set, sets the timeout of calls that
+	// don't have one from the request, a header or the method to this
+	// multiple of the p99 latency of the most recent calls, so slow periods
+	// don't cause cascading timeouts. Calls that time out aren't counted.
+	// The default timeout is used until a call has been made.
+	TimeoutLatencyMultiplier float64
+
+	// TimeoutLatencyFloor is the lowest timeout set by
+	// TimeoutLatencyMultiplier.
+	TimeoutLatencyFloor time.Duration
+
+	// TimeoutLatencyMax is the highest timeout set by
+	// TimeoutLatencyMultiplier, 30 seconds if zero.
+	TimeoutLatencyMax time.Duration
+
+	// OTelTracer, if set, creates an OpenTelemetry span for each unary call,
+	// whose context is injected into the request headers by OTelPropagator.
+	// Tracer isn't required when OTelTracer is set.
+	OTelTracer oteltrace.Tracer
+
+	// OTelPropagator injects the OTelTracer span context into requests,
+	// using W3C trace context (traceparent) headers if it's not set.
+	OTelPropagator propagation.TextMapPropagator
+
+	// CoalesceIdempotent makes identical unary calls to CoalesceMethods
+	// that are made while one of them is in flight share its result,
+	// rather than each calling the server. Calls are identical if they have
+	// the same service, method and body, even if their headers differ.
+	// This changes the semantics of calls: the server sees one request for
+	// each group of concurrent calls, which all fail if it fails, including
+	// because the first call's context was cancelled. It must only be used
+	// for idempotent methods.
+	CoalesceIdempotent bool
+
+	// CoalesceMethods lists the methods whose calls are coalesced when
+	// CoalesceIdempotent is set. Other methods are never coalesced.
+	CoalesceMethods []string
+
+	// SRVName, if set, is a DNS SRV name such as "_grpc._tcp.service.local"
+	// that is looked up when the transport is created, adding the targets
+	// of its records to Addresses. Only the records with the lowest
+	// priority are used, ordered by decreasing weight.
+	SRVName string
+
+	// SRVResolver looks up SRVName, using net.DefaultResolver if nil.
+	SRVResolver SRVResolver
+
+	// SRVRefreshInterval, if set, looks up SRVName again this often, adding
+	// and removing peers to match its records. If a lookup fails, the
+	// peers are left unchanged.
+	SRVRefreshInterval time.Duration
+
+	// PeerDrainTimeout is how long the connections of a removed peer are
+	// kept open for the calls still in progress to it. Defaults to 10
+	// seconds.
+	PeerDrainTimeout time.Duration
+
+	// HeadersFile, if set, is a JSON or YAML file mapping header names to
+	// values that is loaded when the transport is created. The headers are
+	// added to every call, unless the request sets a header with the same
+	// name. Values may reference variables such as ${region} or
+	// ${region:west}, which are looked up in HeadersFileVars, and in the
+	// environment if ExpandEnv is set.
+	HeadersFile string
+
+	// HeadersFileVars are the variables that values in HeadersFile can
+	// reference.
+	HeadersFileVars map[string]string
+
+	// NormalizeEmptyBody makes the Body of every response without any
+	// data a non-nil, empty slice. By default, Body is nil if the response
+	// has no body, but an empty slice if it has an empty body.
+	NormalizeEmptyBody bool
 }
 
 // NewGRPC returns a transport that calls a GRPC service.
@@ -76,18 +432,163 @@ type grpcTransport struct {
 	RoutingKey      string
 	RoutingDelegate string
 	tracer          opentracing.Tracer
+	logger          Logger
+
+	maxBufferedResponse int
+	responseHeaders     map[string]struct{}
+	methodTimeouts      *methodTimeouts
+	timeoutJitter       time.Duration
+
+	randMu sync.Mutex
+	rand   *rand.Rand
+
+	limiter      ratelimit.Limiter
+	bufPool      *sync.Pool
+	shardKeyFunc func() string
+	cache        *responseCache
+	includePeer  bool
+	web          *grpcWebDetector
+	stats        *callStats
+
+	truncateResponseAt int
+	tokenSource        oauth2.TokenSource
+	signer             func(body []byte) (map[string]string, error)
+	peerList           apipeer.ChooserList
+	peers              *observedPeerTransport
+	expandEnv          bool
+	idleReconnect      bool
+	deadlineHeader     string
+	formatDeadline     func(time.Time) string
+	includeRawFrame    bool
+	bodyPool           *sync.Pool
+	delegateSplit      *delegateSplit
+	injectLatency      time.Duration
+	streamLimiter      *streamLimiter
+	checksum           *responseChecksum
+
+	generateIdempotencyKeys bool
+	notifier                *connectionNotifier
+	retryableCodes          map[codes.Code]struct{}
+	hedge                   *hedgePolicy
+	expectedCodes           map[codes.Code]struct{}
+	bodyReadTimeout         time.Duration
+	connTimings             *connectionTimings
+	priority                priorityPolicy
+
+	latencyTimeout     *latencyTimeout
+	otelTracer         oteltrace.Tracer
+	otelPropagator     propagation.TextMapPropagator
+	coalescer          *callCoalescer
+	srv                *srvRefresher
+	fileHeaders        map[string]string
+	normalizeEmptyBody bool
+	customEncoding     *CustomEncoding
+
+	gate callGate
 }
 
 func newGRPC(options GRPCOptions) (*grpcTransport, error) {
-	if len(options.Addresses) == 0 {
+	if len(options.Addresses) == 0 && options.SRVName == "" {
 		return nil, errGRPCNoAddresses
 	}
 	if options.Tracer == nil {
-		return nil, errGRPCNoTracer
+		if options.OTelTracer == nil {
+			return nil, errGRPCNoTracer
+		}
+		options.Tracer = opentracing.NoopTracer{}
+	}
+	if options.OTelPropagator == nil {
+		options.OTelPropagator = propagation.TraceContext{}
 	}
 	if options.Caller == "" {
 		return nil, errGRPCNoCaller
 	}
+	if err := validateGRPCEncoding(options.Encoding); err != nil {
+		return nil, err
+	}
+	customEncoding := lookupCustomGRPCEncoding(options.Encoding)
+	if err := validatePool("ResponseBufferPool", options.ResponseBufferPool, (*bytes.Buffer)(nil)); err != nil {
+		return nil, err
+	}
+	if err := validatePool("RequestBodyPool", options.RequestBodyPool, (*bytes.Reader)(nil)); err != nil {
+		return nil, err
+	}
+	if options.GRPCWebAutoDetect && options.hasCA() {
+		return nil, errGRPCWebTLS
+	}
+	if options.IncludeRawFrame && !options.GRPCWebAutoDetect {
+		return nil, errRawFrameNoWeb
+	}
+	if options.BodyReadTimeout > 0 && !options.GRPCWebAutoDetect {
+		return nil, errBodyTimeoutNoWeb
+	}
+	if options.SendFrameSize < 0 {
+		return nil, fmt.Errorf("SendFrameSize must not be negative, got %v", options.SendFrameSize)
+	}
+	if options.SendFrameSize > 0 && options.hasCA() {
+		return nil, errSendFrameSizeTLS
+	}
+	formatDeadline, err := newDeadlineFormatter(options.DeadlineHeader, options.DeadlineHeaderFormat)
+	if err != nil {
+		return nil, err
+	}
+	if options.RoutingDelegate != "" && len(options.RoutingDelegateSplit) > 0 {
+		return nil, errRoutingDelegateSplitConflict
+	}
+	delegateSplit, err := newDelegateSplit(options.RoutingDelegateSplit)
+	if err != nil {
+		return nil, err
+	}
+	checksum, err := newResponseChecksum(options.ChecksumTrailer, options.ChecksumAlgorithm)
+	if err != nil {
+		return nil, err
+	}
+	retryableCodes, err := parseGRPCCodes(options.RetryableCodes)
+	if err != nil {
+		return nil, err
+	}
+	newPeerList, err := newBalancer(options.Balancer, options.PeerAffinity)
+	if err != nil {
+		return nil, err
+	}
+	latencyTimeout, err := newLatencyTimeout(options.TimeoutLatencyMultiplier, options.TimeoutLatencyFloor, options.TimeoutLatencyMax)
+	if err != nil {
+		return nil, err
+	}
+	priority, err := newPriorityPolicy(options.PriorityHeader, options.Priority, options.MaxPriority)
+	if err != nil {
+		return nil, err
+	}
+	var fileHeaders map[string]string
+	if options.HeadersFile != "" {
+		fileHeaders, err = loadHeadersFile(options.HeadersFile, headersFileResolver(options.HeadersFileVars, options.ExpandEnv))
+		if err != nil {
+			return nil, err
+		}
+	}
+	addresses := options.Addresses
+	if options.ExpandEnv {
+		if addresses, err = expandAddresses(addresses); err != nil {
+			return nil, err
+		}
+	}
+	staticAddresses := addresses
+	srvResolver := options.SRVResolver
+	if srvResolver == nil {
+		srvResolver = net.DefaultResolver
+	}
+	var srvPeers []string
+	if options.SRVName != "" {
+		if srvPeers, err = lookupSRVPeers(srvResolver, options.SRVName); err != nil {
+			return nil, err
+		}
+		addresses = appendNewAddresses(addresses, srvPeers)
+	}
+
+	logger := options.Logger
+	if logger == nil {
+		logger = nopLogger{}
+	}
 
 	transportOptions := []grpc.TransportOption{grpc.Tracer(options.Tracer)}
 	if options.MaxResponseSize > 0 {
@@ -95,44 +596,77 @@ func newGRPC(options GRPCOptions) (*grpcTransport, error) {
 	}
 
 	transport := grpc.NewTransport(transportOptions...)
-	var peerTransport apipeer.Transport = transport
-	if options.CAPath != "" && options.CertPath != "" && options.PrivateKeyPath != "" {
-		ca, err := ioutil.ReadFile(options.CAPath)
-		if err != nil {
-			return nil, fmt.Errorf("could not load ca %v", err)
-		}
-
-		certPool := x509.NewCertPool()
-		if !certPool.AppendCertsFromPEM(ca) {
-			return nil, errors.New("failed to append ca")
-		}
-
-		clientCert, err := tls.LoadX509KeyPair(options.CertPath, options.PrivateKeyPath)
+	connTimings := newConnectionTimings()
+	var dialOptions []grpc.DialOption
+	useTLS := options.hasCA() && options.CertPath != "" && options.PrivateKeyPath != ""
+	if useTLS {
+		tlsConfig, err := newTLSConfig(options, logger)
 		if err != nil {
-			return nil, fmt.Errorf("failed to load X509 keypair %v", err)
-		}
-
-		dialOptions := []grpc.DialOption{
-			grpc.DialerTLSConfig(&tls.Config{
-				RootCAs:            certPool,
-				Certificates:       []tls.Certificate{clientCert},
-				InsecureSkipVerify: true,
-			}),
+			return nil, err
 		}
-
-		peerTransport = transport.NewDialer(dialOptions...)
+		// The TLS credentials are wrapped, rather than using
+		// DialerTLSConfig, so that handshakes can be timed.
+		creds := newTimingCredentials(credentials.NewTLS(tlsConfig), connTimings)
+		dialOptions = append(dialOptions, grpc.DialerCredentials(creds))
+	}
+	dial := newTimingDialer(options.Resolver, useTLS, connTimings)
+	if options.SendFrameSize > 0 {
+		dial = newFrameSplittingDialer(dial, options.SendFrameSize)
+	}
+	dialOptions = append(dialOptions, grpc.ContextDialer(func(ctx context.Context, addr string) (net.Conn, error) {
+		return dial(ctx, "tcp", addr)
+	}))
+	peerTransport := transport.NewDialer(dialOptions...)
+	notifier := newConnectionNotifier(options.OnConnect, options.OnDisconnect)
+	observedPeers := newObservedPeerTransport(peerTransport, logger, notifier, options.PeerDrainTimeout)
+	var peerList apipeer.ChooserList = reconnectingList{newPeerList(observedPeers), options.DisableIdleReconnect}
+	peerList = drainingList{peerList, observedPeers}
+	if options.FailureThreshold > 0 {
+		peerList = newCircuitBreakerList(peerList, options.FailureThreshold, options.Cooldown, options.FailFastWhenOpen, logger)
+	}
+	if options.IncludePeerInResponse {
+		peerList = peerRecordingList{peerList}
 	}
-	outbound := transport.NewOutbound(peer.Bind(roundrobin.New(peerTransport), peer.BindPeers(peersToIdentifiers(options.Addresses))))
+	outbound := transport.NewOutbound(peer.Bind(peerList, peer.BindPeers(peersToIdentifiers(addresses))))
 
 	if err := transport.Start(); err != nil {
+		notifier.close()
 		return nil, err
 	}
 	if err := outbound.Start(); err != nil {
 		_ = transport.Stop()
+		notifier.close()
 		return nil, err
 	}
+	logger.Info("started grpc transport", "addresses", addresses)
+
+	limiter := ratelimit.NewInfinite()
+	if options.MaxQPS > 0 {
+		limiter = ratelimit.New(options.MaxQPS)
+	}
+
+	var web *grpcWebDetector
+	if options.GRPCWebAutoDetect {
+		// Probes shouldn't be included in the connection timings.
+		web = newGRPCWebDetector(addresses, newResolvingDialer(options.Resolver), logger)
+	}
+
+	var tokenSource oauth2.TokenSource
+	if options.TokenSource != nil {
+		tokenSource = oauth2.ReuseTokenSource(nil, options.TokenSource)
+	}
+
+	var cache *responseCache
+	if options.CacheIdempotent {
+		cache = newResponseCache(options.CacheMethods)
+	}
+
+	var coalescer *callCoalescer
+	if options.CoalesceIdempotent {
+		coalescer = newCallCoalescer(options.CoalesceMethods)
+	}
 
-	return &grpcTransport{
+	t := &grpcTransport{
 		Transport:       transport,
 		Outbound:        outbound,
 		StreamOutbound:  outbound,
@@ -141,9 +675,199 @@ func newGRPC(options GRPCOptions) (*grpcTransport, error) {
 		RoutingKey:      options.RoutingKey,
 		RoutingDelegate: options.RoutingDelegate,
 		tracer:          options.Tracer,
+		logger:          logger,
+
+		maxBufferedResponse: options.MaxBufferedResponse,
+		responseHeaders:     headerSet(options.ResponseHeaderAllowlist),
+		methodTimeouts:      newMethodTimeouts(options.DescriptorProvider, options.TimeoutOption, logger),
+		timeoutJitter:       options.TimeoutJitter,
+		rand:                rand.New(rand.NewSource(time.Now().UnixNano())),
+		limiter:             limiter,
+		bufPool:             options.ResponseBufferPool,
+		shardKeyFunc:        options.ShardKeyFunc,
+		cache:               cache,
+		includePeer:         options.IncludePeerInResponse,
+		web:                 web,
+		stats:               newCallStats(),
+		truncateResponseAt:  options.TruncateResponseAt,
+		tokenSource:         tokenSource,
+		signer:              options.Signer,
+		peerList:            peerList,
+		peers:               observedPeers,
+		expandEnv:           options.ExpandEnv,
+		idleReconnect:       !options.DisableIdleReconnect,
+		deadlineHeader:      options.DeadlineHeader,
+		formatDeadline:      formatDeadline,
+		includeRawFrame:     options.IncludeRawFrame,
+		bodyPool:            options.RequestBodyPool,
+		delegateSplit:       delegateSplit,
+		injectLatency:       options.InjectLatency,
+		streamLimiter:       newStreamLimiter(options.MaxConcurrentStreams, options.FailOnMaxConcurrentStreams),
+		checksum:            checksum,
+
+		generateIdempotencyKeys: options.GenerateIdempotencyKeys,
+		notifier:                notifier,
+		retryableCodes:          retryableCodes,
+		hedge:                   newHedgePolicy(options.HedgeAfter, options.MaxHedges, options.HedgeMethods),
+		expectedCodes:           codeSet(options.ExpectedCodes),
+		bodyReadTimeout:         options.BodyReadTimeout,
+		connTimings:             connTimings,
+		priority:                priority,
+
+		latencyTimeout:     latencyTimeout,
+		otelTracer:         options.OTelTracer,
+		otelPropagator:     options.OTelPropagator,
+		coalescer:          coalescer,
+		fileHeaders:        fileHeaders,
+		normalizeEmptyBody: options.NormalizeEmptyBody,
+		customEncoding:     customEncoding,
+	}
+	if options.SRVName != "" && options.SRVRefreshInterval > 0 {
+		t.srv = newSRVRefresher(srvResolver, options.SRVName, options.SRVRefreshInterval, staticAddresses, srvPeers)
+		go t.srv.run(t, logger)
+	}
+	return t, nil
+}
+
+// ValidateTLS loads the CA, certificate and private key in options and
+// checks the TLS settings as NewGRPC would, without starting a transport.
+// It returns the same errors as NewGRPC, and fails if any of CAPath (or
+// CADir), CertPath and PrivateKeyPath is missing, since NewGRPC would then
+// silently not use TLS.
+func ValidateTLS(options GRPCOptions) error {
+	var missing []string
+	ca := options.CAPath
+	if ca == "" {
+		ca = options.CADir
+	}
+	for _, path := range []struct{ name, value string }{
+		{"CAPath", ca},
+		{"CertPath", options.CertPath},
+		{"PrivateKeyPath", options.PrivateKeyPath},
+	} {
+		if path.value == "" {
+			missing = append(missing, path.name)
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("TLS requires CAPath, CertPath and PrivateKeyPath, missing %v", strings.Join(missing, ", "))
+	}
+
+	logger := options.Logger
+	if logger == nil {
+		logger = nopLogger{}
+	}
+	_, err := newTLSConfig(options, logger)
+	return err
+}
+
+func newTLSConfig(options GRPCOptions, logger Logger) (*tls.Config, error) {
+	minVersion := options.TLSMinVersion
+	if minVersion == 0 {
+		minVersion = tls.VersionTLS12
+	}
+	if options.TLSMaxVersion != 0 && minVersion > options.TLSMaxVersion {
+		return nil, fmt.Errorf("TLS min version %#x is greater than max version %#x", minVersion, options.TLSMaxVersion)
+	}
+	if err := validateCipherSuites(options.CipherSuites); err != nil {
+		return nil, err
+	}
+
+	certPool := x509.NewCertPool()
+	if options.UseSystemCertPool {
+		if systemPool, err := systemCertPool(); err != nil {
+			logger.Warn("could not load system cert pool, only trusting the custom CA", "error", err)
+		} else {
+			certPool = systemPool
+		}
+	}
+	if options.CAPath != "" {
+		ca, err := ioutil.ReadFile(options.CAPath)
+		if err != nil {
+			return nil, fmt.Errorf("could not load ca %v", err)
+		}
+		if !certPool.AppendCertsFromPEM(ca) {
+			return nil, errors.New("failed to append ca")
+		}
+	}
+	if options.CADir != "" {
+		if err := appendCADir(certPool, options.CADir, logger); err != nil {
+			return nil, err
+		}
+	}
+
+	clientCert, err := tls.LoadX509KeyPair(options.CertPath, options.PrivateKeyPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load X509 keypair %v", err)
+	}
+
+	// Servers are verified against certPool, and the name they were dialed
+	// by, which gRPC sets as the ServerName.
+	return &tls.Config{
+		RootCAs:      certPool,
+		Certificates: []tls.Certificate{clientCert},
+		MinVersion:   minVersion,
+		MaxVersion:   options.TLSMaxVersion,
+		CipherSuites: options.CipherSuites,
 	}, nil
 }
 
+// hasCA returns whether options set a CA to trust, which is required to
+// use TLS.
+func (o GRPCOptions) hasCA() bool {
+	return o.CAPath != "" || o.CADir != ""
+}
+
+// appendCADir adds the certificates in every .pem and .crt file in dir to
+// pool, skipping files that don't hold any.
+func appendCADir(pool *x509.CertPool, dir string, logger Logger) error {
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return fmt.Errorf("could not load ca dir %v", err)
+	}
+
+	var loaded int
+	for _, entry := range entries {
+		ext := strings.ToLower(filepath.Ext(entry.Name()))
+		if entry.IsDir() || (ext != ".pem" && ext != ".crt") {
+			continue
+		}
+
+		path := filepath.Join(dir, entry.Name())
+		ca, err := ioutil.ReadFile(path)
+		if err != nil {
+			logger.Warn("skipping unreadable file in ca dir", "file", path, "error", err)
+			continue
+		}
+		if !pool.AppendCertsFromPEM(ca) {
+			logger.Warn("skipping file in ca dir without a certificate", "file", path)
+			continue
+		}
+		loaded++
+	}
+	if loaded == 0 {
+		return fmt.Errorf("no ca certificates found in %v", dir)
+	}
+	return nil
+}
+
+func validateCipherSuites(suites []uint16) error {
+	if len(suites) == 0 {
+		return nil
+	}
+
+	known := make(map[uint16]struct{})
+	for _, s := range append(tls.CipherSuites(), tls.InsecureCipherSuites()...) {
+		known[s.ID] = struct{}{}
+	}
+	for _, id := range suites {
+		if _, ok := known[id]; !ok {
+			return fmt.Errorf("unknown TLS cipher suite %#04x", id)
+		}
+	}
+	return nil
+}
+
 func (t *grpcTransport) Tracer() opentracing.Tracer {
 	return t.tracer
 }
@@ -152,29 +876,409 @@ func (t *grpcTransport) Protocol() Protocol {
 	return GRPC
 }
 
-func (t *grpcTransport) Call(ctx context.Context, request *Request) (*Response, error) {
+func (t *grpcTransport) Call(ctx context.Context, request *Request) (res *Response, err error) {
 	if request.TargetService == "" {
 		return nil, errGRPCNoService
 	}
 	if request.Method == "" {
 		return nil, errGRPCNoProcedure
 	}
+	// Time spent paused doesn't count towards the call's latency.
+	if err := t.gate.wait(ctx); err != nil {
+		return nil, err
+	}
+	labels := labelsFromContext(ctx)
+	requestBytes := len(request.Body)
+	start := time.Now()
+	defer func() {
+		result := callResult{
+			requestBytes: requestBytes,
+			latency:      time.Since(start),
+			err:          err,
+		}
+		if res != nil {
+			result.responseBytes = len(res.Body)
+		}
+		t.stats.record(labels, result)
+		t.latencyTimeout.record(result.latency, err)
+	}()
+
+	var (
+		cacheKey  responseCacheKey
+		cacheable bool
+	)
+	if t.cache != nil {
+		if cacheKey, cacheable = t.cache.key(request); cacheable {
+			if res, ok := t.cache.get(cacheKey); ok {
+				return res, nil
+			}
+		}
+	}
+
+	if key, ok := t.coalescer.key(request); ok {
+		res, err = t.coalescer.do(ctx, key, func() (*Response, error) {
+			return t.call(ctx, request)
+		})
+	} else {
+		res, err = t.call(ctx, request)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if cacheable {
+		t.cache.put(cacheKey, res)
+	}
+	return res, nil
+}
+
+// call makes a unary call after Call has checked the request and the cache.
+func (t *grpcTransport) call(ctx context.Context, request *Request) (res *Response, err error) {
+	if !t.limiter.Take(ctx.Done()) {
+		return nil, ctx.Err()
+	}
+	if request, err = t.prepareRequest(request); err != nil {
+		return nil, err
+	}
 
-	ctx, cancel := requestContextWithTimeout(ctx, request)
+	ctx, cancel, err := t.requestContextWithTimeout(ctx, request)
+	if err != nil {
+		return nil, err
+	}
 	defer cancel()
-	transportResponse, err := t.Outbound.Call(ctx, t.requestToYARPCRequest(request))
+	ctx, finishSpan := withSampling(ctx, t.tracer, request)
+	defer finishSpan()
+	ctx, request, finishOTelSpan := t.withOTelSpan(ctx, request)
+	defer func() { finishOTelSpan(err) }()
+	if deadline, ok := ctx.Deadline(); ok && t.formatDeadline != nil {
+		request = withHeaders(request, map[string]string{t.deadlineHeader: t.formatDeadline(deadline)})
+	}
+	if err := sleepCtx(ctx, t.injectLatency); err != nil {
+		return nil, err
+	}
+
+	if addr, ok := t.webPeer(ctx); ok {
+		res, err = t.callWeb(ctx, addr, request)
+		if err == nil && t.includePeer {
+			res.PeerAddress = addr
+		}
+	} else if t.hedge.allows(request) {
+		res, err = t.callHedged(ctx, request)
+	} else {
+		res, err = t.callYARPC(ctx, request)
+		if err != nil && t.shouldRetry(request, err) {
+			t.logger.Info("retrying failed grpc call",
+				"service", request.TargetService,
+				"procedure", request.Method,
+				"error", err)
+			res, err = t.callYARPC(ctx, request)
+		}
+	}
+	if err != nil {
+		err = wrapStreamReset(err)
+		if res, ok := t.expectedCodeResponse(err); ok {
+			t.logger.Debug("grpc call failed with expected code",
+				"service", request.TargetService,
+				"procedure", request.Method,
+				"code", res.TransportFields["code"])
+			return res, nil
+		}
+		t.logger.Error("grpc call failed",
+			"service", request.TargetService,
+			"procedure", request.Method,
+			"code", yarpcerrors.FromError(err).Code().String(),
+			"error", err)
+		return nil, err
+	}
+	if err := t.decodeResponseBody(res); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// prepareRequest returns request with the body encoding and headers that
+// are added to every unary call before its context is set up.
+func (t *grpcTransport) prepareRequest(request *Request) (*Request, error) {
+	request = t.withFileHeaders(request)
+	request, err := t.encodeRequestBody(request)
+	if err != nil {
+		return nil, err
+	}
+	if request, err = t.withIdempotencyKey(request); err != nil {
+		return nil, err
+	}
+	if request, err = t.priority.withPriority(request); err != nil {
+		return nil, err
+	}
+	if request, err = t.authorize(request); err != nil {
+		return nil, err
+	}
+	return t.sign(request)
+}
+
+func (t *grpcTransport) callYARPC(ctx context.Context, request *Request) (*Response, error) {
+	var peerRecord *atomic.String
+	if t.includePeer {
+		ctx, peerRecord = withPeerRecord(ctx)
+	}
+	yarpcRequest := t.requestToYARPCRequest(request)
+	body := t.requestBody(request.Body)
+	defer t.releaseRequestBody(body)
+	yarpcRequest.Body = body
+	transportResponse, err := t.Outbound.Call(ctx, yarpcRequest)
 	if err != nil {
 		return nil, err
 	}
-	return yarpcResponseToResponse(transportResponse)
+	res, err := t.yarpcResponseToResponse(transportResponse)
+	if err != nil {
+		return nil, err
+	}
+	if peerRecord != nil {
+		res.PeerAddress = peerRecord.Load()
+	}
+	return res, nil
+}
+
+// unsentConnectionMessages are in the messages gRPC fails calls with when
+// their connection was closed or couldn't be made before the request was
+// sent, so the server can't have seen it.
+var unsentConnectionMessages = []string{
+	"transport is closing",
+	"connection refused",
+}
+
+// lostConnectionMessages are the start of the messages gRPC fails calls with
+// when their connection is closed after the request may have been sent.
+var lostConnectionMessages = []string{
+	"error reading from server",
+	"connection error",
+}
+
+// sleepCtx waits for d, returning early with the context's error if ctx ends
+// first.
+func sleepCtx(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// connectionClosed returns whether err is from the connection a call was
+// sent on being closed, such as when a server drops an idle connection just
+// as a request is written to it, and whether the request may have reached
+// the server before it was.
+func connectionClosed(err error) (closed, maybeSent bool) {
+	status := yarpcerrors.FromError(err)
+	if status.Code() != yarpcerrors.CodeUnavailable {
+		return false, false
+	}
+	for _, msg := range unsentConnectionMessages {
+		if strings.Contains(status.Message(), msg) {
+			return true, false
+		}
+	}
+	for _, prefix := range lostConnectionMessages {
+		if strings.HasPrefix(status.Message(), prefix) {
+			return true, true
+		}
+	}
+	return false, false
+}
+
+// webPeer returns the peer to call using gRPC-Web, if auto-detection is
+// enabled and the next peer doesn't support native gRPC.
+func (t *grpcTransport) webPeer(ctx context.Context) (string, bool) {
+	if t.web == nil {
+		return "", false
+	}
+	return t.web.webPeer(ctx)
+}
+
+// Stats returns the number of calls made and how many failed, for each set
+// of labels that calls were made with.
+func (t *grpcTransport) Stats() []CallStats {
+	return t.stats.stats()
+}
+
+// callNMaxWorkers bounds the number of calls CallN makes concurrently.
+const callNMaxWorkers = 64
+
+// CallNError is returned by CallN when any of its calls fail.
+type CallNError struct {
+	// Errs holds the error of each call, at the same index as its response,
+	// and is nil for calls that succeeded.
+	Errs []error
+}
+
+func (e *CallNError) Error() string {
+	first := -1
+	var failed int
+	for i, err := range e.Errs {
+		if err == nil {
+			continue
+		}
+		if first < 0 {
+			first = i
+		}
+		failed++
+	}
+	return fmt.Sprintf("%v of %v calls failed, first was call %v: %v", failed, len(e.Errs), first, e.Errs[first])
+}
+
+// CallN makes n concurrent calls with the same request, and returns their
+// responses, with index i holding the response of the i-th call, or nil if it
+// failed. If any calls fail, the error is a *CallNError with each call's
+// error. An error is returned, and no calls are made, if n is negative.
+func (t *grpcTransport) CallN(ctx context.Context, request *Request, n int) ([]*Response, error) {
+	if n < 0 {
+		return nil, fmt.Errorf("number of calls must not be negative, got %v", n)
+	}
+
+	responses := make([]*Response, n)
+	errs := make([]error, n)
+	var failed atomic.Bool
+
+	workers := n
+	if workers > callNMaxWorkers {
+		workers = callNMaxWorkers
+	}
+
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+	wg.Add(workers)
+	for w := 0; w < workers; w++ {
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				if responses[i], errs[i] = t.Call(ctx, request); errs[i] != nil {
+					failed.Store(true)
+				}
+			}
+		}()
+	}
+	for i := 0; i < n; i++ {
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+
+	if failed.Load() {
+		return responses, &CallNError{Errs: errs}
+	}
+	return responses, nil
 }
 
 func (t *grpcTransport) CallStream(ctx context.Context, request *StreamRequest) (*transport.ClientStream, error) {
-	return t.StreamOutbound.CallStream(ctx, t.requestToYARPCStreamRequest(request))
+	if request != nil && request.Request != nil {
+		authorized, err := t.authorize(t.withFileHeaders(request.Request))
+		if err != nil {
+			return nil, err
+		}
+		request = &StreamRequest{Request: authorized}
+	}
+	if err := t.streamLimiter.acquire(ctx); err != nil {
+		return nil, err
+	}
+	// The cancel function is kept in the stream's context so that sends
+	// that time out can cancel the stream. It's called when the stream ends.
+	ctx, cancel := context.WithCancel(ctx)
+	ctx = context.WithValue(ctx, streamCancelKey{}, cancel)
+	stream, err := t.StreamOutbound.CallStream(ctx, t.requestToYARPCStreamRequest(request))
+	if err == nil {
+		stream, err = newResetReportingStream(stream)
+	}
+	if err != nil {
+		cancel()
+		t.streamLimiter.release()
+		return nil, wrapStreamReset(err)
+	}
+	return newFinishingStream(stream, func() {
+		cancel()
+		t.streamLimiter.release()
+	})
+}
+
+// AddPeer adds addr to the peers that calls are made to.
+func (t *grpcTransport) AddPeer(addr string) error {
+	addr, err := t.peerAddress(addr)
+	if err != nil {
+		return err
+	}
+	if err := t.peerList.Update(apipeer.ListUpdates{Additions: peersToIdentifiers([]string{addr})}); err != nil {
+		return fmt.Errorf("could not add grpc peer %q: %v", addr, err)
+	}
+	if t.web != nil {
+		t.web.addPeer(addr)
+	}
+	t.logger.Info("added grpc peer", "peer", addr)
+	return nil
+}
+
+// RemovePeer stops new calls from being made to addr. Its connections are
+// closed once the calls in progress to it have finished, or after
+// PeerDrainTimeout.
+func (t *grpcTransport) RemovePeer(addr string) error {
+	addr, err := t.peerAddress(addr)
+	if err != nil {
+		return err
+	}
+	if err := t.peerList.Update(apipeer.ListUpdates{Removals: peersToIdentifiers([]string{addr})}); err != nil {
+		return fmt.Errorf("could not remove grpc peer %q: %v", addr, err)
+	}
+	if t.web != nil {
+		t.web.removePeer(addr)
+	}
+	t.logger.Info("removed grpc peer", "peer", addr)
+	return nil
+}
+
+// WaitForPeers blocks until at least min peers are available, or ctx is done.
+func (t *grpcTransport) WaitForPeers(ctx context.Context, min int) error {
+	for {
+		available, changed := t.peers.availablePeers()
+		if available >= min {
+			return nil
+		}
+
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return fmt.Errorf("only %v of %v required grpc peers were available: %v", available, min, ctx.Err())
+		}
+	}
+}
+
+// peerAddress validates addr the same way as the addresses the transport
+// was created with.
+func (t *grpcTransport) peerAddress(addr string) (string, error) {
+	if addr == "" {
+		return "", errGRPCNoAddress
+	}
+	if !t.expandEnv {
+		return addr, nil
+	}
+	expanded, err := expandAddresses([]string{addr})
+	if err != nil {
+		return "", err
+	}
+	return expanded[0], nil
 }
 
 func (t *grpcTransport) Close() error {
-	return multierr.Combine(t.Transport.Stop(), t.Outbound.Stop())
+	if t.srv != nil {
+		t.srv.close()
+	}
+	t.peers.stop()
+	err := multierr.Combine(t.Transport.Stop(), t.Outbound.Stop())
+	t.notifier.close()
+	t.logger.Info("stopped grpc transport")
+	return err
 }
 
 func (t *grpcTransport) requestToYARPCStreamRequest(streamRequest *StreamRequest) *transport.StreamRequest {
@@ -189,55 +1293,389 @@ func (t *grpcTransport) requestToYARPCStreamRequest(streamRequest *StreamRequest
 			Encoding:        transport.Encoding(t.Encoding),
 			Procedure:       streamRequest.Request.Method,
 			Headers:         transport.HeadersFromMap(streamRequest.Request.Headers),
-			ShardKey:        streamRequest.Request.ShardKey,
+			ShardKey:        t.shardKey(streamRequest.Request),
 			RoutingKey:      t.RoutingKey,
-			RoutingDelegate: t.RoutingDelegate,
+			RoutingDelegate: t.routingDelegate(),
 		},
 	}
 }
 
 func (t *grpcTransport) requestToYARPCRequest(request *Request) *transport.Request {
+	return t.newYARPCRequest(request, t.shardKey(request), t.routingDelegate())
+}
+
+func (t *grpcTransport) newYARPCRequest(request *Request, shardKey, routingDelegate string) *transport.Request {
 	return &transport.Request{
 		Caller:          t.Caller,
 		Service:         request.TargetService,
 		Encoding:        transport.Encoding(t.Encoding),
 		Procedure:       request.Method,
 		Headers:         transport.HeadersFromMap(request.Headers),
-		ShardKey:        request.ShardKey,
+		ShardKey:        shardKey,
 		RoutingKey:      t.RoutingKey,
-		RoutingDelegate: t.RoutingDelegate,
-		Body:            bytes.NewReader(request.Body),
+		RoutingDelegate: routingDelegate,
+	}
+}
+
+// requestBody returns a reader for body, taken from the request body pool if
+// the transport has one. It should be passed to releaseRequestBody once the
+// reader is unused.
+func (t *grpcTransport) requestBody(body []byte) *bytes.Reader {
+	if t.bodyPool == nil {
+		return bytes.NewReader(body)
+	}
+	// Values of the wrong type, which can only have been added by the
+	// caller, are dropped.
+	r, ok := t.bodyPool.Get().(*bytes.Reader)
+	if !ok {
+		return bytes.NewReader(body)
+	}
+	r.Reset(body)
+	return r
+}
+
+// validatePool returns an error if pool is set but its New function is
+// missing or returns values of a different type than want.
+func validatePool(name string, pool *sync.Pool, want interface{}) error {
+	if pool == nil {
+		return nil
+	}
+	if pool.New == nil {
+		return fmt.Errorf("%v must have a New function", name)
+	}
+	if v := pool.New(); reflect.TypeOf(v) != reflect.TypeOf(want) {
+		return fmt.Errorf("%v must hold %T values, but New returned %T", name, want, v)
+	}
+	return nil
+}
+
+func (t *grpcTransport) releaseRequestBody(r *bytes.Reader) {
+	if t.bodyPool != nil {
+		r.Reset(nil)
+		t.bodyPool.Put(r)
+	}
+}
+
+// authorize returns a copy of request with an authorization header holding
+// a token from the transport's token source, if it has one.
+func (t *grpcTransport) authorize(request *Request) (*Request, error) {
+	if t.tokenSource == nil {
+		return request, nil
+	}
+
+	token, err := t.tokenSource.Token()
+	if err != nil {
+		return nil, fmt.Errorf("could not get OAuth2 token: %v", err)
+	}
+
+	return withHeaders(request, map[string]string{
+		"authorization": token.Type() + " " + token.AccessToken,
+	}), nil
+}
+
+// sign returns a copy of request with the headers returned by the
+// transport's signer for the request body, if it has one.
+func (t *grpcTransport) sign(request *Request) (*Request, error) {
+	if t.signer == nil {
+		return request, nil
+	}
+
+	headers, err := t.signer(request.Body)
+	if err != nil {
+		return nil, fmt.Errorf("could not sign request: %v", err)
+	}
+	return withHeaders(request, headers), nil
+}
+
+// withHeaders returns a copy of request with headers added to its headers,
+// replacing any with the same names.
+func withHeaders(request *Request, headers map[string]string) *Request {
+	copied := *request
+	copied.Headers = make(map[string]string, len(request.Headers)+len(headers))
+	for k, v := range request.Headers {
+		copied.Headers[k] = v
 	}
+	for k, v := range headers {
+		copied.Headers[k] = v
+	}
+	return &copied
+}
+
+func (t *grpcTransport) shardKey(request *Request) string {
+	if request.ShardKey == "" && t.shardKeyFunc != nil {
+		return t.shardKeyFunc()
+	}
+	return request.ShardKey
+}
+
+// WireSize returns an estimate of the number of bytes that will be sent for
+// request, without sending it. It includes the length-prefixed gRPC message
+// and the request metadata, sized as uncompressed HPACK header fields.
+//
+// The request is prepared as it would be for Call, with the same body
+// encoding and headers, but no span is started and no shard key or routing
+// delegate is picked. Trace context headers are sized as if the call is
+// traced, shard keys from ShardKeyFunc aren't counted, and the longest
+// delegate in RoutingDelegateSplit is used.
+func (t *grpcTransport) WireSize(request *Request) (int, error) {
+	request, err := t.prepareRequest(request)
+	if err != nil {
+		return 0, err
+	}
+	request = withHeaders(request, t.otelWireHeaders())
+	if t.formatDeadline != nil {
+		timeout, err := t.requestTimeout(context.Background(), request)
+		if err != nil {
+			return 0, err
+		}
+		deadline := t.formatDeadline(time.Now().Add(timeout))
+		request = withHeaders(request, map[string]string{t.deadlineHeader: deadline})
+	}
+
+	yarpcRequest := t.newYARPCRequest(request, request.ShardKey, t.longestRoutingDelegate())
+	return grpcMessageWireSize(request.Body) + grpcMetadataWireSize(yarpcRequest), nil
+}
+
+// grpcMessageWireSize returns the size of body framed as a gRPC message:
+// a 1 byte compressed flag, a 4 byte length, then the body.
+func grpcMessageWireSize(body []byte) int {
+	return 5 + len(body)
+}
+
+// grpcMessageFrame returns body framed as an uncompressed gRPC message.
+func grpcMessageFrame(body []byte) []byte {
+	frame := make([]byte, grpcMessageWireSize(body))
+	binary.BigEndian.PutUint32(frame[1:5], uint32(len(body)))
+	copy(frame[5:], body)
+	return frame
+}
+
+// grpcMetadataWireSize returns the size of the metadata sent for request,
+// using the overhead of 32 bytes per header field from RFC 7541, section 4.1.
+func grpcMetadataWireSize(request *transport.Request) int {
+	const fieldOverhead = 32
+
+	size := 0
+	addField := func(k, v string) {
+		if v != "" {
+			size += len(k) + len(v) + fieldOverhead
+		}
+	}
+	addField(grpc.CallerHeader, request.Caller)
+	addField(grpc.ServiceHeader, request.Service)
+	addField(grpc.ShardKeyHeader, request.ShardKey)
+	addField(grpc.RoutingKeyHeader, request.RoutingKey)
+	addField(grpc.RoutingDelegateHeader, request.RoutingDelegate)
+	addField(grpc.EncodingHeader, string(request.Encoding))
+	for k, v := range request.Headers.Items() {
+		addField(k, v)
+	}
+	return size
 }
 
-func requestContextWithTimeout(ctx context.Context, request *Request) (context.Context, context.CancelFunc) {
+func (t *grpcTransport) requestContextWithTimeout(ctx context.Context, request *Request) (context.Context, context.CancelFunc, error) {
 	if _, ok := ctx.Deadline(); ok {
-		return ctx, func() {}
+		return ctx, func() {}, nil
+	}
+	timeout, err := t.requestTimeout(ctx, request)
+	if err != nil {
+		return nil, nil, err
+	}
+	ctx, cancel := context.WithTimeout(ctx, t.jitterTimeout(timeout))
+	return ctx, cancel, nil
+}
+
+// requestTimeout returns the timeout for request when it's called with a
+// ctx that has no deadline, before any jitter is applied.
+func (t *grpcTransport) requestTimeout(ctx context.Context, request *Request) (time.Duration, error) {
+	headerTimeout, err := deadlineHeaderTimeout(request.Headers)
+	if err != nil {
+		return 0, err
 	}
+
 	timeout := time.Second
 	if request.Timeout > 0 {
 		timeout = request.Timeout
+	} else if headerTimeout > 0 {
+		timeout = headerTimeout
+	} else if methodTimeout := t.methodTimeouts.timeout(request.Method); methodTimeout > 0 {
+		timeout = methodTimeout
+	} else if scaledTimeout, ok := t.latencyTimeout.timeout(ctx); ok {
+		timeout = scaledTimeout
+	}
+	return timeout, nil
+}
+
+// deadlineHeaderTimeout returns the timeout set by the deadlineHeader in
+// headers, or zero if it's not set. The header name is matched
+// case-insensitively.
+func deadlineHeaderTimeout(headers map[string]string) (time.Duration, error) {
+	for k, v := range headers {
+		if !strings.EqualFold(k, deadlineHeader) {
+			continue
+		}
+		ms, err := strconv.ParseInt(strings.TrimSpace(v), 10, 64)
+		if err != nil || ms <= 0 {
+			return 0, fmt.Errorf("invalid %v header %q: must be a positive number of milliseconds", deadlineHeader, v)
+		}
+		return time.Duration(ms) * time.Millisecond, nil
 	}
-	return context.WithTimeout(ctx, timeout)
+	return 0, nil
 }
 
-func yarpcResponseToResponse(transportResponse *transport.Response) (*Response, error) {
+// jitterTimeout returns timeout adjusted by a random amount in
+// [-TimeoutJitter, TimeoutJitter]. The result is at least a millisecond.
+func (t *grpcTransport) jitterTimeout(timeout time.Duration) time.Duration {
+	if t.timeoutJitter <= 0 {
+		return timeout
+	}
+
+	t.randMu.Lock()
+	jitter := time.Duration(t.rand.Int63n(int64(2*t.timeoutJitter)+1)) - t.timeoutJitter
+	t.randMu.Unlock()
+
+	if timeout += jitter; timeout < time.Millisecond {
+		timeout = time.Millisecond
+	}
+	return timeout
+}
+
+func (t *grpcTransport) yarpcResponseToResponse(transportResponse *transport.Response) (*Response, error) {
 	response := &Response{
-		Headers: transportResponse.Headers.Items(),
+		Headers: t.filterResponseHeaders(transportResponse.Headers.Items()),
 	}
 	if transportResponse.Body != nil {
-		body, err := ioutil.ReadAll(transportResponse.Body)
-		if err != nil {
-			return nil, err
+		err := t.readResponseBody(response, transportResponse.Body)
+		if closeErr := transportResponse.Body.Close(); err == nil {
+			err = closeErr
+		}
+		if err == nil {
+			err = t.verifyChecksum(response, transportResponse.Headers.Items())
 		}
-		if err := transportResponse.Body.Close(); err != nil {
+		if err != nil {
+			response.Release()
 			return nil, err
 		}
-		response.Body = body
 	}
+	t.normalizeBody(response)
 	return response, nil
 }
 
+// normalizeBody replaces a nil Body with an empty slice if the transport
+// normalizes empty bodies, so that callers don't need to tell them apart.
+func (t *grpcTransport) normalizeBody(response *Response) {
+	if t.normalizeEmptyBody && response.Body == nil {
+		response.Body = []byte{}
+	}
+}
+
+// verifyChecksum checks the body of response against the checksum in
+// trailers, if the transport verifies checksums.
+func (t *grpcTransport) verifyChecksum(response *Response, trailers map[string]string) error {
+	if t.checksum == nil || response.Truncated {
+		return nil
+	}
+	return t.checksum.verify(response.Body, trailers)
+}
+
+func (t *grpcTransport) filterResponseHeaders(headers map[string]string) map[string]string {
+	if len(t.responseHeaders) == 0 {
+		return headers
+	}
+
+	filtered := make(map[string]string, len(t.responseHeaders))
+	for k, v := range headers {
+		if _, ok := t.responseHeaders[strings.ToLower(k)]; ok {
+			filtered[k] = v
+		}
+	}
+	return filtered
+}
+
+// headerSet returns a set of lower-cased header names, or nil if names is empty.
+func headerSet(names []string) map[string]struct{} {
+	if len(names) == 0 {
+		return nil
+	}
+
+	set := make(map[string]struct{}, len(names))
+	for _, name := range names {
+		set[strings.ToLower(name)] = struct{}{}
+	}
+	return set
+}
+
+// readResponseBody reads body into response.Body, using a pooled buffer if
+// the transport has a pool.
+func (t *grpcTransport) readResponseBody(response *Response, body io.Reader) error {
+	// Read one byte past each limit so we can tell a body that fits exactly
+	// apart from one that exceeds it.
+	limited := body
+	if t.truncateResponseAt > 0 {
+		limited = io.LimitReader(limited, int64(t.truncateResponseAt)+1)
+	}
+	if t.maxBufferedResponse > 0 {
+		limited = io.LimitReader(limited, int64(t.maxBufferedResponse)+1)
+	}
+
+	var err error
+	if t.bufPool == nil {
+		response.Body, err = ioutil.ReadAll(limited)
+	} else {
+		buf, ok := t.bufPool.Get().(*bytes.Buffer)
+		if !ok {
+			buf = new(bytes.Buffer)
+		}
+		buf.Reset()
+		response.release = func() { t.bufPool.Put(buf) }
+		_, err = buf.ReadFrom(limited)
+		response.Body = buf.Bytes()
+	}
+	if err != nil {
+		return err
+	}
+
+	if t.truncateResponseAt > 0 && len(response.Body) > t.truncateResponseAt {
+		if _, err := io.Copy(ioutil.Discard, body); err != nil {
+			return err
+		}
+	}
+	return t.limitResponseBody(response)
+}
+
+// limitResponseBody truncates the response body if it's longer than
+// TruncateResponseAt, and fails if it's longer than MaxBufferedResponse.
+func (t *grpcTransport) limitResponseBody(response *Response) error {
+	if t.truncateResponseAt > 0 && len(response.Body) > t.truncateResponseAt {
+		response.Body = response.Body[:t.truncateResponseAt]
+		response.Truncated = true
+	}
+	if t.maxBufferedResponse > 0 && len(response.Body) > t.maxBufferedResponse {
+		return fmt.Errorf("response body exceeds max buffered response size of %v bytes", t.maxBufferedResponse)
+	}
+	return nil
+}
+
+// expandAddresses replaces environment variable references in addresses
+// with their values, failing if any referenced variable is unset.
+func expandAddresses(addresses []string) ([]string, error) {
+	expanded := make([]string, len(addresses))
+	for i, addr := range addresses {
+		var unset []string
+		expanded[i] = os.Expand(addr, func(name string) string {
+			v, ok := os.LookupEnv(name)
+			if !ok {
+				unset = append(unset, name)
+			}
+			return v
+		})
+		if len(unset) > 0 {
+			return nil, fmt.Errorf("grpc address %q references unset environment variable %q", addr, unset[0])
+		}
+	}
+	return expanded, nil
+}
+
 func peersToIdentifiers(peers []string) []apipeer.Identifier {
 	identifiers := make([]apipeer.Identifier, len(peers))
 	for i, peer := range peers {
@@ -0,0 +1,72 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package transport
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/yarpc/yab/sorted"
+)
+
+var errDeadlineFormatNoHeader = errors.New("must specify DeadlineHeader to use DeadlineHeaderFormat")
+
+// defaultDeadlineHeaderFormat is used when DeadlineHeader is set without
+// DeadlineHeaderFormat.
+const defaultDeadlineHeaderFormat = "epoch-millis"
+
+// deadlineHeaderFormats maps the names of the supported DeadlineHeaderFormat
+// values to functions formatting a deadline in that format.
+var deadlineHeaderFormats = map[string]func(time.Time) string{
+	"epoch-millis": func(deadline time.Time) string {
+		return strconv.FormatInt(deadline.UnixNano()/int64(time.Millisecond), 10)
+	},
+	"epoch-seconds": func(deadline time.Time) string {
+		return strconv.FormatInt(deadline.Unix(), 10)
+	},
+	"rfc3339": func(deadline time.Time) string {
+		return deadline.UTC().Format(time.RFC3339Nano)
+	},
+}
+
+// newDeadlineFormatter returns the function formatting deadlines for the
+// DeadlineHeader, or nil if no header is configured.
+func newDeadlineFormatter(header, format string) (func(time.Time) string, error) {
+	if header == "" {
+		if format != "" {
+			return nil, errDeadlineFormatNoHeader
+		}
+		return nil, nil
+	}
+
+	if format == "" {
+		format = defaultDeadlineHeaderFormat
+	}
+	formatter, ok := deadlineHeaderFormats[format]
+	if !ok {
+		return nil, fmt.Errorf("unknown deadline header format %q, valid formats are: %v",
+			format, strings.Join(sorted.MapKeys(deadlineHeaderFormats), ", "))
+	}
+	return formatter, nil
+}
@@ -0,0 +1,127 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package transport
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/opentracing/opentracing-go/mocktracer"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/yarpc/yab/testdata/protobuf/simple"
+	"google.golang.org/grpc/metadata"
+)
+
+// deadlineRecordingSvc records the deadline and metadata of the last call.
+type deadlineRecordingSvc struct {
+	simpleSvc
+
+	deadline time.Time
+	md       metadata.MD
+}
+
+func (s *deadlineRecordingSvc) Baz(ctx context.Context, in *simple.Foo) (*simple.Foo, error) {
+	s.deadline, _ = ctx.Deadline()
+	s.md, _ = metadata.FromIncomingContext(ctx)
+	return in, nil
+}
+
+func TestNewDeadlineFormatter(t *testing.T) {
+	deadline := time.Date(2021, 3, 4, 5, 6, 7, 890000000, time.UTC)
+	tests := []struct {
+		header  string
+		format  string
+		want    string
+		wantErr string
+	}{
+		{header: "", format: ""},
+		{header: "deadline", format: "", want: "1614834367890"},
+		{header: "deadline", format: "epoch-millis", want: "1614834367890"},
+		{header: "deadline", format: "epoch-seconds", want: "1614834367"},
+		{header: "deadline", format: "rfc3339", want: "2021-03-04T05:06:07.89Z"},
+		{
+			header:  "deadline",
+			format:  "unix",
+			wantErr: `unknown deadline header format "unix", valid formats are: epoch-millis, epoch-seconds, rfc3339`,
+		},
+		{
+			header:  "",
+			format:  "epoch-millis",
+			wantErr: errDeadlineFormatNoHeader.Error(),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.header+"/"+tt.format, func(t *testing.T) {
+			formatter, err := newDeadlineFormatter(tt.header, tt.format)
+			if tt.wantErr != "" {
+				assert.EqualError(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			if tt.header == "" {
+				assert.Nil(t, formatter)
+				return
+			}
+			assert.Equal(t, tt.want, formatter(deadline))
+		})
+	}
+}
+
+func TestGRPCDeadlineHeaderFormat(t *testing.T) {
+	svc := &deadlineRecordingSvc{}
+	client, cleanup := newSimpleGRPCClient(t, svc, GRPCOptions{
+		DeadlineHeader: "deadline",
+	})
+	defer cleanup()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	clientDeadline, _ := ctx.Deadline()
+	_, err := client.Call(ctx, &Request{
+		TargetService: "Bar",
+		Method:        "Bar::Baz",
+		Body:          []byte{},
+	})
+	require.NoError(t, err)
+
+	// grpc-timeout is consumed by the server, which sets it as the deadline.
+	assert.WithinDuration(t, clientDeadline, svc.deadline, 50*time.Millisecond, "grpc-timeout should match the context deadline")
+
+	require.Len(t, svc.md.Get("deadline"), 1)
+	millis, err := strconv.ParseInt(svc.md.Get("deadline")[0], 10, 64)
+	require.NoError(t, err)
+	assert.WithinDuration(t, clientDeadline, time.Unix(0, millis*int64(time.Millisecond)), time.Millisecond, "custom header should match the context deadline")
+}
+
+func TestGRPCDeadlineHeaderFormatInvalid(t *testing.T) {
+	_, err := newGRPC(GRPCOptions{
+		Addresses:            []string{"127.0.0.1:0"},
+		Tracer:               mocktracer.New(),
+		Caller:               "test",
+		DeadlineHeader:       "deadline",
+		DeadlineHeaderFormat: "unix",
+	})
+	assert.EqualError(t, err, `unknown deadline header format "unix", valid formats are: epoch-millis, epoch-seconds, rfc3339`)
+}
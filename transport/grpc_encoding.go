@@ -0,0 +1,169 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package transport
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+var (
+	grpcEncodingsMu sync.RWMutex
+
+	// grpcEncodings is the set of encodings accepted by NewGRPC.
+	grpcEncodings = map[string]struct{}{
+		"proto":  {},
+		"json":   {},
+		"raw":    {},
+		"thrift": {},
+	}
+
+	// customGRPCEncodings are the encodings registered with a CustomEncoding.
+	customGRPCEncodings = map[string]*CustomEncoding{}
+)
+
+var builtinGRPCEncodings = []string{"json", "proto", "raw", "thrift"}
+
+// CustomEncoding converts the bodies of calls made with a bespoke encoding.
+type CustomEncoding struct {
+	// Marshal converts a request body to the bytes sent to the server.
+	Marshal func(body []byte) ([]byte, error)
+
+	// Unmarshal converts the bytes returned by the server to the response
+	// body.
+	Unmarshal func(body []byte) ([]byte, error)
+}
+
+// RegisterCustomGRPCEncoding adds name to the set of encodings accepted by
+// NewGRPC, like RegisterGRPCEncoding, with encoding used to convert the
+// bodies of calls made by transports using it. Transports use the encoding
+// registered when they're created.
+// Returns a function to undo the change made by this call.
+func RegisterCustomGRPCEncoding(name string, encoding CustomEncoding) (restore func(), err error) {
+	if name == "" {
+		return nil, errors.New("custom grpc encoding name must not be empty")
+	}
+	if encoding.Marshal == nil || encoding.Unmarshal == nil {
+		return nil, fmt.Errorf("custom grpc encoding %q must have Marshal and Unmarshal functions", name)
+	}
+	for _, builtin := range builtinGRPCEncodings {
+		if strings.EqualFold(name, builtin) {
+			return nil, fmt.Errorf("custom grpc encoding %q collides with built-in encoding %q", name, builtin)
+		}
+	}
+
+	grpcEncodingsMu.Lock()
+	defer grpcEncodingsMu.Unlock()
+
+	if _, ok := grpcEncodings[name]; ok {
+		return nil, fmt.Errorf("grpc encoding %q is already registered", name)
+	}
+	grpcEncodings[name] = struct{}{}
+	customGRPCEncodings[name] = &encoding
+	return func() {
+		grpcEncodingsMu.Lock()
+		defer grpcEncodingsMu.Unlock()
+		delete(grpcEncodings, name)
+		delete(customGRPCEncodings, name)
+	}, nil
+}
+
+// lookupCustomGRPCEncoding returns the CustomEncoding registered for
+// encoding, or nil if there isn't one.
+func lookupCustomGRPCEncoding(encoding string) *CustomEncoding {
+	grpcEncodingsMu.RLock()
+	defer grpcEncodingsMu.RUnlock()
+	return customGRPCEncodings[encoding]
+}
+
+// RegisterGRPCEncoding adds name to the set of encodings accepted by NewGRPC,
+// so that custom encodings can be used with the gRPC transport.
+// Returns a function to undo the change made by this call.
+func RegisterGRPCEncoding(name string) (restore func()) {
+	grpcEncodingsMu.Lock()
+	defer grpcEncodingsMu.Unlock()
+
+	if _, ok := grpcEncodings[name]; ok {
+		return func() {}
+	}
+	grpcEncodings[name] = struct{}{}
+	return func() {
+		grpcEncodingsMu.Lock()
+		defer grpcEncodingsMu.Unlock()
+		delete(grpcEncodings, name)
+	}
+}
+
+// validateGRPCEncoding returns an error if encoding is not empty and has not
+// been registered as a known encoding.
+func validateGRPCEncoding(encoding string) error {
+	if encoding == "" {
+		return nil
+	}
+
+	grpcEncodingsMu.RLock()
+	defer grpcEncodingsMu.RUnlock()
+
+	if _, ok := grpcEncodings[encoding]; ok {
+		return nil
+	}
+
+	valid := make([]string, 0, len(grpcEncodings))
+	for name := range grpcEncodings {
+		valid = append(valid, name)
+	}
+	sort.Strings(valid)
+	return fmt.Errorf("unknown grpc encoding %q, valid encodings are: %v", encoding, strings.Join(valid, ", "))
+}
+
+// encodeRequestBody returns a copy of request with its body marshalled by
+// the transport's custom encoding, if it has one.
+func (t *grpcTransport) encodeRequestBody(request *Request) (*Request, error) {
+	if t.customEncoding == nil {
+		return request, nil
+	}
+
+	body, err := t.customEncoding.Marshal(request.Body)
+	if err != nil {
+		return nil, fmt.Errorf("could not marshal request with %q encoding: %v", t.Encoding, err)
+	}
+	copied := *request
+	copied.Body = body
+	return &copied, nil
+}
+
+// decodeResponseBody unmarshals the body of response with the transport's
+// custom encoding, if it has one.
+func (t *grpcTransport) decodeResponseBody(response *Response) error {
+	if t.customEncoding == nil {
+		return nil
+	}
+
+	body, err := t.customEncoding.Unmarshal(response.Body)
+	if err != nil {
+		return fmt.Errorf("could not unmarshal response with %q encoding: %v", t.Encoding, err)
+	}
+	response.Body = body
+	return nil
+}
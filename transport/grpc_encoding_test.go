@@ -0,0 +1,204 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package transport
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"io/ioutil"
+	"testing"
+
+	"github.com/opentracing/opentracing-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/yarpc/api/transport"
+)
+
+func TestGRPCEncodingValidation(t *testing.T) {
+	newOptions := func(encoding string) GRPCOptions {
+		return GRPCOptions{
+			Addresses: []string{"127.0.0.1:1"},
+			Tracer:    opentracing.NoopTracer{},
+			Caller:    "example-caller",
+			Encoding:  encoding,
+		}
+	}
+
+	for _, encoding := range []string{"", "proto", "json", "raw", "thrift"} {
+		t.Run("valid "+encoding, func(t *testing.T) {
+			tr, err := NewGRPC(newOptions(encoding))
+			require.NoError(t, err)
+			tr.Close()
+		})
+	}
+
+	t.Run("invalid", func(t *testing.T) {
+		_, err := NewGRPC(newOptions("xml"))
+		assert.EqualError(t, err, `unknown grpc encoding "xml", valid encodings are: json, proto, raw, thrift`)
+	})
+
+	t.Run("registered", func(t *testing.T) {
+		restore := RegisterGRPCEncoding("xml")
+		tr, err := NewGRPC(newOptions("xml"))
+		require.NoError(t, err)
+		tr.Close()
+
+		_, err = NewGRPC(newOptions("yaml"))
+		assert.EqualError(t, err, `unknown grpc encoding "yaml", valid encodings are: json, proto, raw, thrift, xml`)
+
+		restore()
+		_, err = NewGRPC(newOptions("xml"))
+		assert.Error(t, err, "encoding should be unknown after restore")
+	})
+
+	t.Run("registering a built-in is a no-op", func(t *testing.T) {
+		RegisterGRPCEncoding("proto")()
+		tr, err := NewGRPC(newOptions("proto"))
+		require.NoError(t, err)
+		tr.Close()
+	})
+}
+
+var base64Encoding = CustomEncoding{
+	Marshal: func(body []byte) ([]byte, error) {
+		return []byte(base64.StdEncoding.EncodeToString(body)), nil
+	},
+	Unmarshal: func(body []byte) ([]byte, error) {
+		return base64.StdEncoding.DecodeString(string(body))
+	},
+}
+
+// upperBase64Handler decodes base64 request bodies and returns them in upper
+// case, encoded as base64.
+type upperBase64Handler struct {
+	encodings []transport.Encoding
+}
+
+func (h *upperBase64Handler) Handle(ctx context.Context, req *transport.Request, resw transport.ResponseWriter) error {
+	h.encodings = append(h.encodings, req.Encoding)
+	body, err := ioutil.ReadAll(req.Body)
+	if err != nil {
+		return err
+	}
+	decoded, err := base64.StdEncoding.DecodeString(string(body))
+	if err != nil {
+		return err
+	}
+	_, err = resw.Write([]byte(base64.StdEncoding.EncodeToString(bytes.ToUpper(decoded))))
+	return err
+}
+
+func TestCustomGRPCEncoding(t *testing.T) {
+	restore, err := RegisterCustomGRPCEncoding("base64", base64Encoding)
+	require.NoError(t, err)
+	defer restore()
+
+	handler := &upperBase64Handler{}
+	doWithGRPCTestEnvOptions(t, 1, []transport.Procedure{{
+		Name:        "Foo::Bar",
+		Service:     "example",
+		Encoding:    "base64",
+		HandlerSpec: transport.NewUnaryHandlerSpec(handler),
+	}}, GRPCOptions{Caller: "example-caller", Encoding: "base64"}, func(t *testing.T, grpcTestEnv *grpcTestEnv) {
+		res, err := grpcTestEnv.Transport.Call(context.Background(), &Request{
+			TargetService: "example",
+			Method:        "Foo::Bar",
+			Body:          []byte("hello"),
+		})
+		require.NoError(t, err)
+		assert.Equal(t, "HELLO", string(res.Body), "response should be decoded")
+		assert.Equal(t, []transport.Encoding{"base64"}, handler.encodings)
+	})
+
+	t.Run("unmarshal error", func(t *testing.T) {
+		restore, err := RegisterCustomGRPCEncoding("bad-base64", CustomEncoding{
+			Marshal: base64Encoding.Marshal,
+			Unmarshal: func(body []byte) ([]byte, error) {
+				return nil, errors.New("bad response")
+			},
+		})
+		require.NoError(t, err)
+		defer restore()
+
+		doWithGRPCTestEnvOptions(t, 1, []transport.Procedure{{
+			Name:        "Foo::Bar",
+			Service:     "example",
+			Encoding:    "bad-base64",
+			HandlerSpec: transport.NewUnaryHandlerSpec(&upperBase64Handler{}),
+		}}, GRPCOptions{Caller: "example-caller", Encoding: "bad-base64"}, func(t *testing.T, grpcTestEnv *grpcTestEnv) {
+			_, err := grpcTestEnv.Transport.Call(context.Background(), &Request{
+				TargetService: "example",
+				Method:        "Foo::Bar",
+				Body:          []byte("hello"),
+			})
+			assert.EqualError(t, err, `could not unmarshal response with "bad-base64" encoding: bad response`)
+		})
+	})
+}
+
+func TestRegisterCustomGRPCEncodingErrors(t *testing.T) {
+	tests := []struct {
+		msg      string
+		name     string
+		encoding CustomEncoding
+		wantErr  string
+	}{
+		{
+			msg:      "empty name",
+			encoding: base64Encoding,
+			wantErr:  "custom grpc encoding name must not be empty",
+		},
+		{
+			msg:      "missing functions",
+			name:     "base64",
+			encoding: CustomEncoding{Marshal: base64Encoding.Marshal},
+			wantErr:  `custom grpc encoding "base64" must have Marshal and Unmarshal functions`,
+		},
+		{
+			msg:      "built-in",
+			name:     "proto",
+			encoding: base64Encoding,
+			wantErr:  `custom grpc encoding "proto" collides with built-in encoding "proto"`,
+		},
+		{
+			msg:      "built-in with different case",
+			name:     "JSON",
+			encoding: base64Encoding,
+			wantErr:  `custom grpc encoding "JSON" collides with built-in encoding "json"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.msg, func(t *testing.T) {
+			_, err := RegisterCustomGRPCEncoding(tt.name, tt.encoding)
+			assert.EqualError(t, err, tt.wantErr)
+		})
+	}
+
+	t.Run("already registered", func(t *testing.T) {
+		restore := RegisterGRPCEncoding("xml")
+		defer restore()
+		_, err := RegisterCustomGRPCEncoding("xml", base64Encoding)
+		assert.EqualError(t, err, `grpc encoding "xml" is already registered`)
+	})
+}
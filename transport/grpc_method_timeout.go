@@ -0,0 +1,147 @@
+// Copyright (c) 2021 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package transport
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/jhump/protoreflect/desc"
+	"github.com/jhump/protoreflect/dynamic"
+	"github.com/yarpc/yab/protobuf"
+	"go.uber.org/yarpc/pkg/procedure"
+)
+
+// methodTimeouts reads default timeouts from a custom method option, caching
+// the result for each procedure.
+type methodTimeouts struct {
+	provider protobuf.DescriptorProvider
+	option   string
+	logger   Logger
+
+	mu    sync.Mutex
+	cache map[string]time.Duration
+}
+
+// newMethodTimeouts returns nil if method timeouts are not configured.
+func newMethodTimeouts(provider protobuf.DescriptorProvider, option string, logger Logger) *methodTimeouts {
+	if provider == nil || option == "" {
+		return nil
+	}
+	return &methodTimeouts{
+		provider: provider,
+		option:   option,
+		logger:   logger,
+		cache:    make(map[string]time.Duration),
+	}
+}
+
+// timeout returns the timeout for the given procedure, or 0 if the method
+// has no timeout option.
+func (m *methodTimeouts) timeout(procedureName string) time.Duration {
+	if m == nil {
+		return 0
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if timeout, ok := m.cache[procedureName]; ok {
+		return timeout
+	}
+
+	timeout, err := m.lookup(procedureName)
+	if err != nil {
+		m.logger.Warn("could not read method timeout option", "procedure", procedureName, "option", m.option, "error", err)
+	}
+	m.cache[procedureName] = timeout
+	return timeout
+}
+
+func (m *methodTimeouts) lookup(procedureName string) (time.Duration, error) {
+	serviceName, methodName := procedure.FromName(procedureName)
+	service, err := m.provider.FindService(serviceName)
+	if err != nil {
+		return 0, err
+	}
+	method := service.FindMethodByName(methodName)
+	if method == nil {
+		return 0, fmt.Errorf("method %q not found in service %q", methodName, serviceName)
+	}
+
+	ext := findExtension(method.GetFile(), m.option)
+	if ext == nil || method.GetMethodOptions() == nil {
+		// The option is either unknown to the method's file, or not set.
+		return 0, nil
+	}
+
+	// Custom options are kept as unknown fields of the options message, so
+	// decode its serialized form with the extension registered.
+	optsBytes, err := proto.Marshal(method.GetMethodOptions())
+	if err != nil {
+		return 0, err
+	}
+	er := dynamic.NewExtensionRegistryWithDefaults()
+	if err := er.AddExtension(ext); err != nil {
+		return 0, err
+	}
+	opts := dynamic.NewMessageWithExtensionRegistry(ext.GetOwner(), er)
+	if err := opts.Unmarshal(optsBytes); err != nil {
+		return 0, err
+	}
+	if !opts.HasField(ext) {
+		return 0, nil
+	}
+
+	v, err := opts.TryGetField(ext)
+	if err != nil {
+		return 0, err
+	}
+	var ms int64
+	switch v := v.(type) {
+	case int32:
+		ms = int64(v)
+	case int64:
+		ms = v
+	case uint32:
+		ms = int64(v)
+	case uint64:
+		ms = int64(v)
+	default:
+		return 0, fmt.Errorf("option has type %T, expected an integer", v)
+	}
+	return time.Duration(ms) * time.Millisecond, nil
+}
+
+// findExtension finds an extension by name in fd or any of its dependencies.
+func findExtension(fd *desc.FileDescriptor, name string) *desc.FieldDescriptor {
+	if ext := fd.FindExtensionByName(name); ext != nil {
+		return ext
+	}
+	for _, dep := range fd.GetDependencies() {
+		if ext := findExtension(dep, name); ext != nil {
+			return ext
+		}
+	}
+	return nil
+}
@@ -0,0 +1,144 @@
+// Copyright (c) 2021 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package transport
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/opentracing/opentracing-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/yarpc/yab/protobuf"
+)
+
+func TestGRPCMethodTimeoutOption(t *testing.T) {
+	provider, err := protobuf.NewDescriptorProviderFileDescriptorSetBins("../testdata/protobuf/options/options.proto.bin")
+	require.NoError(t, err)
+	defer provider.Close()
+
+	tests := []struct {
+		msg           string
+		option        string
+		method        string
+		timeout       time.Duration
+		want          time.Duration
+		wantWarning   bool
+		noDescriptors bool
+	}{
+		{
+			msg:    "annotated method",
+			option: "options.timeout_ms",
+			method: "options.Bar::Annotated",
+			want:   3 * time.Second,
+		},
+		{
+			msg:     "request timeout takes precedence",
+			option:  "options.timeout_ms",
+			method:  "options.Bar::Annotated",
+			timeout: 500 * time.Millisecond,
+			want:    500 * time.Millisecond,
+		},
+		{
+			msg:    "method without annotation",
+			option: "options.timeout_ms",
+			method: "options.Bar::NotAnnotated",
+			want:   time.Second,
+		},
+		{
+			msg:    "unknown option",
+			option: "options.unknown",
+			method: "options.Bar::Annotated",
+			want:   time.Second,
+		},
+		{
+			msg:         "option is not an integer",
+			option:      "options.owner",
+			method:      "options.Bar::WrongType",
+			want:        time.Second,
+			wantWarning: true,
+		},
+		{
+			msg:         "unknown method",
+			option:      "options.timeout_ms",
+			method:      "options.Bar::Unknown",
+			want:        time.Second,
+			wantWarning: true,
+		},
+		{
+			msg:         "unknown service",
+			option:      "options.timeout_ms",
+			method:      "options.Unknown::Annotated",
+			want:        time.Second,
+			wantWarning: true,
+		},
+		{
+			msg:           "no descriptor provider",
+			option:        "options.timeout_ms",
+			method:        "options.Bar::Annotated",
+			want:          time.Second,
+			noDescriptors: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.msg, func(t *testing.T) {
+			logger := &recordingLogger{}
+			options := GRPCOptions{
+				Addresses:          []string{"127.0.0.1:0"},
+				Tracer:             opentracing.NoopTracer{},
+				Caller:             "example-caller",
+				Logger:             logger,
+				DescriptorProvider: provider,
+				TimeoutOption:      tt.option,
+			}
+			if tt.noDescriptors {
+				options.DescriptorProvider = nil
+			}
+			transport, err := newGRPC(options)
+			require.NoError(t, err)
+			defer transport.Close()
+
+			// Look up the timeout twice to exercise the cache.
+			for i := 0; i < 2; i++ {
+				start := time.Now()
+				ctx, cancel, err := transport.requestContextWithTimeout(context.Background(), &Request{
+					TargetService: "options.Bar",
+					Method:        tt.method,
+					Timeout:       tt.timeout,
+				})
+				require.NoError(t, err)
+				deadline, ok := ctx.Deadline()
+				cancel()
+				require.True(t, ok)
+				assert.WithinDuration(t, start.Add(tt.want), deadline, 100*time.Millisecond)
+			}
+
+			warnings := logger.find("warn", "could not read method timeout option")
+			if tt.wantWarning {
+				assert.Len(t, warnings, 1, "failed lookups should be cached")
+			} else {
+				assert.Empty(t, warnings)
+			}
+		})
+	}
+}
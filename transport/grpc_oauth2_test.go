@@ -0,0 +1,113 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package transport
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/opentracing/opentracing-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/yarpc"
+	"go.uber.org/yarpc/api/transport"
+	"golang.org/x/oauth2"
+)
+
+// fakeTokenSource returns a new token each time it's called, using the
+// expiry at the same index in expiries.
+type fakeTokenSource struct {
+	mu       sync.Mutex
+	fetched  int
+	expiries []time.Duration
+	err      error
+}
+
+func (s *fakeTokenSource) Token() (*oauth2.Token, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.err != nil {
+		return nil, s.err
+	}
+	expiry := s.expiries[s.fetched]
+	s.fetched++
+	return &oauth2.Token{
+		AccessToken: fmt.Sprintf("token-%v", s.fetched),
+		Expiry:      time.Now().Add(expiry),
+	}, nil
+}
+
+func TestGRPCTokenSource(t *testing.T) {
+	var (
+		mu   sync.Mutex
+		seen []string
+	)
+	recordAuth := func(ctx context.Context, request *testBarRequest) (*testBarResponse, error) {
+		mu.Lock()
+		seen = append(seen, yarpc.CallFromContext(ctx).Header("authorization"))
+		mu.Unlock()
+		return &testBarResponse{One: request.One}, nil
+	}
+
+	// The first token expires within oauth2's expiry margin, so it must be
+	// refreshed on the next call. The second is reused.
+	tokens := &fakeTokenSource{expiries: []time.Duration{time.Second, time.Hour}}
+	options := GRPCOptions{
+		Caller:      "example-caller",
+		TokenSource: tokens,
+	}
+	doWithGRPCTestEnvOptions(t, 1, []transport.Procedure{
+		newTestJSONProcedure("example", "Foo::Bar", recordAuth),
+	}, options, func(t *testing.T, grpcTestEnv *grpcTestEnv) {
+		for i := 0; i < 3; i++ {
+			request, err := newTestJSONRequest("example", "Foo::Bar", &testBarRequest{One: "hello"})
+			require.NoError(t, err)
+			request.Headers = map[string]string{"custom": "header"}
+			_, err = grpcTestEnv.Transport.Call(context.Background(), request)
+			require.NoError(t, err)
+			assert.Equal(t, map[string]string{"custom": "header"}, request.Headers, "request should not be modified")
+		}
+	})
+
+	assert.Equal(t, []string{"Bearer token-1", "Bearer token-2", "Bearer token-2"}, seen)
+	assert.Equal(t, 2, tokens.fetched)
+
+	t.Run("token error", func(t *testing.T) {
+		client, err := newGRPC(GRPCOptions{
+			Addresses:   []string{"127.0.0.1:1"},
+			Tracer:      opentracing.NoopTracer{},
+			Caller:      "example-caller",
+			TokenSource: &fakeTokenSource{err: errors.New("token endpoint unavailable")},
+		})
+		require.NoError(t, err)
+		defer client.Close()
+
+		request := &Request{TargetService: "example", Method: "Foo::Bar"}
+		_, err = client.Call(context.Background(), request)
+		assert.EqualError(t, err, "could not get OAuth2 token: token endpoint unavailable")
+		_, err = client.CallStream(context.Background(), &StreamRequest{Request: request})
+		assert.EqualError(t, err, "could not get OAuth2 token: token endpoint unavailable")
+	})
+}
@@ -23,13 +23,20 @@ package transport
 import (
 	"bytes"
 	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
+	"math/rand"
 	"net"
+	"os"
+	"path/filepath"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -39,8 +46,14 @@ import (
 	"github.com/stretchr/testify/require"
 	"github.com/yarpc/yab/testdata/protobuf/simple"
 	googlegrpc "google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/stats"
 
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/atomic"
 	"go.uber.org/multierr"
+	"go.uber.org/yarpc"
+	apipeer "go.uber.org/yarpc/api/peer"
 	"go.uber.org/yarpc/api/transport"
 	yarpcjson "go.uber.org/yarpc/encoding/json"
 	"go.uber.org/yarpc/transport/grpc"
@@ -101,6 +114,70 @@ func TestGRPCConstructor(t *testing.T) {
 	}
 }
 
+func TestGRPCExpandEnv(t *testing.T) {
+	os.Setenv("YAB_TEST_GRPC_HOST", "127.0.0.1")
+	defer os.Unsetenv("YAB_TEST_GRPC_HOST")
+	os.Unsetenv("YAB_TEST_GRPC_UNSET")
+
+	tests := []struct {
+		msg       string
+		addresses []string
+		want      []string
+		wantErr   string
+	}{
+		{
+			msg:       "no variables",
+			addresses: []string{"127.0.0.1:8080"},
+			want:      []string{"127.0.0.1:8080"},
+		},
+		{
+			msg:       "set variable",
+			addresses: []string{"${YAB_TEST_GRPC_HOST}:8080", "$YAB_TEST_GRPC_HOST:8081"},
+			want:      []string{"127.0.0.1:8080", "127.0.0.1:8081"},
+		},
+		{
+			msg:       "unset variable",
+			addresses: []string{"127.0.0.1:8080", "${YAB_TEST_GRPC_UNSET}:8080"},
+			wantErr:   `grpc address "${YAB_TEST_GRPC_UNSET}:8080" references unset environment variable "YAB_TEST_GRPC_UNSET"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.msg, func(t *testing.T) {
+			got, err := expandAddresses(tt.addresses)
+			if tt.wantErr != "" {
+				assert.EqualError(t, err, tt.wantErr)
+			} else {
+				require.NoError(t, err)
+				assert.Equal(t, tt.want, got)
+			}
+
+			transport, err := NewGRPC(GRPCOptions{
+				Addresses: tt.addresses,
+				Tracer:    opentracing.NoopTracer{},
+				Caller:    "example-caller",
+				ExpandEnv: true,
+			})
+			if tt.wantErr != "" {
+				assert.EqualError(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.NoError(t, transport.Close())
+		})
+	}
+
+	t.Run("disabled", func(t *testing.T) {
+		transport, err := NewGRPC(GRPCOptions{
+			Addresses: []string{"${YAB_TEST_GRPC_UNSET}:8080"},
+			Tracer:    opentracing.NoopTracer{},
+			Caller:    "example-caller",
+		})
+		require.NoError(t, err, "addresses should be used as-is when ExpandEnv is not set")
+		assert.NoError(t, transport.Close())
+	})
+}
+
 func TestGRPCSuccess(t *testing.T) {
 	doWithGRPCTestEnv(t, "example-caller", 5, []transport.Procedure{
 		newTestJSONProcedure("example", "Foo::Bar", testBar)},
@@ -147,6 +224,38 @@ func (*simpleSvc) ServerStream(*simple.Foo, simple.Bar_ServerStreamServer) error
 	return nil
 }
 
+// newSimpleGRPCClient starts a gRPC server for the simple.Bar service and
+// returns a transport connected to it. Addresses, Tracer, Caller and Encoding
+// are filled in if they are not set.
+func newSimpleGRPCClient(t testing.TB, svc simple.BarServer, options GRPCOptions, serverOptions ...googlegrpc.ServerOption) (*grpcTransport, func()) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	server := googlegrpc.NewServer(serverOptions...)
+	simple.RegisterBarServer(server, svc)
+	go server.Serve(lis)
+
+	if options.Addresses == nil {
+		options.Addresses = []string{lis.Addr().String()}
+	}
+	if options.Tracer == nil {
+		options.Tracer = opentracing.NoopTracer{}
+	}
+	if options.Caller == "" {
+		options.Caller = "test"
+	}
+	if options.Encoding == "" {
+		options.Encoding = "proto"
+	}
+	client, err := newGRPC(options)
+	require.NoError(t, err)
+
+	return client, func() {
+		assert.NoError(t, client.Close())
+		server.Stop()
+	}
+}
+
 func TestGRPCStream(t *testing.T) {
 	lis, err := net.Listen("tcp", "127.0.0.1:0")
 	require.NoError(t, err)
@@ -226,127 +335,1696 @@ func TestGRPCMaxResponseSize(t *testing.T) {
 	})
 }
 
-type testBarRequest struct {
-	One   string
-	Error string
-	Size  int
+func TestGRPCMaxBufferedResponse(t *testing.T) {
+	tests := []struct {
+		msg     string
+		size    int
+		wantErr string
+	}{
+		{
+			msg:  "under limit",
+			size: 100,
+		},
+		{
+			// The JSON response wraps the payload as {"One":"..."}\n, which
+			// adds 11 bytes, so this response is exactly one byte over.
+			msg:     "just over limit",
+			size:    1014,
+			wantErr: "response body exceeds max buffered response size of 1024 bytes",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.msg, func(t *testing.T) {
+			doWithGRPCTestEnvOptions(t, 1, []transport.Procedure{
+				newTestJSONProcedure("example", "Foo::Bar", testLargeResponse),
+			}, GRPCOptions{
+				Caller:              "example-caller",
+				MaxBufferedResponse: 1024,
+			}, func(t *testing.T, grpcTestEnv *grpcTestEnv) {
+				request, err := newTestJSONRequest("example", "Foo::Bar", &testBarRequest{Size: tt.size})
+				require.NoError(t, err)
+				response, err := grpcTestEnv.Transport.Call(context.Background(), request)
+				if tt.wantErr != "" {
+					require.EqualError(t, err, tt.wantErr)
+					return
+				}
+				require.NoError(t, err)
+				assert.Len(t, response.Body, tt.size+11)
+			})
+		})
+	}
 }
 
-type testBarResponse struct {
-	One string
+// capturingStatsHandler records the wire sizes of inbound messages and headers.
+type capturingStatsHandler struct {
+	mu            sync.Mutex
+	payloadLength int
+	headerLength  int
 }
 
-func testBar(ctx context.Context, request *testBarRequest) (*testBarResponse, error) {
-	if request == nil {
-		return nil, nil
+func (h *capturingStatsHandler) TagRPC(ctx context.Context, _ *stats.RPCTagInfo) context.Context {
+	return ctx
+}
+
+func (h *capturingStatsHandler) HandleRPC(_ context.Context, s stats.RPCStats) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	switch s := s.(type) {
+	case *stats.InPayload:
+		h.payloadLength = s.WireLength
+	case *stats.InHeader:
+		h.headerLength = s.WireLength
 	}
-	if request.Error != "" {
-		return nil, errors.New(request.Error)
+}
+
+func (h *capturingStatsHandler) TagConn(ctx context.Context, _ *stats.ConnTagInfo) context.Context {
+	return ctx
+}
+
+func (h *capturingStatsHandler) HandleConn(context.Context, stats.ConnStats) {}
+
+func TestGRPCWireSize(t *testing.T) {
+	statsHandler := &capturingStatsHandler{}
+	client, cleanup := newSimpleGRPCClient(t, &simpleSvc{}, GRPCOptions{
+		RoutingKey: "rk",
+	}, googlegrpc.StatsHandler(statsHandler))
+	defer cleanup()
+
+	body, err := proto.Marshal(&simple.Foo{Test: 42, Nested: &simple.Nested{Value: 100}})
+	require.NoError(t, err)
+	request := &Request{
+		TargetService: "Bar",
+		Method:        "Bar::Baz",
+		Headers:       map[string]string{"foo": "bar"},
+		ShardKey:      "sk",
+		Body:          body,
 	}
-	return &testBarResponse{
-		One: request.One,
-	}, nil
+
+	var sizer WireSizer = client
+	wireSize, err := sizer.WireSize(request)
+	require.NoError(t, err)
+
+	_, err = client.Call(context.Background(), request)
+	require.NoError(t, err)
+
+	statsHandler.mu.Lock()
+	defer statsHandler.mu.Unlock()
+	assert.Equal(t, statsHandler.payloadLength, grpcMessageWireSize(body), "message size should match the captured frame")
+
+	metadataSize := wireSize - statsHandler.payloadLength
+	assert.Equal(t, grpcMetadataWireSize(client.requestToYARPCRequest(request)), metadataSize)
+	assert.True(t, metadataSize > statsHandler.headerLength,
+		"uncompressed metadata estimate %v should exceed the HPACK-compressed headers %v", metadataSize, statsHandler.headerLength)
 }
 
-func testLargeResponse(ctx context.Context, request *testBarRequest) (*testBarResponse, error) {
-	return &testBarResponse{
-		// filling One with non-zero value to avoid html-escape in json encoder
-		One: strings.Repeat("a", request.Size),
-	}, nil
+func TestGRPCWireSizeMatchesCall(t *testing.T) {
+	headersFile := filepath.Join(t.TempDir(), "headers.json")
+	require.NoError(t, ioutil.WriteFile(headersFile, []byte(`{"file-header": "from-file"}`), 0644))
+
+	var shardKeys atomic.Int32
+	svc := &deadlineRecordingSvc{}
+	client, cleanup := newSimpleGRPCClient(t, svc, GRPCOptions{
+		HeadersFile:             headersFile,
+		GenerateIdempotencyKeys: true,
+		Priority:                3,
+		TokenSource:             &fakeTokenSource{expiries: []time.Duration{time.Hour}},
+		Signer: func(body []byte) (map[string]string, error) {
+			return map[string]string{"signature": fmt.Sprintf("%x", sha256.Sum256(body))}, nil
+		},
+		OTelTracer:           trace.NewNoopTracerProvider().Tracer("test"),
+		DeadlineHeader:       "deadline",
+		RoutingKey:           "rk",
+		RoutingDelegateSplit: map[string]int{"delegate-a": 1, "delegate-b": 1},
+		ShardKeyFunc: func() string {
+			shardKeys.Inc()
+			return "random-shard"
+		},
+	})
+	defer cleanup()
+
+	request := &Request{
+		TargetService: "Bar",
+		Method:        "Bar::Baz",
+		Headers:       map[string]string{"foo": "bar"},
+		ShardKey:      "sk",
+		Body:          []byte{},
+	}
+	wireSize, err := client.WireSize(request)
+	require.NoError(t, err)
+	assert.Zero(t, shardKeys.Load(), "WireSize should not call ShardKeyFunc")
+
+	// The OTel tracer is a no-op, so give calls a span context to propagate.
+	ctx := trace.ContextWithRemoteSpanContext(context.Background(), otelWireSpanContext)
+	_, err = client.Call(ctx, request)
+	require.NoError(t, err)
+
+	// gRPC adds these headers itself, so they aren't part of the request's
+	// metadata.
+	grpcHeaders := map[string]struct{}{":authority": {}, "content-type": {}, "user-agent": {}}
+	var sent int
+	for k, vs := range svc.md {
+		if _, ok := grpcHeaders[k]; ok {
+			continue
+		}
+		for _, v := range vs {
+			sent += len(k) + len(v) + 32
+		}
+	}
+	assert.Equal(t, sent+grpcMessageWireSize(nil), wireSize, "sent metadata: %v", svc.md)
+
+	t.Run("custom encoding", func(t *testing.T) {
+		restore, err := RegisterCustomGRPCEncoding("base64", base64Encoding)
+		require.NoError(t, err)
+		defer restore()
+
+		client, err := newGRPC(GRPCOptions{
+			Addresses: []string{"127.0.0.1:0"},
+			Tracer:    opentracing.NoopTracer{},
+			Caller:    "test",
+			Encoding:  "base64",
+		})
+		require.NoError(t, err)
+
+		request := &Request{TargetService: "Bar", Method: "Bar::Baz", Body: []byte("body")}
+		wireSize, err := client.WireSize(request)
+		require.NoError(t, err)
+		metadataSize := grpcMetadataWireSize(client.requestToYARPCRequest(request))
+		assert.Equal(t, grpcMessageWireSize([]byte("Ym9keQ==")), wireSize-metadataSize, "the encoded body should be sized")
+	})
+
+	t.Run("failed to prepare", func(t *testing.T) {
+		client, err := newGRPC(GRPCOptions{
+			Addresses: []string{"127.0.0.1:0"},
+			Tracer:    opentracing.NoopTracer{},
+			Caller:    "test",
+			Signer: func([]byte) (map[string]string, error) {
+				return nil, errors.New("no key")
+			},
+		})
+		require.NoError(t, err)
+
+		_, err = client.WireSize(&Request{TargetService: "Bar", Method: "Bar::Baz"})
+		assert.EqualError(t, err, "could not sign request: no key")
+	})
 }
 
-func newTestJSONRequest(service string, method string, request interface{}) (*Request, error) {
-	body, err := json.Marshal(request)
-	if err != nil {
-		return nil, err
+func TestGRPCResponseHeaderAllowlist(t *testing.T) {
+	withHeaders := func(ctx context.Context, request *testBarRequest) (*testBarResponse, error) {
+		call := yarpc.CallFromContext(ctx)
+		for _, k := range []string{"keep-me", "Also-Keep", "drop-me"} {
+			if err := call.WriteResponseHeader(k, "v-"+k); err != nil {
+				return nil, err
+			}
+		}
+		return &testBarResponse{One: request.One}, nil
+	}
+
+	tests := []struct {
+		msg       string
+		allowlist []string
+		want      map[string]string
+	}{
+		{
+			msg: "no allowlist",
+			want: map[string]string{
+				"keep-me":   "v-keep-me",
+				"also-keep": "v-Also-Keep",
+				"drop-me":   "v-drop-me",
+			},
+		},
+		{
+			msg:       "allowlist is case-insensitive",
+			allowlist: []string{"Keep-Me", "also-keep", "not-sent"},
+			want: map[string]string{
+				"keep-me":   "v-keep-me",
+				"also-keep": "v-Also-Keep",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.msg, func(t *testing.T) {
+			doWithGRPCTestEnvOptions(t, 1, []transport.Procedure{
+				newTestJSONProcedure("example", "Foo::Bar", withHeaders),
+			}, GRPCOptions{
+				Caller:                  "example-caller",
+				ResponseHeaderAllowlist: tt.allowlist,
+			}, func(t *testing.T, grpcTestEnv *grpcTestEnv) {
+				request, err := newTestJSONRequest("example", "Foo::Bar", &testBarRequest{One: "hello"})
+				require.NoError(t, err)
+				response, err := grpcTestEnv.Transport.Call(context.Background(), request)
+				require.NoError(t, err)
+				for k, v := range tt.want {
+					assert.Equal(t, v, response.Headers[k], "header %q", k)
+				}
+				if tt.allowlist != nil {
+					assert.Equal(t, tt.want, response.Headers)
+				}
+			})
+		})
 	}
-	return &Request{
-		TargetService: service,
-		Method:        method,
-		Body:          body,
-	}, nil
 }
 
-func newTestJSONProcedure(service string, name string, handler interface{}) transport.Procedure {
-	procedure := yarpcjson.Procedure(name, handler)[0]
-	procedure.Service = service
-	return procedure
+func TestGRPCCallN(t *testing.T) {
+	var calls atomic.Int32
+	failEveryThird := func(ctx context.Context, request *testBarRequest) (*testBarResponse, error) {
+		if n := calls.Inc(); n%3 == 0 {
+			return nil, fmt.Errorf("call %v failed", n)
+		}
+		return &testBarResponse{One: request.One}, nil
+	}
+
+	for _, n := range []int{0, 1, 10, callNMaxWorkers + 10} {
+		t.Run(fmt.Sprint(n), func(t *testing.T) {
+			calls.Store(0)
+			doWithGRPCTestEnv(t, "example-caller", 2, []transport.Procedure{
+				newTestJSONProcedure("example", "Foo::Bar", failEveryThird),
+			}, func(t *testing.T, grpcTestEnv *grpcTestEnv) {
+				request, err := newTestJSONRequest("example", "Foo::Bar", &testBarRequest{One: "hello"})
+				require.NoError(t, err)
+
+				caller := grpcTestEnv.Transport.(MultiCaller)
+				responses, err := caller.CallN(context.Background(), request, n)
+				require.Len(t, responses, n)
+				assert.Equal(t, int32(n), calls.Load(), "server should see every call")
+
+				errs := make([]error, n)
+				if n/3 > 0 {
+					var callNErr *CallNError
+					require.True(t, errors.As(err, &callNErr), "unexpected error: %v", err)
+					require.Len(t, callNErr.Errs, n)
+					assert.Contains(t, err.Error(), fmt.Sprintf("%v of %v calls failed, first was call ", n/3, n))
+					errs = callNErr.Errs
+				} else {
+					require.NoError(t, err)
+				}
+
+				var failed int
+				for i := range responses {
+					if errs[i] != nil {
+						failed++
+						assert.Nil(t, responses[i], "failed call %v should not have a response", i)
+						continue
+					}
+					require.NotNil(t, responses[i], "call %v should have a response", i)
+					assert.JSONEq(t, `{"One":"hello"}`, string(responses[i].Body))
+				}
+				assert.Equal(t, n/3, failed)
+			}, 0)
+		})
+	}
+
+	t.Run("negative", func(t *testing.T) {
+		client, cleanup := newSimpleGRPCClient(t, &simpleSvc{}, GRPCOptions{})
+		defer cleanup()
+
+		request := &Request{TargetService: "Bar", Method: "Bar::Baz", Body: []byte{}}
+		responses, err := client.CallN(context.Background(), request, -1)
+		assert.EqualError(t, err, "number of calls must not be negative, got -1")
+		assert.Nil(t, responses)
+	})
+
+	t.Run("error", func(t *testing.T) {
+		err := &CallNError{Errs: []error{nil, errors.New("first"), nil, errors.New("second")}}
+		assert.EqualError(t, err, "2 of 4 calls failed, first was call 1: first")
+	})
 }
 
-func doWithGRPCTestEnv(
-	t *testing.T,
-	caller string,
-	numInbounds int,
-	procedures []transport.Procedure,
-	f func(*testing.T, *grpcTestEnv),
-	maxResponseSize int,
-) {
-	grpcTestEnv, err := newGRPCTestEnv(caller, numInbounds, procedures, maxResponseSize)
+func TestGRPCMaxQPS(t *testing.T) {
+	const qps = 40
+	client, cleanup := newSimpleGRPCClient(t, &simpleSvc{}, GRPCOptions{MaxQPS: qps})
+	defer cleanup()
+
+	request := &Request{TargetService: "Bar", Method: "Bar::Baz", Body: []byte{}}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// The first call isn't throttled, so n calls take at least (n-1)/qps.
+	const n = 21
+	start := time.Now()
+	_, err := client.CallN(ctx, request, n)
+	elapsed := time.Since(start)
 	require.NoError(t, err)
-	defer func() {
-		assert.NoError(t, grpcTestEnv.Close())
-	}()
-	f(t, grpcTestEnv)
+
+	rate := float64(n-1) / elapsed.Seconds()
+	assert.True(t, rate <= qps*1.05, "observed rate %.1f should not exceed %v QPS", rate, qps)
+	assert.True(t, elapsed < 2*time.Second, "calls took %v, longer than expected", elapsed)
+
+	t.Run("cancelled while throttled", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		_, err := client.Call(ctx, request)
+		assert.Equal(t, context.Canceled, err)
+	})
 }
 
-type grpcTestEnv struct {
-	Caller         string
-	Transport      TransportCloser
-	YARPCTransport *grpc.Transport
-	YARPCInbounds  []*grpc.Inbound
+func newTestBufferPool() *sync.Pool {
+	return &sync.Pool{New: func() interface{} { return new(bytes.Buffer) }}
 }
 
-func newGRPCTestEnv(
-	caller string,
-	numInbounds int,
-	procedures []transport.Procedure,
-	maxResponseSize int,
-) (_ *grpcTestEnv, err error) {
-	options := []grpc.TransportOption{grpc.ServerMaxSendMsgSize(1024 * 1024 * 10)}
-	yarpcTransport := grpc.NewTransport(options...)
-	if err := yarpcTransport.Start(); err != nil {
-		return nil, err
+func TestGRPCResponseBufferPool(t *testing.T) {
+	client, cleanup := newSimpleGRPCClient(t, &simpleSvc{}, GRPCOptions{ResponseBufferPool: newTestBufferPool()})
+	defer cleanup()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	for i := 1; i <= 3; i++ {
+		body, err := proto.Marshal(&simple.Foo{Test: int32(i)})
+		require.NoError(t, err)
+
+		res, err := client.Call(ctx, &Request{TargetService: "Bar", Method: "Bar::Baz", Body: body})
+		require.NoError(t, err)
+		assert.Equal(t, body, res.Body)
+
+		res.Release()
+		assert.Nil(t, res.Body, "body should not be usable after release")
+		res.Release()
 	}
-	defer func() {
-		if err != nil {
-			err = multierr.Append(err, yarpcTransport.Stop())
-		}
-	}()
 
-	addresses := make([]string, numInbounds)
-	yarpcInbounds := make([]*grpc.Inbound, numInbounds)
-	for i := 0; i < numInbounds; i++ {
-		listener, err := net.Listen("tcp", "127.0.0.1:0")
-		if err != nil {
-			return nil, err
-		}
-		addresses[i] = listener.Addr().String()
-		yarpcInbound := yarpcTransport.NewInbound(listener)
-		yarpcInbound.SetRouter(newTestRouter(procedures))
-		if err := yarpcInbound.Start(); err != nil {
-			return nil, err
-		}
-		defer func() {
-			if err != nil {
-				err = multierr.Append(err, yarpcInbound.Stop())
+	t.Run("exceeds max buffered response", func(t *testing.T) {
+		client := &grpcTransport{bufPool: newTestBufferPool(), maxBufferedResponse: 2}
+		_, err := client.yarpcResponseToResponse(&transport.Response{
+			Body: ioutil.NopCloser(bytes.NewReader([]byte("abc"))),
+		})
+		assert.EqualError(t, err, "response body exceeds max buffered response size of 2 bytes")
+	})
+
+	t.Run("release without pool", func(t *testing.T) {
+		res := &Response{Body: []byte("abc")}
+		res.Release()
+		assert.Equal(t, []byte("abc"), res.Body)
+	})
+}
+
+// trackingBody records how much of a response body was read and whether
+// it was closed.
+type trackingBody struct {
+	*bytes.Reader
+	closed bool
+}
+
+func (b *trackingBody) Close() error {
+	b.closed = true
+	return nil
+}
+
+func TestGRPCTruncateResponse(t *testing.T) {
+	tests := []struct {
+		msg           string
+		truncateAt    int
+		maxBuffered   int
+		pool          *sync.Pool
+		wantBody      string
+		wantTruncated bool
+		wantErr       string
+	}{
+		{
+			msg:      "no truncation",
+			wantBody: "hello world",
+		},
+		{
+			msg:           "truncated",
+			truncateAt:    5,
+			wantBody:      "hello",
+			wantTruncated: true,
+		},
+		{
+			msg:           "truncated into pooled buffer",
+			truncateAt:    5,
+			pool:          newTestBufferPool(),
+			wantBody:      "hello",
+			wantTruncated: true,
+		},
+		{
+			msg:        "body fits exactly",
+			truncateAt: 11,
+			wantBody:   "hello world",
+		},
+		{
+			msg:           "truncated body within max buffered",
+			truncateAt:    5,
+			maxBuffered:   8,
+			wantBody:      "hello",
+			wantTruncated: true,
+		},
+		{
+			msg:         "max buffered below truncation",
+			truncateAt:  8,
+			maxBuffered: 5,
+			wantErr:     "response body exceeds max buffered response size of 5 bytes",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.msg, func(t *testing.T) {
+			client := &grpcTransport{
+				bufPool:             tt.pool,
+				maxBufferedResponse: tt.maxBuffered,
+				truncateResponseAt:  tt.truncateAt,
 			}
-		}()
-		yarpcInbounds[i] = yarpcInbound
+			body := &trackingBody{Reader: bytes.NewReader([]byte("hello world"))}
+			res, err := client.yarpcResponseToResponse(&transport.Response{Body: body})
+			assert.True(t, body.closed, "body should be closed")
+			if tt.wantErr != "" {
+				assert.EqualError(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantBody, string(res.Body))
+			assert.Equal(t, tt.wantTruncated, res.Truncated)
+			assert.Zero(t, body.Len(), "rest of the body should be drained")
+			res.Release()
+		})
 	}
+}
 
-	transport, err := NewGRPC(GRPCOptions{
-		Addresses:       addresses,
-		Tracer:          opentracing.NoopTracer{},
-		Caller:          caller,
-		Encoding:        "json",
-		MaxResponseSize: maxResponseSize,
-	})
+func TestGRPCNormalizeEmptyBody(t *testing.T) {
+	tests := []struct {
+		msg       string
+		body      io.ReadCloser
+		normalize bool
+		want      []byte
+	}{
+		{msg: "nil body", want: nil},
+		{msg: "empty body", body: ioutil.NopCloser(bytes.NewReader(nil)), want: []byte{}},
+		{msg: "non-empty body", body: ioutil.NopCloser(strings.NewReader("hello")), want: []byte("hello")},
+		{msg: "normalized nil body", normalize: true, want: []byte{}},
+		{msg: "normalized empty body", body: ioutil.NopCloser(bytes.NewReader(nil)), normalize: true, want: []byte{}},
+		{msg: "normalized non-empty body", body: ioutil.NopCloser(strings.NewReader("hello")), normalize: true, want: []byte("hello")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.msg, func(t *testing.T) {
+			client := &grpcTransport{normalizeEmptyBody: tt.normalize}
+			res, err := client.yarpcResponseToResponse(&transport.Response{Body: tt.body})
+			require.NoError(t, err)
+			defer res.Release()
+			assert.Equal(t, tt.want, res.Body)
+			assert.Equal(t, tt.want == nil, res.Body == nil, "body should be nil only if expected")
+		})
+	}
+}
+
+func BenchmarkGRPCResponseBody(b *testing.B) {
+	data := bytes.Repeat([]byte("x"), 16*1024)
+	benchmarks := []struct {
+		name string
+		pool *sync.Pool
+	}{
+		{name: "ReadAll"},
+		{name: "Pool", pool: newTestBufferPool()},
+	}
+
+	for _, bb := range benchmarks {
+		b.Run(bb.name, func(b *testing.B) {
+			client := &grpcTransport{bufPool: bb.pool}
+			body := bytes.NewReader(data)
+			transportResponse := &transport.Response{Body: ioutil.NopCloser(body)}
+
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				body.Reset(data)
+				res, err := client.yarpcResponseToResponse(transportResponse)
+				if err != nil {
+					b.Fatal(err)
+				}
+				res.Release()
+			}
+		})
+	}
+}
+
+func newTestReaderPool() *sync.Pool {
+	return &sync.Pool{New: func() interface{} { return new(bytes.Reader) }}
+}
+
+func TestGRPCRequestBodyPool(t *testing.T) {
+	pool := newTestReaderPool()
+	client, cleanup := newSimpleGRPCClient(t, &simpleSvc{}, GRPCOptions{RequestBodyPool: pool})
+	defer cleanup()
+
+	for i := 1; i <= 3; i++ {
+		res, err := client.Call(context.Background(), &Request{
+			TargetService: "Bar",
+			Method:        "Bar::Baz",
+			Timeout:       time.Second,
+			Body:          []byte{0x08, byte(i)},
+		})
+		require.NoError(t, err)
+		assert.Equal(t, []byte{0x08, byte(i)}, res.Body, "call %v", i)
+	}
+
+	r := pool.Get().(*bytes.Reader)
+	assert.Zero(t, r.Len(), "pooled readers should not hold on to request bodies")
+}
+
+func BenchmarkGRPCRequestBody(b *testing.B) {
+	data := []byte{0x08, 0x01}
+	benchmarks := []struct {
+		name string
+		pool *sync.Pool
+	}{
+		{name: "NewReader"},
+		{name: "Pool", pool: newTestReaderPool()},
+	}
+
+	for _, bb := range benchmarks {
+		b.Run(bb.name, func(b *testing.B) {
+			client, cleanup := newSimpleGRPCClient(b, &simpleSvc{}, GRPCOptions{RequestBodyPool: bb.pool})
+			defer cleanup()
+			request := &Request{
+				TargetService: "Bar",
+				Method:        "Bar::Baz",
+				Body:          data,
+			}
+
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if _, err := client.Call(context.Background(), request); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func TestGRPCPoolValidation(t *testing.T) {
+	tests := []struct {
+		msg     string
+		options GRPCOptions
+		wantErr string
+	}{
+		{
+			msg:     "request pool without New",
+			options: GRPCOptions{RequestBodyPool: &sync.Pool{}},
+			wantErr: "RequestBodyPool must have a New function",
+		},
+		{
+			msg:     "request pool of the wrong type",
+			options: GRPCOptions{RequestBodyPool: newTestBufferPool()},
+			wantErr: "RequestBodyPool must hold *bytes.Reader values, but New returned *bytes.Buffer",
+		},
+		{
+			msg:     "response pool without New",
+			options: GRPCOptions{ResponseBufferPool: &sync.Pool{}},
+			wantErr: "ResponseBufferPool must have a New function",
+		},
+		{
+			msg:     "response pool of the wrong type",
+			options: GRPCOptions{ResponseBufferPool: newTestReaderPool()},
+			wantErr: "ResponseBufferPool must hold *bytes.Buffer values, but New returned *bytes.Reader",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.msg, func(t *testing.T) {
+			tt.options.Addresses = []string{"127.0.0.1:0"}
+			tt.options.Tracer = opentracing.NoopTracer{}
+			tt.options.Caller = "test"
+			_, err := newGRPC(tt.options)
+			assert.EqualError(t, err, tt.wantErr)
+		})
+	}
+
+	t.Run("values of the wrong type are dropped", func(t *testing.T) {
+		bodyPool := newTestReaderPool()
+		bodyPool.Put("not a reader")
+		bufPool := newTestBufferPool()
+		bufPool.Put("not a buffer")
+		client, cleanup := newSimpleGRPCClient(t, &simpleSvc{}, GRPCOptions{
+			RequestBodyPool:    bodyPool,
+			ResponseBufferPool: bufPool,
+		})
+		defer cleanup()
+
+		res, err := client.Call(context.Background(), &Request{
+			TargetService: "Bar",
+			Method:        "Bar::Baz",
+			Body:          []byte{0x08, 0x01},
+		})
+		require.NoError(t, err)
+		assert.Equal(t, []byte{0x08, 0x01}, res.Body)
+		res.Release()
+	})
+}
+
+func TestGRPCInjectLatency(t *testing.T) {
+	const latency = 100 * time.Millisecond
+	client, cleanup := newSimpleGRPCClient(t, &simpleSvc{}, GRPCOptions{InjectLatency: latency})
+	defer cleanup()
+
+	request := &Request{
+		TargetService: "Bar",
+		Method:        "Bar::Baz",
+		Body:          []byte{},
+	}
+
+	t.Run("delays call", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+
+		start := time.Now()
+		_, err := client.Call(ctx, request)
+		require.NoError(t, err)
+		assert.GreaterOrEqual(t, time.Since(start), latency)
+	})
+
+	t.Run("aborts on cancel", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		time.AfterFunc(10*time.Millisecond, cancel)
+
+		start := time.Now()
+		_, err := client.Call(ctx, request)
+		assert.Equal(t, context.Canceled, err)
+		assert.Less(t, int64(time.Since(start)), int64(latency), "call should return before the injected latency")
+	})
+}
+
+func TestGRPCShardKeyFunc(t *testing.T) {
+	var (
+		mu   sync.Mutex
+		seen []string
+	)
+	recordShardKey := func(ctx context.Context, request *testBarRequest) (*testBarResponse, error) {
+		mu.Lock()
+		seen = append(seen, yarpc.CallFromContext(ctx).ShardKey())
+		mu.Unlock()
+		return &testBarResponse{One: request.One}, nil
+	}
+
+	var next atomic.Int32
+	options := GRPCOptions{
+		Caller: "example-caller",
+		ShardKeyFunc: func() string {
+			return fmt.Sprintf("shard-%v", next.Inc())
+		},
+	}
+	doWithGRPCTestEnvOptions(t, 1, []transport.Procedure{
+		newTestJSONProcedure("example", "Foo::Bar", recordShardKey),
+	}, options, func(t *testing.T, grpcTestEnv *grpcTestEnv) {
+		for i := 0; i < 3; i++ {
+			request, err := newTestJSONRequest("example", "Foo::Bar", &testBarRequest{One: "hello"})
+			require.NoError(t, err)
+			_, err = grpcTestEnv.Transport.Call(context.Background(), request)
+			require.NoError(t, err)
+		}
+
+		request, err := newTestJSONRequest("example", "Foo::Bar", &testBarRequest{One: "hello"})
+		require.NoError(t, err)
+		request.ShardKey = "fixed"
+		_, err = grpcTestEnv.Transport.Call(context.Background(), request)
+		require.NoError(t, err)
+	})
+
+	assert.Equal(t, []string{"shard-1", "shard-2", "shard-3", "fixed"}, seen)
+}
+
+func TestGRPCSigner(t *testing.T) {
+	key := []byte("secret")
+	hmacSigner := func(body []byte) (map[string]string, error) {
+		mac := hmac.New(sha256.New, key)
+		mac.Write(body)
+		return map[string]string{"x-signature": hex.EncodeToString(mac.Sum(nil))}, nil
+	}
+
+	var seen string
+	recordSignature := func(ctx context.Context, request *testBarRequest) (*testBarResponse, error) {
+		seen = yarpc.CallFromContext(ctx).Header("x-signature")
+		return &testBarResponse{One: request.One}, nil
+	}
+
+	options := GRPCOptions{
+		Caller: "example-caller",
+		Signer: hmacSigner,
+	}
+	doWithGRPCTestEnvOptions(t, 1, []transport.Procedure{
+		newTestJSONProcedure("example", "Foo::Bar", recordSignature),
+	}, options, func(t *testing.T, grpcTestEnv *grpcTestEnv) {
+		request, err := newTestJSONRequest("example", "Foo::Bar", &testBarRequest{One: "hello"})
+		require.NoError(t, err)
+		_, err = grpcTestEnv.Transport.Call(context.Background(), request)
+		require.NoError(t, err)
+
+		mac := hmac.New(sha256.New, key)
+		mac.Write(request.Body)
+		assert.Equal(t, hex.EncodeToString(mac.Sum(nil)), seen)
+		assert.Empty(t, request.Headers["x-signature"], "request should not be modified")
+	})
+
+	t.Run("signing error", func(t *testing.T) {
+		client, err := newGRPC(GRPCOptions{
+			Addresses: []string{"127.0.0.1:1"},
+			Tracer:    opentracing.NoopTracer{},
+			Caller:    "example-caller",
+			Signer: func([]byte) (map[string]string, error) {
+				return nil, errors.New("no signing key")
+			},
+		})
+		require.NoError(t, err)
+		defer client.Close()
+
+		_, err = client.Call(context.Background(), &Request{TargetService: "example", Method: "Foo::Bar"})
+		assert.EqualError(t, err, "could not sign request: no signing key")
+	})
+}
+
+func TestGRPCCacheIdempotent(t *testing.T) {
+	var calls atomic.Int32
+	countCalls := func(ctx context.Context, request *testBarRequest) (*testBarResponse, error) {
+		return &testBarResponse{One: fmt.Sprintf("%v-%v", request.One, calls.Inc())}, nil
+	}
+
+	options := GRPCOptions{
+		Caller:          "example-caller",
+		CacheIdempotent: true,
+		CacheMethods:    []string{"Foo::Bar"},
+	}
+	doWithGRPCTestEnvOptions(t, 1, []transport.Procedure{
+		newTestJSONProcedure("example", "Foo::Bar", countCalls),
+		newTestJSONProcedure("example", "Foo::Baz", countCalls),
+	}, options, func(t *testing.T, grpcTestEnv *grpcTestEnv) {
+		call := func(method, one string) string {
+			request, err := newTestJSONRequest("example", method, &testBarRequest{One: one})
+			require.NoError(t, err)
+			res, err := grpcTestEnv.Transport.Call(context.Background(), request)
+			require.NoError(t, err)
+			var body testBarResponse
+			require.NoError(t, json.Unmarshal(res.Body, &body))
+			return body.One
+		}
+
+		assert.Equal(t, "hello-1", call("Foo::Bar", "hello"))
+		assert.Equal(t, "hello-1", call("Foo::Bar", "hello"), "identical request should be served from the cache")
+		assert.Equal(t, int32(1), calls.Load(), "server should only see the first request")
+
+		assert.Equal(t, "world-2", call("Foo::Bar", "world"), "different body should not be cached")
+		assert.Equal(t, "hello-3", call("Foo::Baz", "hello"), "method not in the allowlist")
+		assert.Equal(t, "hello-4", call("Foo::Baz", "hello"), "method not in the allowlist")
+	})
+}
+
+func TestGRPCIncludePeerInResponse(t *testing.T) {
+	echo := func(ctx context.Context, request *testBarRequest) (*testBarResponse, error) {
+		return &testBarResponse{One: request.One}, nil
+	}
+
+	for _, include := range []bool{false, true} {
+		t.Run(fmt.Sprint("include=", include), func(t *testing.T) {
+			var addresses []string
+			options := GRPCOptions{
+				Caller:                "example-caller",
+				IncludePeerInResponse: include,
+			}
+			doWithGRPCTestEnvOptions(t, 2, []transport.Procedure{
+				newTestJSONProcedure("example", "Foo::Bar", echo),
+			}, options, func(t *testing.T, grpcTestEnv *grpcTestEnv) {
+				for _, inbound := range grpcTestEnv.YARPCInbounds {
+					addresses = append(addresses, inbound.Addr().String())
+				}
+
+				seen := make(map[string]struct{})
+				for i := 0; i < 10; i++ {
+					request, err := newTestJSONRequest("example", "Foo::Bar", &testBarRequest{One: "hello"})
+					require.NoError(t, err)
+					res, err := grpcTestEnv.Transport.Call(context.Background(), request)
+					require.NoError(t, err)
+					if !include {
+						assert.Empty(t, res.PeerAddress)
+						continue
+					}
+					assert.Contains(t, addresses, res.PeerAddress)
+					seen[res.PeerAddress] = struct{}{}
+				}
+				if include {
+					assert.Len(t, seen, 2, "calls should be spread across both peers")
+				}
+			})
+		})
+	}
+}
+
+func TestGRPCAddRemovePeer(t *testing.T) {
+	echo := func(ctx context.Context, request *testBarRequest) (*testBarResponse, error) {
+		return &testBarResponse{One: request.One}, nil
+	}
+
+	options := GRPCOptions{
+		Caller:                "example-caller",
+		IncludePeerInResponse: true,
+	}
+	doWithGRPCTestEnvOptions(t, 2, []transport.Procedure{
+		newTestJSONProcedure("example", "Foo::Bar", echo),
+	}, options, func(t *testing.T, grpcTestEnv *grpcTestEnv) {
+		first := grpcTestEnv.YARPCInbounds[0].Addr().String()
+		second := grpcTestEnv.YARPCInbounds[1].Addr().String()
+		updater := grpcTestEnv.Transport.(PeerUpdater)
+
+		peersCalled := func() map[string]int {
+			seen := make(map[string]int)
+			for i := 0; i < 10; i++ {
+				request, err := newTestJSONRequest("example", "Foo::Bar", &testBarRequest{One: "hello"})
+				require.NoError(t, err)
+				res, err := grpcTestEnv.Transport.Call(context.Background(), request)
+				require.NoError(t, err)
+				seen[res.PeerAddress]++
+			}
+			return seen
+		}
+
+		assert.Len(t, peersCalled(), 2, "both peers should be called")
+
+		require.NoError(t, updater.RemovePeer(second))
+		assert.Equal(t, map[string]int{first: 10}, peersCalled(), "removed peer should not be called")
+
+		require.NoError(t, updater.AddPeer(second))
+		assert.Eventually(t, func() bool {
+			return len(peersCalled()) == 2
+		}, time.Second, 10*time.Millisecond, "added peer should be called once it's connected")
+
+		assert.Equal(t, errGRPCNoAddress, updater.AddPeer(""))
+		assert.Equal(t, errGRPCNoAddress, updater.RemovePeer(""))
+		err := updater.RemovePeer("127.0.0.1:1")
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), `could not remove grpc peer "127.0.0.1:1"`)
+	})
+}
+
+// blockingBazSvc blocks Baz calls until released, signalling when each
+// call starts.
+type blockingBazSvc struct {
+	simpleSvc
+
+	started chan struct{}
+	release chan struct{}
+}
+
+func (s *blockingBazSvc) Baz(ctx context.Context, in *simple.Foo) (*simple.Foo, error) {
+	select {
+	case s.started <- struct{}{}:
+	default:
+	}
+	select {
+	case <-s.release:
+	case <-ctx.Done():
+	}
+	return in, nil
+}
+
+func TestGRPCRemovePeerDrains(t *testing.T) {
+	tests := []struct {
+		msg          string
+		drainTimeout time.Duration
+		wantErr      bool
+	}{
+		{msg: "pending call finishes", drainTimeout: 5 * time.Second},
+		{msg: "drain timeout", drainTimeout: 50 * time.Millisecond, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.msg, func(t *testing.T) {
+			lis, err := net.Listen("tcp", "127.0.0.1:0")
+			require.NoError(t, err)
+			svc := &blockingBazSvc{started: make(chan struct{}, 1), release: make(chan struct{})}
+			server := googlegrpc.NewServer()
+			simple.RegisterBarServer(server, svc)
+			go server.Serve(lis)
+			defer server.Stop()
+
+			client, err := newGRPC(GRPCOptions{
+				Addresses:        []string{lis.Addr().String()},
+				Tracer:           opentracing.NoopTracer{},
+				Caller:           "test",
+				Encoding:         "proto",
+				PeerDrainTimeout: tt.drainTimeout,
+			})
+			require.NoError(t, err)
+			defer client.Close()
+
+			errs := make(chan error, 1)
+			go func() {
+				_, err := client.Call(context.Background(), &Request{
+					TargetService: "Bar",
+					Method:        "Bar::Baz",
+					Timeout:       5 * time.Second,
+					Body:          []byte{0x08, 1},
+				})
+				errs <- err
+			}()
+			<-svc.started
+
+			require.NoError(t, client.RemovePeer(lis.Addr().String()))
+			time.Sleep(200 * time.Millisecond)
+			close(svc.release)
+
+			err = <-errs
+			if tt.wantErr {
+				assert.Error(t, err, "call should fail once the drain timeout closes the connection")
+				return
+			}
+			assert.NoError(t, err, "pending call should finish on the removed peer")
+		})
+	}
+}
+
+func TestGRPCAddPeerExpandEnv(t *testing.T) {
+	os.Unsetenv("YAB_TEST_GRPC_UNSET")
+	client, err := newGRPC(GRPCOptions{
+		Addresses: []string{"127.0.0.1:1"},
+		Tracer:    opentracing.NoopTracer{},
+		Caller:    "example-caller",
+		ExpandEnv: true,
+	})
+	require.NoError(t, err)
+	defer client.Close()
+
+	err = client.AddPeer("${YAB_TEST_GRPC_UNSET}:1234")
+	assert.EqualError(t, err, `grpc address "${YAB_TEST_GRPC_UNSET}:1234" references unset environment variable "YAB_TEST_GRPC_UNSET"`)
+}
+
+func TestGRPCWaitForPeers(t *testing.T) {
+	startServer := func(lis net.Listener) func() {
+		server := googlegrpc.NewServer()
+		simple.RegisterBarServer(server, &simpleSvc{})
+		go server.Serve(lis)
+		return server.Stop
+	}
+
+	// The first peer is up from the start, the second only after the
+	// first wait.
+	first, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer startServer(first)()
+
+	reserved, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	secondAddr := reserved.Addr().String()
+	require.NoError(t, reserved.Close())
+
+	client, err := newGRPC(GRPCOptions{
+		Addresses: []string{first.Addr().String(), secondAddr},
+		Tracer:    opentracing.NoopTracer{},
+		Caller:    "example-caller",
+	})
+	require.NoError(t, err)
+	defer client.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	require.NoError(t, client.WaitForPeers(ctx, 1))
+
+	shortCtx, shortCancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer shortCancel()
+	err = client.WaitForPeers(shortCtx, 2)
+	assert.EqualError(t, err, "only 1 of 2 required grpc peers were available: context deadline exceeded")
+
+	second, err := net.Listen("tcp", secondAddr)
+	require.NoError(t, err)
+	defer startServer(second)()
+	require.NoError(t, client.WaitForPeers(ctx, 2))
+}
+
+func TestGRPCConnectionCallbacks(t *testing.T) {
+	reserved, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	addr := reserved.Addr().String()
+	require.NoError(t, reserved.Close())
+
+	// The channels are unbuffered, so the callbacks block until the test
+	// receives from them.
+	connected := make(chan string)
+	disconnected := make(chan string)
+	client, err := newGRPC(GRPCOptions{
+		Addresses:    []string{addr},
+		Tracer:       opentracing.NoopTracer{},
+		Caller:       "example-caller",
+		OnConnect:    func(addr string) { connected <- addr },
+		OnDisconnect: func(addr string) { disconnected <- addr },
+	})
+	require.NoError(t, err)
+	defer client.Close()
+
+	select {
+	case addr := <-connected:
+		t.Fatalf("OnConnect called with %v before the peer was up", addr)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	lis, err := net.Listen("tcp", addr)
+	require.NoError(t, err)
+	server := googlegrpc.NewServer()
+	simple.RegisterBarServer(server, &simpleSvc{})
+	go server.Serve(lis)
+
+	// A blocked callback should not stop the transport from using the peer.
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	require.NoError(t, client.WaitForPeers(ctx, 1))
+
+	select {
+	case got := <-connected:
+		assert.Equal(t, addr, got)
+	case <-ctx.Done():
+		t.Fatal("OnConnect was not called after the peer came up")
+	}
+
+	server.Stop()
+	select {
+	case got := <-disconnected:
+		assert.Equal(t, addr, got)
+	case <-ctx.Done():
+		t.Fatal("OnDisconnect was not called after the peer went down")
+	}
+}
+
+func TestGRPCTimeoutJitter(t *testing.T) {
+	tests := []struct {
+		msg     string
+		timeout time.Duration
+		jitter  time.Duration
+		wantMin time.Duration
+		wantMax time.Duration
+	}{
+		{
+			msg:     "no jitter",
+			timeout: time.Second,
+			wantMin: time.Second,
+			wantMax: time.Second,
+		},
+		{
+			msg:     "jitter within range",
+			timeout: time.Second,
+			jitter:  200 * time.Millisecond,
+			wantMin: 800 * time.Millisecond,
+			wantMax: 1200 * time.Millisecond,
+		},
+		{
+			msg:     "jitter larger than timeout",
+			timeout: 10 * time.Millisecond,
+			jitter:  time.Second,
+			wantMin: time.Millisecond,
+			wantMax: 1010 * time.Millisecond,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.msg, func(t *testing.T) {
+			transport, err := newGRPC(GRPCOptions{
+				Addresses:     []string{"127.0.0.1:0"},
+				Tracer:        opentracing.NoopTracer{},
+				Caller:        "example-caller",
+				TimeoutJitter: tt.jitter,
+			})
+			require.NoError(t, err)
+			defer transport.Close()
+			transport.rand = rand.New(rand.NewSource(1))
+
+			seen := make(map[time.Duration]struct{})
+			for i := 0; i < 100; i++ {
+				got := transport.jitterTimeout(tt.timeout)
+				assert.True(t, got >= tt.wantMin && got <= tt.wantMax, "timeout %v not in [%v, %v]", got, tt.wantMin, tt.wantMax)
+				seen[got] = struct{}{}
+			}
+			if tt.jitter > 0 {
+				assert.True(t, len(seen) > 1, "jitter should vary the timeout")
+			}
+
+			start := time.Now()
+			ctx, cancel, err := transport.requestContextWithTimeout(context.Background(), &Request{Timeout: tt.timeout})
+			require.NoError(t, err)
+			defer cancel()
+			deadline, ok := ctx.Deadline()
+			require.True(t, ok)
+			assert.True(t, deadline.Sub(start) <= tt.wantMax+50*time.Millisecond, "deadline should be within the jitter range")
+		})
+	}
+}
+
+func TestGRPCDeadlineHeader(t *testing.T) {
+	tests := []struct {
+		msg     string
+		timeout time.Duration
+		headers map[string]string
+		want    time.Duration
+		wantErr string
+	}{
+		{
+			msg:  "no header uses the default",
+			want: time.Second,
+		},
+		{
+			msg:     "header sets timeout",
+			headers: map[string]string{"x-deadline-ms": "250"},
+			want:    250 * time.Millisecond,
+		},
+		{
+			msg:     "header name is case-insensitive",
+			headers: map[string]string{"X-Deadline-Ms": "3000"},
+			want:    3 * time.Second,
+		},
+		{
+			msg:     "request timeout takes precedence",
+			timeout: 2 * time.Second,
+			headers: map[string]string{"x-deadline-ms": "250"},
+			want:    2 * time.Second,
+		},
+		{
+			msg:     "not a number",
+			headers: map[string]string{"x-deadline-ms": "soon"},
+			wantErr: `invalid x-deadline-ms header "soon": must be a positive number of milliseconds`,
+		},
+		{
+			msg:     "not positive",
+			headers: map[string]string{"x-deadline-ms": "0"},
+			wantErr: `invalid x-deadline-ms header "0": must be a positive number of milliseconds`,
+		},
+	}
+
+	transport, err := newGRPC(GRPCOptions{
+		Addresses: []string{"127.0.0.1:1"},
+		Tracer:    opentracing.NoopTracer{},
+		Caller:    "example-caller",
+	})
+	require.NoError(t, err)
+	defer transport.Close()
+
+	for _, tt := range tests {
+		t.Run(tt.msg, func(t *testing.T) {
+			request := &Request{
+				TargetService: "example",
+				Method:        "Foo::Bar",
+				Timeout:       tt.timeout,
+				Headers:       tt.headers,
+			}
+			start := time.Now()
+			ctx, cancel, err := transport.requestContextWithTimeout(context.Background(), request)
+			if tt.wantErr != "" {
+				assert.EqualError(t, err, tt.wantErr)
+				_, err = transport.Call(context.Background(), request)
+				assert.EqualError(t, err, tt.wantErr, "Call should fail before sending the request")
+				return
+			}
+			require.NoError(t, err)
+			defer cancel()
+			deadline, ok := ctx.Deadline()
+			require.True(t, ok)
+			assert.WithinDuration(t, start.Add(tt.want), deadline, 50*time.Millisecond)
+		})
+	}
+}
+
+// idleClosingProxy forwards connections to addr, and closes them once they've
+// been idle for longer than idle. If closeIdle is set, the first connection
+// to go idle is closed right away, as a server with a short idle timeout
+// does. Otherwise, the next data sent by the client is dropped and the
+// connection closed, as happens when the server's close races with a new
+// request.
+type idleClosingProxy struct {
+	lis       net.Listener
+	addr      string
+	idle      time.Duration
+	closeIdle bool
+	closed    atomic.Bool
+}
+
+func newIdleClosingProxy(t *testing.T, addr string, idle time.Duration, closeIdle bool) *idleClosingProxy {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	p := &idleClosingProxy{lis: lis, addr: addr, idle: idle, closeIdle: closeIdle}
+	go p.serve()
+	return p
+}
+
+func (p *idleClosingProxy) serve() {
+	for {
+		client, err := p.lis.Accept()
+		if err != nil {
+			return
+		}
+		go p.forward(client)
+	}
+}
+
+func (p *idleClosingProxy) forward(client net.Conn) {
+	defer client.Close()
+	server, err := net.Dial("tcp", p.addr)
+	if err != nil {
+		return
+	}
+	defer server.Close()
+
+	lastActive := atomic.NewInt64(time.Now().UnixNano())
+	idle := func() bool {
+		return time.Since(time.Unix(0, lastActive.Load())) > p.idle
+	}
+	if p.closeIdle {
+		go func() {
+			ticker := time.NewTicker(p.idle / 10)
+			defer ticker.Stop()
+			for range ticker.C {
+				if idle() {
+					if p.closed.CAS(false, true) {
+						client.Close()
+					}
+					return
+				}
+			}
+		}()
+	}
+	go func() {
+		buf := make([]byte, 32*1024)
+		for {
+			n, err := server.Read(buf)
+			if err != nil {
+				client.Close()
+				return
+			}
+			lastActive.Store(time.Now().UnixNano())
+			if _, err := client.Write(buf[:n]); err != nil {
+				return
+			}
+		}
+	}()
+
+	buf := make([]byte, 32*1024)
+	for {
+		n, err := client.Read(buf)
+		if err != nil {
+			return
+		}
+		if !p.closeIdle && idle() {
+			return
+		}
+		lastActive.Store(time.Now().UnixNano())
+		if _, err := server.Write(buf[:n]); err != nil {
+			return
+		}
+	}
+}
+
+func (p *idleClosingProxy) Addr() string { return p.lis.Addr().String() }
+
+func (p *idleClosingProxy) Close() error { return p.lis.Close() }
+
+func TestGRPCReconnectOnIdleClose(t *testing.T) {
+	tests := []struct {
+		msg string
+		// closeIdle closes the connection while it's idle, before the
+		// second call. Otherwise, it's closed as the second call is sent,
+		// so it's only retried with an idempotency key.
+		closeIdle bool
+		key       string
+		disable   bool
+		wantErr   bool
+	}{
+		{msg: "closed while idle", closeIdle: true},
+		{msg: "closed while idle with idempotency key", closeIdle: true, key: "k1"},
+		{msg: "closed while sending", wantErr: true},
+		{msg: "closed while sending with idempotency key", key: "k1"},
+		{msg: "closed while sending with reconnect disabled", key: "k1", disable: true, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.msg, func(t *testing.T) {
+			lis, err := net.Listen("tcp", "127.0.0.1:0")
+			require.NoError(t, err)
+			server := googlegrpc.NewServer()
+			simple.RegisterBarServer(server, &simpleSvc{})
+			go server.Serve(lis)
+			defer server.Stop()
+
+			proxy := newIdleClosingProxy(t, lis.Addr().String(), 50*time.Millisecond, tt.closeIdle)
+			defer proxy.Close()
+
+			client, err := newGRPC(GRPCOptions{
+				Addresses:            []string{proxy.Addr()},
+				Tracer:               opentracing.NoopTracer{},
+				Caller:               "test",
+				Encoding:             "proto",
+				DisableIdleReconnect: tt.disable,
+			})
+			require.NoError(t, err)
+			defer client.Close()
+
+			request := &Request{
+				TargetService:  "Bar",
+				Method:         "Bar::Baz",
+				Body:           []byte{0x08, 1},
+				Timeout:        time.Second,
+				IdempotencyKey: tt.key,
+			}
+			_, err = client.Call(context.Background(), request)
+			require.NoError(t, err, "first call failed")
+
+			time.Sleep(100 * time.Millisecond)
+			_, err = client.Call(context.Background(), request)
+			if tt.wantErr {
+				require.Error(t, err, "call on the closed connection should fail")
+				assert.Equal(t, yarpcerrors.CodeUnavailable, yarpcerrors.FromError(err).Code(), "unexpected error: %v", err)
+				return
+			}
+			assert.NoError(t, err, "call after idle close should reconnect")
+		})
+	}
+}
+
+// stalePeer is a peer whose connection status is set by the test.
+type stalePeer struct {
+	id     string
+	status *atomic.Int32
+}
+
+func (p stalePeer) Identifier() string { return p.id }
+
+func (p stalePeer) Status() apipeer.Status {
+	return apipeer.Status{ConnectionStatus: apipeer.ConnectionStatus(p.status.Load())}
+}
+
+func (p stalePeer) StartRequest() {}
+
+func (p stalePeer) EndRequest() {}
+
+// stalePeerList always chooses the same peer, and records the errors its
+// calls finish with.
+type stalePeerList struct {
+	apipeer.ChooserList
+
+	peer     stalePeer
+	chosen   atomic.Int32
+	finished []error
+}
+
+func (l *stalePeerList) Choose(ctx context.Context, req *transport.Request) (apipeer.Peer, func(error), error) {
+	// The peer reconnects after being chosen twice.
+	if l.chosen.Inc() == 2 {
+		l.peer.status.Store(int32(apipeer.Available))
+	}
+	return l.peer, func(err error) { l.finished = append(l.finished, err) }, nil
+}
+
+func TestReconnectingListClosedPeer(t *testing.T) {
+	tests := []struct {
+		msg        string
+		disabled   bool
+		wantChosen int32
+		wantErr    string
+	}{
+		{msg: "reconnect", wantChosen: 2},
+		{
+			msg:        "disabled",
+			disabled:   true,
+			wantChosen: 1,
+			wantErr:    "connection to peer 1.1.1.1:1 was closed before the request was sent",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.msg, func(t *testing.T) {
+			list := &stalePeerList{peer: stalePeer{id: "1.1.1.1:1", status: atomic.NewInt32(int32(apipeer.Unavailable))}}
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+			defer cancel()
+
+			p, onFinish, err := reconnectingList{list, tt.disabled}.Choose(ctx, &transport.Request{})
+			assert.Equal(t, tt.wantChosen, list.chosen.Load())
+			require.Len(t, list.finished, 1, "the closed peer's call should be finished")
+			assert.Equal(t, yarpcerrors.CodeUnavailable, yarpcerrors.FromError(list.finished[0]).Code())
+			if tt.wantErr != "" {
+				assert.Contains(t, err.Error(), tt.wantErr)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, apipeer.Available, p.Status().ConnectionStatus)
+			onFinish(nil)
+			assert.Len(t, list.finished, 2)
+		})
+	}
+}
+
+// delegateRecordingSvc counts calls by their routing delegate.
+type delegateRecordingSvc struct {
+	simpleSvc
+
+	mu        sync.Mutex
+	delegates map[string]int
+}
+
+func (s *delegateRecordingSvc) Baz(ctx context.Context, in *simple.Foo) (*simple.Foo, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.delegates[strings.Join(md.Get(grpc.RoutingDelegateHeader), ",")]++
+	return in, nil
+}
+
+func TestGRPCRoutingDelegateSplit(t *testing.T) {
+	const calls = 2000
+	svc := &delegateRecordingSvc{delegates: make(map[string]int)}
+	client, cleanup := newSimpleGRPCClient(t, svc, GRPCOptions{
+		RoutingDelegateSplit: map[string]int{"v1": 70, "v2": 30, "unused": 0},
+	})
+	defer cleanup()
+
+	for i := 0; i < calls; i++ {
+		_, err := client.Call(context.Background(), &Request{
+			TargetService: "Bar",
+			Method:        "Bar::Baz",
+			Timeout:       time.Second,
+			Body:          []byte{},
+		})
+		require.NoError(t, err)
+	}
+
+	assert.Len(t, svc.delegates, 2, "only delegates with a weight should be used: %v", svc.delegates)
+	assert.InDelta(t, 0.7*calls, svc.delegates["v1"], 0.05*calls, "v1 calls")
+	assert.InDelta(t, 0.3*calls, svc.delegates["v2"], 0.05*calls, "v2 calls")
+}
+
+func TestGRPCRoutingDelegateSplitInvalid(t *testing.T) {
+	tests := []struct {
+		msg     string
+		opts    GRPCOptions
+		wantErr string
+	}{
+		{
+			msg:     "with routing delegate",
+			opts:    GRPCOptions{RoutingDelegate: "v1", RoutingDelegateSplit: map[string]int{"v2": 1}},
+			wantErr: errRoutingDelegateSplitConflict.Error(),
+		},
+		{
+			msg:     "negative weight",
+			opts:    GRPCOptions{RoutingDelegateSplit: map[string]int{"v1": 1, "v2": -1}},
+			wantErr: `routing delegate "v2" has negative weight -1`,
+		},
+		{
+			msg:     "no weight",
+			opts:    GRPCOptions{RoutingDelegateSplit: map[string]int{"v1": 0}},
+			wantErr: errRoutingDelegateSplitNoWeight.Error(),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.msg, func(t *testing.T) {
+			tt.opts.Addresses = []string{"127.0.0.1:0"}
+			tt.opts.Tracer = opentracing.NoopTracer{}
+			tt.opts.Caller = "test"
+			_, err := newGRPC(tt.opts)
+			assert.EqualError(t, err, tt.wantErr)
+		})
+	}
+}
+
+func TestGRPCShouldRetryConnectionClosed(t *testing.T) {
+	tests := []struct {
+		msg              string
+		err              error
+		wantRetry        bool
+		wantRetryWithKey bool
+	}{
+		{
+			msg:              "transport closing before send",
+			err:              yarpcerrors.UnavailableErrorf("transport is closing"),
+			wantRetry:        true,
+			wantRetryWithKey: true,
+		},
+		{
+			msg:              "connection refused",
+			err:              yarpcerrors.UnavailableErrorf(`connection error: desc = "transport: Error while dialing dial tcp 127.0.0.1:1: connect: connection refused"`),
+			wantRetry:        true,
+			wantRetryWithKey: true,
+		},
+		{
+			msg:              "connection lost after send",
+			err:              yarpcerrors.UnavailableErrorf("error reading from server: EOF"),
+			wantRetryWithKey: true,
+		},
+		{
+			msg:              "connection error after send",
+			err:              yarpcerrors.UnavailableErrorf(`connection error: desc = "transport: write: broken pipe"`),
+			wantRetryWithKey: true,
+		},
+		{
+			msg: "server unavailable",
+			err: yarpcerrors.UnavailableErrorf("server is draining"),
+		},
+		{
+			msg: "other code",
+			err: yarpcerrors.InternalErrorf("transport is closing"),
+		},
+	}
+
+	tr := &grpcTransport{idleReconnect: true}
+	for _, tt := range tests {
+		t.Run(tt.msg, func(t *testing.T) {
+			assert.Equal(t, tt.wantRetry, tr.shouldRetry(&Request{}, tt.err), "without idempotency key")
+			withKey := &Request{Headers: map[string]string{IdempotencyKeyHeader: "k1"}}
+			assert.Equal(t, tt.wantRetryWithKey, tr.shouldRetry(withKey, tt.err), "with idempotency key")
+		})
+	}
+}
+
+type testBarRequest struct {
+	One   string
+	Error string
+	Size  int
+}
+
+type testBarResponse struct {
+	One string
+}
+
+func testBar(ctx context.Context, request *testBarRequest) (*testBarResponse, error) {
+	if request == nil {
+		return nil, nil
+	}
+	if request.Error != "" {
+		return nil, errors.New(request.Error)
+	}
+	return &testBarResponse{
+		One: request.One,
+	}, nil
+}
+
+func testLargeResponse(ctx context.Context, request *testBarRequest) (*testBarResponse, error) {
+	return &testBarResponse{
+		// filling One with non-zero value to avoid html-escape in json encoder
+		One: strings.Repeat("a", request.Size),
+	}, nil
+}
+
+func newTestJSONRequest(service string, method string, request interface{}) (*Request, error) {
+	body, err := json.Marshal(request)
+	if err != nil {
+		return nil, err
+	}
+	return &Request{
+		TargetService: service,
+		Method:        method,
+		Body:          body,
+	}, nil
+}
+
+func newTestJSONProcedure(service string, name string, handler interface{}) transport.Procedure {
+	procedure := yarpcjson.Procedure(name, handler)[0]
+	procedure.Service = service
+	return procedure
+}
+
+func doWithGRPCTestEnv(
+	t *testing.T,
+	caller string,
+	numInbounds int,
+	procedures []transport.Procedure,
+	f func(*testing.T, *grpcTestEnv),
+	maxResponseSize int,
+) {
+	doWithGRPCTestEnvOptions(t, numInbounds, procedures, GRPCOptions{
+		Caller:          caller,
+		MaxResponseSize: maxResponseSize,
+	}, f)
+}
+
+// doWithGRPCTestEnvOptions is like doWithGRPCTestEnv, but creates the
+// transport with the given options. Addresses, Tracer and Encoding are
+// filled in if they are not set.
+func doWithGRPCTestEnvOptions(
+	t *testing.T,
+	numInbounds int,
+	procedures []transport.Procedure,
+	options GRPCOptions,
+	f func(*testing.T, *grpcTestEnv),
+) {
+	grpcTestEnv, err := newGRPCTestEnv(numInbounds, procedures, options)
+	require.NoError(t, err)
+	defer func() {
+		assert.NoError(t, grpcTestEnv.Close())
+	}()
+	f(t, grpcTestEnv)
+}
+
+type grpcTestEnv struct {
+	Caller         string
+	Transport      TransportCloser
+	YARPCTransport *grpc.Transport
+	YARPCInbounds  []*grpc.Inbound
+}
+
+func newGRPCTestEnv(
+	numInbounds int,
+	procedures []transport.Procedure,
+	options GRPCOptions,
+) (_ *grpcTestEnv, err error) {
+	transportOptions := []grpc.TransportOption{grpc.ServerMaxSendMsgSize(1024 * 1024 * 10)}
+	yarpcTransport := grpc.NewTransport(transportOptions...)
+	if err := yarpcTransport.Start(); err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err != nil {
+			err = multierr.Append(err, yarpcTransport.Stop())
+		}
+	}()
+
+	addresses := make([]string, numInbounds)
+	yarpcInbounds := make([]*grpc.Inbound, numInbounds)
+	for i := 0; i < numInbounds; i++ {
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			return nil, err
+		}
+		addresses[i] = listener.Addr().String()
+		yarpcInbound := yarpcTransport.NewInbound(listener)
+		yarpcInbound.SetRouter(newTestRouter(procedures))
+		if err := yarpcInbound.Start(); err != nil {
+			return nil, err
+		}
+		defer func() {
+			if err != nil {
+				err = multierr.Append(err, yarpcInbound.Stop())
+			}
+		}()
+		yarpcInbounds[i] = yarpcInbound
+	}
+
+	if options.Addresses == nil {
+		options.Addresses = addresses
+	}
+	if options.Tracer == nil {
+		options.Tracer = opentracing.NoopTracer{}
+	}
+	if options.Encoding == "" {
+		options.Encoding = "json"
+	}
+	transport, err := NewGRPC(options)
 	if err != nil {
 		return nil, err
 	}
 
 	return &grpcTestEnv{
-		caller,
+		options.Caller,
 		transport,
 		yarpcTransport,
 		yarpcInbounds,
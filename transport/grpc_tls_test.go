@@ -0,0 +1,473 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package transport
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/opentracing/opentracing-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testTLSFiles struct {
+	CAPath, CertPath, KeyPath string
+
+	cert tls.Certificate
+}
+
+// writeTestTLSFiles writes a self-signed certificate, used as both the CA and
+// the client certificate, to a temporary directory.
+func writeTestTLSFiles(t *testing.T) testTLSFiles {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "yab-test"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+		DNSNames:              []string{"stub.fake"},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+
+	dir := t.TempDir()
+	files := testTLSFiles{
+		CAPath:   filepath.Join(dir, "ca.pem"),
+		CertPath: filepath.Join(dir, "cert.pem"),
+		KeyPath:  filepath.Join(dir, "key.pem"),
+	}
+	require.NoError(t, ioutil.WriteFile(files.CAPath, certPEM, 0644))
+	require.NoError(t, ioutil.WriteFile(files.CertPath, certPEM, 0644))
+	require.NoError(t, ioutil.WriteFile(files.KeyPath, keyPEM, 0600))
+
+	files.cert, err = tls.X509KeyPair(certPEM, keyPEM)
+	require.NoError(t, err)
+	return files
+}
+
+// startTLSStub accepts TLS connections using config and reports the result
+// of each handshake.
+func startTLSStub(t *testing.T, config *tls.Config) (addr string, handshakes <-chan error) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { lis.Close() })
+
+	results := make(chan error, 16)
+	go func() {
+		for {
+			conn, err := lis.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				tlsConn := tls.Server(conn, config)
+				tlsConn.SetDeadline(time.Now().Add(time.Second))
+				select {
+				case results <- tlsConn.Handshake():
+				default:
+				}
+			}()
+		}
+	}()
+	return lis.Addr().String(), results
+}
+
+// newTLSTestClient returns a client using the certificate in files, which
+// is also trusted as the CA unless options set CAPath or CADir.
+func newTLSTestClient(t *testing.T, addr string, files testTLSFiles, options GRPCOptions) *grpcTransport {
+	options.Addresses = []string{addr}
+	options.Tracer = opentracing.NoopTracer{}
+	options.Caller = "test"
+	if !options.hasCA() {
+		options.CAPath = files.CAPath
+	}
+	options.CertPath = files.CertPath
+	options.PrivateKeyPath = files.KeyPath
+	client, err := newGRPC(options)
+	require.NoError(t, err)
+	t.Cleanup(func() { client.Close() })
+	return client
+}
+
+// dialTLSStub makes a call to force a connection and returns the result of
+// the first handshake.
+func dialTLSStub(t *testing.T, client *grpcTransport, handshakes <-chan error) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	_, err := client.Call(ctx, &Request{TargetService: "svc", Method: "Svc::Method"})
+	require.Error(t, err, "the stub does not serve gRPC")
+
+	select {
+	case err := <-handshakes:
+		return err
+	case <-time.After(time.Second):
+		t.Fatal("no handshake with the stub server")
+		return nil
+	}
+}
+
+func TestGRPCTLSVersion(t *testing.T) {
+	files := writeTestTLSFiles(t)
+	tls11Only := &tls.Config{
+		Certificates: []tls.Certificate{files.cert},
+		MinVersion:   tls.VersionTLS10,
+		MaxVersion:   tls.VersionTLS11,
+	}
+
+	t.Run("default rejects TLS 1.1", func(t *testing.T) {
+		addr, handshakes := startTLSStub(t, tls11Only)
+		client := newTLSTestClient(t, addr, files, GRPCOptions{})
+		err := dialTLSStub(t, client, handshakes)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "unsupported versions")
+	})
+
+	t.Run("explicit min allows TLS 1.1", func(t *testing.T) {
+		addr, handshakes := startTLSStub(t, tls11Only)
+		client := newTLSTestClient(t, addr, files, GRPCOptions{TLSMinVersion: tls.VersionTLS11})
+		assert.NoError(t, dialTLSStub(t, client, handshakes))
+	})
+}
+
+func TestGRPCCipherSuites(t *testing.T) {
+	files := writeTestTLSFiles(t)
+	offered := make(chan []uint16, 1)
+	addr, handshakes := startTLSStub(t, &tls.Config{
+		Certificates: []tls.Certificate{files.cert},
+		GetConfigForClient: func(hello *tls.ClientHelloInfo) (*tls.Config, error) {
+			select {
+			case offered <- hello.CipherSuites:
+			default:
+			}
+			return nil, nil
+		},
+	})
+
+	suites := []uint16{tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256, tls.TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305}
+	client := newTLSTestClient(t, addr, files, GRPCOptions{
+		// TLS 1.3 always offers its own suites, so limit to TLS 1.2.
+		TLSMaxVersion: tls.VersionTLS12,
+		CipherSuites:  suites,
+	})
+	assert.NoError(t, dialTLSStub(t, client, handshakes))
+	assert.ElementsMatch(t, suites, <-offered)
+}
+
+func TestNewTLSConfig(t *testing.T) {
+	files := writeTestTLSFiles(t)
+	tests := []struct {
+		msg     string
+		min     uint16
+		max     uint16
+		suites  []uint16
+		wantMin uint16
+		wantErr string
+	}{
+		{
+			msg:     "defaults",
+			wantMin: tls.VersionTLS12,
+		},
+		{
+			msg:     "min and max",
+			min:     tls.VersionTLS12,
+			max:     tls.VersionTLS13,
+			wantMin: tls.VersionTLS12,
+		},
+		{
+			msg:     "min greater than max",
+			min:     tls.VersionTLS13,
+			max:     tls.VersionTLS12,
+			wantErr: "TLS min version 0x304 is greater than max version 0x303",
+		},
+		{
+			msg:     "default min greater than max",
+			max:     tls.VersionTLS11,
+			wantErr: "TLS min version 0x303 is greater than max version 0x302",
+		},
+		{
+			msg:     "known cipher suites",
+			suites:  []uint16{tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256, tls.TLS_RSA_WITH_RC4_128_SHA},
+			wantMin: tls.VersionTLS12,
+		},
+		{
+			msg:     "unknown cipher suite",
+			suites:  []uint16{tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256, 0x1234},
+			wantErr: "unknown TLS cipher suite 0x1234",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.msg, func(t *testing.T) {
+			config, err := newTLSConfig(GRPCOptions{
+				CAPath:         files.CAPath,
+				CertPath:       files.CertPath,
+				PrivateKeyPath: files.KeyPath,
+				TLSMinVersion:  tt.min,
+				TLSMaxVersion:  tt.max,
+				CipherSuites:   tt.suites,
+			}, nopLogger{})
+			if tt.wantErr != "" {
+				assert.EqualError(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantMin, config.MinVersion)
+			assert.Equal(t, tt.max, config.MaxVersion)
+			assert.Equal(t, tt.suites, config.CipherSuites)
+		})
+	}
+}
+
+func TestGRPCTLSSystemCertPool(t *testing.T) {
+	custom := writeTestTLSFiles(t)
+	public := writeTestTLSFiles(t)
+	publicCert, err := x509.ParseCertificate(public.cert.Certificate[0])
+	require.NoError(t, err)
+	defer func(orig func() (*x509.CertPool, error)) { systemCertPool = orig }(systemCertPool)
+
+	tests := []struct {
+		msg       string
+		server    testTLSFiles
+		useSystem bool
+		systemErr bool
+		wantErr   bool
+		wantWarn  bool
+	}{
+		{msg: "custom CA", server: custom},
+		{msg: "untrusted server", server: public, wantErr: true},
+		{msg: "system pool", server: public, useSystem: true},
+		{msg: "system and custom CA", server: custom, useSystem: true},
+		{msg: "system pool fails", server: public, useSystem: true, systemErr: true, wantErr: true, wantWarn: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.msg, func(t *testing.T) {
+			systemCertPool = func() (*x509.CertPool, error) {
+				if tt.systemErr {
+					return nil, errors.New("no system roots")
+				}
+				pool := x509.NewCertPool()
+				pool.AddCert(publicCert)
+				return pool, nil
+			}
+
+			addr, handshakes := startTLSStub(t, &tls.Config{Certificates: []tls.Certificate{tt.server.cert}})
+			logger := &recordingLogger{}
+			client := newTLSTestClient(t, addr, custom, GRPCOptions{UseSystemCertPool: tt.useSystem, Logger: logger})
+			err := dialTLSStub(t, client, handshakes)
+			if tt.wantErr {
+				require.Error(t, err, "handshake with an untrusted server should fail")
+				assert.Contains(t, err.Error(), "bad certificate")
+			} else {
+				assert.NoError(t, err)
+			}
+
+			warnings := logger.find("warn", "could not load system cert pool, only trusting the custom CA")
+			if tt.wantWarn {
+				assert.Len(t, warnings, 1)
+			} else {
+				assert.Empty(t, warnings)
+			}
+		})
+	}
+}
+
+func TestValidateTLS(t *testing.T) {
+	files := writeTestTLSFiles(t)
+	other := writeTestTLSFiles(t)
+
+	badCA := filepath.Join(t.TempDir(), "bad-ca.pem")
+	require.NoError(t, ioutil.WriteFile(badCA, []byte("not a certificate"), 0644))
+
+	tests := []struct {
+		msg        string
+		caPath     string
+		certPath   string
+		keyPath    string
+		min        uint16
+		max        uint16
+		wantErr    string
+		wantPrefix string
+	}{
+		{
+			msg:      "valid",
+			caPath:   files.CAPath,
+			certPath: files.CertPath,
+			keyPath:  files.KeyPath,
+		},
+		{
+			msg:     "missing paths",
+			caPath:  files.CAPath,
+			wantErr: "TLS requires CAPath, CertPath and PrivateKeyPath, missing CertPath, PrivateKeyPath",
+		},
+		{
+			msg:        "missing CA file",
+			caPath:     filepath.Join(t.TempDir(), "missing.pem"),
+			certPath:   files.CertPath,
+			keyPath:    files.KeyPath,
+			wantPrefix: "could not load ca ",
+		},
+		{
+			msg:      "bad CA",
+			caPath:   badCA,
+			certPath: files.CertPath,
+			keyPath:  files.KeyPath,
+			wantErr:  "failed to append ca",
+		},
+		{
+			msg:        "mismatched key",
+			caPath:     files.CAPath,
+			certPath:   files.CertPath,
+			keyPath:    other.KeyPath,
+			wantPrefix: "failed to load X509 keypair tls: private key does not match public key",
+		},
+		{
+			msg:      "invalid versions",
+			caPath:   files.CAPath,
+			certPath: files.CertPath,
+			keyPath:  files.KeyPath,
+			min:      tls.VersionTLS13,
+			max:      tls.VersionTLS12,
+			wantErr:  "TLS min version 0x304 is greater than max version 0x303",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.msg, func(t *testing.T) {
+			err := ValidateTLS(GRPCOptions{
+				CAPath:         tt.caPath,
+				CertPath:       tt.certPath,
+				PrivateKeyPath: tt.keyPath,
+				TLSMinVersion:  tt.min,
+				TLSMaxVersion:  tt.max,
+			})
+			switch {
+			case tt.wantErr != "":
+				assert.EqualError(t, err, tt.wantErr)
+			case tt.wantPrefix != "":
+				require.Error(t, err)
+				assert.True(t, strings.HasPrefix(err.Error(), tt.wantPrefix), "unexpected error: %v", err)
+			default:
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestGRPCTLSCADir(t *testing.T) {
+	first, second, third := writeTestTLSFiles(t), writeTestTLSFiles(t), writeTestTLSFiles(t)
+	copyFile := func(dir, name, src string) {
+		contents, err := ioutil.ReadFile(src)
+		require.NoError(t, err)
+		require.NoError(t, ioutil.WriteFile(filepath.Join(dir, name), contents, 0644))
+	}
+
+	caDir := t.TempDir()
+	copyFile(caDir, "first.pem", first.CAPath)
+	copyFile(caDir, "second.crt", second.CAPath)
+	require.NoError(t, ioutil.WriteFile(filepath.Join(caDir, "README"), []byte("not a certificate"), 0644))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(caDir, "bad.pem"), []byte("not a certificate"), 0644))
+
+	newConfig := func(caPath, caDir string, logger Logger) (*tls.Config, error) {
+		return newTLSConfig(GRPCOptions{
+			CAPath:         caPath,
+			CADir:          caDir,
+			CertPath:       first.CertPath,
+			PrivateKeyPath: first.KeyPath,
+		}, logger)
+	}
+
+	tests := []struct {
+		msg     string
+		caPath  string
+		server  testTLSFiles
+		wantErr bool
+	}{
+		{msg: "directory .pem", server: first},
+		{msg: "directory .crt", server: second},
+		{msg: "untrusted server", server: third, wantErr: true},
+		{msg: "directory and CA path", caPath: third.CAPath, server: third},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.msg, func(t *testing.T) {
+			addr, handshakes := startTLSStub(t, &tls.Config{Certificates: []tls.Certificate{tt.server.cert}})
+			logger := &recordingLogger{}
+			client := newTLSTestClient(t, addr, first, GRPCOptions{CAPath: tt.caPath, CADir: caDir, Logger: logger})
+			err := dialTLSStub(t, client, handshakes)
+			if tt.wantErr {
+				require.Error(t, err, "handshake with an untrusted server should fail")
+				assert.Contains(t, err.Error(), "bad certificate")
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Len(t, logger.find("warn", "skipping file in ca dir without a certificate"), 1)
+		})
+	}
+
+	t.Run("no certificates", func(t *testing.T) {
+		emptyDir := t.TempDir()
+		_, err := newConfig("", emptyDir, nopLogger{})
+		assert.EqualError(t, err, "no ca certificates found in "+emptyDir)
+	})
+
+	t.Run("missing directory", func(t *testing.T) {
+		_, err := newConfig("", filepath.Join(caDir, "missing"), nopLogger{})
+		require.Error(t, err)
+		assert.True(t, strings.HasPrefix(err.Error(), "could not load ca dir "), "unexpected error: %v", err)
+	})
+
+	t.Run("validate with directory", func(t *testing.T) {
+		assert.NoError(t, ValidateTLS(GRPCOptions{
+			CADir:          caDir,
+			CertPath:       first.CertPath,
+			PrivateKeyPath: first.KeyPath,
+		}))
+	})
+}
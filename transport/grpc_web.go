@@ -0,0 +1,338 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package transport
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/textproto"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/atomic"
+	"go.uber.org/yarpc/pkg/procedure"
+	"go.uber.org/yarpc/transport/grpc"
+	"go.uber.org/yarpc/yarpcerrors"
+)
+
+// grpcWebProbeTimeout bounds how long detecting a peer's protocol can take.
+const grpcWebProbeTimeout = time.Second
+
+// http2Preface is the HTTP/2 client connection preface followed by an empty
+// SETTINGS frame, which an HTTP/2 server answers with its own SETTINGS frame.
+var http2Preface = []byte("PRI * HTTP/2.0\r\n\r\nSM\r\n\r\n\x00\x00\x00\x04\x00\x00\x00\x00\x00")
+
+var errGRPCWebNoStatus = errors.New("gRPC-Web response is missing grpc-status")
+
+type peerProtocol int
+
+const (
+	peerProtocolUnknown peerProtocol = iota
+	peerProtocolNative
+	peerProtocolWeb
+)
+
+// grpcWebDetector picks peers in turn and detects whether each one speaks
+// native gRPC or only gRPC-Web, caching the result per peer.
+type grpcWebDetector struct {
+	next   atomic.Uint32
+	logger Logger
+	dial   dialFunc
+	client *http.Client
+
+	mu        sync.Mutex
+	addresses []string
+	protocols map[string]peerProtocol
+}
+
+// newGRPCWebDetector uses dial to connect to peers, or the default dialer
+// if dial is nil.
+func newGRPCWebDetector(addresses []string, dial dialFunc, logger Logger) *grpcWebDetector {
+	client := &http.Client{}
+	if dial != nil {
+		client.Transport = &http.Transport{DialContext: dial}
+	} else {
+		var dialer net.Dialer
+		dial = dialer.DialContext
+	}
+	return &grpcWebDetector{
+		logger:    logger,
+		dial:      dial,
+		client:    client,
+		addresses: append([]string(nil), addresses...),
+		protocols: make(map[string]peerProtocol, len(addresses)),
+	}
+}
+
+// webPeer returns the next peer in turn if it only supports gRPC-Web.
+// Otherwise, the call should be made using native gRPC.
+func (d *grpcWebDetector) webPeer(ctx context.Context) (string, bool) {
+	d.mu.Lock()
+	if len(d.addresses) == 0 {
+		d.mu.Unlock()
+		return "", false
+	}
+	addr := d.addresses[int(d.next.Inc()-1)%len(d.addresses)]
+	protocol := d.protocols[addr]
+	d.mu.Unlock()
+
+	if protocol == peerProtocolUnknown {
+		protocol = d.detect(ctx, addr)
+	}
+	return addr, protocol == peerProtocolWeb
+}
+
+// detect attempts an HTTP/2 connection to addr, and falls back to gRPC-Web if
+// the peer answers with HTTP/1.x. The result is only cached if the peer
+// could be reached.
+func (d *grpcWebDetector) detect(ctx context.Context, addr string) peerProtocol {
+	protocol, err := probeHTTP2(ctx, d.dial, addr)
+	if err != nil {
+		d.logger.Warn("could not detect peer protocol", "peer", addr, "error", err)
+		return peerProtocolUnknown
+	}
+
+	d.mu.Lock()
+	d.protocols[addr] = protocol
+	d.mu.Unlock()
+	if protocol == peerProtocolWeb {
+		d.logger.Info("peer does not support HTTP/2, falling back to gRPC-Web", "peer", addr)
+	}
+	return protocol
+}
+
+func (d *grpcWebDetector) addPeer(addr string) {
+	d.mu.Lock()
+	d.addresses = append(d.addresses, addr)
+	d.mu.Unlock()
+}
+
+func (d *grpcWebDetector) removePeer(addr string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for i, a := range d.addresses {
+		if a == addr {
+			d.addresses = append(d.addresses[:i:i], d.addresses[i+1:]...)
+			break
+		}
+	}
+	delete(d.protocols, addr)
+}
+
+func probeHTTP2(ctx context.Context, dial dialFunc, addr string) (peerProtocol, error) {
+	ctx, cancel := context.WithTimeout(ctx, grpcWebProbeTimeout)
+	defer cancel()
+
+	conn, err := dial(ctx, "tcp", addr)
+	if err != nil {
+		return peerProtocolUnknown, err
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	if _, err := conn.Write(http2Preface); err != nil {
+		return peerProtocolUnknown, err
+	}
+	// Enough to tell an HTTP/2 frame header from an HTTP/1.x status line.
+	buf := make([]byte, len("HTTP/1."))
+	n, err := conn.Read(buf)
+	if n == 0 {
+		return peerProtocolUnknown, fmt.Errorf("no response to HTTP/2 preface: %v", err)
+	}
+	if bytes.HasPrefix([]byte("HTTP/1."), buf[:n]) {
+		return peerProtocolWeb, nil
+	}
+	return peerProtocolNative, nil
+}
+
+// callWeb makes a unary call to addr using gRPC-Web framing over HTTP/1.1.
+func (t *grpcTransport) callWeb(ctx context.Context, addr string, request *Request) (*Response, error) {
+	serviceName, methodName := procedure.FromName(request.Method)
+	if methodName == "" {
+		return nil, fmt.Errorf("invalid procedure name: %v", request.Method)
+	}
+	path := "/" + url.QueryEscape(serviceName) + "/" + url.QueryEscape(methodName)
+
+	req, err := http.NewRequest("POST", "http://"+addr+path, bytes.NewReader(grpcMessageFrame(request.Body)))
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	for k, v := range request.Headers {
+		req.Header.Set(k, v)
+	}
+	encoding := t.Encoding
+	if encoding == "" {
+		encoding = "proto"
+	}
+	req.Header.Set("Content-Type", "application/grpc-web+"+encoding)
+	req.Header.Set("X-Grpc-Web", "1")
+	setHeaderIfNotEmpty(req.Header, grpc.CallerHeader, t.Caller)
+	setHeaderIfNotEmpty(req.Header, grpc.ServiceHeader, request.TargetService)
+	setHeaderIfNotEmpty(req.Header, grpc.EncodingHeader, t.Encoding)
+	setHeaderIfNotEmpty(req.Header, grpc.ShardKeyHeader, t.shardKey(request))
+	setHeaderIfNotEmpty(req.Header, grpc.RoutingKeyHeader, t.RoutingKey)
+	setHeaderIfNotEmpty(req.Header, grpc.RoutingDelegateHeader, t.routingDelegate())
+	if deadline, ok := ctx.Deadline(); ok {
+		req.Header.Set("Grpc-Timeout", fmt.Sprintf("%dm", time.Until(deadline).Milliseconds()))
+	}
+
+	resp, err := t.web.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		// Proxies may reject a call with an HTTP error that still carries
+		// the call's gRPC status, which is more useful to report.
+		if err := grpcWebStatus(resp.Header, nil); err != nil && err != errGRPCWebNoStatus {
+			return nil, err
+		}
+		return nil, fmt.Errorf("gRPC-Web call got non-success response code: %v", resp.StatusCode)
+	}
+
+	body, stop := t.withBodyReadTimeout(resp.Body)
+	respBody, err := ioutil.ReadAll(body)
+	stop()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read gRPC-Web response body: %v", err)
+	}
+	message, frame, trailers, err := parseGRPCWebFrames(respBody)
+	if err != nil {
+		return nil, err
+	}
+	if err := grpcWebStatus(resp.Header, trailers); err != nil {
+		return nil, err
+	}
+	headers := make(map[string]string, len(resp.Header))
+	for k := range resp.Header {
+		k = strings.ToLower(k)
+		if k == "content-type" || strings.HasPrefix(k, "grpc-") || strings.HasPrefix(k, "rpc-") {
+			continue
+		}
+		headers[k] = resp.Header.Get(k)
+	}
+	response := &Response{
+		Headers: t.filterResponseHeaders(headers),
+		Body:    message,
+	}
+	if err := t.limitResponseBody(response); err != nil {
+		return nil, err
+	}
+	if t.checksum != nil {
+		trailerValues := make(map[string]string, len(trailers))
+		for k := range trailers {
+			trailerValues[strings.ToLower(k)] = trailers.Get(k)
+		}
+		if err := t.verifyChecksum(response, trailerValues); err != nil {
+			return nil, err
+		}
+	}
+	if t.includeRawFrame && !response.Truncated {
+		response.RawFrame = frame
+	}
+	t.normalizeBody(response)
+	return response, nil
+}
+
+func setHeaderIfNotEmpty(h http.Header, k, v string) {
+	if v != "" {
+		h.Set(k, v)
+	}
+}
+
+// parseGRPCWebFrames splits a gRPC-Web response body into the message, the
+// message's frame including its header, and the trailers, which are sent as a
+// frame with the high bit of the flags set.
+func parseGRPCWebFrames(body []byte) ([]byte, []byte, http.Header, error) {
+	var (
+		message      []byte
+		messageFrame []byte
+		trailers     = make(http.Header)
+	)
+	for len(body) > 0 {
+		if len(body) < 5 {
+			return nil, nil, nil, fmt.Errorf("gRPC-Web response has a truncated frame header")
+		}
+		flags, size := body[0], binary.BigEndian.Uint32(body[1:5])
+		if uint64(size) > uint64(len(body)-5) {
+			return nil, nil, nil, fmt.Errorf("gRPC-Web response frame of %v bytes is truncated", size)
+		}
+		rawFrame := body[:5+size]
+		frame := rawFrame[5:]
+		body = body[5+size:]
+
+		if flags&0x80 == 0 {
+			message, messageFrame = frame, rawFrame
+			continue
+		}
+		// Trailers are sent as HTTP/1 headers without the terminating empty line.
+		r := textproto.NewReader(bufio.NewReader(io.MultiReader(bytes.NewReader(frame), strings.NewReader("\r\n"))))
+		mimeHeader, err := r.ReadMIMEHeader()
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("failed to parse gRPC-Web trailers: %v", err)
+		}
+		for k, vs := range mimeHeader {
+			trailers[k] = append(trailers[k], vs...)
+		}
+	}
+	return message, messageFrame, trailers, nil
+}
+
+// grpcWebStatus returns the error for the gRPC status in the trailers, or in
+// the headers for a trailers-only response. A non-OK status is returned as a
+// *CallError.
+func grpcWebStatus(headers, trailers http.Header) error {
+	code := trailers.Get("Grpc-Status")
+	message := trailers.Get("Grpc-Message")
+	if code == "" {
+		code = headers.Get("Grpc-Status")
+		message = headers.Get("Grpc-Message")
+	}
+	if code == "" {
+		return errGRPCWebNoStatus
+	}
+
+	c, err := strconv.Atoi(code)
+	if err != nil {
+		return fmt.Errorf("gRPC-Web response has invalid grpc-status %q", code)
+	}
+	if c == 0 {
+		return nil
+	}
+	if unescaped, err := url.PathUnescape(message); err == nil {
+		message = unescaped
+	}
+	return newCallError(yarpcerrors.Newf(yarpcerrors.Code(c), "%s", message))
+}
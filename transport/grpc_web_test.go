@@ -0,0 +1,326 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package transport
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/opentracing/opentracing-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/yarpc/yab/testdata/protobuf/simple"
+	"go.uber.org/yarpc/yarpcerrors"
+	googlegrpc "google.golang.org/grpc"
+)
+
+func grpcWebFrame(flags byte, body []byte) []byte {
+	frame := make([]byte, 5+len(body))
+	frame[0] = flags
+	binary.BigEndian.PutUint32(frame[1:5], uint32(len(body)))
+	copy(frame[5:], body)
+	return frame
+}
+
+// newGRPCWebStub starts an HTTP/1.1-only server that echoes gRPC-Web
+// requests to Bar::Baz and fails requests to Bar::Fail.
+func newGRPCWebStub(t *testing.T) *httptest.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/Bar/Baz", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "application/grpc-web+proto", r.Header.Get("Content-Type"))
+		assert.Equal(t, "test", r.Header.Get("Rpc-Caller"))
+		assert.Equal(t, "Bar", r.Header.Get("Rpc-Service"))
+		assert.NotEmpty(t, r.Header.Get("Grpc-Timeout"))
+
+		body, err := ioutil.ReadAll(r.Body)
+		require.NoError(t, err)
+		require.True(t, len(body) >= 5, "request is missing frame header")
+
+		w.Header().Set("Content-Type", "application/grpc-web+proto")
+		w.Header().Set("Web-Header", "web")
+		w.Write(grpcWebFrame(0, body[5:]))
+		w.Write(grpcWebFrame(0x80, []byte("grpc-status: 0\r\ngrpc-message: \r\n")))
+	})
+	mux.HandleFunc("/Bar/Fail", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/grpc-web+proto")
+		w.Write(grpcWebFrame(0x80, []byte("grpc-status: 5\r\ngrpc-message: no%20such%20bar\r\n")))
+	})
+	return httptest.NewServer(mux)
+}
+
+func TestGRPCWebAutoDetect(t *testing.T) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	server := googlegrpc.NewServer()
+	simple.RegisterBarServer(server, &simpleSvc{})
+	go server.Serve(lis)
+	defer server.Stop()
+	nativeAddr := lis.Addr().String()
+
+	webServer := newGRPCWebStub(t)
+	defer webServer.Close()
+	webAddr := webServer.Listener.Addr().String()
+
+	newClient := func(addresses ...string) *grpcTransport {
+		client, err := newGRPC(GRPCOptions{
+			Addresses:             addresses,
+			Tracer:                opentracing.NoopTracer{},
+			Caller:                "test",
+			Encoding:              "proto",
+			GRPCWebAutoDetect:     true,
+			IncludePeerInResponse: true,
+		})
+		require.NoError(t, err)
+		return client
+	}
+	call := func(client *grpcTransport, method string) (*Response, error) {
+		return client.Call(context.Background(), &Request{
+			TargetService: "Bar",
+			Method:        method,
+			Timeout:       time.Second,
+			Body:          []byte{0x08, 0x01},
+		})
+	}
+
+	t.Run("native and web peers", func(t *testing.T) {
+		client := newClient(nativeAddr, webAddr)
+		defer client.Close()
+
+		seen := make(map[string]int)
+		for i := 0; i < 4; i++ {
+			res, err := call(client, "Bar::Baz")
+			require.NoError(t, err)
+			assert.Equal(t, []byte{0x08, 0x01}, res.Body)
+			if res.PeerAddress == webAddr {
+				assert.Equal(t, "web", res.Headers["web-header"])
+			}
+			seen[res.PeerAddress]++
+		}
+		assert.Equal(t, map[string]int{nativeAddr: 2, webAddr: 2}, seen)
+		assert.Equal(t, map[string]peerProtocol{
+			nativeAddr: peerProtocolNative,
+			webAddr:    peerProtocolWeb,
+		}, client.web.protocols, "detected protocols should be cached")
+	})
+
+	t.Run("web error status", func(t *testing.T) {
+		client := newClient(webAddr)
+		defer client.Close()
+
+		_, err := call(client, "Bar::Fail")
+		require.Error(t, err)
+		assert.Equal(t, yarpcerrors.CodeNotFound, yarpcerrors.FromError(err).Code())
+		assert.Equal(t, "no such bar", yarpcerrors.FromError(err).Message())
+	})
+
+	t.Run("TLS is not supported", func(t *testing.T) {
+		_, err := newGRPC(GRPCOptions{
+			Addresses:         []string{webAddr},
+			Tracer:            opentracing.NoopTracer{},
+			Caller:            "test",
+			CAPath:            "ca.pem",
+			GRPCWebAutoDetect: true,
+		})
+		assert.Equal(t, errGRPCWebTLS, err)
+	})
+}
+
+func TestParseGRPCWebFrames(t *testing.T) {
+	tests := []struct {
+		msg         string
+		body        []byte
+		wantMessage []byte
+		wantErr     string
+	}{
+		{
+			msg:         "message and trailers",
+			body:        append(grpcWebFrame(0, []byte("hello")), grpcWebFrame(0x80, []byte("grpc-status: 0\r\n"))...),
+			wantMessage: []byte("hello"),
+		},
+		{
+			msg:     "truncated header",
+			body:    []byte{0, 0},
+			wantErr: "gRPC-Web response has a truncated frame header",
+		},
+		{
+			msg:     "truncated frame",
+			body:    grpcWebFrame(0, []byte("hello"))[:7],
+			wantErr: "gRPC-Web response frame of 5 bytes is truncated",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.msg, func(t *testing.T) {
+			message, frame, trailers, err := parseGRPCWebFrames(tt.body)
+			if tt.wantErr != "" {
+				assert.EqualError(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantMessage, message)
+			assert.Equal(t, grpcWebFrame(0, tt.wantMessage), frame)
+			assert.NoError(t, grpcWebStatus(nil, trailers), fmt.Sprint(trailers))
+		})
+	}
+}
+
+func TestGRPCWebStatusCallError(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/Bar/Trailer", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/grpc-web+proto")
+		w.Write(grpcWebFrame(0, []byte{0x08, 0x01}))
+		w.Write(grpcWebFrame(0x80, []byte("grpc-status: 7\r\ngrpc-message: not%20allowed\r\n")))
+	})
+	mux.HandleFunc("/Bar/Rejected", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Grpc-Status", "8")
+		w.Header().Set("Grpc-Message", "slow down")
+		w.WriteHeader(http.StatusTooManyRequests)
+	})
+	mux.HandleFunc("/Bar/HTTPError", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	})
+	webServer := httptest.NewServer(mux)
+	defer webServer.Close()
+
+	client, err := newGRPC(GRPCOptions{
+		Addresses:         []string{webServer.Listener.Addr().String()},
+		Tracer:            opentracing.NoopTracer{},
+		Caller:            "test",
+		Encoding:          "proto",
+		GRPCWebAutoDetect: true,
+	})
+	require.NoError(t, err)
+	defer client.Close()
+
+	tests := []struct {
+		method      string
+		wantCode    yarpcerrors.Code
+		wantMessage string
+		wantErr     string
+	}{
+		{
+			method:      "Bar::Trailer",
+			wantCode:    yarpcerrors.CodePermissionDenied,
+			wantMessage: "not allowed",
+		},
+		{
+			method:      "Bar::Rejected",
+			wantCode:    yarpcerrors.CodeResourceExhausted,
+			wantMessage: "slow down",
+		},
+		{
+			method:  "Bar::HTTPError",
+			wantErr: "gRPC-Web call got non-success response code: 502",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.method, func(t *testing.T) {
+			_, err := client.Call(context.Background(), &Request{
+				TargetService: "Bar",
+				Method:        tt.method,
+				Timeout:       time.Second,
+			})
+			if tt.wantErr != "" {
+				assert.EqualError(t, err, tt.wantErr)
+				return
+			}
+
+			var callErr *CallError
+			require.True(t, errors.As(err, &callErr), "expected CallError, got %v", err)
+			assert.Equal(t, tt.wantCode, callErr.Code)
+			assert.Equal(t, tt.wantMessage, yarpcerrors.FromError(err).Message())
+		})
+	}
+}
+
+func TestGRPCIncludeRawFrame(t *testing.T) {
+	t.Run("requires gRPC-Web", func(t *testing.T) {
+		_, err := newGRPC(GRPCOptions{
+			Addresses:       []string{"127.0.0.1:0"},
+			Tracer:          opentracing.NoopTracer{},
+			Caller:          "test",
+			IncludeRawFrame: true,
+		})
+		assert.Equal(t, errRawFrameNoWeb, err)
+	})
+
+	// The server flags the message as compressed without compressing it,
+	// which the raw frame should show.
+	mux := http.NewServeMux()
+	mux.HandleFunc("/Bar/Baz", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/grpc-web+proto")
+		w.Write(grpcWebFrame(1, []byte{0x08, 0x01}))
+		w.Write(grpcWebFrame(0x80, []byte("grpc-status: 0\r\n")))
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	tests := []struct {
+		msg          string
+		opts         GRPCOptions
+		wantRawFrame []byte
+	}{
+		{
+			msg:  "disabled",
+			opts: GRPCOptions{},
+		},
+		{
+			msg:          "enabled",
+			opts:         GRPCOptions{IncludeRawFrame: true},
+			wantRawFrame: []byte{1, 0, 0, 0, 2, 0x08, 0x01},
+		},
+		{
+			msg:  "truncated",
+			opts: GRPCOptions{IncludeRawFrame: true, TruncateResponseAt: 1},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.msg, func(t *testing.T) {
+			tt.opts.Addresses = []string{server.Listener.Addr().String()}
+			tt.opts.Tracer = opentracing.NoopTracer{}
+			tt.opts.Caller = "test"
+			tt.opts.Encoding = "proto"
+			tt.opts.GRPCWebAutoDetect = true
+			client, err := newGRPC(tt.opts)
+			require.NoError(t, err)
+			defer client.Close()
+
+			res, err := client.Call(context.Background(), &Request{
+				TargetService: "Bar",
+				Method:        "Bar::Baz",
+				Timeout:       time.Second,
+				Body:          []byte{0x08, 0x01},
+			})
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantRawFrame, res.RawFrame)
+		})
+	}
+}
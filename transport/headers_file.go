@@ -0,0 +1,92 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package transport
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/yarpc/yab/templateargs/interpolate"
+	"gopkg.in/yaml.v2"
+)
+
+// loadHeadersFile reads the headers in the JSON or YAML file at path,
+// rendering any variables in their values with resolve.
+func loadHeadersFile(path string, resolve interpolate.VariableResolver) (map[string]string, error) {
+	contents, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not read headers file: %v", err)
+	}
+
+	// YAML errors include the line of the problem, and JSON is valid YAML.
+	var raw map[string]string
+	if err := yaml.Unmarshal(contents, &raw); err != nil {
+		return nil, fmt.Errorf("could not parse headers file %q: %v", path, err)
+	}
+
+	headers := make(map[string]string, len(raw))
+	for k, v := range raw {
+		parsed, err := interpolate.Parse(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid value for header %q in headers file %q: %v", k, path, err)
+		}
+		if headers[k], err = parsed.Render(resolve); err != nil {
+			return nil, fmt.Errorf("could not render header %q in headers file %q: %v", k, path, err)
+		}
+	}
+	return headers, nil
+}
+
+// headersFileResolver looks up variables in vars, and then the environment
+// if expandEnv is set.
+func headersFileResolver(vars map[string]string, expandEnv bool) interpolate.VariableResolver {
+	return func(name string) (string, bool) {
+		if v, ok := vars[name]; ok {
+			return v, true
+		}
+		if expandEnv {
+			return os.LookupEnv(name)
+		}
+		return "", false
+	}
+}
+
+// withFileHeaders returns a copy of request with the headers loaded from the
+// headers file added, except those the request already sets.
+func (t *grpcTransport) withFileHeaders(request *Request) *Request {
+	if len(t.fileHeaders) == 0 {
+		return request
+	}
+
+	set := make(map[string]struct{}, len(request.Headers))
+	for k := range request.Headers {
+		set[strings.ToLower(k)] = struct{}{}
+	}
+	missing := make(map[string]string, len(t.fileHeaders))
+	for k, v := range t.fileHeaders {
+		if _, ok := set[strings.ToLower(k)]; !ok {
+			missing[k] = v
+		}
+	}
+	return withHeaders(request, missing)
+}
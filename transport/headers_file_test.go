@@ -0,0 +1,145 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package transport
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/opentracing/opentracing-go/mocktracer"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeHeadersFile(t *testing.T, name, contents string) string {
+	path := filepath.Join(t.TempDir(), name)
+	require.NoError(t, ioutil.WriteFile(path, []byte(contents), 0644))
+	return path
+}
+
+func TestGRPCHeadersFile(t *testing.T) {
+	require.NoError(t, os.Setenv("YAB_TEST_HEADERS_TEAM", "payments"))
+	defer os.Unsetenv("YAB_TEST_HEADERS_TEAM")
+
+	path := writeHeadersFile(t, "headers.yaml", `
+x-region: ${region}
+x-team: ${YAB_TEST_HEADERS_TEAM}
+x-tier: ${tier:gold}
+x-override: from-file
+`)
+	svc := &deadlineRecordingSvc{}
+	client, cleanup := newSimpleGRPCClient(t, svc, GRPCOptions{
+		HeadersFile:     path,
+		HeadersFileVars: map[string]string{"region": "west"},
+		ExpandEnv:       true,
+	})
+	defer cleanup()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	_, err := client.Call(ctx, &Request{
+		TargetService: "Bar",
+		Method:        "Bar::Baz",
+		Headers:       map[string]string{"X-Override": "from-request"},
+		Body:          []byte{},
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"west"}, svc.md.Get("x-region"))
+	assert.Equal(t, []string{"payments"}, svc.md.Get("x-team"))
+	assert.Equal(t, []string{"gold"}, svc.md.Get("x-tier"), "defaults should be used for unset variables")
+	assert.Equal(t, []string{"from-request"}, svc.md.Get("x-override"), "request headers should take precedence")
+}
+
+func TestGRPCHeadersFileErrors(t *testing.T) {
+	tests := []struct {
+		msg      string
+		contents string
+		vars     map[string]string
+		wantErr  string
+	}{
+		{
+			msg:      "invalid YAML",
+			contents: "x-region: west\nx-team: [payments\n",
+			wantErr:  "yaml: line 2: did not find expected ',' or ']'",
+		},
+		{
+			msg:      "invalid JSON",
+			contents: "{\n  \"x-region\": \"west\",\n  \"x-team\": [\n}\n",
+			wantErr:  "yaml: line 3: did not find expected node content",
+		},
+		{
+			msg:      "unknown variable",
+			contents: "x-region: ${region}",
+			wantErr:  `could not render header "x-region" in headers file`,
+		},
+		{
+			msg:      "variable not read from environment without ExpandEnv",
+			contents: "x-home: ${HOME}",
+			vars:     map[string]string{"region": "west"},
+			wantErr:  `unknown variable "HOME" does not have a value or a default`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.msg, func(t *testing.T) {
+			_, err := newGRPC(GRPCOptions{
+				Addresses:       []string{"127.0.0.1:0"},
+				Tracer:          mocktracer.New(),
+				Caller:          "test",
+				HeadersFile:     writeHeadersFile(t, "headers", tt.contents),
+				HeadersFileVars: tt.vars,
+			})
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.wantErr)
+		})
+	}
+
+	t.Run("missing file", func(t *testing.T) {
+		_, err := newGRPC(GRPCOptions{
+			Addresses:   []string{"127.0.0.1:0"},
+			Tracer:      mocktracer.New(),
+			Caller:      "test",
+			HeadersFile: filepath.Join(t.TempDir(), "missing.yaml"),
+		})
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "could not read headers file")
+	})
+}
+
+func TestGRPCHeadersFileStream(t *testing.T) {
+	client, err := newGRPC(GRPCOptions{
+		Addresses:   []string{"127.0.0.1:0"},
+		Tracer:      mocktracer.New(),
+		Caller:      "test",
+		HeadersFile: writeHeadersFile(t, "headers.json", `{"x-region": "west"}`),
+	})
+	require.NoError(t, err)
+	defer client.Close()
+
+	request := client.withFileHeaders(&Request{Headers: map[string]string{"x-team": "payments"}})
+	yarpcRequest := client.requestToYARPCStreamRequest(&StreamRequest{Request: request})
+	assert.Equal(t, map[string]string{"x-region": "west", "x-team": "payments"}, yarpcRequest.Meta.Headers.Items())
+}
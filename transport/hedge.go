@@ -0,0 +1,128 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package transport
+
+import (
+	"context"
+	"time"
+)
+
+// hedgePolicy sends extra copies of slow calls to allowlisted methods.
+type hedgePolicy struct {
+	after     time.Duration
+	maxHedges int
+	methods   map[string]struct{}
+}
+
+// newHedgePolicy returns nil if after is not positive or no methods are
+// allowed, meaning calls aren't hedged. maxHedges defaults to 1.
+func newHedgePolicy(after time.Duration, maxHedges int, methods []string) *hedgePolicy {
+	if after <= 0 || len(methods) == 0 {
+		return nil
+	}
+	if maxHedges <= 0 {
+		maxHedges = 1
+	}
+	p := &hedgePolicy{
+		after:     after,
+		maxHedges: maxHedges,
+		methods:   make(map[string]struct{}, len(methods)),
+	}
+	for _, m := range methods {
+		p.methods[m] = struct{}{}
+	}
+	return p
+}
+
+func (p *hedgePolicy) allows(request *Request) bool {
+	if p == nil {
+		return false
+	}
+	_, ok := p.methods[request.Method]
+	return ok
+}
+
+type hedgeResult struct {
+	res *Response
+	err error
+}
+
+// callHedged calls request, and sends another copy of it every hedge delay
+// without a response, up to the maximum number of hedges. Since the peer
+// list picks the next peer for each copy, hedges go to other peers when
+// there are any. The first successful response is returned and the other
+// copies are cancelled. A copy that fails doesn't trigger a hedge; the call
+// fails with the last error once every copy that was sent has failed.
+func (t *grpcTransport) callHedged(ctx context.Context, request *Request) (*Response, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	results := make(chan hedgeResult, t.hedge.maxHedges+1)
+	send := func() {
+		res, err := t.callYARPC(ctx, request)
+		results <- hedgeResult{res, err}
+	}
+	go send()
+
+	var (
+		pending = 1
+		hedges  int
+		lastErr error
+	)
+	timer := time.NewTimer(t.hedge.after)
+	defer timer.Stop()
+	for {
+		select {
+		case r := <-results:
+			pending--
+			if r.err == nil {
+				go releaseHedgeResults(results, pending)
+				return r.res, nil
+			}
+			lastErr = r.err
+			if pending == 0 {
+				return nil, lastErr
+			}
+		case <-timer.C:
+			if hedges >= t.hedge.maxHedges {
+				continue
+			}
+			hedges++
+			pending++
+			t.logger.Debug("sending hedged grpc call",
+				"service", request.TargetService,
+				"procedure", request.Method,
+				"hedge", hedges)
+			go send()
+			timer.Reset(t.hedge.after)
+		}
+	}
+}
+
+// releaseHedgeResults waits for the copies of a hedged call that lost, and
+// releases any responses they got.
+func releaseHedgeResults(results <-chan hedgeResult, pending int) {
+	for i := 0; i < pending; i++ {
+		if r := <-results; r.res != nil {
+			r.res.Release()
+		}
+	}
+}
@@ -0,0 +1,139 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package transport
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/opentracing/opentracing-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/yarpc/yab/testdata/protobuf/simple"
+	"go.uber.org/atomic"
+	googlegrpc "google.golang.org/grpc"
+)
+
+// slowSvc responds to Baz after delay, and counts the calls that were
+// cancelled before then.
+type slowSvc struct {
+	simpleSvc
+
+	delay     time.Duration
+	calls     atomic.Int32
+	cancelled atomic.Int32
+}
+
+func (s *slowSvc) Baz(ctx context.Context, in *simple.Foo) (*simple.Foo, error) {
+	s.calls.Inc()
+	select {
+	case <-time.After(s.delay):
+		return in, nil
+	case <-ctx.Done():
+		s.cancelled.Inc()
+		return nil, ctx.Err()
+	}
+}
+
+func TestGRPCHedging(t *testing.T) {
+	const slowDelay = 500 * time.Millisecond
+
+	startServer := func(svc simple.BarServer) string {
+		lis, err := net.Listen("tcp", "127.0.0.1:0")
+		require.NoError(t, err)
+		server := googlegrpc.NewServer()
+		simple.RegisterBarServer(server, svc)
+		go server.Serve(lis)
+		t.Cleanup(server.Stop)
+		return lis.Addr().String()
+	}
+
+	tests := []struct {
+		msg         string
+		methods     []string
+		wantHedging bool
+	}{
+		{
+			msg:         "hedged method",
+			methods:     []string{"Bar::Baz"},
+			wantHedging: true,
+		},
+		{
+			msg:     "method not allowed",
+			methods: []string{"Bar::Other"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.msg, func(t *testing.T) {
+			slow := &slowSvc{delay: slowDelay}
+			fast := &slowSvc{}
+			client, err := newGRPC(GRPCOptions{
+				Addresses:    []string{startServer(slow), startServer(fast)},
+				Tracer:       opentracing.NoopTracer{},
+				Caller:       "test",
+				Encoding:     "proto",
+				HedgeAfter:   20 * time.Millisecond,
+				HedgeMethods: tt.methods,
+			})
+			require.NoError(t, err)
+			defer client.Close()
+
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			require.NoError(t, client.WaitForPeers(ctx, 2))
+
+			// Calls alternate between peers, so some are first sent to the
+			// slow peer.
+			const calls = 4
+			var slowest time.Duration
+			for i := 0; i < calls; i++ {
+				start := time.Now()
+				res, err := client.Call(ctx, &Request{
+					TargetService: "Bar",
+					Method:        "Bar::Baz",
+					Timeout:       time.Second,
+					Body:          []byte{0x08, 1},
+				})
+				require.NoError(t, err)
+				assert.Equal(t, []byte{0x08, 1}, res.Body)
+				if elapsed := time.Since(start); elapsed > slowest {
+					slowest = elapsed
+				}
+			}
+
+			require.NotZero(t, slow.calls.Load(), "slow peer should get calls")
+			if !tt.wantHedging {
+				assert.True(t, slowest >= slowDelay, "unhedged calls to the slow peer should wait for it, slowest took %v", slowest)
+				assert.Equal(t, int32(calls), slow.calls.Load()+fast.calls.Load(), "calls should not be hedged")
+				return
+			}
+
+			assert.True(t, slowest < slowDelay, "hedges should win over the slow peer, slowest took %v", slowest)
+			assert.True(t, slow.calls.Load()+fast.calls.Load() > calls, "calls to the slow peer should be hedged")
+			assert.Eventually(t, func() bool {
+				return slow.cancelled.Load() == slow.calls.Load()
+			}, time.Second, 10*time.Millisecond, "calls to the slow peer should be cancelled once a hedge wins")
+		})
+	}
+}
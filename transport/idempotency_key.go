@@ -0,0 +1,58 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package transport
+
+import (
+	"crypto/rand"
+	"fmt"
+)
+
+// IdempotencyKeyHeader is the header that idempotency keys are sent in.
+const IdempotencyKeyHeader = "idempotency-key"
+
+// withIdempotencyKey returns request with its idempotency key set in the
+// IdempotencyKeyHeader header. If the request doesn't have a key and the
+// transport generates them, a random UUID is used. The key is added once per
+// call, so every attempt of a call that's retried sends the same key.
+func (t *grpcTransport) withIdempotencyKey(request *Request) (*Request, error) {
+	key := request.IdempotencyKey
+	if key == "" {
+		if !t.generateIdempotencyKeys {
+			return request, nil
+		}
+		var err error
+		if key, err = newUUID(); err != nil {
+			return nil, fmt.Errorf("could not generate idempotency key: %v", err)
+		}
+	}
+	return withHeaders(request, map[string]string{IdempotencyKeyHeader: key}), nil
+}
+
+// newUUID returns a random (version 4) UUID.
+func newUUID() (string, error) {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", err
+	}
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:]), nil
+}
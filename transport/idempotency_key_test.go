@@ -0,0 +1,121 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package transport
+
+import (
+	"context"
+	"regexp"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/yarpc/api/transport"
+	"go.uber.org/yarpc/yarpcerrors"
+)
+
+// closingOutbound records the headers of each request it's called with, and
+// fails the first attempt of every call as if its connection was closed.
+type closingOutbound struct {
+	transport.UnaryOutbound
+
+	mu       sync.Mutex
+	attempts []map[string]string
+}
+
+func (o *closingOutbound) Call(ctx context.Context, request *transport.Request) (*transport.Response, error) {
+	o.mu.Lock()
+	o.attempts = append(o.attempts, request.Headers.Items())
+	attempt := len(o.attempts)
+	o.mu.Unlock()
+
+	if attempt%2 == 1 {
+		return nil, yarpcerrors.UnavailableErrorf("transport is closing")
+	}
+	return o.UnaryOutbound.Call(ctx, request)
+}
+
+func TestGRPCIdempotencyKey(t *testing.T) {
+	uuidRegexp := regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
+
+	tests := []struct {
+		msg      string
+		generate bool
+		key      string
+		wantKey  func(t *testing.T, key string)
+	}{
+		{
+			msg: "no key",
+			wantKey: func(t *testing.T, key string) {
+				assert.Empty(t, key)
+			},
+		},
+		{
+			msg:      "generated key",
+			generate: true,
+			wantKey: func(t *testing.T, key string) {
+				assert.Regexp(t, uuidRegexp, key)
+			},
+		},
+		{
+			msg:      "request key",
+			generate: true,
+			key:      "request-key",
+			wantKey: func(t *testing.T, key string) {
+				assert.Equal(t, "request-key", key)
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.msg, func(t *testing.T) {
+			client, cleanup := newSimpleGRPCClient(t, &simpleSvc{}, GRPCOptions{GenerateIdempotencyKeys: tt.generate})
+			defer cleanup()
+			outbound := &closingOutbound{UnaryOutbound: client.Outbound}
+			client.Outbound = outbound
+
+			const calls = 3
+			for i := 0; i < calls; i++ {
+				_, err := client.Call(context.Background(), &Request{
+					TargetService:  "Bar",
+					Method:         "Bar::Baz",
+					Timeout:        time.Second,
+					Body:           []byte{},
+					IdempotencyKey: tt.key,
+				})
+				require.NoError(t, err)
+			}
+
+			require.Len(t, outbound.attempts, 2*calls, "each call should be retried once")
+			keys := make(map[string]struct{})
+			for i := 0; i < calls; i++ {
+				key := outbound.attempts[2*i][IdempotencyKeyHeader]
+				assert.Equal(t, key, outbound.attempts[2*i+1][IdempotencyKeyHeader], "call %v retry should reuse its key", i)
+				tt.wantKey(t, key)
+				keys[key] = struct{}{}
+			}
+			if tt.generate && tt.key == "" {
+				assert.Len(t, keys, calls, "each call should generate a different key")
+			}
+		})
+	}
+}
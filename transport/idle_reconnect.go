@@ -0,0 +1,63 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package transport
+
+import (
+	"context"
+	"time"
+
+	apipeer "go.uber.org/yarpc/api/peer"
+	"go.uber.org/yarpc/api/transport"
+	"go.uber.org/yarpc/yarpcerrors"
+)
+
+// reconnectInterval is how long reconnectingList waits before choosing
+// again, so the peer list can see the closed connection.
+const reconnectInterval = time.Millisecond
+
+// reconnectingList wraps a peer list so calls aren't sent to a peer whose
+// connection has closed, such as by a server with a short idle timeout,
+// before the peer list has noticed. The peer is chosen again instead, which
+// waits for a new connection, unless reconnecting is disabled. No bytes of
+// the request have been written at that point, so this is safe for any call.
+type reconnectingList struct {
+	apipeer.ChooserList
+
+	disabled bool
+}
+
+func (l reconnectingList) Choose(ctx context.Context, req *transport.Request) (apipeer.Peer, func(error), error) {
+	for {
+		p, onFinish, err := l.ChooserList.Choose(ctx, req)
+		if err != nil || p.Status().ConnectionStatus == apipeer.Available {
+			return p, onFinish, err
+		}
+
+		err = yarpcerrors.UnavailableErrorf("connection to peer %v was closed before the request was sent", p.Identifier())
+		onFinish(err)
+		if l.disabled {
+			return nil, nil, err
+		}
+		if err := sleepCtx(ctx, reconnectInterval); err != nil {
+			return nil, nil, err
+		}
+	}
+}
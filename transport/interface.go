@@ -39,8 +39,32 @@ type Request struct {
 	TransportHeaders map[string]string
 	ShardKey         string
 	Body             []byte
+
+	// Sampling overrides whether the call is sampled by the tracer.
+	Sampling Sampling
+
+	// IdempotencyKey, if set, is sent in the IdempotencyKeyHeader header of
+	// every attempt of the call, so servers can deduplicate retries.
+	IdempotencyKey string
+
+	// Priority, if set, is sent in the transport's priority header, so
+	// servers with priority lanes can handle the call accordingly.
+	Priority int
 }
 
+// Sampling overrides the tracer's sampling decision for a call.
+type Sampling int
+
+// The sampling overrides supported for calls.
+const (
+	// SampleDefault leaves the decision to the tracer's sampler.
+	SampleDefault Sampling = iota
+	// SampleAlways forces the call to be sampled.
+	SampleAlways
+	// SampleNever forces the call to not be sampled.
+	SampleNever
+)
+
 // StreamRequest is a wrapper of Request, to be used for streaming RPC
 type StreamRequest struct {
 	Request *Request
@@ -53,6 +77,34 @@ type Response struct {
 
 	// TransportFields contains fields that are transport-specific.
 	TransportFields map[string]interface{}
+
+	// PeerAddress is the address of the peer that handled the call, if the
+	// transport was configured to record it.
+	PeerAddress string
+
+	// Truncated is set if Body only holds the start of the response body,
+	// because the transport was configured to truncate responses.
+	Truncated bool
+
+	// RawFrame is the response message frame as received from a gRPC-Web
+	// peer: a compressed flag, a 4 byte length and the payload. It's only
+	// set if the transport was configured to include it, the response came
+	// from a gRPC-Web peer, and the response was not truncated.
+	RawFrame []byte
+
+	// release returns the buffer holding Body to its pool, if any.
+	release func()
+}
+
+// Release returns the buffer holding the response body to the pool it was
+// read into, if the transport uses a pool. The Body must not be used after
+// calling Release, which is safe to call more than once.
+func (r *Response) Release() {
+	if r.release != nil {
+		r.release()
+		r.release = nil
+		r.Body = nil
+	}
 }
 
 // Protocol represents the wire protocol used to send the request.
@@ -80,6 +132,80 @@ type StreamTransport interface {
 	CallStream(ctx context.Context, request *StreamRequest) (*transport.ClientStream, error)
 }
 
+// WireSizer is implemented by transports that can estimate the size of a
+// request on the wire before sending it.
+type WireSizer interface {
+	WireSize(request *Request) (int, error)
+}
+
+// MultiCaller is implemented by transports that can make several identical
+// calls concurrently.
+type MultiCaller interface {
+	CallN(ctx context.Context, request *Request, n int) ([]*Response, error)
+}
+
+// WeightedCaller is implemented by transports that can spread calls across
+// several requests by weight.
+type WeightedCaller interface {
+	CallWeighted(ctx context.Context, specs []CallSpec) (*Response, int, error)
+}
+
+// Replayer is implemented by transports that can replay the requests in a
+// capture written by CaptureWriter.
+type Replayer interface {
+	Replay(ctx context.Context, path string, concurrency int) ([]*Response, error)
+}
+
+// TraceExporter is implemented by transports that can export the spans
+// recorded by their tracer.
+type TraceExporter interface {
+	ExportTraces(w io.Writer) error
+}
+
+// PeerUpdater is implemented by transports whose peers can be changed while
+// they are running.
+type PeerUpdater interface {
+	AddPeer(addr string) error
+	RemovePeer(addr string) error
+}
+
+// PeerWaiter is implemented by transports that can wait for a number of
+// their peers to be available.
+type PeerWaiter interface {
+	WaitForPeers(ctx context.Context, min int) error
+}
+
+// StatsReporter is implemented by transports that count the calls they
+// make, broken down by the labels set using WithLabels.
+type StatsReporter interface {
+	Stats() []CallStats
+}
+
+// PrometheusExporter is implemented by transports that can write their Stats
+// in the Prometheus text exposition format.
+type PrometheusExporter interface {
+	ExportPrometheus(w io.Writer) error
+}
+
+// LatencyHistogramExporter is implemented by transports that can write the
+// latencies of their calls as an HDR histogram log.
+type LatencyHistogramExporter interface {
+	ExportLatencyHistogram(w io.Writer) error
+}
+
+// ConnectionTimer is implemented by transports that record how long it took
+// to set up the first connection to each peer.
+type ConnectionTimer interface {
+	ConnectionTimings() map[string]ConnectionTiming
+}
+
+// Pauser is implemented by transports that can hold back new calls, such as
+// to coordinate a benchmark with changes made to the server.
+type Pauser interface {
+	Pause()
+	Resume()
+}
+
 // TransportCloser is a Transport that can be closed.
 type TransportCloser interface {
 	Transport
@@ -0,0 +1,148 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package transport
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"go.uber.org/yarpc/yarpcerrors"
+)
+
+const (
+	// latencyTimeoutQuantile is the quantile of observed latency that
+	// TimeoutLatencyMultiplier scales.
+	latencyTimeoutQuantile = 0.99
+
+	// latencyWindowSize is the number of recent calls whose latency is
+	// used, so the timeout follows the current latency rather than the
+	// latency of every call made.
+	latencyWindowSize = 256
+
+	// defaultTimeoutLatencyMax is the highest timeout set by
+	// TimeoutLatencyMultiplier if TimeoutLatencyMax isn't set.
+	defaultTimeoutLatencyMax = 30 * time.Second
+)
+
+// latencyTimeout sets call timeouts from the latency of recent calls. It's
+// nil if timeouts aren't scaled.
+type latencyTimeout struct {
+	multiplier float64
+	floor      time.Duration
+	max        time.Duration
+
+	mu      sync.Mutex
+	samples []time.Duration // ring of the latest latencyWindowSize samples
+	next    int
+}
+
+func newLatencyTimeout(multiplier float64, floor, max time.Duration) (*latencyTimeout, error) {
+	if multiplier < 0 || math.IsNaN(multiplier) || math.IsInf(multiplier, 0) {
+		return nil, fmt.Errorf("TimeoutLatencyMultiplier must be a non-negative number, got %v", multiplier)
+	}
+	if multiplier == 0 {
+		return nil, nil
+	}
+	if max == 0 {
+		max = defaultTimeoutLatencyMax
+	}
+	if floor < 0 || max < floor {
+		return nil, fmt.Errorf("TimeoutLatencyFloor must be between 0 and TimeoutLatencyMax (%v), got %v", max, floor)
+	}
+	return &latencyTimeout{
+		multiplier: multiplier,
+		floor:      floor,
+		max:        max,
+		samples:    make([]time.Duration, 0, latencyWindowSize),
+	}, nil
+}
+
+// record adds the latency of a call. Calls that timed out are skipped, as
+// their latency is the timeout that was set rather than how long the call
+// would have taken.
+func (l *latencyTimeout) record(latency time.Duration, err error) {
+	if l == nil {
+		return
+	}
+	if errors.Is(err, context.DeadlineExceeded) || yarpcerrors.FromError(err).Code() == yarpcerrors.CodeDeadlineExceeded {
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if len(l.samples) < latencyWindowSize {
+		l.samples = append(l.samples, latency)
+		return
+	}
+	l.samples[l.next] = latency
+	l.next = (l.next + 1) % latencyWindowSize
+}
+
+// quantile returns the q quantile of the recorded latencies, and false if
+// there are none.
+func (l *latencyTimeout) quantile(q float64) (time.Duration, bool) {
+	l.mu.Lock()
+	sorted := append([]time.Duration(nil), l.samples...)
+	l.mu.Unlock()
+	if len(sorted) == 0 {
+		return 0, false
+	}
+
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	rank := int(math.Ceil(q*float64(len(sorted)))) - 1
+	if rank < 0 {
+		rank = 0
+	}
+	return sorted[rank], true
+}
+
+// timeout returns TimeoutLatencyMultiplier times the p99 latency of recent
+// calls, between TimeoutLatencyFloor and TimeoutLatencyMax, and no later
+// than ctx's deadline. It returns false if scaling is disabled, or no calls
+// have been recorded yet.
+func (l *latencyTimeout) timeout(ctx context.Context) (time.Duration, bool) {
+	if l == nil {
+		return 0, false
+	}
+	p99, ok := l.quantile(latencyTimeoutQuantile)
+	if !ok {
+		return 0, false
+	}
+
+	timeout := time.Duration(float64(p99) * l.multiplier)
+	if timeout < l.floor {
+		timeout = l.floor
+	}
+	if timeout > l.max {
+		timeout = l.max
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		if remaining := time.Until(deadline); remaining < timeout {
+			timeout = remaining
+		}
+	}
+	return timeout, true
+}
@@ -0,0 +1,225 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package transport
+
+import (
+	"context"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/opentracing/opentracing-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/yarpc/yab/testdata/protobuf/simple"
+	"go.uber.org/atomic"
+	"go.uber.org/yarpc/yarpcerrors"
+)
+
+// latencySvc waits for delay before responding, and records how long each call
+// had left before its deadline.
+type latencySvc struct {
+	simpleSvc
+
+	delay     atomic.Duration
+	remaining atomic.Duration
+}
+
+func (s *latencySvc) Baz(ctx context.Context, in *simple.Foo) (*simple.Foo, error) {
+	deadline, _ := ctx.Deadline()
+	s.remaining.Store(time.Until(deadline))
+	select {
+	case <-time.After(s.delay.Load()):
+		return in, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func TestGRPCTimeoutLatencyMultiplier(t *testing.T) {
+	const floor = 50 * time.Millisecond
+	svc := &latencySvc{}
+	client, cleanup := newSimpleGRPCClient(t, svc, GRPCOptions{
+		TimeoutLatencyMultiplier: 2,
+		TimeoutLatencyFloor:      floor,
+	})
+	defer cleanup()
+
+	call := func() error {
+		_, err := client.Call(context.Background(), &Request{
+			TargetService: "Bar",
+			Method:        "Bar::Baz",
+			Body:          []byte{},
+		})
+		return err
+	}
+
+	require.NoError(t, call())
+	assert.True(t, svc.remaining.Load() > floor, "the default timeout is used before any calls, got %v", svc.remaining.Load())
+
+	for i := 0; i < 20; i++ {
+		require.NoError(t, call())
+	}
+	timeout, ok := client.latencyTimeout.timeout(context.Background())
+	require.True(t, ok)
+	assert.Equal(t, floor, timeout, "fast calls should use the floor")
+	assert.True(t, svc.remaining.Load() <= floor, "got %v", svc.remaining.Load())
+
+	// As calls slow down, the timeout follows them.
+	const delay = 40 * time.Millisecond
+	svc.delay.Store(delay)
+	for i := 0; i < 5; i++ {
+		require.NoError(t, call())
+	}
+	timeout, _ = client.latencyTimeout.timeout(context.Background())
+	assert.True(t, timeout >= 2*delay, "timeout should scale with the new latency, got %v", timeout)
+	assert.True(t, svc.remaining.Load() > delay, "got %v", svc.remaining.Load())
+
+	// Calls that time out don't raise the timeout.
+	svc.delay.Store(time.Second)
+	require.Error(t, call())
+	after, _ := client.latencyTimeout.timeout(context.Background())
+	assert.Equal(t, timeout, after, "timed out calls should not change the timeout")
+}
+
+func TestLatencyTimeout(t *testing.T) {
+	newTimeout := func(t *testing.T, max time.Duration) *latencyTimeout {
+		l, err := newLatencyTimeout(2, 10*time.Millisecond, max)
+		require.NoError(t, err)
+		return l
+	}
+	timeout := func(l *latencyTimeout) time.Duration {
+		timeout, ok := l.timeout(context.Background())
+		require.True(t, ok)
+		return timeout
+	}
+
+	t.Run("no calls", func(t *testing.T) {
+		_, ok := newTimeout(t, 0).timeout(context.Background())
+		assert.False(t, ok)
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		l, err := newLatencyTimeout(0, time.Second, 0)
+		require.NoError(t, err)
+		l.record(time.Second, nil)
+		_, ok := l.timeout(context.Background())
+		assert.False(t, ok)
+	})
+
+	t.Run("floor", func(t *testing.T) {
+		l := newTimeout(t, 0)
+		l.record(time.Millisecond, nil)
+		assert.Equal(t, 10*time.Millisecond, timeout(l))
+	})
+
+	t.Run("max", func(t *testing.T) {
+		l := newTimeout(t, time.Second)
+		l.record(time.Minute, nil)
+		assert.Equal(t, time.Second, timeout(l))
+
+		l = newTimeout(t, 0)
+		l.record(time.Minute, nil)
+		assert.Equal(t, defaultTimeoutLatencyMax, timeout(l))
+	})
+
+	t.Run("deadline", func(t *testing.T) {
+		l := newTimeout(t, 0)
+		l.record(time.Second, nil)
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+		got, ok := l.timeout(ctx)
+		require.True(t, ok)
+		assert.True(t, got <= 100*time.Millisecond, "timeout should not be past the deadline, got %v", got)
+	})
+
+	t.Run("timed out calls are skipped", func(t *testing.T) {
+		l := newTimeout(t, 0)
+		l.record(50*time.Millisecond, nil)
+		l.record(time.Second, yarpcerrors.DeadlineExceededErrorf("timed out"))
+		l.record(time.Second, context.DeadlineExceeded)
+		assert.Equal(t, 100*time.Millisecond, timeout(l))
+
+		l.record(time.Second, yarpcerrors.InternalErrorf("failed"))
+		assert.Equal(t, 2*time.Second, timeout(l), "other failures are counted")
+	})
+
+	t.Run("old calls leave the window", func(t *testing.T) {
+		l := newTimeout(t, 0)
+		for i := 0; i < latencyWindowSize; i++ {
+			l.record(time.Second, nil)
+		}
+		assert.Equal(t, 2*time.Second, timeout(l))
+
+		// The p99 of the window is its 3rd slowest call.
+		for i := 0; i < latencyWindowSize-3; i++ {
+			l.record(50*time.Millisecond, nil)
+		}
+		assert.Equal(t, 2*time.Second, timeout(l), "3 slow calls are still in the window")
+		l.record(50*time.Millisecond, nil)
+		assert.Equal(t, 100*time.Millisecond, timeout(l))
+	})
+}
+
+func TestNewGRPCTimeoutLatencyMultiplierErrors(t *testing.T) {
+	tests := []struct {
+		msg     string
+		opts    GRPCOptions
+		wantErr string
+	}{
+		{
+			msg:     "negative multiplier",
+			opts:    GRPCOptions{TimeoutLatencyMultiplier: -1},
+			wantErr: "TimeoutLatencyMultiplier must be a non-negative number, got -1",
+		},
+		{
+			msg:     "NaN multiplier",
+			opts:    GRPCOptions{TimeoutLatencyMultiplier: math.NaN()},
+			wantErr: "TimeoutLatencyMultiplier must be a non-negative number, got NaN",
+		},
+		{
+			msg:     "infinite multiplier",
+			opts:    GRPCOptions{TimeoutLatencyMultiplier: math.Inf(1)},
+			wantErr: "TimeoutLatencyMultiplier must be a non-negative number, got +Inf",
+		},
+		{
+			msg:     "floor above max",
+			opts:    GRPCOptions{TimeoutLatencyMultiplier: 2, TimeoutLatencyFloor: 2 * time.Second, TimeoutLatencyMax: time.Second},
+			wantErr: "TimeoutLatencyFloor must be between 0 and TimeoutLatencyMax (1s), got 2s",
+		},
+		{
+			msg:     "floor above default max",
+			opts:    GRPCOptions{TimeoutLatencyMultiplier: 2, TimeoutLatencyFloor: time.Minute},
+			wantErr: "TimeoutLatencyFloor must be between 0 and TimeoutLatencyMax (30s), got 1m0s",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.msg, func(t *testing.T) {
+			opts := tt.opts
+			opts.Addresses = []string{"127.0.0.1:0"}
+			opts.Tracer = opentracing.NoopTracer{}
+			opts.Caller = "test"
+			_, err := newGRPC(opts)
+			assert.EqualError(t, err, tt.wantErr)
+		})
+	}
+}
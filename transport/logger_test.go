@@ -0,0 +1,109 @@
+// Copyright (c) 2021 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package transport
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/yarpc/api/transport"
+)
+
+type logEntry struct {
+	level  string
+	msg    string
+	fields map[string]interface{}
+}
+
+// recordingLogger is a Logger that records all entries for tests.
+type recordingLogger struct {
+	mu      sync.Mutex
+	entries []logEntry
+}
+
+func (l *recordingLogger) log(level, msg string, keysAndValues []interface{}) {
+	fields := make(map[string]interface{})
+	for i := 0; i+1 < len(keysAndValues); i += 2 {
+		fields[keysAndValues[i].(string)] = keysAndValues[i+1]
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.entries = append(l.entries, logEntry{level, msg, fields})
+}
+
+func (l *recordingLogger) Debug(msg string, kv ...interface{}) { l.log("debug", msg, kv) }
+func (l *recordingLogger) Info(msg string, kv ...interface{})  { l.log("info", msg, kv) }
+func (l *recordingLogger) Warn(msg string, kv ...interface{})  { l.log("warn", msg, kv) }
+func (l *recordingLogger) Error(msg string, kv ...interface{}) { l.log("error", msg, kv) }
+
+// find returns the entries with the given level and message.
+func (l *recordingLogger) find(level, msg string) []logEntry {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	var found []logEntry
+	for _, e := range l.entries {
+		if e.level == level && e.msg == msg {
+			found = append(found, e)
+		}
+	}
+	return found
+}
+
+func TestGRPCLogger(t *testing.T) {
+	logger := &recordingLogger{}
+	doWithGRPCTestEnvOptions(t, 1, []transport.Procedure{
+		newTestJSONProcedure("example", "Foo::Bar", testBar),
+	}, GRPCOptions{
+		Caller: "example-caller",
+		Logger: logger,
+	}, func(t *testing.T, grpcTestEnv *grpcTestEnv) {
+		request, err := newTestJSONRequest("example", "Foo::Bar", &testBarRequest{One: "hello"})
+		require.NoError(t, err)
+		_, err = grpcTestEnv.Transport.Call(context.Background(), request)
+		require.NoError(t, err)
+		assert.Empty(t, logger.find("error", "grpc call failed"), "successful calls should not log errors")
+
+		request, err = newTestJSONRequest("example", "Foo::Bar", &testBarRequest{Error: "hello"})
+		require.NoError(t, err)
+		_, err = grpcTestEnv.Transport.Call(context.Background(), request)
+		require.Error(t, err)
+
+		failed := logger.find("error", "grpc call failed")
+		require.Len(t, failed, 1)
+		assert.Equal(t, "unknown", failed[0].fields["code"])
+		assert.Equal(t, "example", failed[0].fields["service"])
+		assert.Equal(t, "Foo::Bar", failed[0].fields["procedure"])
+
+		assert.Len(t, logger.find("info", "started grpc transport"), 1)
+		assert.Len(t, logger.find("debug", "retained peer"), 1)
+		connected := logger.find("info", "peer connection status changed")
+		require.NotEmpty(t, connected)
+		assert.Equal(t, "Available", connected[len(connected)-1].fields["status"])
+	})
+
+	assert.Len(t, logger.find("debug", "released peer"), 1)
+	assert.Len(t, logger.find("info", "stopped grpc transport"), 1)
+}
@@ -0,0 +1,93 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package transport
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel/attribute"
+	otelcodes "go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// withOTelSpan starts an OpenTelemetry span for request if the transport
+// has an OTelTracer, and returns request with the span's context injected
+// into its headers. The returned function ends the span, recording err if
+// the call failed.
+func (t *grpcTransport) withOTelSpan(ctx context.Context, request *Request) (context.Context, *Request, func(err error)) {
+	if t.otelTracer == nil {
+		return ctx, request, func(error) {}
+	}
+
+	ctx, span := t.otelTracer.Start(ctx, request.Method,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("rpc.system", "grpc"),
+			attribute.String("rpc.service", request.TargetService),
+			attribute.String("rpc.method", request.Method),
+		))
+
+	carrier := headerCarrier{}
+	t.otelPropagator.Inject(ctx, carrier)
+	request = withHeaders(request, carrier)
+
+	return ctx, request, func(err error) {
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(otelcodes.Error, err.Error())
+		}
+		span.End()
+	}
+}
+
+// otelWireSpanContext stands in for the span context of a traced call when
+// sizing its headers. Its IDs are the same length as any other span's.
+var otelWireSpanContext = trace.NewSpanContext(trace.SpanContextConfig{
+	TraceID:    trace.TraceID{1},
+	SpanID:     trace.SpanID{1},
+	TraceFlags: trace.FlagsSampled,
+})
+
+// otelWireHeaders returns the headers withOTelSpan would inject for a traced
+// call, without starting a span.
+func (t *grpcTransport) otelWireHeaders() map[string]string {
+	if t.otelTracer == nil {
+		return nil
+	}
+	carrier := headerCarrier{}
+	t.otelPropagator.Inject(trace.ContextWithSpanContext(context.Background(), otelWireSpanContext), carrier)
+	return carrier
+}
+
+// headerCarrier is a propagation.TextMapCarrier that holds request headers.
+type headerCarrier map[string]string
+
+func (c headerCarrier) Get(key string) string { return c[key] }
+
+func (c headerCarrier) Set(key, value string) { c[key] = value }
+
+func (c headerCarrier) Keys() []string {
+	keys := make([]string, 0, len(c))
+	for k := range c {
+		keys = append(keys, k)
+	}
+	return keys
+}
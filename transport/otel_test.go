@@ -0,0 +1,83 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package transport
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestGRPCOTelTracer(t *testing.T) {
+	parent := trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    trace.TraceID{0x4b, 0xf9, 0x2f, 0x35, 0x77, 0xb3, 0x4d, 0xa6, 0xa3, 0xce, 0x92, 0x9d, 0x0e, 0x0e, 0x47, 0x36},
+		SpanID:     trace.SpanID{0x00, 0xf0, 0x67, 0xaa, 0x0b, 0xa9, 0x02, 0xb7},
+		TraceFlags: trace.FlagsSampled,
+		Remote:     true,
+	})
+
+	tests := []struct {
+		msg     string
+		options GRPCOptions
+		want    []string
+	}{
+		{
+			msg: "no OTel tracer",
+		},
+		{
+			msg:     "OTel tracer",
+			options: GRPCOptions{OTelTracer: trace.NewNoopTracerProvider().Tracer("test")},
+			want:    []string{"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.msg, func(t *testing.T) {
+			svc := &deadlineRecordingSvc{}
+			client, cleanup := newSimpleGRPCClient(t, svc, tt.options)
+			defer cleanup()
+
+			ctx := trace.ContextWithRemoteSpanContext(context.Background(), parent)
+			_, err := client.Call(ctx, &Request{
+				TargetService: "Bar",
+				Method:        "Bar::Baz",
+				Timeout:       time.Second,
+				Body:          []byte{},
+			})
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, svc.md.Get("traceparent"))
+		})
+	}
+}
+
+func TestNewGRPCOTelTracerWithoutTracer(t *testing.T) {
+	client, err := newGRPC(GRPCOptions{
+		Addresses:  []string{"127.0.0.1:0"},
+		Caller:     "test",
+		OTelTracer: trace.NewNoopTracerProvider().Tracer("test"),
+	})
+	require.NoError(t, err, "Tracer isn't required with an OTelTracer")
+	assert.NoError(t, client.Close())
+}
@@ -0,0 +1,87 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package transport
+
+import (
+	"sort"
+
+	apipeer "go.uber.org/yarpc/api/peer"
+	"go.uber.org/yarpc/api/transport"
+	"go.uber.org/yarpc/peer/abstractlist"
+)
+
+// PeerAffinity chooses the peer for a call with the given shard key, which
+// may be empty, from the addresses of the available peers, sorted. If it
+// returns an address that isn't one of peers, such as "", the peer is
+// chosen by the balancer instead.
+type PeerAffinity func(shardKey string, peers []string) string
+
+// affinityRing is an abstractlist.Implementation that chooses peers using a
+// PeerAffinity, falling back to another implementation.
+type affinityRing struct {
+	affinity PeerAffinity
+	fallback abstractlist.Implementation
+
+	ids   []string // sorted
+	peers map[string]apipeer.StatusPeer
+}
+
+func newAffinityList(t apipeer.Transport, affinity PeerAffinity, fallback abstractlist.Implementation) *abstractlist.List {
+	return abstractlist.New("affinity", t, &affinityRing{
+		affinity: affinity,
+		fallback: fallback,
+		peers:    make(map[string]apipeer.StatusPeer),
+	})
+}
+
+func (r *affinityRing) Add(p apipeer.StatusPeer, id apipeer.Identifier) abstractlist.Subscriber {
+	addr := id.Identifier()
+	if _, ok := r.peers[addr]; !ok {
+		i := sort.SearchStrings(r.ids, addr)
+		r.ids = append(r.ids, "")
+		copy(r.ids[i+1:], r.ids[i:])
+		r.ids[i] = addr
+	}
+	r.peers[addr] = p
+	return r.fallback.Add(p, id)
+}
+
+func (r *affinityRing) Remove(p apipeer.StatusPeer, id apipeer.Identifier, sub abstractlist.Subscriber) {
+	addr := id.Identifier()
+	if _, ok := r.peers[addr]; ok {
+		i := sort.SearchStrings(r.ids, addr)
+		r.ids = append(r.ids[:i], r.ids[i+1:]...)
+		delete(r.peers, addr)
+	}
+	r.fallback.Remove(p, id, sub)
+}
+
+func (r *affinityRing) Choose(req *transport.Request) apipeer.StatusPeer {
+	if len(r.ids) == 0 {
+		return nil
+	}
+	// Copy the peers so the affinity can't modify the list.
+	chosen := r.affinity(req.ShardKey, append([]string(nil), r.ids...))
+	if p, ok := r.peers[chosen]; ok {
+		return p
+	}
+	return r.fallback.Choose(req)
+}
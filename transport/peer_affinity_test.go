@@ -0,0 +1,101 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package transport
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/opentracing/opentracing-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGRPCPeerAffinity(t *testing.T) {
+	addresses := startBarServers(t, 3)
+	smallest := addresses[0]
+	for _, addr := range addresses {
+		if addr < smallest {
+			smallest = addr
+		}
+	}
+
+	newClient := func(balancer BalancerType, affinity PeerAffinity) *grpcTransport {
+		client, err := newGRPC(GRPCOptions{
+			Addresses:             addresses,
+			Tracer:                opentracing.NoopTracer{},
+			Caller:                "test",
+			Balancer:              balancer,
+			PeerAffinity:          affinity,
+			IncludePeerInResponse: true,
+		})
+		require.NoError(t, err)
+		t.Cleanup(func() { client.Close() })
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		require.NoError(t, client.WaitForPeers(ctx, len(addresses)))
+		return client
+	}
+	call := func(client *grpcTransport, shardKey string) string {
+		res, err := client.Call(context.Background(), &Request{
+			TargetService: "foo",
+			Method:        "Bar::Baz",
+			Timeout:       time.Second,
+			ShardKey:      shardKey,
+		})
+		require.NoError(t, err)
+		return res.PeerAddress
+	}
+
+	t.Run("smallest peer", func(t *testing.T) {
+		var gotKeys []string
+		client := newClient(ConsistentHash, func(shardKey string, peers []string) string {
+			gotKeys = append(gotKeys, shardKey)
+			assert.ElementsMatch(t, addresses, peers)
+			chosen := peers[0]
+			for _, p := range peers {
+				if p < chosen {
+					chosen = p
+				}
+			}
+			return chosen
+		})
+
+		for i := 0; i < 10; i++ {
+			assert.Equal(t, smallest, call(client, fmt.Sprint("key-", i)))
+		}
+		assert.Equal(t, smallest, call(client, ""))
+		assert.Equal(t, "", gotKeys[len(gotKeys)-1], "the affinity should be called for calls without a shard key")
+	})
+
+	t.Run("unknown peer falls back to the balancer", func(t *testing.T) {
+		client := newClient(RoundRobin, func(string, []string) string { return "" })
+
+		seen := make(map[string]struct{})
+		for range addresses {
+			seen[call(client, "key")] = struct{}{}
+		}
+		assert.Len(t, seen, len(addresses), "calls should be sent round-robin")
+	})
+}
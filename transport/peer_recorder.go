@@ -0,0 +1,55 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package transport
+
+import (
+	"context"
+
+	"go.uber.org/atomic"
+	apipeer "go.uber.org/yarpc/api/peer"
+	"go.uber.org/yarpc/api/transport"
+)
+
+type peerRecordKey struct{}
+
+// withPeerRecord returns a context that records the identifier of the peer
+// chosen for a call made with it.
+func withPeerRecord(ctx context.Context) (context.Context, *atomic.String) {
+	record := atomic.NewString("")
+	return context.WithValue(ctx, peerRecordKey{}, record), record
+}
+
+// peerRecordingList wraps a peer list to record the peer chosen for each
+// call in the call's context.
+type peerRecordingList struct {
+	apipeer.ChooserList
+}
+
+func (l peerRecordingList) Choose(ctx context.Context, req *transport.Request) (apipeer.Peer, func(error), error) {
+	p, onFinish, err := l.ChooserList.Choose(ctx, req)
+	if err != nil {
+		return p, onFinish, err
+	}
+	if record, ok := ctx.Value(peerRecordKey{}).(*atomic.String); ok {
+		record.Store(p.Identifier())
+	}
+	return p, onFinish, nil
+}
@@ -0,0 +1,289 @@
+// Copyright (c) 2021 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package transport
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	apipeer "go.uber.org/yarpc/api/peer"
+	"go.uber.org/yarpc/api/transport"
+)
+
+// defaultPeerDrainTimeout is how long a removed peer's connection is kept
+// open for its pending calls, if GRPCOptions.PeerDrainTimeout isn't set.
+const defaultPeerDrainTimeout = 10 * time.Second
+
+// observedPeerTransport wraps a peer transport to observe changes to the
+// connection status of the peers it manages. Released peers are drained:
+// their connections are only closed once the calls made to them through a
+// drainingList have finished, or the drain timeout has passed.
+type observedPeerTransport struct {
+	apipeer.Transport
+
+	logger       Logger
+	notifier     *connectionNotifier
+	drainTimeout time.Duration
+
+	mu          sync.Mutex
+	subscribers map[apipeer.Subscriber]*observedSubscriber
+	// changed is closed and replaced whenever peers are retained or
+	// released, or their connection status changes.
+	changed chan struct{}
+	// pending counts the calls in progress to each peer, and drained holds
+	// a channel for each peer being drained, closed when it has none.
+	pending map[string]int
+	drained map[string]chan struct{}
+	stopped chan struct{}
+}
+
+func newObservedPeerTransport(t apipeer.Transport, logger Logger, notifier *connectionNotifier, drainTimeout time.Duration) *observedPeerTransport {
+	if drainTimeout <= 0 {
+		drainTimeout = defaultPeerDrainTimeout
+	}
+	return &observedPeerTransport{
+		Transport:    t,
+		logger:       logger,
+		notifier:     notifier,
+		drainTimeout: drainTimeout,
+		subscribers:  make(map[apipeer.Subscriber]*observedSubscriber),
+		changed:      make(chan struct{}),
+		pending:      make(map[string]int),
+		drained:      make(map[string]chan struct{}),
+		stopped:      make(chan struct{}),
+	}
+}
+
+// startRequest records a call to the peer id, and returns a function to call
+// once it's finished.
+func (t *observedPeerTransport) startRequest(id string) func() {
+	t.mu.Lock()
+	t.pending[id]++
+	t.mu.Unlock()
+
+	return func() {
+		t.mu.Lock()
+		defer t.mu.Unlock()
+		if t.pending[id]--; t.pending[id] > 0 {
+			return
+		}
+		delete(t.pending, id)
+		if drained, ok := t.drained[id]; ok {
+			close(drained)
+			delete(t.drained, id)
+		}
+	}
+}
+
+// stop stops waiting for peers to drain, so they are released right away.
+func (t *observedPeerTransport) stop() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	select {
+	case <-t.stopped:
+	default:
+		close(t.stopped)
+	}
+}
+
+// availablePeers returns the number of retained peers that are available,
+// and a channel that is closed the next time that may change.
+func (t *observedPeerTransport) availablePeers() (int, <-chan struct{}) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	available := make(map[string]struct{}, len(t.subscribers))
+	for _, observed := range t.subscribers {
+		if p := observed.getPeer(); p != nil && p.Status().ConnectionStatus == apipeer.Available {
+			available[p.Identifier()] = struct{}{}
+		}
+	}
+	return len(available), t.changed
+}
+
+// notifyChanged wakes up anything waiting for peers to change.
+func (t *observedPeerTransport) notifyChanged() {
+	t.mu.Lock()
+	close(t.changed)
+	t.changed = make(chan struct{})
+	t.mu.Unlock()
+}
+
+func (t *observedPeerTransport) RetainPeer(id apipeer.Identifier, sub apipeer.Subscriber) (apipeer.Peer, error) {
+	observed := &observedSubscriber{Subscriber: sub, transport: t}
+
+	p, err := t.Transport.RetainPeer(id, observed)
+	if err != nil {
+		t.logger.Warn("failed to retain peer", "peer", id.Identifier(), "error", err)
+		return nil, err
+	}
+	// A peer that's already connected won't report a status change.
+	if observed.setPeer(p) == apipeer.Available {
+		t.notifier.notify(id.Identifier(), true)
+	}
+
+	t.mu.Lock()
+	t.subscribers[sub] = observed
+	t.mu.Unlock()
+	t.notifyChanged()
+
+	t.logger.Debug("retained peer", "peer", id.Identifier())
+	return p, nil
+}
+
+// ReleasePeer stops tracking the peer right away, but only releases it from
+// the underlying transport, which closes its connection, once its pending
+// calls have finished.
+func (t *observedPeerTransport) ReleasePeer(id apipeer.Identifier, sub apipeer.Subscriber) error {
+	t.mu.Lock()
+	observed, ok := t.subscribers[sub]
+	delete(t.subscribers, sub)
+	var drained chan struct{}
+	if pending := t.pending[id.Identifier()]; pending > 0 {
+		if drained = t.drained[id.Identifier()]; drained == nil {
+			drained = make(chan struct{})
+			t.drained[id.Identifier()] = drained
+		}
+	}
+	t.mu.Unlock()
+	t.notifyChanged()
+
+	// The underlying transport only knows about the wrapped subscriber.
+	var releaseSub apipeer.Subscriber = sub
+	if ok {
+		releaseSub = observed
+	}
+	release := func() error {
+		if err := t.Transport.ReleasePeer(id, releaseSub); err != nil {
+			t.logger.Warn("failed to release peer", "peer", id.Identifier(), "error", err)
+			return err
+		}
+		if ok && observed.getStatus() == apipeer.Available {
+			t.notifier.notify(id.Identifier(), false)
+		}
+		t.logger.Debug("released peer", "peer", id.Identifier())
+		return nil
+	}
+	if drained == nil {
+		return release()
+	}
+
+	t.logger.Info("draining peer", "peer", id.Identifier())
+	go func() {
+		timer := time.NewTimer(t.drainTimeout)
+		defer timer.Stop()
+		select {
+		case <-drained:
+		case <-t.stopped:
+		case <-timer.C:
+			t.logger.Warn("peer still has pending calls after drain timeout, closing it", "peer", id.Identifier(), "timeout", t.drainTimeout)
+		}
+		release()
+	}()
+	return nil
+}
+
+func (t *observedPeerTransport) connectionStatusChanged(id apipeer.Identifier, from, to apipeer.ConnectionStatus) {
+	t.logger.Info("peer connection status changed", "peer", id.Identifier(), "status", to.String())
+	t.notifyChanged()
+
+	if to == apipeer.Available {
+		t.notifier.notify(id.Identifier(), true)
+	} else if from == apipeer.Available {
+		t.notifier.notify(id.Identifier(), false)
+	}
+}
+
+// observedSubscriber forwards notifications to the peer list, and reports
+// connection status changes to the transport.
+type observedSubscriber struct {
+	apipeer.Subscriber
+
+	transport *observedPeerTransport
+
+	mu         sync.Mutex
+	peer       apipeer.Peer
+	lastStatus apipeer.ConnectionStatus
+}
+
+// setPeer records the peer and returns its initial status.
+func (s *observedSubscriber) setPeer(p apipeer.Peer) apipeer.ConnectionStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.peer = p
+	s.lastStatus = p.Status().ConnectionStatus
+	return s.lastStatus
+}
+
+func (s *observedSubscriber) getPeer() apipeer.Peer {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.peer
+}
+
+func (s *observedSubscriber) getStatus() apipeer.ConnectionStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.lastStatus
+}
+
+func (s *observedSubscriber) NotifyStatusChanged(id apipeer.Identifier) {
+	s.Subscriber.NotifyStatusChanged(id)
+
+	s.mu.Lock()
+	if s.peer == nil {
+		// Notified before RetainPeer returned, the initial status is
+		// recorded by setPeer.
+		s.mu.Unlock()
+		return
+	}
+	status := s.peer.Status().ConnectionStatus
+	previous := s.lastStatus
+	s.lastStatus = status
+	s.mu.Unlock()
+
+	if status != previous {
+		s.transport.connectionStatusChanged(id, previous, status)
+	}
+}
+
+// drainingList wraps a peer list to record the calls in progress to each
+// peer, so their connections aren't closed when they're removed until the
+// calls have finished.
+type drainingList struct {
+	apipeer.ChooserList
+
+	peers *observedPeerTransport
+}
+
+func (l drainingList) Choose(ctx context.Context, req *transport.Request) (apipeer.Peer, func(error), error) {
+	p, onFinish, err := l.ChooserList.Choose(ctx, req)
+	if err != nil {
+		return p, onFinish, err
+	}
+
+	finish := l.peers.startRequest(p.Identifier())
+	return p, func(err error) {
+		onFinish(err)
+		finish()
+	}, nil
+}
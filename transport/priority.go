@@ -0,0 +1,86 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package transport
+
+import (
+	"fmt"
+	"strconv"
+)
+
+const (
+	// DefaultPriorityHeader is the header priorities are sent in if
+	// GRPCOptions.PriorityHeader isn't set.
+	DefaultPriorityHeader = "x-priority"
+
+	// DefaultMaxPriority is the highest priority allowed if
+	// GRPCOptions.MaxPriority isn't set.
+	DefaultMaxPriority = 10
+)
+
+// priorityPolicy sets the priority header of calls.
+type priorityPolicy struct {
+	header          string
+	defaultPriority int
+	max             int
+}
+
+func newPriorityPolicy(header string, defaultPriority, max int) (priorityPolicy, error) {
+	if header == "" {
+		header = DefaultPriorityHeader
+	}
+	if max < 0 {
+		return priorityPolicy{}, fmt.Errorf("MaxPriority must not be negative, got %v", max)
+	}
+	if max == 0 {
+		max = DefaultMaxPriority
+	}
+
+	p := priorityPolicy{header: header, max: max}
+	if err := p.validate(defaultPriority); err != nil {
+		return priorityPolicy{}, err
+	}
+	p.defaultPriority = defaultPriority
+	return p, nil
+}
+
+func (p priorityPolicy) validate(priority int) error {
+	if priority < 0 || priority > p.max {
+		return fmt.Errorf("priority %v is out of range, must be between 0 and %v", priority, p.max)
+	}
+	return nil
+}
+
+// withPriority returns request with its priority, or the default priority
+// if it doesn't set one, in the priority header. Requests without either
+// are returned unchanged.
+func (p priorityPolicy) withPriority(request *Request) (*Request, error) {
+	priority := request.Priority
+	if priority == 0 {
+		priority = p.defaultPriority
+	}
+	if err := p.validate(priority); err != nil {
+		return nil, err
+	}
+	if priority == 0 {
+		return request, nil
+	}
+	return withHeaders(request, map[string]string{p.header: strconv.Itoa(priority)}), nil
+}
@@ -0,0 +1,134 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package transport
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/opentracing/opentracing-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGRPCPriority(t *testing.T) {
+	tests := []struct {
+		msg        string
+		options    GRPCOptions
+		priority   int
+		wantHeader string
+		wantValue  []string
+		wantErr    string
+	}{
+		{
+			msg:        "no priority",
+			wantHeader: DefaultPriorityHeader,
+		},
+		{
+			msg:        "request priority",
+			priority:   3,
+			wantHeader: DefaultPriorityHeader,
+			wantValue:  []string{"3"},
+		},
+		{
+			msg:        "default priority",
+			options:    GRPCOptions{Priority: 2},
+			wantHeader: DefaultPriorityHeader,
+			wantValue:  []string{"2"},
+		},
+		{
+			msg:        "request overrides default",
+			options:    GRPCOptions{Priority: 2, PriorityHeader: "qos"},
+			priority:   5,
+			wantHeader: "qos",
+			wantValue:  []string{"5"},
+		},
+		{
+			msg:        "custom max",
+			options:    GRPCOptions{MaxPriority: 100},
+			priority:   100,
+			wantHeader: DefaultPriorityHeader,
+			wantValue:  []string{"100"},
+		},
+		{
+			msg:      "above max",
+			priority: DefaultMaxPriority + 1,
+			wantErr:  "priority 11 is out of range, must be between 0 and 10",
+		},
+		{
+			msg:      "negative",
+			priority: -1,
+			wantErr:  "priority -1 is out of range, must be between 0 and 10",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.msg, func(t *testing.T) {
+			svc := &deadlineRecordingSvc{}
+			client, cleanup := newSimpleGRPCClient(t, svc, tt.options)
+			defer cleanup()
+
+			_, err := client.Call(context.Background(), &Request{
+				TargetService: "Bar",
+				Method:        "Bar::Baz",
+				Timeout:       time.Second,
+				Body:          []byte{},
+				Priority:      tt.priority,
+			})
+			if tt.wantErr != "" {
+				assert.EqualError(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantValue, svc.md.Get(tt.wantHeader))
+		})
+	}
+}
+
+func TestNewGRPCPriorityErrors(t *testing.T) {
+	tests := []struct {
+		msg     string
+		options GRPCOptions
+		wantErr string
+	}{
+		{
+			msg:     "default above max",
+			options: GRPCOptions{Priority: 5, MaxPriority: 4},
+			wantErr: "priority 5 is out of range, must be between 0 and 4",
+		},
+		{
+			msg:     "negative max",
+			options: GRPCOptions{MaxPriority: -1},
+			wantErr: "MaxPriority must not be negative, got -1",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.msg, func(t *testing.T) {
+			tt.options.Addresses = []string{"127.0.0.1:0"}
+			tt.options.Tracer = opentracing.NoopTracer{}
+			tt.options.Caller = "test"
+			_, err := newGRPC(tt.options)
+			assert.EqualError(t, err, tt.wantErr)
+		})
+	}
+}
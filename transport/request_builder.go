@@ -0,0 +1,100 @@
+// Copyright (c) 2021 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package transport
+
+import (
+	"errors"
+	"time"
+)
+
+var (
+	errRequestNoService = errors.New("must specify request service")
+	errRequestNoMethod  = errors.New("must specify request method")
+)
+
+// RequestBuilder builds a Request using chained method calls. A builder can
+// be reused, each call to Build returns a new Request.
+type RequestBuilder struct {
+	req Request
+}
+
+// NewRequestBuilder returns an empty RequestBuilder.
+func NewRequestBuilder() *RequestBuilder {
+	return &RequestBuilder{}
+}
+
+// Service sets the target service.
+func (b *RequestBuilder) Service(service string) *RequestBuilder {
+	b.req.TargetService = service
+	return b
+}
+
+// Method sets the method to call.
+func (b *RequestBuilder) Method(method string) *RequestBuilder {
+	b.req.Method = method
+	return b
+}
+
+// Header adds a header, replacing any previous value for the key.
+func (b *RequestBuilder) Header(key, value string) *RequestBuilder {
+	if b.req.Headers == nil {
+		b.req.Headers = make(map[string]string)
+	}
+	b.req.Headers[key] = value
+	return b
+}
+
+// Body sets the serialized request body.
+func (b *RequestBuilder) Body(body []byte) *RequestBuilder {
+	b.req.Body = body
+	return b
+}
+
+// Timeout sets the request timeout.
+func (b *RequestBuilder) Timeout(timeout time.Duration) *RequestBuilder {
+	b.req.Timeout = timeout
+	return b
+}
+
+// ShardKey sets the shard key.
+func (b *RequestBuilder) ShardKey(shardKey string) *RequestBuilder {
+	b.req.ShardKey = shardKey
+	return b
+}
+
+// Build returns the Request, or an error if the service or method is missing.
+func (b *RequestBuilder) Build() (*Request, error) {
+	if b.req.TargetService == "" {
+		return nil, errRequestNoService
+	}
+	if b.req.Method == "" {
+		return nil, errRequestNoMethod
+	}
+
+	req := b.req
+	if b.req.Headers != nil {
+		req.Headers = make(map[string]string, len(b.req.Headers))
+		for k, v := range b.req.Headers {
+			req.Headers[k] = v
+		}
+	}
+	return &req, nil
+}
@@ -0,0 +1,88 @@
+// Copyright (c) 2021 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package transport
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRequestBuilder(t *testing.T) {
+	b := NewRequestBuilder().
+		Service("svc").
+		Method("Svc::Method").
+		Header("k1", "v1").
+		Header("k2", "v2").
+		Body([]byte("body")).
+		Timeout(time.Second).
+		ShardKey("sk")
+
+	req, err := b.Build()
+	require.NoError(t, err)
+	assert.Equal(t, &Request{
+		TargetService: "svc",
+		Method:        "Svc::Method",
+		Timeout:       time.Second,
+		Headers:       map[string]string{"k1": "v1", "k2": "v2"},
+		ShardKey:      "sk",
+		Body:          []byte("body"),
+	}, req)
+
+	// Changes to the builder should not affect previously built requests.
+	req2, err := b.Header("k1", "changed").Build()
+	require.NoError(t, err)
+	assert.Equal(t, "v1", req.Headers["k1"])
+	assert.Equal(t, "changed", req2.Headers["k1"])
+}
+
+func TestRequestBuilderMissingFields(t *testing.T) {
+	tests := []struct {
+		msg     string
+		builder *RequestBuilder
+		wantErr error
+	}{
+		{
+			msg:     "empty",
+			builder: NewRequestBuilder(),
+			wantErr: errRequestNoService,
+		},
+		{
+			msg:     "missing service",
+			builder: NewRequestBuilder().Method("Svc::Method"),
+			wantErr: errRequestNoService,
+		},
+		{
+			msg:     "missing method",
+			builder: NewRequestBuilder().Service("svc"),
+			wantErr: errRequestNoMethod,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.msg, func(t *testing.T) {
+			_, err := tt.builder.Build()
+			assert.Equal(t, tt.wantErr, err)
+		})
+	}
+}
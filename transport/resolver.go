@@ -0,0 +1,97 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package transport
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"time"
+
+	"go.uber.org/multierr"
+)
+
+// Resolver looks up the addresses of a host name. *net.Resolver implements
+// Resolver, and tests can use an in-memory implementation.
+type Resolver interface {
+	LookupHost(ctx context.Context, host string) ([]string, error)
+}
+
+// dialFunc dials a network address, like net.Dialer.DialContext.
+type dialFunc func(ctx context.Context, network, addr string) (net.Conn, error)
+
+// newResolvingDialer returns a dialFunc that looks up host names using r,
+// and tries each of the addresses it returns in order. It returns nil if r
+// is nil, so the default dialer should be used.
+func newResolvingDialer(r Resolver) dialFunc {
+	if r == nil {
+		return nil
+	}
+
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		return resolveAndDial(ctx, r, network, addr, nil)
+	}
+}
+
+// resolveAndDial looks up the host in addr using r, and dials each of the
+// addresses it returns in order until one succeeds. If timing is non-nil,
+// the time spent looking up the host and connecting are recorded in it.
+func resolveAndDial(ctx context.Context, r Resolver, network, addr string, timing *ConnectionTiming) (net.Conn, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+
+	ips := []string{host}
+	if net.ParseIP(host) == nil {
+		start := time.Now()
+		ips, err = r.LookupHost(ctx, host)
+		if timing != nil {
+			timing.DNS = time.Since(start)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("could not resolve %q: %v", host, err)
+		}
+		if len(ips) == 0 {
+			return nil, fmt.Errorf("no addresses found for %q", host)
+		}
+	}
+
+	start := time.Now()
+	defer func() {
+		if timing != nil {
+			timing.TCP = time.Since(start)
+		}
+	}()
+
+	var (
+		dialer net.Dialer
+		errs   error
+	)
+	for _, ip := range ips {
+		conn, err := dialer.DialContext(ctx, network, net.JoinHostPort(ip, port))
+		if err == nil {
+			return conn, nil
+		}
+		errs = multierr.Append(errs, err)
+	}
+	return nil, errs
+}
@@ -0,0 +1,151 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package transport
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/opentracing/opentracing-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/yarpc/yab/testdata/protobuf/simple"
+	googlegrpc "google.golang.org/grpc"
+)
+
+// fakeResolver resolves host names from a fixed map.
+type fakeResolver struct {
+	hosts map[string][]string
+
+	mu      sync.Mutex
+	lookups []string
+}
+
+func (r *fakeResolver) LookupHost(_ context.Context, host string) ([]string, error) {
+	r.mu.Lock()
+	r.lookups = append(r.lookups, host)
+	r.mu.Unlock()
+
+	addrs, ok := r.hosts[host]
+	if !ok {
+		return nil, fmt.Errorf("no such host %q", host)
+	}
+	return addrs, nil
+}
+
+func TestGRPCResolver(t *testing.T) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	server := googlegrpc.NewServer()
+	simple.RegisterBarServer(server, &simpleSvc{})
+	go server.Serve(lis)
+	defer server.Stop()
+	_, port, err := net.SplitHostPort(lis.Addr().String())
+	require.NoError(t, err)
+
+	resolver := &fakeResolver{hosts: map[string][]string{
+		// Nothing listens on 127.0.0.2, so dialing falls through to 127.0.0.1.
+		"bar.fake": {"127.0.0.2", "127.0.0.1"},
+	}}
+	client, err := newGRPC(GRPCOptions{
+		Addresses: []string{net.JoinHostPort("bar.fake", port)},
+		Tracer:    opentracing.NoopTracer{},
+		Caller:    "test",
+		Encoding:  "proto",
+		Resolver:  resolver,
+	})
+	require.NoError(t, err)
+	defer client.Close()
+
+	res, err := client.Call(context.Background(), &Request{
+		TargetService: "Bar",
+		Method:        "Bar::Baz",
+		Timeout:       time.Second,
+		Body:          []byte{0x08, 0x01},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []byte{0x08, 0x01}, res.Body)
+
+	resolver.mu.Lock()
+	defer resolver.mu.Unlock()
+	assert.Contains(t, resolver.lookups, "bar.fake", "peer host should be looked up using the resolver")
+}
+
+func TestResolvingDialer(t *testing.T) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer lis.Close()
+	go func() {
+		for {
+			conn, err := lis.Accept()
+			if err != nil {
+				return
+			}
+			conn.Close()
+		}
+	}()
+	_, port, err := net.SplitHostPort(lis.Addr().String())
+	require.NoError(t, err)
+
+	assert.Nil(t, newResolvingDialer(nil), "no dialer without a resolver")
+
+	resolver := &fakeResolver{hosts: map[string][]string{
+		"up.fake":    {"127.0.0.1"},
+		"empty.fake": {},
+	}}
+	dial := newResolvingDialer(resolver)
+
+	tests := []struct {
+		msg     string
+		addr    string
+		wantErr string
+	}{
+		{msg: "resolved host", addr: net.JoinHostPort("up.fake", port)},
+		{msg: "IP address", addr: lis.Addr().String()},
+		{
+			msg:     "unknown host",
+			addr:    net.JoinHostPort("down.fake", port),
+			wantErr: `could not resolve "down.fake": no such host "down.fake"`,
+		},
+		{
+			msg:     "no addresses",
+			addr:    net.JoinHostPort("empty.fake", port),
+			wantErr: `no addresses found for "empty.fake"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.msg, func(t *testing.T) {
+			conn, err := dial(context.Background(), "tcp", tt.addr)
+			if tt.wantErr != "" {
+				assert.EqualError(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			conn.Close()
+		})
+	}
+	assert.NotContains(t, resolver.lookups, "127.0.0.1", "IP addresses should not be looked up")
+}
@@ -0,0 +1,108 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package transport
+
+import (
+	"crypto/sha256"
+	"sync"
+)
+
+// responseCacheKey identifies requests that are served the same cached response.
+type responseCacheKey struct {
+	service  string
+	method   string
+	bodyHash [sha256.Size]byte
+}
+
+// responseCache stores the first successful response for each distinct
+// request to an allowlisted method.
+type responseCache struct {
+	methods map[string]struct{}
+
+	mu        sync.RWMutex
+	responses map[responseCacheKey]*Response
+}
+
+func newResponseCache(methods []string) *responseCache {
+	c := &responseCache{
+		methods:   make(map[string]struct{}, len(methods)),
+		responses: make(map[responseCacheKey]*Response),
+	}
+	for _, m := range methods {
+		c.methods[m] = struct{}{}
+	}
+	return c
+}
+
+// key returns the cache key for request, and false if its method is not
+// cacheable.
+func (c *responseCache) key(request *Request) (responseCacheKey, bool) {
+	if _, ok := c.methods[request.Method]; !ok {
+		return responseCacheKey{}, false
+	}
+	return responseCacheKey{
+		service:  request.TargetService,
+		method:   request.Method,
+		bodyHash: sha256.Sum256(request.Body),
+	}, true
+}
+
+func (c *responseCache) get(key responseCacheKey) (*Response, bool) {
+	c.mu.RLock()
+	res, ok := c.responses[key]
+	c.mu.RUnlock()
+	if !ok {
+		return nil, false
+	}
+	return copyResponse(res), true
+}
+
+func (c *responseCache) put(key responseCacheKey, res *Response) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.responses[key]; !ok {
+		c.responses[key] = copyResponse(res)
+	}
+}
+
+// copyResponse returns a copy of res that doesn't share its body buffer or
+// headers, so cached responses are not affected by callers or buffer pools.
+func copyResponse(res *Response) *Response {
+	headers := make(map[string]string, len(res.Headers))
+	for k, v := range res.Headers {
+		headers[k] = v
+	}
+	var transportFields map[string]interface{}
+	if res.TransportFields != nil {
+		transportFields = make(map[string]interface{}, len(res.TransportFields))
+		for k, v := range res.TransportFields {
+			transportFields[k] = v
+		}
+	}
+	return &Response{
+		Headers:         headers,
+		Body:            append([]byte(nil), res.Body...),
+		TransportFields: transportFields,
+		PeerAddress:     res.PeerAddress,
+		Truncated:       res.Truncated,
+		RawFrame:        append([]byte(nil), res.RawFrame...),
+	}
+}
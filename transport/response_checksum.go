@@ -0,0 +1,108 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package transport
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"strings"
+
+	"github.com/yarpc/yab/sorted"
+)
+
+var errChecksumNoTrailer = errors.New("must specify ChecksumTrailer to use ChecksumAlgorithm")
+
+// checksumAlgorithms are the algorithms that response bodies can be verified
+// with, by the name used in ChecksumAlgorithm.
+var checksumAlgorithms = map[string]func() hash.Hash{
+	"crc32":  func() hash.Hash { return crc32.NewIEEE() },
+	"sha256": sha256.New,
+}
+
+// ChecksumMismatchError is returned when a response body doesn't match the
+// checksum the server sent for it.
+type ChecksumMismatchError struct {
+	Algorithm string
+	Want      string
+	Got       string
+}
+
+func (e *ChecksumMismatchError) Error() string {
+	return fmt.Sprintf("response body %v checksum %v does not match %v sent by the server", e.Algorithm, e.Got, e.Want)
+}
+
+// responseChecksum verifies response bodies against a hex encoded checksum
+// that the server sends in a trailer.
+type responseChecksum struct {
+	trailer   string
+	algorithm string
+	newHash   func() hash.Hash
+}
+
+// newResponseChecksum returns nil if trailer is empty, meaning responses
+// aren't verified. The algorithm defaults to crc32.
+func newResponseChecksum(trailer, algorithm string) (*responseChecksum, error) {
+	if trailer == "" {
+		if algorithm != "" {
+			return nil, errChecksumNoTrailer
+		}
+		return nil, nil
+	}
+
+	if algorithm == "" {
+		algorithm = "crc32"
+	}
+	newHash, ok := checksumAlgorithms[algorithm]
+	if !ok {
+		return nil, fmt.Errorf("unknown checksum algorithm %q, valid algorithms are: %v",
+			algorithm, strings.Join(sorted.MapKeys(checksumAlgorithms), ", "))
+	}
+	return &responseChecksum{
+		trailer:   strings.ToLower(trailer),
+		algorithm: algorithm,
+		newHash:   newHash,
+	}, nil
+}
+
+// verify checks body against the checksum in trailers, which are looked up
+// by their lower-cased names.
+func (c *responseChecksum) verify(body []byte, trailers map[string]string) error {
+	want, ok := trailers[c.trailer]
+	if !ok {
+		return fmt.Errorf("response is missing checksum trailer %q", c.trailer)
+	}
+
+	h := c.newHash()
+	h.Write(body)
+	got := hex.EncodeToString(h.Sum(nil))
+	if !strings.EqualFold(got, strings.TrimSpace(want)) {
+		return &ChecksumMismatchError{
+			Algorithm: c.algorithm,
+			Want:      want,
+			Got:       got,
+		}
+	}
+	return nil
+}
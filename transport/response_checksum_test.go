@@ -0,0 +1,167 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package transport
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"hash/crc32"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/opentracing/opentracing-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/yarpc/yab/testdata/protobuf/simple"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+// checksumSvc sends the checksum returned by checksum for each response
+// body in the x-checksum trailer, leaving out the trailer if it's empty.
+type checksumSvc struct {
+	simpleSvc
+
+	checksum func(body []byte) string
+}
+
+func (s *checksumSvc) Baz(ctx context.Context, in *simple.Foo) (*simple.Foo, error) {
+	body, err := proto.Marshal(in)
+	if err != nil {
+		return nil, err
+	}
+	if sum := s.checksum(body); sum != "" {
+		if err := grpc.SetTrailer(ctx, metadata.Pairs("x-checksum", sum)); err != nil {
+			return nil, err
+		}
+	}
+	return in, nil
+}
+
+func TestGRPCChecksum(t *testing.T) {
+	crc32Checksum := func(body []byte) string {
+		sum := crc32.NewIEEE()
+		sum.Write(body)
+		return hex.EncodeToString(sum.Sum(nil))
+	}
+	sha256Checksum := func(body []byte) string {
+		sum := sha256.Sum256(body)
+		return hex.EncodeToString(sum[:])
+	}
+
+	tests := []struct {
+		msg       string
+		algorithm string
+		checksum  func(body []byte) string
+		wantErr   string
+		mismatch  bool
+	}{
+		{
+			msg:      "crc32 by default",
+			checksum: crc32Checksum,
+		},
+		{
+			msg:       "sha256",
+			algorithm: "sha256",
+			checksum:  sha256Checksum,
+		},
+		{
+			msg:       "crc32 mismatch",
+			algorithm: "crc32",
+			checksum:  func([]byte) string { return "00000000" },
+			mismatch:  true,
+		},
+		{
+			msg:       "wrong algorithm",
+			algorithm: "sha256",
+			checksum:  crc32Checksum,
+			mismatch:  true,
+		},
+		{
+			msg:      "missing trailer",
+			checksum: func([]byte) string { return "" },
+			wantErr:  `response is missing checksum trailer "x-checksum"`,
+		},
+	}
+
+	body, err := proto.Marshal(&simple.Foo{Test: 42})
+	require.NoError(t, err)
+
+	for _, tt := range tests {
+		t.Run(tt.msg, func(t *testing.T) {
+			client, cleanup := newSimpleGRPCClient(t, &checksumSvc{checksum: tt.checksum}, GRPCOptions{
+				ChecksumTrailer:   "X-Checksum",
+				ChecksumAlgorithm: tt.algorithm,
+			})
+			defer cleanup()
+
+			res, err := client.Call(context.Background(), &Request{
+				TargetService: "Bar",
+				Method:        "Bar::Baz",
+				Timeout:       time.Second,
+				Body:          body,
+			})
+			if tt.mismatch {
+				var mismatch *ChecksumMismatchError
+				require.ErrorAs(t, err, &mismatch)
+				assert.Equal(t, tt.checksum(body), mismatch.Want)
+				return
+			}
+			if tt.wantErr != "" {
+				assert.EqualError(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, body, res.Body)
+		})
+	}
+}
+
+func TestGRPCChecksumInvalid(t *testing.T) {
+	tests := []struct {
+		msg     string
+		opts    GRPCOptions
+		wantErr string
+	}{
+		{
+			msg:     "algorithm without trailer",
+			opts:    GRPCOptions{ChecksumAlgorithm: "crc32"},
+			wantErr: errChecksumNoTrailer.Error(),
+		},
+		{
+			msg:     "unknown algorithm",
+			opts:    GRPCOptions{ChecksumTrailer: "x-checksum", ChecksumAlgorithm: "md5"},
+			wantErr: `unknown checksum algorithm "md5", valid algorithms are: crc32, sha256`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.msg, func(t *testing.T) {
+			tt.opts.Addresses = []string{"127.0.0.1:0"}
+			tt.opts.Tracer = opentracing.NoopTracer{}
+			tt.opts.Caller = "test"
+			_, err := newGRPC(tt.opts)
+			assert.EqualError(t, err, tt.wantErr)
+		})
+	}
+}
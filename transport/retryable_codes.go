@@ -0,0 +1,96 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package transport
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"go.uber.org/yarpc/yarpcerrors"
+	"google.golang.org/grpc/codes"
+)
+
+// grpcCodeNames maps the names that gRPC status codes are known by across
+// implementations to the codes.
+var grpcCodeNames = map[string]codes.Code{
+	"OK":                  codes.OK,
+	"CANCELLED":           codes.Canceled,
+	"UNKNOWN":             codes.Unknown,
+	"INVALID_ARGUMENT":    codes.InvalidArgument,
+	"DEADLINE_EXCEEDED":   codes.DeadlineExceeded,
+	"NOT_FOUND":           codes.NotFound,
+	"ALREADY_EXISTS":      codes.AlreadyExists,
+	"PERMISSION_DENIED":   codes.PermissionDenied,
+	"RESOURCE_EXHAUSTED":  codes.ResourceExhausted,
+	"FAILED_PRECONDITION": codes.FailedPrecondition,
+	"ABORTED":             codes.Aborted,
+	"OUT_OF_RANGE":        codes.OutOfRange,
+	"UNIMPLEMENTED":       codes.Unimplemented,
+	"INTERNAL":            codes.Internal,
+	"UNAVAILABLE":         codes.Unavailable,
+	"DATA_LOSS":           codes.DataLoss,
+	"UNAUTHENTICATED":     codes.Unauthenticated,
+}
+
+// parseGRPCCodes returns the set of codes with the given names, which are
+// matched case-insensitively. It returns nil if names is empty.
+func parseGRPCCodes(names []string) (map[codes.Code]struct{}, error) {
+	if len(names) == 0 {
+		return nil, nil
+	}
+
+	parsed := make(map[codes.Code]struct{}, len(names))
+	var invalid []string
+	for _, name := range names {
+		code, ok := grpcCodeNames[strings.ToUpper(strings.TrimSpace(name))]
+		if !ok {
+			invalid = append(invalid, fmt.Sprintf("%q", name))
+			continue
+		}
+		parsed[code] = struct{}{}
+	}
+	if len(invalid) > 0 {
+		valid := make([]string, 0, len(grpcCodeNames))
+		for name := range grpcCodeNames {
+			valid = append(valid, name)
+		}
+		sort.Strings(valid)
+		return nil, fmt.Errorf("unknown gRPC codes %v, valid codes are: %v",
+			strings.Join(invalid, ", "), strings.Join(valid, ", "))
+	}
+	return parsed, nil
+}
+
+// shouldRetry returns whether a unary call of request that failed with err
+// should be retried.
+func (t *grpcTransport) shouldRetry(request *Request, err error) bool {
+	// The server may have handled a request that was sent before the
+	// connection closed, so it's only sent again if it has an idempotency key
+	// for the server to tell it's a retry.
+	closed, maybeSent := connectionClosed(err)
+	if t.idleReconnect && closed && (!maybeSent || request.Headers[IdempotencyKeyHeader] != "") {
+		return true
+	}
+	// yarpc uses the same values as gRPC for its codes.
+	_, ok := t.retryableCodes[codes.Code(yarpcerrors.FromError(err).Code())]
+	return ok
+}
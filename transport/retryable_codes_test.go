@@ -0,0 +1,132 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package transport
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/yarpc/yab/testdata/protobuf/simple"
+	"go.uber.org/atomic"
+	"go.uber.org/yarpc/yarpcerrors"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestParseGRPCCodes(t *testing.T) {
+	tests := []struct {
+		msg     string
+		names   []string
+		want    map[codes.Code]struct{}
+		wantErr string
+	}{
+		{
+			msg: "no names",
+		},
+		{
+			msg:   "valid names",
+			names: []string{"UNAVAILABLE", "aborted", " Resource_Exhausted "},
+			want: map[codes.Code]struct{}{
+				codes.Unavailable:       {},
+				codes.Aborted:           {},
+				codes.ResourceExhausted: {},
+			},
+		},
+		{
+			msg:   "valid and invalid names",
+			names: []string{"UNAVAILABLE", "Unavailble", "ABORTED", "14"},
+			wantErr: `unknown gRPC codes "Unavailble", "14", valid codes are: ` +
+				"ABORTED, ALREADY_EXISTS, CANCELLED, DATA_LOSS, DEADLINE_EXCEEDED, FAILED_PRECONDITION, " +
+				"INTERNAL, INVALID_ARGUMENT, NOT_FOUND, OK, OUT_OF_RANGE, PERMISSION_DENIED, " +
+				"RESOURCE_EXHAUSTED, UNAUTHENTICATED, UNAVAILABLE, UNIMPLEMENTED, UNKNOWN",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.msg, func(t *testing.T) {
+			got, err := parseGRPCCodes(tt.names)
+			if tt.wantErr != "" {
+				assert.EqualError(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+// failingOnceSvc fails the first call to Baz with code.
+type failingOnceSvc struct {
+	simpleSvc
+
+	code  codes.Code
+	calls atomic.Int32
+}
+
+func (s *failingOnceSvc) Baz(ctx context.Context, in *simple.Foo) (*simple.Foo, error) {
+	if s.calls.Inc() == 1 {
+		return nil, status.Error(s.code, "try again")
+	}
+	return in, nil
+}
+
+func TestGRPCRetryableCodes(t *testing.T) {
+	tests := []struct {
+		msg      string
+		code     codes.Code
+		wantCode yarpcerrors.Code
+	}{
+		{
+			msg:  "retryable",
+			code: codes.Aborted,
+		},
+		{
+			msg:      "not retryable",
+			code:     codes.Internal,
+			wantCode: yarpcerrors.CodeInternal,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.msg, func(t *testing.T) {
+			svc := &failingOnceSvc{code: tt.code}
+			client, cleanup := newSimpleGRPCClient(t, svc, GRPCOptions{RetryableCodes: []string{"UNAVAILABLE", "ABORTED"}})
+			defer cleanup()
+
+			_, err := client.Call(context.Background(), &Request{
+				TargetService: "Bar",
+				Method:        "Bar::Baz",
+				Timeout:       time.Second,
+				Body:          []byte{},
+			})
+			if tt.wantCode != yarpcerrors.CodeOK {
+				assert.Equal(t, tt.wantCode, yarpcerrors.FromError(err).Code(), "unexpected error: %v", err)
+				assert.Equal(t, int32(1), svc.calls.Load(), "call should not be retried")
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, int32(2), svc.calls.Load(), "call should be retried once")
+		})
+	}
+}
@@ -0,0 +1,126 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package transport
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+)
+
+var (
+	errRoutingDelegateSplitConflict = errors.New("cannot specify both RoutingDelegate and RoutingDelegateSplit")
+	errRoutingDelegateSplitNoWeight = errors.New("RoutingDelegateSplit must have a positive total weight")
+)
+
+// cumulativeWeights picks indexes in proportion to their weights.
+// cumulativeWeights[i] is the total weight of indexes up to and including i.
+type cumulativeWeights []int
+
+// newCumulativeWeights expects weights to be non-negative.
+func newCumulativeWeights(weights []int) cumulativeWeights {
+	cumulative := make(cumulativeWeights, len(weights))
+	total := 0
+	for i, weight := range weights {
+		total += weight
+		cumulative[i] = total
+	}
+	return cumulative
+}
+
+func (w cumulativeWeights) total() int {
+	if len(w) == 0 {
+		return 0
+	}
+	return w[len(w)-1]
+}
+
+// pick returns the index for n, which must be in [0, total).
+func (w cumulativeWeights) pick(n int) int {
+	return sort.Search(len(w), func(i int) bool {
+		return n < w[i]
+	})
+}
+
+// delegateSplit picks routing delegates in proportion to their weights.
+type delegateSplit struct {
+	delegates []string
+	weights   cumulativeWeights
+}
+
+// newDelegateSplit returns nil if weights is empty.
+func newDelegateSplit(weights map[string]int) (*delegateSplit, error) {
+	if len(weights) == 0 {
+		return nil, nil
+	}
+
+	delegates := make([]string, 0, len(weights))
+	for delegate, weight := range weights {
+		if weight < 0 {
+			return nil, fmt.Errorf("routing delegate %q has negative weight %v", delegate, weight)
+		}
+		delegates = append(delegates, delegate)
+	}
+	sort.Strings(delegates)
+
+	delegateWeights := make([]int, len(delegates))
+	for i, delegate := range delegates {
+		delegateWeights[i] = weights[delegate]
+	}
+	cumulative := newCumulativeWeights(delegateWeights)
+	if cumulative.total() == 0 {
+		return nil, errRoutingDelegateSplitNoWeight
+	}
+	return &delegateSplit{delegates: delegates, weights: cumulative}, nil
+}
+
+// routingDelegate returns the routing delegate for a call, picked from the
+// RoutingDelegateSplit if one is configured.
+func (t *grpcTransport) routingDelegate() string {
+	if t.delegateSplit == nil {
+		return t.RoutingDelegate
+	}
+	return t.delegateSplit.delegates[t.pickWeighted(t.delegateSplit.weights)]
+}
+
+// longestRoutingDelegate returns the longest routing delegate a call may be
+// sent with, without picking one from the RoutingDelegateSplit.
+func (t *grpcTransport) longestRoutingDelegate() string {
+	if t.delegateSplit == nil {
+		return t.RoutingDelegate
+	}
+	var longest string
+	for _, delegate := range t.delegateSplit.delegates {
+		if len(delegate) > len(longest) {
+			longest = delegate
+		}
+	}
+	return longest
+}
+
+// pickWeighted returns an index picked at random in proportion to weights,
+// which must have a positive total.
+func (t *grpcTransport) pickWeighted(weights cumulativeWeights) int {
+	t.randMu.Lock()
+	n := t.rand.Intn(weights.total())
+	t.randMu.Unlock()
+	return weights.pick(n)
+}
@@ -0,0 +1,53 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package transport
+
+import (
+	"context"
+
+	"github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/ext"
+)
+
+// withSampling applies the request's sampling override by setting the
+// sampling priority on the span in ctx, which the call's span is a child
+// of. If ctx has no span, one is started for the call, and the returned
+// function finishes it.
+func withSampling(ctx context.Context, tracer opentracing.Tracer, request *Request) (context.Context, func()) {
+	var priority uint16
+	switch request.Sampling {
+	case SampleAlways:
+		priority = 1
+	case SampleNever:
+		priority = 0
+	default:
+		return ctx, func() {}
+	}
+
+	if span := opentracing.SpanFromContext(ctx); span != nil {
+		ext.SamplingPriority.Set(span, priority)
+		return ctx, func() {}
+	}
+
+	span := tracer.StartSpan(request.Method)
+	ext.SamplingPriority.Set(span, priority)
+	return opentracing.ContextWithSpan(ctx, span), span.Finish
+}
@@ -0,0 +1,130 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package transport
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/ext"
+	"github.com/opentracing/opentracing-go/mocktracer"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGRPCSamplingOverride(t *testing.T) {
+	tests := []struct {
+		msg      string
+		sampling Sampling
+		// parentSampled is the sampling decision of a parent span already
+		// in the context, if set.
+		parentSampled *bool
+		wantSampled   bool
+		wantSpans     int
+	}{
+		{
+			msg:         "default",
+			sampling:    SampleDefault,
+			wantSampled: true,
+			wantSpans:   1,
+		},
+		{
+			msg:           "default keeps parent decision",
+			sampling:      SampleDefault,
+			parentSampled: boolPtr(false),
+			wantSampled:   false,
+			wantSpans:     2,
+		},
+		{
+			msg:         "always without parent",
+			sampling:    SampleAlways,
+			wantSampled: true,
+			wantSpans:   2,
+		},
+		{
+			msg:         "never without parent",
+			sampling:    SampleNever,
+			wantSampled: false,
+			wantSpans:   2,
+		},
+		{
+			msg:           "always with unsampled parent",
+			sampling:      SampleAlways,
+			parentSampled: boolPtr(false),
+			wantSampled:   true,
+			wantSpans:     2,
+		},
+		{
+			msg:           "never with sampled parent",
+			sampling:      SampleNever,
+			parentSampled: boolPtr(true),
+			wantSampled:   false,
+			wantSpans:     2,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.msg, func(t *testing.T) {
+			tracer := mocktracer.New()
+			client, cleanup := newSimpleGRPCClient(t, &simpleSvc{}, GRPCOptions{Tracer: tracer})
+			defer cleanup()
+
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+			defer cancel()
+			var parent opentracing.Span
+			if tt.parentSampled != nil {
+				parent = tracer.StartSpan("parent")
+				if !*tt.parentSampled {
+					ext.SamplingPriority.Set(parent, 0)
+				}
+				ctx = opentracing.ContextWithSpan(ctx, parent)
+			}
+
+			_, err := client.Call(ctx, &Request{
+				TargetService: "Bar",
+				Method:        "Bar::Baz",
+				Body:          []byte{},
+				Sampling:      tt.sampling,
+			})
+			require.NoError(t, err)
+			if parent != nil {
+				parent.Finish()
+			}
+
+			// mocktracer applies the sampling priority tag to the span's
+			// sampled flag, which its children inherit.
+			spans := tracer.FinishedSpans()
+			require.Len(t, spans, tt.wantSpans)
+			call := spans[0]
+			assert.Equal(t, "Bar::Baz", call.OperationName)
+			for _, span := range spans {
+				assert.Equal(t, tt.wantSampled, span.SpanContext.Sampled, "span %q sampled", span.OperationName)
+				assert.Equal(t, call.SpanContext.TraceID, span.SpanContext.TraceID, "spans should be in the same trace")
+			}
+		})
+	}
+}
+
+func boolPtr(b bool) *bool {
+	return &b
+}
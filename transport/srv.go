@@ -0,0 +1,188 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package transport
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// srvLookupTimeout bounds each lookup of GRPCOptions.SRVName.
+const srvLookupTimeout = 5 * time.Second
+
+// SRVResolver looks up DNS SRV records. *net.Resolver implements
+// SRVResolver, and tests can use an in-memory implementation.
+type SRVResolver interface {
+	LookupSRV(ctx context.Context, service, proto, name string) (string, []*net.SRV, error)
+}
+
+// lookupSRVPeers returns the host:port peers of the SRV records for name.
+// Only the records with the lowest priority are used, as the others are
+// only meant to be used when those are unavailable. Peers are ordered by
+// decreasing weight, since round-robin can't weight peers.
+func lookupSRVPeers(r SRVResolver, name string) ([]string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), srvLookupTimeout)
+	defer cancel()
+
+	_, records, err := r.LookupSRV(ctx, "", "", name)
+	if err != nil {
+		return nil, fmt.Errorf("could not resolve SRV name %q: %v", name, err)
+	}
+	if len(records) == 0 {
+		return nil, fmt.Errorf("no SRV records found for %q", name)
+	}
+
+	sorted := append([]*net.SRV(nil), records...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if sorted[i].Priority != sorted[j].Priority {
+			return sorted[i].Priority < sorted[j].Priority
+		}
+		return sorted[i].Weight > sorted[j].Weight
+	})
+
+	var peers []string
+	for _, record := range sorted {
+		if record.Priority != sorted[0].Priority {
+			break
+		}
+		host := strings.TrimSuffix(record.Target, ".")
+		peers = append(peers, net.JoinHostPort(host, strconv.Itoa(int(record.Port))))
+	}
+	return peers, nil
+}
+
+// srvRefresher periodically looks up an SRV name, and updates the peers of
+// a transport to match. Peers that were set in Addresses are left alone.
+// Peers that are dropped from the records are removed with RemovePeer, so
+// the calls in progress to them can finish before they're disconnected.
+type srvRefresher struct {
+	resolver SRVResolver
+	name     string
+	interval time.Duration
+	static   map[string]struct{}
+
+	// current holds the peers added from SRV records.
+	current map[string]struct{}
+
+	stopOnce sync.Once
+	stop     chan struct{}
+	done     chan struct{}
+}
+
+func newSRVRefresher(r SRVResolver, name string, interval time.Duration, static, peers []string) *srvRefresher {
+	s := &srvRefresher{
+		resolver: r,
+		name:     name,
+		interval: interval,
+		static:   make(map[string]struct{}, len(static)),
+		current:  make(map[string]struct{}, len(peers)),
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	for _, addr := range static {
+		s.static[addr] = struct{}{}
+	}
+	for _, addr := range peers {
+		if _, ok := s.static[addr]; !ok {
+			s.current[addr] = struct{}{}
+		}
+	}
+	return s
+}
+
+func (s *srvRefresher) run(t PeerUpdater, logger Logger) {
+	defer close(s.done)
+
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-ticker.C:
+		}
+
+		peers, err := lookupSRVPeers(s.resolver, s.name)
+		if err != nil {
+			logger.Warn("could not refresh SRV peers, keeping the current peers", "name", s.name, "error", err)
+			continue
+		}
+		s.update(t, peers, logger)
+	}
+}
+
+// update adds and removes peers so the SRV peers of t match peers.
+func (s *srvRefresher) update(t PeerUpdater, peers []string, logger Logger) {
+	next := make(map[string]struct{}, len(peers))
+	for _, addr := range peers {
+		if _, ok := s.static[addr]; !ok {
+			next[addr] = struct{}{}
+		}
+	}
+
+	for addr := range next {
+		if _, ok := s.current[addr]; ok {
+			continue
+		}
+		if err := t.AddPeer(addr); err != nil {
+			logger.Warn("could not add SRV peer", "peer", addr, "error", err)
+			delete(next, addr)
+		}
+	}
+	for addr := range s.current {
+		if _, ok := next[addr]; ok {
+			continue
+		}
+		if err := t.RemovePeer(addr); err != nil {
+			logger.Warn("could not remove SRV peer", "peer", addr, "error", err)
+			next[addr] = struct{}{}
+		}
+	}
+	s.current = next
+}
+
+func (s *srvRefresher) close() {
+	s.stopOnce.Do(func() { close(s.stop) })
+	<-s.done
+}
+
+// appendNewAddresses returns addresses with the peers that it doesn't
+// already have appended.
+func appendNewAddresses(addresses, peers []string) []string {
+	seen := make(map[string]struct{}, len(addresses))
+	for _, addr := range addresses {
+		seen[addr] = struct{}{}
+	}
+	result := append([]string(nil), addresses...)
+	for _, addr := range peers {
+		if _, ok := seen[addr]; !ok {
+			seen[addr] = struct{}{}
+			result = append(result, addr)
+		}
+	}
+	return result
+}
@@ -0,0 +1,190 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package transport
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/opentracing/opentracing-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/yarpc/yab/testdata/protobuf/simple"
+	googlegrpc "google.golang.org/grpc"
+)
+
+// fakeSRVResolver returns the records set for each name.
+type fakeSRVResolver struct {
+	mu      sync.Mutex
+	records map[string][]*net.SRV
+}
+
+func (r *fakeSRVResolver) LookupSRV(_ context.Context, service, proto, name string) (string, []*net.SRV, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	records, ok := r.records[name]
+	if !ok {
+		return "", nil, errors.New("no such host")
+	}
+	return name, records, nil
+}
+
+func (r *fakeSRVResolver) set(name string, records ...*net.SRV) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.records[name] = records
+}
+
+// srvRecord returns an SRV record for the address of a local server.
+func srvRecord(t *testing.T, addr string, priority, weight uint16) *net.SRV {
+	host, port, err := net.SplitHostPort(addr)
+	require.NoError(t, err)
+	p, err := strconv.Atoi(port)
+	require.NoError(t, err)
+	return &net.SRV{Target: host + ".", Port: uint16(p), Priority: priority, Weight: weight}
+}
+
+func TestLookupSRVPeers(t *testing.T) {
+	resolver := &fakeSRVResolver{records: map[string][]*net.SRV{
+		"_grpc._tcp.svc": {
+			{Target: "backup.local.", Port: 1000, Priority: 20, Weight: 100},
+			{Target: "light.local.", Port: 1001, Priority: 10, Weight: 10},
+			{Target: "heavy.local.", Port: 1002, Priority: 10, Weight: 90},
+		},
+		"_grpc._tcp.empty": {},
+	}}
+
+	peers, err := lookupSRVPeers(resolver, "_grpc._tcp.svc")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"heavy.local:1002", "light.local:1001"}, peers)
+
+	_, err = lookupSRVPeers(resolver, "_grpc._tcp.missing")
+	assert.EqualError(t, err, `could not resolve SRV name "_grpc._tcp.missing": no such host`)
+
+	_, err = lookupSRVPeers(resolver, "_grpc._tcp.empty")
+	assert.EqualError(t, err, `no SRV records found for "_grpc._tcp.empty"`)
+}
+
+func TestGRPCSRVPeers(t *testing.T) {
+	const name = "_grpc._tcp.bar.local"
+	addresses := startBarServers(t, 2)
+	resolver := &fakeSRVResolver{records: make(map[string][]*net.SRV)}
+	resolver.set(name, srvRecord(t, addresses[0], 10, 0))
+
+	client, err := newGRPC(GRPCOptions{
+		Tracer:                opentracing.NoopTracer{},
+		Caller:                "test",
+		SRVName:               name,
+		SRVResolver:           resolver,
+		SRVRefreshInterval:    10 * time.Millisecond,
+		IncludePeerInResponse: true,
+	})
+	require.NoError(t, err)
+	defer client.Close()
+
+	call := func() string {
+		res, err := client.Call(context.Background(), &Request{
+			TargetService: "Bar",
+			Method:        "Bar::Baz",
+			Timeout:       time.Second,
+			Body:          []byte{},
+		})
+		require.NoError(t, err)
+		return res.PeerAddress
+	}
+	assert.Equal(t, addresses[0], call(), "initial peer from SRV")
+
+	resolver.set(name, srvRecord(t, addresses[1], 10, 0))
+	assert.Eventually(t, func() bool {
+		for i := 0; i < 5; i++ {
+			if call() != addresses[1] {
+				return false
+			}
+		}
+		return true
+	}, 2*time.Second, 10*time.Millisecond, "peers should follow the SRV records")
+}
+
+func TestGRPCSRVPeersDrainRemovedPeer(t *testing.T) {
+	const name = "_grpc._tcp.bar.local"
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	svc := &blockingBazSvc{started: make(chan struct{}, 1), release: make(chan struct{})}
+	server := googlegrpc.NewServer()
+	simple.RegisterBarServer(server, svc)
+	go server.Serve(lis)
+	defer server.Stop()
+
+	next := startBarServers(t, 1)[0]
+	resolver := &fakeSRVResolver{records: make(map[string][]*net.SRV)}
+	resolver.set(name, srvRecord(t, lis.Addr().String(), 10, 0))
+
+	client, err := newGRPC(GRPCOptions{
+		Tracer:                opentracing.NoopTracer{},
+		Caller:                "test",
+		Encoding:              "proto",
+		SRVName:               name,
+		SRVResolver:           resolver,
+		SRVRefreshInterval:    10 * time.Millisecond,
+		IncludePeerInResponse: true,
+	})
+	require.NoError(t, err)
+	defer client.Close()
+
+	call := func(timeout time.Duration) (*Response, error) {
+		return client.Call(context.Background(), &Request{
+			TargetService: "Bar",
+			Method:        "Bar::Baz",
+			Timeout:       timeout,
+			Body:          []byte{0x08, 1},
+		})
+	}
+	errs := make(chan error, 1)
+	go func() {
+		_, err := call(5 * time.Second)
+		errs <- err
+	}()
+	<-svc.started
+
+	resolver.set(name, srvRecord(t, next, 10, 0))
+	assert.Eventually(t, func() bool {
+		res, err := call(100 * time.Millisecond)
+		return err == nil && res.PeerAddress == next
+	}, 2*time.Second, 10*time.Millisecond, "calls should move to the new SRV peer")
+
+	close(svc.release)
+	assert.NoError(t, <-errs, "call in progress on the removed SRV peer should finish")
+}
+
+func TestNewGRPCSRVError(t *testing.T) {
+	_, err := newGRPC(GRPCOptions{
+		Tracer:      opentracing.NoopTracer{},
+		Caller:      "test",
+		SRVName:     "_grpc._tcp.missing",
+		SRVResolver: &fakeSRVResolver{},
+	})
+	assert.EqualError(t, err, `could not resolve SRV name "_grpc._tcp.missing": no such host`)
+}
@@ -0,0 +1,234 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package transport
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/atomic"
+)
+
+type labelsKey struct{}
+
+// WithLabels returns a context whose calls are counted separately in the
+// transport's Stats under the given labels, such as {"scenario": "warmup"}.
+// Labels are added to any already set on ctx, replacing those with the same
+// name.
+func WithLabels(ctx context.Context, labels map[string]string) context.Context {
+	merged := make(map[string]string, len(labels))
+	for k, v := range labelsFromContext(ctx) {
+		merged[k] = v
+	}
+	for k, v := range labels {
+		merged[k] = v
+	}
+	return context.WithValue(ctx, labelsKey{}, merged)
+}
+
+func labelsFromContext(ctx context.Context) map[string]string {
+	labels, _ := ctx.Value(labelsKey{}).(map[string]string)
+	return labels
+}
+
+// CallStats counts the calls made with a set of labels.
+type CallStats struct {
+	Labels map[string]string
+	Calls  int64
+	Errors int64
+
+	// RequestBytes and ResponseBytes are the total sizes of the request and
+	// response bodies of the calls.
+	RequestBytes  int64
+	ResponseBytes int64
+
+	// Latency is a histogram of how long the calls took.
+	Latency LatencyHistogram
+}
+
+// LatencyHistogram counts calls into buckets by latency.
+type LatencyHistogram struct {
+	// Bounds are the inclusive upper bounds of the buckets, in increasing
+	// order.
+	Bounds []time.Duration
+
+	// Counts holds the number of calls in each bucket. It has one more
+	// entry than Bounds, for calls slower than the last bound.
+	Counts []int64
+
+	// Sum is the total latency of all calls.
+	Sum time.Duration
+}
+
+// latencyBounds are the bucket bounds of the latency histograms.
+var latencyBounds = []time.Duration{
+	time.Millisecond,
+	2500 * time.Microsecond,
+	5 * time.Millisecond,
+	10 * time.Millisecond,
+	25 * time.Millisecond,
+	50 * time.Millisecond,
+	100 * time.Millisecond,
+	250 * time.Millisecond,
+	500 * time.Millisecond,
+	time.Second,
+	2500 * time.Millisecond,
+	5 * time.Second,
+	10 * time.Second,
+}
+
+// callResult is what's recorded about each call.
+type callResult struct {
+	requestBytes  int
+	responseBytes int
+	latency       time.Duration
+	err           error
+}
+
+// callStats keeps counters for each distinct set of labels.
+type callStats struct {
+	mu       sync.RWMutex
+	counters map[string]*labelCounters
+
+	// latencies holds the latency of every call, regardless of labels.
+	latencies *hdrLatencies
+}
+
+type labelCounters struct {
+	labels map[string]string
+	calls  atomic.Int64
+	errors atomic.Int64
+
+	requestBytes  atomic.Int64
+	responseBytes atomic.Int64
+	latencyCounts []atomic.Int64
+	latencySum    atomic.Int64
+}
+
+func newCallStats() *callStats {
+	return &callStats{
+		counters:  make(map[string]*labelCounters),
+		latencies: newHDRLatencies(),
+	}
+}
+
+func (s *callStats) record(labels map[string]string, result callResult) {
+	c := s.countersFor(labels)
+	c.calls.Inc()
+	if result.err != nil {
+		c.errors.Inc()
+	}
+	c.requestBytes.Add(int64(result.requestBytes))
+	c.responseBytes.Add(int64(result.responseBytes))
+
+	bucket := sort.Search(len(latencyBounds), func(i int) bool {
+		return result.latency <= latencyBounds[i]
+	})
+	c.latencyCounts[bucket].Inc()
+	c.latencySum.Add(int64(result.latency))
+	s.latencies.record(result.latency)
+}
+
+func (s *callStats) countersFor(labels map[string]string) *labelCounters {
+	key := labelSetKey(labels)
+
+	s.mu.RLock()
+	c, ok := s.counters[key]
+	s.mu.RUnlock()
+	if ok {
+		return c
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if c, ok := s.counters[key]; ok {
+		return c
+	}
+	c = &labelCounters{
+		labels:        labels,
+		latencyCounts: make([]atomic.Int64, len(latencyBounds)+1),
+	}
+	s.counters[key] = c
+	return c
+}
+
+// stats returns the counters for each label set, ordered by labels.
+func (s *callStats) stats() []CallStats {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	keys := make([]string, 0, len(s.counters))
+	for k := range s.counters {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	result := make([]CallStats, 0, len(keys))
+	for _, k := range keys {
+		c := s.counters[k]
+		labels := make(map[string]string, len(c.labels))
+		for name, v := range c.labels {
+			labels[name] = v
+		}
+		counts := make([]int64, len(c.latencyCounts))
+		for i := range c.latencyCounts {
+			counts[i] = c.latencyCounts[i].Load()
+		}
+		result = append(result, CallStats{
+			Labels:        labels,
+			Calls:         c.calls.Load(),
+			Errors:        c.errors.Load(),
+			RequestBytes:  c.requestBytes.Load(),
+			ResponseBytes: c.responseBytes.Load(),
+			Latency: LatencyHistogram{
+				Bounds: append([]time.Duration(nil), latencyBounds...),
+				Counts: counts,
+				Sum:    time.Duration(c.latencySum.Load()),
+			},
+		})
+	}
+	return result
+}
+
+// labelSetKey returns a string that is the same for equal sets of labels.
+func labelSetKey(labels map[string]string) string {
+	if len(labels) == 0 {
+		return ""
+	}
+
+	names := make([]string, 0, len(labels))
+	for k := range labels {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+
+	var sb strings.Builder
+	for _, k := range names {
+		sb.WriteString(k)
+		sb.WriteByte(0)
+		sb.WriteString(labels[k])
+		sb.WriteByte(0)
+	}
+	return sb.String()
+}
@@ -0,0 +1,106 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package transport
+
+import (
+	"io"
+	"sync"
+	"time"
+
+	"github.com/HdrHistogram/hdrhistogram-go"
+)
+
+const (
+	// hdrLowestLatency and hdrHighestLatency are the range of latencies, in
+	// nanoseconds, that the HDR histogram tracks. Slower calls are recorded
+	// as taking hdrHighestLatency.
+	hdrLowestLatency      = int64(time.Microsecond)
+	hdrHighestLatency     = int64(time.Hour)
+	hdrSignificantFigures = 3
+)
+
+// hdrLatencies records every call's latency in an HDR histogram, which keeps
+// much finer detail than the latency buckets in Stats.
+type hdrLatencies struct {
+	mu    sync.Mutex
+	start time.Time
+	hist  *hdrhistogram.Histogram
+}
+
+func newHDRLatencies() *hdrLatencies {
+	return &hdrLatencies{
+		start: time.Now(),
+		hist:  newHDRHistogram(),
+	}
+}
+
+func (h *hdrLatencies) record(latency time.Duration) {
+	h.mu.Lock()
+	recordHDRLatency(h.hist, latency)
+	h.mu.Unlock()
+}
+
+// newHDRHistogram returns an empty histogram covering the latencies that
+// recordHDRLatency records.
+func newHDRHistogram() *hdrhistogram.Histogram {
+	return hdrhistogram.New(hdrLowestLatency, hdrHighestLatency, hdrSignificantFigures)
+}
+
+// recordHDRLatency records latency in hist, clamped to hdrHighestLatency.
+func recordHDRLatency(hist *hdrhistogram.Histogram, latency time.Duration) {
+	v := int64(latency)
+	if v > hdrHighestLatency {
+		v = hdrHighestLatency
+	}
+	// The value is within the histogram's range, so this can't fail.
+	_ = hist.RecordValue(v)
+}
+
+// snapshot returns a copy of the histogram, stamped with the time it covers.
+func (h *hdrLatencies) snapshot() *hdrhistogram.Histogram {
+	h.mu.Lock()
+	hist := hdrhistogram.Import(h.hist.Export())
+	h.mu.Unlock()
+
+	hist.SetStartTimeMs(h.start.UnixNano() / int64(time.Millisecond))
+	hist.SetEndTimeMs(time.Now().UnixNano() / int64(time.Millisecond))
+	return hist
+}
+
+// ExportLatencyHistogram writes the latencies of all calls made so far to w
+// as an HDR histogram log, with a single interval covering the lifetime of
+// the transport. Latencies are recorded in nanoseconds. The log can be read
+// by HdrHistogram tools, and merged with the logs of other runs.
+func (t *grpcTransport) ExportLatencyHistogram(w io.Writer) error {
+	hist := t.stats.latencies.snapshot()
+
+	lw := hdrhistogram.NewHistogramLogWriter(w)
+	if err := lw.OutputLogFormatVersion(); err != nil {
+		return err
+	}
+	if err := lw.OutputStartTime(hist.StartTimeMs()); err != nil {
+		return err
+	}
+	if err := lw.OutputLegend(); err != nil {
+		return err
+	}
+	return lw.OutputIntervalHistogram(hist)
+}
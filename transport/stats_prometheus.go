@@ -0,0 +1,118 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package transport
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ExportPrometheus writes the transport's Stats to w in the Prometheus text
+// exposition format, with the labels of each set of calls as metric labels.
+func (t *grpcTransport) ExportPrometheus(w io.Writer) error {
+	return writePrometheus(w, t.Stats())
+}
+
+func writePrometheus(w io.Writer, stats []CallStats) error {
+	bw := bufio.NewWriter(w)
+
+	counters := []struct {
+		name  string
+		help  string
+		value func(CallStats) int64
+	}{
+		{"yab_calls_total", "Number of calls made.", func(s CallStats) int64 { return s.Calls }},
+		{"yab_call_errors_total", "Number of calls that failed.", func(s CallStats) int64 { return s.Errors }},
+		{"yab_request_bytes_total", "Total size of request bodies.", func(s CallStats) int64 { return s.RequestBytes }},
+		{"yab_response_bytes_total", "Total size of response bodies.", func(s CallStats) int64 { return s.ResponseBytes }},
+	}
+	for _, c := range counters {
+		fmt.Fprintf(bw, "# HELP %v %v\n# TYPE %v counter\n", c.name, c.help, c.name)
+		for _, s := range stats {
+			fmt.Fprintf(bw, "%v%v %v\n", c.name, prometheusLabels(s.Labels, ""), c.value(s))
+		}
+	}
+
+	const latency = "yab_call_latency_seconds"
+	fmt.Fprintf(bw, "# HELP %v Latency of calls.\n# TYPE %v histogram\n", latency, latency)
+	for _, s := range stats {
+		var cumulative int64
+		for i, count := range s.Latency.Counts {
+			cumulative += count
+			le := "+Inf"
+			if i < len(s.Latency.Bounds) {
+				le = strconv.FormatFloat(s.Latency.Bounds[i].Seconds(), 'g', -1, 64)
+			}
+			fmt.Fprintf(bw, "%v_bucket%v %v\n", latency, prometheusLabels(s.Labels, le), cumulative)
+		}
+		labels := prometheusLabels(s.Labels, "")
+		fmt.Fprintf(bw, "%v_sum%v %v\n", latency, labels, strconv.FormatFloat(s.Latency.Sum.Seconds(), 'g', -1, 64))
+		fmt.Fprintf(bw, "%v_count%v %v\n", latency, labels, cumulative)
+	}
+
+	return bw.Flush()
+}
+
+// prometheusLabelValueEscaper escapes the characters that must be escaped in
+// Prometheus label values.
+var prometheusLabelValueEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// prometheusLabels formats labels as a Prometheus label set, adding an "le"
+// label for histogram buckets if le is set. Characters that aren't allowed
+// in label names are replaced with underscores.
+func prometheusLabels(labels map[string]string, le string) string {
+	if len(labels) == 0 && le == "" {
+		return ""
+	}
+
+	names := make([]string, 0, len(labels))
+	for k := range labels {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+
+	pairs := make([]string, 0, len(names)+1)
+	for _, k := range names {
+		pairs = append(pairs, prometheusLabelName(k)+`="`+prometheusLabelValueEscaper.Replace(labels[k])+`"`)
+	}
+	if le != "" {
+		pairs = append(pairs, `le="`+le+`"`)
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+func prometheusLabelName(name string) string {
+	sanitized := []byte(name)
+	for i, c := range sanitized {
+		isLetter := c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+		if !isLetter && (i == 0 || c < '0' || c > '9') {
+			sanitized[i] = '_'
+		}
+	}
+	if len(sanitized) == 0 {
+		return "_"
+	}
+	return string(sanitized)
+}
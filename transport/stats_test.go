@@ -0,0 +1,205 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package transport
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/HdrHistogram/hdrhistogram-go"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/yarpc/api/transport"
+)
+
+func TestGRPCStatsLabels(t *testing.T) {
+	succeedUnlessEmpty := func(ctx context.Context, request *testBarRequest) (*testBarResponse, error) {
+		if request.One == "" {
+			return nil, errors.New("empty request")
+		}
+		return &testBarResponse{One: request.One}, nil
+	}
+
+	doWithGRPCTestEnvOptions(t, 1, []transport.Procedure{
+		newTestJSONProcedure("example", "Foo::Bar", succeedUnlessEmpty),
+	}, GRPCOptions{Caller: "example-caller"}, func(t *testing.T, grpcTestEnv *grpcTestEnv) {
+		call := func(ctx context.Context, one string) {
+			request, err := newTestJSONRequest("example", "Foo::Bar", &testBarRequest{One: one})
+			require.NoError(t, err)
+			grpcTestEnv.Transport.Call(ctx, request)
+		}
+
+		warmup := WithLabels(context.Background(), map[string]string{"scenario": "warmup"})
+		measure := WithLabels(context.Background(), map[string]string{"scenario": "measure"})
+		measureRegion := WithLabels(measure, map[string]string{"region": "west"})
+
+		call(warmup, "hello")
+		call(warmup, "")
+		for i := 0; i < 3; i++ {
+			call(measure, "hello")
+		}
+		call(measureRegion, "hello")
+		call(context.Background(), "hello")
+
+		stats := grpcTestEnv.Transport.(StatsReporter).Stats()
+		counts := make([]CallStats, len(stats))
+		for i, s := range stats {
+			counts[i] = CallStats{Labels: s.Labels, Calls: s.Calls, Errors: s.Errors}
+
+			assert.Positive(t, s.RequestBytes, "request bytes for %v", s.Labels)
+			var latencyCalls int64
+			for _, c := range s.Latency.Counts {
+				latencyCalls += c
+			}
+			assert.Equal(t, s.Calls, latencyCalls, "latency histogram for %v should count every call", s.Labels)
+			assert.Positive(t, s.Latency.Sum, "latency sum for %v", s.Labels)
+		}
+		assert.Equal(t, []CallStats{
+			{Labels: map[string]string{}, Calls: 1},
+			{Labels: map[string]string{"region": "west", "scenario": "measure"}, Calls: 1},
+			{Labels: map[string]string{"scenario": "measure"}, Calls: 3},
+			{Labels: map[string]string{"scenario": "warmup"}, Calls: 2, Errors: 1},
+		}, counts)
+		assert.Equal(t, stats[2].ResponseBytes, 3*stats[1].ResponseBytes, "each successful call has the same response")
+	})
+}
+
+func TestWithLabelsOverrides(t *testing.T) {
+	ctx := WithLabels(context.Background(), map[string]string{"scenario": "warmup", "region": "west"})
+	labels := map[string]string{"scenario": "measure"}
+	ctx = WithLabels(ctx, labels)
+	labels["scenario"] = "changed"
+
+	assert.Equal(t, map[string]string{"scenario": "measure", "region": "west"}, labelsFromContext(ctx))
+}
+
+func TestExportPrometheus(t *testing.T) {
+	counts := make([]int64, len(latencyBounds)+1)
+	counts[0] = 2
+	counts[3] = 1
+	counts[len(latencyBounds)] = 1
+	stats := []CallStats{
+		{
+			Labels:        map[string]string{},
+			Calls:         1,
+			RequestBytes:  10,
+			ResponseBytes: 20,
+			Latency: LatencyHistogram{
+				Bounds: latencyBounds,
+				Counts: make([]int64, len(latencyBounds)+1),
+			},
+		},
+		{
+			Labels:        map[string]string{"scenario": `say "hi"` + "\n", "step-1": "a\\b"},
+			Calls:         4,
+			Errors:        1,
+			RequestBytes:  40,
+			ResponseBytes: 80,
+			Latency: LatencyHistogram{
+				Bounds: latencyBounds,
+				Counts: counts,
+				Sum:    12 * time.Second,
+			},
+		},
+	}
+
+	var buf bytes.Buffer
+	require.NoError(t, writePrometheus(&buf, stats))
+
+	var parser expfmt.TextParser
+	families, err := parser.TextToMetricFamilies(&buf)
+	require.NoError(t, err, "output should be valid Prometheus text format")
+
+	assertCounter := func(name string, want ...float64) {
+		family, ok := families[name]
+		require.True(t, ok, "missing metric %v", name)
+		assert.Equal(t, dto.MetricType_COUNTER, family.GetType())
+		require.Len(t, family.Metric, len(want))
+		for i, m := range family.Metric {
+			assert.Equal(t, want[i], m.GetCounter().GetValue(), "%v[%v]", name, i)
+		}
+	}
+	assertCounter("yab_calls_total", 1, 4)
+	assertCounter("yab_call_errors_total", 0, 1)
+	assertCounter("yab_request_bytes_total", 10, 40)
+	assertCounter("yab_response_bytes_total", 20, 80)
+
+	latency, ok := families["yab_call_latency_seconds"]
+	require.True(t, ok, "missing latency histogram")
+	assert.Equal(t, dto.MetricType_HISTOGRAM, latency.GetType())
+	require.Len(t, latency.Metric, 2)
+
+	labeled := latency.Metric[1]
+	labels := make(map[string]string)
+	for _, l := range labeled.Label {
+		labels[l.GetName()] = l.GetValue()
+	}
+	assert.Equal(t, map[string]string{"scenario": `say "hi"` + "\n", "step_1": "a\\b"}, labels)
+
+	histogram := labeled.GetHistogram()
+	assert.EqualValues(t, 4, histogram.GetSampleCount())
+	assert.Equal(t, 12.0, histogram.GetSampleSum())
+	require.Len(t, histogram.Bucket, len(latencyBounds)+1, "buckets should include +Inf")
+	assert.Equal(t, 0.001, histogram.Bucket[0].GetUpperBound())
+	assert.EqualValues(t, 2, histogram.Bucket[0].GetCumulativeCount())
+	assert.EqualValues(t, 3, histogram.Bucket[3].GetCumulativeCount())
+	assert.EqualValues(t, 3, histogram.Bucket[len(latencyBounds)-1].GetCumulativeCount())
+	assert.EqualValues(t, 4, histogram.Bucket[len(latencyBounds)].GetCumulativeCount())
+}
+
+func TestExportLatencyHistogram(t *testing.T) {
+	echo := func(ctx context.Context, request *testBarRequest) (*testBarResponse, error) {
+		return &testBarResponse{One: request.One}, nil
+	}
+
+	doWithGRPCTestEnvOptions(t, 1, []transport.Procedure{
+		newTestJSONProcedure("example", "Foo::Bar", echo),
+	}, GRPCOptions{Caller: "example-caller"}, func(t *testing.T, grpcTestEnv *grpcTestEnv) {
+		const calls = 5
+		for i := 0; i < calls; i++ {
+			request, err := newTestJSONRequest("example", "Foo::Bar", &testBarRequest{One: "hello"})
+			require.NoError(t, err)
+			_, err = grpcTestEnv.Transport.Call(WithLabels(context.Background(), map[string]string{"i": fmt.Sprint(i % 2)}), request)
+			require.NoError(t, err)
+		}
+
+		var buf bytes.Buffer
+		require.NoError(t, grpcTestEnv.Transport.(LatencyHistogramExporter).ExportLatencyHistogram(&buf))
+		assert.Contains(t, buf.String(), "#[Histogram log format version 1.3]")
+
+		reader := hdrhistogram.NewHistogramLogReader(&buf)
+		hist, err := reader.NextIntervalHistogram()
+		require.NoError(t, err)
+		require.NotNil(t, hist, "log should contain a histogram")
+		assert.Equal(t, int64(calls), hist.TotalCount(), "histogram should count calls with every label")
+		assert.Positive(t, hist.Max())
+
+		hist, err = reader.NextIntervalHistogram()
+		require.NoError(t, err)
+		assert.Nil(t, hist, "log should contain a single histogram")
+	})
+}
@@ -0,0 +1,493 @@
+// Copyright (c) 2021 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package transport
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sync"
+	"time"
+
+	"go.uber.org/multierr"
+	"go.uber.org/yarpc/api/transport"
+	"go.uber.org/yarpc/yarpcerrors"
+)
+
+// StreamSendProgress describes how much has been sent on a stream so far.
+type StreamSendProgress struct {
+	Messages int
+	Bytes    int64
+	Elapsed  time.Duration
+}
+
+// BytesPerSecond returns the average send rate since sending started.
+func (p StreamSendProgress) BytesPerSecond() float64 {
+	if p.Elapsed <= 0 {
+		return 0
+	}
+	return float64(p.Bytes) / p.Elapsed.Seconds()
+}
+
+// streamCancelKey is the context key for the function that cancels a stream
+// opened by grpcTransport.CallStream.
+type streamCancelKey struct{}
+
+// finishingStream calls onFinish once the stream ends, which is when a
+// receive fails (including with io.EOF), closing it fails, or its context is
+// done. Closing the stream only closes the send side, so the server may
+// still be sending, and the stream isn't finished until it's done.
+type finishingStream struct {
+	*transport.ClientStream
+
+	once     sync.Once
+	done     chan struct{}
+	onFinish func()
+}
+
+func newFinishingStream(stream *transport.ClientStream, onFinish func()) (*transport.ClientStream, error) {
+	finishing := &finishingStream{
+		ClientStream: stream,
+		done:         make(chan struct{}),
+		onFinish:     onFinish,
+	}
+	go func() {
+		select {
+		case <-stream.Context().Done():
+			finishing.finish()
+		case <-finishing.done:
+		}
+	}()
+	return transport.NewClientStream(finishing)
+}
+
+func (s *finishingStream) finish() {
+	s.once.Do(func() {
+		close(s.done)
+		s.onFinish()
+	})
+}
+
+func (s *finishingStream) ReceiveMessage(ctx context.Context) (*transport.StreamMessage, error) {
+	msg, err := s.ClientStream.ReceiveMessage(ctx)
+	if err != nil {
+		s.finish()
+	}
+	return msg, err
+}
+
+func (s *finishingStream) Close(ctx context.Context) error {
+	err := s.ClientStream.Close(ctx)
+	if err != nil {
+		s.finish()
+	}
+	return err
+}
+
+// SendStreamOptions are options for SendStreamWithOptions.
+type SendStreamOptions struct {
+	// OnSend, if set, is called after every message with the progress so
+	// far, which reflects the rate at which the server accepts data.
+	OnSend func(StreamSendProgress)
+
+	// SendTimeout, if set, bounds how long each message can take to send,
+	// so a server that stops reading doesn't hang the stream. A send that
+	// takes longer cancels the stream and fails with DEADLINE_EXCEEDED.
+	SendTimeout time.Duration
+}
+
+// SendStream sends the messages returned by next until it returns io.EOF.
+// Messages are sent one at a time from the calling goroutine and each send
+// blocks while the stream's flow-control window is full, so a server that
+// stops reading blocks the producer instead of messages being buffered
+// locally. If onSend is non-nil, it is called after every message with the
+// progress so far, which reflects the rate at which the server accepts data.
+//
+// SendStream does not close the send direction of the stream.
+func SendStream(ctx context.Context, stream *transport.ClientStream, next func() ([]byte, error), onSend func(StreamSendProgress)) error {
+	return SendStreamWithOptions(ctx, stream, next, SendStreamOptions{OnSend: onSend})
+}
+
+// SendStreamWithOptions is SendStream with options to bound each send.
+func SendStreamWithOptions(ctx context.Context, stream *transport.ClientStream, next func() ([]byte, error), opts SendStreamOptions) error {
+	var progress StreamSendProgress
+	start := time.Now()
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		body, err := next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		if err := sendWithTimeout(ctx, stream, body, opts.SendTimeout); err != nil {
+			return err
+		}
+
+		progress.Messages++
+		progress.Bytes += int64(len(body))
+		progress.Elapsed = time.Since(start)
+		if opts.OnSend != nil {
+			opts.OnSend(progress)
+		}
+	}
+}
+
+// Bidi opens a bidirectional stream using t and sends the messages returned
+// by produce until it returns io.EOF, while concurrently passing each
+// received message to consume. Once all messages are sent, the send
+// direction is closed and Bidi waits for the server to finish the stream.
+//
+// A failure on either side cancels the stream, unblocking the other side.
+// The returned error combines the send error, the receive error and the
+// final status of the stream, leaving out errors caused only by that
+// cancellation.
+func Bidi(ctx context.Context, t StreamTransport, request *StreamRequest, produce func() ([]byte, error), consume func([]byte) error) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	stream, err := t.CallStream(ctx, request)
+	if err != nil {
+		return err
+	}
+
+	var (
+		wg      sync.WaitGroup
+		sendErr error
+	)
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		if sendErr = SendStream(ctx, stream, produce, nil); sendErr == nil {
+			sendErr = stream.Close(ctx)
+		}
+		// io.EOF means the server ended the stream, and its status will be
+		// reported by the receive side.
+		if sendErr == io.EOF {
+			sendErr = nil
+		}
+		if sendErr != nil {
+			cancel()
+		}
+	}()
+
+	recvErr := receiveAll(ctx, stream, consume)
+	if recvErr != nil {
+		cancel()
+	}
+	wg.Wait()
+
+	// Only report cancellations that didn't come from the other side failing.
+	if sendErr != nil && recvErr != nil {
+		if isCancellation(sendErr) {
+			sendErr = nil
+		} else if isCancellation(recvErr) {
+			recvErr = nil
+		}
+	}
+	if sendErr != nil {
+		sendErr = fmt.Errorf("failed while sending stream request: %w", sendErr)
+	}
+	return multierr.Combine(sendErr, recvErr)
+}
+
+func receiveAll(ctx context.Context, stream *transport.ClientStream, consume func([]byte) error) error {
+	return ReceiveStream(ctx, stream, func(r io.Reader) error {
+		body, err := ioutil.ReadAll(r)
+		if err != nil {
+			return fmt.Errorf("failed while reading stream response: %w", err)
+		}
+		return consume(body)
+	})
+}
+
+// ReceiveStream passes a reader for the body of each message received on
+// stream to consume, until the server ends the stream. This lets large
+// messages be processed incrementally rather than buffered by the caller.
+//
+// The reader is only valid until consume returns. Any part of the message
+// that consume did not read is then drained and the body closed before the
+// next message is received.
+func ReceiveStream(ctx context.Context, stream *transport.ClientStream, consume func(io.Reader) error) error {
+	for {
+		recvCtx, cancel := withStreamDeadline(ctx, stream)
+		msg, err := stream.ReceiveMessage(recvCtx)
+		cancel()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed while receiving stream response: %w", err)
+		}
+
+		err = consume(msg.Body)
+		_, drainErr := io.Copy(ioutil.Discard, msg.Body)
+		msg.Body.Close()
+		if err != nil {
+			return err
+		}
+		if drainErr != nil {
+			return fmt.Errorf("failed while reading stream response: %w", drainErr)
+		}
+	}
+}
+
+// sendWithTimeout sends body on stream. If timeout is positive and the send
+// takes longer, the stream is cancelled, which unblocks the send, and a
+// DEADLINE_EXCEEDED error is returned.
+func sendWithTimeout(ctx context.Context, stream *transport.ClientStream, body []byte, timeout time.Duration) error {
+	sendCtx, cancel := withStreamDeadline(ctx, stream)
+	defer cancel()
+	send := func() error {
+		return stream.SendMessage(sendCtx, &transport.StreamMessage{
+			Body: ioutil.NopCloser(bytes.NewReader(body)),
+		})
+	}
+	if timeout <= 0 {
+		return send()
+	}
+
+	done := make(chan error, 1)
+	go func() { done <- send() }()
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case err := <-done:
+		return err
+	case <-timer.C:
+	}
+
+	// Sends don't observe their context, so the only way to stop a blocked
+	// send is to cancel the stream. Streams from other transports can't be
+	// cancelled, and their send is left to finish in the background.
+	if cancelStream, ok := stream.Context().Value(streamCancelKey{}).(context.CancelFunc); ok {
+		cancelStream()
+		<-done
+	}
+	return yarpcerrors.DeadlineExceededErrorf("stream send did not complete within %v", timeout)
+}
+
+// RemainingDeadline returns the time left before the deadline that stream
+// was opened with, or false if it was opened without a deadline.
+func RemainingDeadline(stream *transport.ClientStream) (time.Duration, bool) {
+	deadline, ok := stream.Context().Deadline()
+	if !ok {
+		return 0, false
+	}
+	return time.Until(deadline), true
+}
+
+// withStreamDeadline bounds ctx by the deadline that stream was opened with,
+// so each send or receive only waits for the time remaining on the stream
+// even if ctx has a later deadline, or none.
+func withStreamDeadline(ctx context.Context, stream *transport.ClientStream) (context.Context, context.CancelFunc) {
+	deadline, ok := stream.Context().Deadline()
+	if !ok {
+		return ctx, func() {}
+	}
+	return context.WithDeadline(ctx, deadline)
+}
+
+// SendJSONLines reads newline-delimited JSON request messages from r, such as
+// stdin, and sends each one on stream after converting it with marshal,
+// until r is exhausted. It then closes the send direction and returns the
+// server's response, as with CloseSendAndReceive.
+//
+// Each message is sent as soon as its line is complete, so input can be
+// piped in interactively. Blank lines are skipped, and the last line doesn't
+// need a trailing newline. If a line can't be marshaled, nothing more is sent
+// and the error includes the line number.
+func SendJSONLines(ctx context.Context, stream *transport.ClientStream, r io.Reader, marshal func(json []byte) ([]byte, error)) (*Response, error) {
+	reader := bufio.NewReader(r)
+	var line int
+	next := func() ([]byte, error) {
+		for {
+			text, err := reader.ReadBytes('\n')
+			if err != nil && (err != io.EOF || len(text) == 0) {
+				return nil, err
+			}
+			line++
+			text = bytes.TrimSpace(text)
+			if len(text) == 0 {
+				continue
+			}
+
+			body, err := marshal(text)
+			if err != nil {
+				return nil, fmt.Errorf("could not marshal request on line %v: %v", line, err)
+			}
+			return body, nil
+		}
+	}
+	if err := SendStream(ctx, stream, next, nil); err != nil {
+		return nil, err
+	}
+	return CloseSendAndReceive(ctx, stream)
+}
+
+// CollectServerStream makes a server-streaming call using t, sending body as
+// the single request message, and returns the body of every response in the
+// order they were received. The error is the final status of the stream, in
+// which case the responses received before it are still returned.
+//
+// If maxBytes is positive, the call fails once the responses add up to more
+// than maxBytes, bounding how much is held in memory.
+func CollectServerStream(ctx context.Context, t StreamTransport, request *StreamRequest, body []byte, maxBytes int) ([][]byte, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	stream, err := t.CallStream(ctx, request)
+	if err != nil {
+		return nil, err
+	}
+
+	// io.EOF means the server ended the stream early, and its status will
+	// be reported when receiving.
+	err = stream.SendMessage(ctx, &transport.StreamMessage{
+		Body: ioutil.NopCloser(bytes.NewReader(body)),
+	})
+	if err == nil {
+		err = stream.Close(ctx)
+	}
+	if err != nil && err != io.EOF {
+		return nil, fmt.Errorf("failed while sending stream request: %w", err)
+	}
+
+	var (
+		responses [][]byte
+		total     int
+	)
+	err = ReceiveStream(ctx, stream, func(r io.Reader) error {
+		if maxBytes > 0 {
+			// Read one byte past the limit to tell when it's exceeded.
+			r = io.LimitReader(r, int64(maxBytes-total)+1)
+		}
+		body, err := ioutil.ReadAll(r)
+		if err != nil {
+			return fmt.Errorf("failed while reading stream response: %w", err)
+		}
+		total += len(body)
+		if maxBytes > 0 && total > maxBytes {
+			return fmt.Errorf("stream responses exceed the maximum of %v bytes", maxBytes)
+		}
+		responses = append(responses, body)
+		return nil
+	})
+	return responses, err
+}
+
+// CallError is returned when a stream call or a gRPC-Web call fails, and
+// holds the status code the call failed with.
+type CallError struct {
+	Code yarpcerrors.Code
+	Err  error
+}
+
+func (e *CallError) Error() string {
+	return fmt.Sprintf("call failed with code %v: %v", e.Code, e.Err)
+}
+
+// Unwrap returns the underlying error.
+func (e *CallError) Unwrap() error {
+	return e.Err
+}
+
+var errStreamNoResponse = errors.New("server ended the stream without a response")
+
+// CloseSendAndReceive closes the send direction of stream and reads the
+// single response sent by the server, as used by client-streaming RPCs.
+// Any failure, including the server not sending exactly one response, is
+// returned as a *CallError.
+func CloseSendAndReceive(ctx context.Context, stream *transport.ClientStream) (*Response, error) {
+	if err := stream.Close(ctx); err != nil && err != io.EOF {
+		return nil, newCallError(err)
+	}
+
+	msg, err := stream.ReceiveMessage(ctx)
+	if err == io.EOF {
+		return nil, newCallError(errStreamNoResponse)
+	}
+	if err != nil {
+		return nil, newCallError(err)
+	}
+	body, err := ioutil.ReadAll(msg.Body)
+	msg.Body.Close()
+	if err != nil {
+		return nil, newCallError(fmt.Errorf("failed while reading stream response: %w", err))
+	}
+
+	// The stream must end after the response for the call to have succeeded.
+	if extra, err := stream.ReceiveMessage(ctx); err != io.EOF {
+		if err == nil {
+			extra.Body.Close()
+			err = errors.New("server sent more than one response")
+		}
+		return nil, newCallError(err)
+	}
+
+	response := &Response{Body: body}
+	// Not every stream supports reading headers, in which case the response
+	// is returned without them.
+	if headers, err := stream.Headers(); err == nil {
+		response.Headers = headers.Items()
+	}
+	return response, nil
+}
+
+// ErrClientTrailersUnsupported is returned by CloseSendWithTrailers when given
+// trailers, since gRPC client streams can only send metadata when opened.
+var ErrClientTrailersUnsupported = errors.New("client streams cannot send trailing metadata")
+
+// CloseSendWithTrailers closes the send direction of stream, sending trailers
+// as trailing metadata. yarpc's gRPC client streams have no way to send
+// metadata after they're opened, so if there are any trailers, it returns
+// ErrClientTrailersUnsupported without closing the stream, and the metadata
+// should be sent as request headers when opening the stream instead.
+func CloseSendWithTrailers(ctx context.Context, stream *transport.ClientStream, trailers map[string]string) error {
+	if len(trailers) > 0 {
+		return ErrClientTrailersUnsupported
+	}
+	if err := stream.Close(ctx); err != nil && err != io.EOF {
+		return err
+	}
+	return nil
+}
+
+func newCallError(err error) *CallError {
+	return &CallError{
+		Code: yarpcerrors.FromError(err).Code(),
+		Err:  err,
+	}
+}
+
+func isCancellation(err error) bool {
+	return errors.Is(err, context.Canceled) ||
+		yarpcerrors.FromError(err).Code() == yarpcerrors.CodeCancelled
+}
@@ -0,0 +1,74 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package transport
+
+import (
+	"context"
+
+	"go.uber.org/yarpc/yarpcerrors"
+)
+
+// streamLimiter bounds the number of streams that are open at once.
+type streamLimiter struct {
+	slots    chan struct{}
+	failFast bool
+}
+
+// newStreamLimiter returns nil if max is not positive, meaning streams are
+// unlimited.
+func newStreamLimiter(max int, failFast bool) *streamLimiter {
+	if max <= 0 {
+		return nil
+	}
+	return &streamLimiter{
+		slots:    make(chan struct{}, max),
+		failFast: failFast,
+	}
+}
+
+// acquire takes a slot for a new stream, waiting for one to be released
+// unless the limiter fails fast. Streams are unlimited if l is nil.
+func (l *streamLimiter) acquire(ctx context.Context) error {
+	if l == nil {
+		return nil
+	}
+	if l.failFast {
+		select {
+		case l.slots <- struct{}{}:
+			return nil
+		default:
+			return yarpcerrors.ResourceExhaustedErrorf("already have the maximum of %v concurrent streams open", cap(l.slots))
+		}
+	}
+
+	select {
+	case l.slots <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return yarpcerrors.DeadlineExceededErrorf("timed out waiting for one of %v concurrent streams to close: %v", cap(l.slots), ctx.Err())
+	}
+}
+
+func (l *streamLimiter) release() {
+	if l != nil {
+		<-l.slots
+	}
+}
@@ -0,0 +1,145 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package transport
+
+import (
+	"context"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/yarpc/api/transport"
+	"go.uber.org/yarpc/yarpcerrors"
+)
+
+func TestGRPCMaxConcurrentStreams(t *testing.T) {
+	const maxStreams = 2
+
+	client, cleanup := newSimpleGRPCClient(t, &simpleSvc{}, GRPCOptions{MaxConcurrentStreams: maxStreams})
+	defer cleanup()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var streams []*transport.ClientStream
+	for i := 0; i < maxStreams; i++ {
+		streams = append(streams, openSimpleStream(ctx, t, client, "BidiStream"))
+	}
+
+	opened := make(chan *transport.ClientStream)
+	go func() {
+		stream, err := client.CallStream(ctx, &StreamRequest{
+			Request: &Request{TargetService: "Bar", Method: "Bar::BidiStream"},
+		})
+		assert.NoError(t, err)
+		opened <- stream
+	}()
+
+	select {
+	case <-opened:
+		t.Fatal("stream opened while the maximum number of streams were open")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	// Closing the stream only closes the send side, so it's still open
+	// until the server ends it.
+	require.NoError(t, streams[0].Close(ctx))
+	select {
+	case <-opened:
+		t.Fatal("stream opened after another stream was only half-closed")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	_, err := streams[0].ReceiveMessage(ctx)
+	require.Equal(t, io.EOF, err)
+	select {
+	case stream := <-opened:
+		streams = append(streams[1:], stream)
+	case <-time.After(time.Second):
+		t.Fatal("stream did not open after another stream ended")
+	}
+
+	t.Run("timeout waiting for a stream", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+		defer cancel()
+		_, err := client.CallStream(ctx, &StreamRequest{
+			Request: &Request{TargetService: "Bar", Method: "Bar::BidiStream"},
+		})
+		assert.Equal(t, yarpcerrors.CodeDeadlineExceeded, yarpcerrors.FromError(err).Code(), "unexpected error: %v", err)
+	})
+
+	for _, stream := range streams {
+		require.NoError(t, stream.Close(ctx))
+	}
+}
+
+func TestGRPCFailOnMaxConcurrentStreams(t *testing.T) {
+	client, cleanup := newSimpleGRPCClient(t, &simpleSvc{}, GRPCOptions{
+		MaxConcurrentStreams:       1,
+		FailOnMaxConcurrentStreams: true,
+	})
+	defer cleanup()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	stream := openSimpleStream(ctx, t, client, "BidiStream")
+
+	_, err := client.CallStream(ctx, &StreamRequest{
+		Request: &Request{TargetService: "Bar", Method: "Bar::BidiStream"},
+	})
+	assert.Equal(t, yarpcerrors.CodeResourceExhausted, yarpcerrors.FromError(err).Code(), "unexpected error: %v", err)
+
+	// Once the stream ends, the next stream can be opened.
+	require.NoError(t, stream.Close(ctx))
+	_, err = stream.ReceiveMessage(ctx)
+	require.Error(t, err)
+	stream = openSimpleStream(ctx, t, client, "BidiStream")
+	require.NoError(t, stream.Close(ctx))
+}
+
+func TestGRPCMaxConcurrentStreamsCancelled(t *testing.T) {
+	client, cleanup := newSimpleGRPCClient(t, &simpleSvc{}, GRPCOptions{
+		MaxConcurrentStreams:       1,
+		FailOnMaxConcurrentStreams: true,
+	})
+	defer cleanup()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	streamCtx, cancelStream := context.WithCancel(ctx)
+	openSimpleStream(streamCtx, t, client, "BidiStream")
+	cancelStream()
+
+	// The slot is released asynchronously once the stream's context is done.
+	assert.Eventually(t, func() bool {
+		stream, err := client.CallStream(ctx, &StreamRequest{
+			Request: &Request{TargetService: "Bar", Method: "Bar::BidiStream"},
+		})
+		if err != nil {
+			return false
+		}
+		require.NoError(t, stream.Close(ctx))
+		return true
+	}, time.Second, 10*time.Millisecond, "stream did not open after another stream was cancelled")
+}
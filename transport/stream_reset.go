@@ -0,0 +1,95 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package transport
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"go.uber.org/yarpc/api/transport"
+	"go.uber.org/yarpc/yarpcerrors"
+)
+
+// rstStreamMessage starts the message gRPC fails calls with when the server
+// resets their HTTP/2 stream, which is followed by the HTTP/2 error code.
+const rstStreamMessage = "stream terminated by RST_STREAM with error code: "
+
+// StreamResetError is returned when the server resets the HTTP/2 stream of a
+// call, which is a protocol error rather than a gRPC status sent by the
+// application. The underlying error still has the gRPC code, such as
+// Internal, that the reset was mapped to.
+type StreamResetError struct {
+	// ErrCode is the name of the HTTP/2 error code the stream was reset
+	// with, such as PROTOCOL_ERROR or INTERNAL_ERROR.
+	ErrCode string
+	Err     error
+}
+
+func (e *StreamResetError) Error() string {
+	return fmt.Sprintf("server reset the HTTP/2 stream with error code %v, a protocol error rather than an application error: %v", e.ErrCode, e.Err)
+}
+
+// Unwrap returns the underlying error.
+func (e *StreamResetError) Unwrap() error {
+	return e.Err
+}
+
+// wrapStreamReset returns err as a *StreamResetError if it's from the
+// server resetting the call's stream, and otherwise returns it unchanged.
+func wrapStreamReset(err error) error {
+	if err == nil {
+		return nil
+	}
+	message := yarpcerrors.FromError(err).Message()
+	i := strings.Index(message, rstStreamMessage)
+	if i < 0 {
+		return err
+	}
+	errCode := message[i+len(rstStreamMessage):]
+	if end := strings.IndexAny(errCode, " ;,"); end >= 0 {
+		errCode = errCode[:end]
+	}
+	return &StreamResetError{ErrCode: errCode, Err: err}
+}
+
+// resetReportingStream returns errors from the server resetting the stream
+// as a *StreamResetError.
+type resetReportingStream struct {
+	*transport.ClientStream
+}
+
+func newResetReportingStream(stream *transport.ClientStream) (*transport.ClientStream, error) {
+	return transport.NewClientStream(resetReportingStream{stream})
+}
+
+func (s resetReportingStream) SendMessage(ctx context.Context, msg *transport.StreamMessage) error {
+	return wrapStreamReset(s.ClientStream.SendMessage(ctx, msg))
+}
+
+func (s resetReportingStream) ReceiveMessage(ctx context.Context) (*transport.StreamMessage, error) {
+	msg, err := s.ClientStream.ReceiveMessage(ctx)
+	return msg, wrapStreamReset(err)
+}
+
+func (s resetReportingStream) Close(ctx context.Context) error {
+	return wrapStreamReset(s.ClientStream.Close(ctx))
+}
@@ -0,0 +1,133 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package transport
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/opentracing/opentracing-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/yarpc/yarpcerrors"
+	"golang.org/x/net/http2"
+)
+
+// newResettingServer starts an HTTP/2 server that resets every stream with
+// INTERNAL_ERROR, and returns its address.
+func newResettingServer(t *testing.T) string {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { lis.Close() })
+
+	server := &http2.Server{}
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Aborting the handler resets the stream.
+		panic(http.ErrAbortHandler)
+	})
+	go func() {
+		for {
+			conn, err := lis.Accept()
+			if err != nil {
+				return
+			}
+			go server.ServeConn(conn, &http2.ServeConnOpts{Handler: handler})
+		}
+	}()
+	return lis.Addr().String()
+}
+
+func TestGRPCStreamReset(t *testing.T) {
+	client, err := newGRPC(GRPCOptions{
+		Addresses: []string{newResettingServer(t)},
+		Tracer:    opentracing.NoopTracer{},
+		Caller:    "test",
+		Encoding:  "proto",
+	})
+	require.NoError(t, err)
+	defer client.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	assertReset := func(t *testing.T, err error) {
+		var resetErr *StreamResetError
+		require.True(t, errors.As(err, &resetErr), "expected StreamResetError, got %v", err)
+		assert.Equal(t, "INTERNAL_ERROR", resetErr.ErrCode)
+		assert.Contains(t, err.Error(), "server reset the HTTP/2 stream with error code INTERNAL_ERROR, a protocol error rather than an application error")
+		assert.Equal(t, yarpcerrors.CodeInternal, yarpcerrors.FromError(err).Code(), "gRPC code should be kept")
+	}
+
+	t.Run("unary", func(t *testing.T) {
+		_, err := client.Call(ctx, &Request{
+			TargetService: "Bar",
+			Method:        "Bar::Baz",
+			Timeout:       time.Second,
+			Body:          []byte{},
+		})
+		assertReset(t, err)
+	})
+
+	t.Run("stream", func(t *testing.T) {
+		stream := openSimpleStream(ctx, t, client, "BidiStream")
+		_, err := stream.ReceiveMessage(ctx)
+		assertReset(t, err)
+	})
+}
+
+func TestWrapStreamReset(t *testing.T) {
+	tests := []struct {
+		msg         string
+		err         error
+		wantErrCode string
+	}{
+		{
+			msg: "nil",
+		},
+		{
+			msg: "application error",
+			err: yarpcerrors.InternalErrorf("something failed"),
+		},
+		{
+			msg:         "reset",
+			err:         yarpcerrors.Newf(yarpcerrors.CodeInternal, "stream terminated by RST_STREAM with error code: PROTOCOL_ERROR"),
+			wantErrCode: "PROTOCOL_ERROR",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.msg, func(t *testing.T) {
+			err := wrapStreamReset(tt.err)
+			if tt.wantErrCode == "" {
+				assert.Equal(t, tt.err, err)
+				return
+			}
+			var resetErr *StreamResetError
+			require.True(t, errors.As(err, &resetErr), "expected StreamResetError, got %v", err)
+			assert.Equal(t, tt.wantErrCode, resetErr.ErrCode)
+			assert.Equal(t, tt.err, errors.Unwrap(err))
+		})
+	}
+}
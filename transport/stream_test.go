@@ -0,0 +1,713 @@
+// Copyright (c) 2021 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package transport
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/yarpc/yab/testdata/protobuf/simple"
+	"go.uber.org/atomic"
+	"go.uber.org/multierr"
+	"go.uber.org/yarpc/api/transport"
+	"go.uber.org/yarpc/yarpcerrors"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// blockingClientStreamSvc never reads from client streams until released.
+type blockingClientStreamSvc struct {
+	simpleSvc
+
+	release chan struct{}
+}
+
+func (s *blockingClientStreamSvc) ClientStream(stream simple.Bar_ClientStreamServer) error {
+	select {
+	case <-s.release:
+	case <-stream.Context().Done():
+	}
+	return nil
+}
+
+func openSimpleStream(ctx context.Context, t *testing.T, client *grpcTransport, method string) *transport.ClientStream {
+	stream, err := client.CallStream(ctx, &StreamRequest{
+		Request: &Request{
+			TargetService: "Bar",
+			Method:        "Bar::" + method,
+		},
+	})
+	require.NoError(t, err)
+	return stream
+}
+
+func TestSendStreamBlocksWhenServerStopsReading(t *testing.T) {
+	svc := &blockingClientStreamSvc{release: make(chan struct{})}
+	client, cleanup := newSimpleGRPCClient(t, svc, GRPCOptions{})
+	defer cleanup()
+	defer close(svc.release)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	stream := openSimpleStream(ctx, t, client, "ClientStream")
+
+	// The server never decodes these, so only the size matters.
+	msg := make([]byte, 256*1024)
+	var sent atomic.Int64
+	done := make(chan error, 1)
+	go func() {
+		done <- SendStream(ctx, stream, func() ([]byte, error) {
+			return msg, nil
+		}, func(p StreamSendProgress) {
+			sent.Store(p.Bytes)
+		})
+	}()
+
+	// Wait for the flow-control window to fill up and the sender to stall.
+	var last int64 = -1
+	for i := 0; i < 50; i++ {
+		time.Sleep(50 * time.Millisecond)
+		cur := sent.Load()
+		if cur == last {
+			break
+		}
+		last = cur
+	}
+
+	select {
+	case err := <-done:
+		t.Fatalf("SendStream returned while server was not reading: %v", err)
+	case <-time.After(200 * time.Millisecond):
+	}
+	assert.Equal(t, last, sent.Load(), "producer should be blocked by flow control")
+	assert.Less(t, sent.Load(), int64(64*1024*1024), "messages should not be buffered without bound")
+
+	cancel()
+	select {
+	case err := <-done:
+		assert.Error(t, err)
+	case <-time.After(time.Second):
+		t.Fatal("SendStream did not return after context cancellation")
+	}
+}
+
+func TestSendStream(t *testing.T) {
+	svc := &blockingClientStreamSvc{release: make(chan struct{})}
+	close(svc.release)
+	client, cleanup := newSimpleGRPCClient(t, svc, GRPCOptions{})
+	defer cleanup()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	stream := openSimpleStream(ctx, t, client, "BidiStream")
+
+	bodies := [][]byte{{0x08, 0x01}, {0x08, 0x02}, {0x08, 0x03}}
+	var progress []StreamSendProgress
+	err := SendStream(ctx, stream, func() ([]byte, error) {
+		if len(bodies) == 0 {
+			return nil, io.EOF
+		}
+		b := bodies[0]
+		bodies = bodies[1:]
+		return b, nil
+	}, func(p StreamSendProgress) {
+		progress = append(progress, p)
+	})
+	require.NoError(t, err)
+	require.Len(t, progress, 3)
+	assert.Equal(t, 3, progress[2].Messages)
+	assert.Equal(t, int64(6), progress[2].Bytes)
+	assert.NoError(t, stream.Close(ctx))
+
+	t.Run("producer error", func(t *testing.T) {
+		stream := openSimpleStream(ctx, t, client, "BidiStream")
+		err := SendStream(ctx, stream, func() ([]byte, error) {
+			return nil, errors.New("producer failed")
+		}, nil)
+		assert.EqualError(t, err, "producer failed")
+		assert.NoError(t, stream.Close(ctx))
+	})
+}
+
+func TestSendStreamSendTimeout(t *testing.T) {
+	svc := &blockingClientStreamSvc{release: make(chan struct{})}
+	client, cleanup := newSimpleGRPCClient(t, svc, GRPCOptions{})
+	defer cleanup()
+	defer close(svc.release)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	stream := openSimpleStream(ctx, t, client, "ClientStream")
+
+	// Keep sending until the flow-control window fills up and a send stalls.
+	msg := make([]byte, 256*1024)
+	start := time.Now()
+	err := SendStreamWithOptions(ctx, stream, func() ([]byte, error) {
+		return msg, nil
+	}, SendStreamOptions{SendTimeout: 100 * time.Millisecond})
+	require.Error(t, err)
+	assert.Equal(t, yarpcerrors.CodeDeadlineExceeded, yarpcerrors.FromError(err).Code(), "unexpected error: %v", err)
+	assert.Contains(t, err.Error(), "within 100ms")
+	assert.Less(t, time.Since(start), 5*time.Second, "send should time out well before the stream's deadline")
+	assert.Error(t, stream.Context().Err(), "stream should be cancelled")
+}
+
+// earlyCloseBidiSvc echoes a few messages and then fails the stream while the
+// client is still sending.
+type earlyCloseBidiSvc struct {
+	simpleSvc
+
+	closeAfter int
+}
+
+func (s *earlyCloseBidiSvc) BidiStream(stream simple.Bar_BidiStreamServer) error {
+	for i := 0; i < s.closeAfter; i++ {
+		msg, err := stream.Recv()
+		if err != nil {
+			return err
+		}
+		if err := stream.Send(msg); err != nil {
+			return err
+		}
+	}
+	return status.Error(codes.Aborted, "closing early")
+}
+
+func TestBidi(t *testing.T) {
+	bidiRequest := &StreamRequest{
+		Request: &Request{
+			TargetService: "Bar",
+			Method:        "Bar::BidiStream",
+		},
+	}
+	newProducer := func(n int) func() ([]byte, error) {
+		var sent int
+		return func() ([]byte, error) {
+			if n >= 0 && sent == n {
+				return nil, io.EOF
+			}
+			sent++
+			return []byte{0x08, byte(sent)}, nil
+		}
+	}
+
+	t.Run("success", func(t *testing.T) {
+		client, cleanup := newSimpleGRPCClient(t, &simpleSvc{}, GRPCOptions{})
+		defer cleanup()
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+
+		var received [][]byte
+		err := Bidi(ctx, client, bidiRequest, newProducer(3), func(body []byte) error {
+			received = append(received, body)
+			return nil
+		})
+		require.NoError(t, err)
+		assert.Equal(t, [][]byte{{0x08, 1}, {0x08, 2}, {0x08, 3}}, received)
+	})
+
+	t.Run("server closes early", func(t *testing.T) {
+		client, cleanup := newSimpleGRPCClient(t, &earlyCloseBidiSvc{closeAfter: 2}, GRPCOptions{})
+		defer cleanup()
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		var received int
+		err := Bidi(ctx, client, bidiRequest, newProducer(-1), func([]byte) error {
+			received++
+			return nil
+		})
+		require.Error(t, err)
+		assert.Equal(t, yarpcerrors.CodeAborted, yarpcerrors.FromError(err).Code(), "unexpected error: %v", err)
+		assert.Len(t, multierr.Errors(err), 1, "cancellation of the send side should not be reported: %v", err)
+		assert.Equal(t, 2, received)
+		assert.NoError(t, ctx.Err(), "Bidi should return before the deadline")
+	})
+
+	t.Run("producer error cancels receive", func(t *testing.T) {
+		client, cleanup := newSimpleGRPCClient(t, &blockingClientStreamSvc{release: make(chan struct{})}, GRPCOptions{})
+		defer cleanup()
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		err := Bidi(ctx, client, bidiRequest, func() ([]byte, error) {
+			return nil, errors.New("producer failed")
+		}, func([]byte) error {
+			return nil
+		})
+		assert.EqualError(t, err, "failed while sending stream request: producer failed")
+	})
+
+	t.Run("consumer error cancels send", func(t *testing.T) {
+		client, cleanup := newSimpleGRPCClient(t, &simpleSvc{}, GRPCOptions{})
+		defer cleanup()
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		err := Bidi(ctx, client, bidiRequest, newProducer(-1), func([]byte) error {
+			return errors.New("consumer failed")
+		})
+		assert.EqualError(t, err, "consumer failed")
+	})
+}
+
+// summingClientStreamSvc responds to client streams with the sum of the
+// values it received, or fails with err if set.
+type summingClientStreamSvc struct {
+	simpleSvc
+
+	err error
+}
+
+func (s *summingClientStreamSvc) ClientStream(stream simple.Bar_ClientStreamServer) error {
+	var sum int32
+	for {
+		msg, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		sum += msg.Test
+	}
+	if s.err != nil {
+		return s.err
+	}
+	return stream.SendAndClose(&simple.Foo{Test: sum})
+}
+
+func TestCloseSendAndReceive(t *testing.T) {
+	tests := []struct {
+		msg      string
+		svc      simple.BarServer
+		wantBody []byte
+		wantCode yarpcerrors.Code
+	}{
+		{
+			msg:      "success",
+			svc:      &summingClientStreamSvc{},
+			wantBody: []byte{0x08, 6},
+		},
+		{
+			msg:      "server error",
+			svc:      &summingClientStreamSvc{err: status.Error(codes.FailedPrecondition, "bad stream")},
+			wantCode: yarpcerrors.CodeFailedPrecondition,
+		},
+		{
+			msg:      "no response",
+			svc:      &simpleSvc{},
+			wantCode: yarpcerrors.CodeUnknown,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.msg, func(t *testing.T) {
+			client, cleanup := newSimpleGRPCClient(t, tt.svc, GRPCOptions{})
+			defer cleanup()
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+			defer cancel()
+
+			stream := openSimpleStream(ctx, t, client, "ClientStream")
+			for i := 1; i <= 3; i++ {
+				require.NoError(t, stream.SendMessage(ctx, &transport.StreamMessage{
+					Body: ioutil.NopCloser(bytes.NewReader([]byte{0x08, byte(i)})),
+				}))
+			}
+
+			res, err := CloseSendAndReceive(ctx, stream)
+			if tt.wantBody == nil {
+				var callErr *CallError
+				require.True(t, errors.As(err, &callErr), "expected CallError, got %v", err)
+				assert.Equal(t, tt.wantCode, callErr.Code, "unexpected error: %v", err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantBody, res.Body)
+		})
+	}
+}
+
+func TestCloseSendWithTrailers(t *testing.T) {
+	client, cleanup := newSimpleGRPCClient(t, &summingClientStreamSvc{}, GRPCOptions{})
+	defer cleanup()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	stream := openSimpleStream(ctx, t, client, "ClientStream")
+	send := func() error {
+		return stream.SendMessage(ctx, &transport.StreamMessage{
+			Body: ioutil.NopCloser(bytes.NewReader([]byte{0x08, 1})),
+		})
+	}
+	require.NoError(t, send())
+
+	err := CloseSendWithTrailers(ctx, stream, map[string]string{"checksum": "abc"})
+	assert.Equal(t, ErrClientTrailersUnsupported, err)
+	require.NoError(t, send(), "stream should still be open after failing to send trailers")
+
+	require.NoError(t, CloseSendWithTrailers(ctx, stream, nil))
+	msg, err := stream.ReceiveMessage(ctx)
+	require.NoError(t, err)
+	body, err := ioutil.ReadAll(msg.Body)
+	require.NoError(t, err)
+	assert.Equal(t, []byte{0x08, 2}, body)
+}
+
+func TestSendJSONLines(t *testing.T) {
+	marshalFoo := func(b []byte) ([]byte, error) {
+		var foo struct{ Test int32 }
+		if err := json.Unmarshal(b, &foo); err != nil {
+			return nil, err
+		}
+		return proto.Marshal(&simple.Foo{Test: foo.Test})
+	}
+
+	tests := []struct {
+		msg      string
+		writes   []string
+		wantBody []byte
+		wantErr  string
+	}{
+		{
+			msg:      "three lines",
+			writes:   []string{`{"test": 1}` + "\n", `{"test": 2}` + "\n", `{"test": 3}` + "\n"},
+			wantBody: []byte{0x08, 6},
+		},
+		{
+			msg:      "partial writes and no trailing newline",
+			writes:   []string{`{"te`, `st": 1}` + "\n\n" + `{"test": 2}`, "\n  \n", `{"test": 3}`},
+			wantBody: []byte{0x08, 6},
+		},
+		{
+			msg:     "invalid line",
+			writes:  []string{`{"test": 1}` + "\n", `{"test": ` + "\n", `{"test": 3}` + "\n"},
+			wantErr: "could not marshal request on line 2: unexpected end of JSON input",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.msg, func(t *testing.T) {
+			client, cleanup := newSimpleGRPCClient(t, &summingClientStreamSvc{}, GRPCOptions{})
+			defer cleanup()
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+			defer cancel()
+			stream := openSimpleStream(ctx, t, client, "ClientStream")
+
+			r, w := io.Pipe()
+			go func() {
+				for _, write := range tt.writes {
+					if _, err := io.WriteString(w, write); err != nil {
+						return
+					}
+				}
+				w.Close()
+			}()
+			defer r.Close()
+
+			res, err := SendJSONLines(ctx, stream, r, marshalFoo)
+			if tt.wantErr != "" {
+				assert.EqualError(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantBody, res.Body)
+		})
+	}
+}
+
+// countingServerStreamSvc responds to server streams with the values from
+// 1 to the request's value, and then fails with err if set.
+type countingServerStreamSvc struct {
+	simpleSvc
+
+	err error
+}
+
+func (s *countingServerStreamSvc) ServerStream(in *simple.Foo, stream simple.Bar_ServerStreamServer) error {
+	for i := int32(1); i <= in.Test; i++ {
+		if err := stream.Send(&simple.Foo{Test: i}); err != nil {
+			return err
+		}
+	}
+	return s.err
+}
+
+func TestCollectServerStream(t *testing.T) {
+	request := &StreamRequest{
+		Request: &Request{TargetService: "Bar", Method: "Bar::ServerStream"},
+	}
+	fiveMessages := [][]byte{{0x08, 1}, {0x08, 2}, {0x08, 3}, {0x08, 4}, {0x08, 5}}
+
+	tests := []struct {
+		msg      string
+		svc      simple.BarServer
+		maxBytes int
+		want     [][]byte
+		wantErr  string
+		wantCode yarpcerrors.Code
+	}{
+		{
+			msg:  "five messages",
+			svc:  &countingServerStreamSvc{},
+			want: fiveMessages,
+		},
+		{
+			msg:      "within max bytes",
+			svc:      &countingServerStreamSvc{},
+			maxBytes: 10,
+			want:     fiveMessages,
+		},
+		{
+			msg:      "exceeds max bytes",
+			svc:      &countingServerStreamSvc{},
+			maxBytes: 9,
+			want:     fiveMessages[:4],
+			wantErr:  "stream responses exceed the maximum of 9 bytes",
+		},
+		{
+			msg:      "server error",
+			svc:      &countingServerStreamSvc{err: status.Error(codes.DataLoss, "lost the rest")},
+			want:     fiveMessages,
+			wantCode: yarpcerrors.CodeDataLoss,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.msg, func(t *testing.T) {
+			client, cleanup := newSimpleGRPCClient(t, tt.svc, GRPCOptions{})
+			defer cleanup()
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+			defer cancel()
+
+			got, err := CollectServerStream(ctx, client, request, []byte{0x08, 5}, tt.maxBytes)
+			assert.Equal(t, tt.want, got)
+			switch {
+			case tt.wantErr != "":
+				assert.EqualError(t, err, tt.wantErr)
+			case tt.wantCode != yarpcerrors.CodeOK:
+				assert.Equal(t, tt.wantCode, yarpcerrors.FromError(errors.Unwrap(err)).Code(), "unexpected error: %v", err)
+			default:
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+// rawCodec passes message bytes through unchanged, so tests can send
+// messages without a generated service.
+type rawCodec struct{}
+
+func (rawCodec) Marshal(v interface{}) ([]byte, error) { return *(v.(*[]byte)), nil }
+
+func (rawCodec) Unmarshal(data []byte, v interface{}) error {
+	*(v.(*[]byte)) = append([]byte(nil), data...)
+	return nil
+}
+
+func (rawCodec) Name() string { return "raw" }
+
+func TestReceiveStream(t *testing.T) {
+	const (
+		numMessages = 3
+		messageSize = 6 * 1024 * 1024
+	)
+	largeMessage := func(i int) []byte {
+		return bytes.Repeat([]byte{byte('a' + i)}, messageSize)
+	}
+	sendLarge := func(srv interface{}, stream grpc.ServerStream) error {
+		var req []byte
+		if err := stream.RecvMsg(&req); err != nil {
+			return err
+		}
+		for i := 0; i < numMessages; i++ {
+			msg := largeMessage(i)
+			if err := stream.SendMsg(&msg); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	client, cleanup := newSimpleGRPCClient(t, &simpleSvc{}, GRPCOptions{MaxResponseSize: 2 * messageSize},
+		grpc.ForceServerCodec(rawCodec{}),
+		grpc.MaxSendMsgSize(2*messageSize),
+		grpc.UnknownServiceHandler(sendLarge))
+	defer cleanup()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	stream := openSimpleStream(ctx, t, client, "Download")
+	require.NoError(t, stream.SendMessage(ctx, &transport.StreamMessage{
+		Body: ioutil.NopCloser(bytes.NewReader(nil)),
+	}))
+	require.NoError(t, stream.Close(ctx))
+
+	var received int
+	err := ReceiveStream(ctx, stream, func(r io.Reader) error {
+		i := received
+		received++
+		if i == 0 {
+			// Only read the start, the rest should be drained.
+			prefix := make([]byte, 1024)
+			_, err := io.ReadFull(r, prefix)
+			require.NoError(t, err)
+			assert.Equal(t, largeMessage(i)[:1024], prefix)
+			return nil
+		}
+
+		// Read in chunks to process the message incrementally.
+		var total int
+		buf := make([]byte, 64*1024)
+		for {
+			n, err := r.Read(buf)
+			for _, b := range buf[:n] {
+				if b != byte('a'+i) {
+					return fmt.Errorf("message %v has unexpected byte %q at %v", i, b, total)
+				}
+			}
+			total += n
+			if err == io.EOF {
+				break
+			}
+			require.NoError(t, err)
+		}
+		assert.Equal(t, messageSize, total, "message %v size", i)
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, numMessages, received)
+
+	t.Run("consumer error", func(t *testing.T) {
+		stream := openSimpleStream(ctx, t, client, "Download")
+		require.NoError(t, stream.SendMessage(ctx, &transport.StreamMessage{
+			Body: ioutil.NopCloser(bytes.NewReader(nil)),
+		}))
+		err := ReceiveStream(ctx, stream, func(io.Reader) error {
+			return errors.New("consumer failed")
+		})
+		assert.EqualError(t, err, "consumer failed")
+	})
+}
+
+func TestStreamSendProgressBytesPerSecond(t *testing.T) {
+	assert.Zero(t, StreamSendProgress{Bytes: 10}.BytesPerSecond())
+	assert.Equal(t, float64(20), StreamSendProgress{Bytes: 10, Elapsed: 500 * time.Millisecond}.BytesPerSecond())
+}
+
+func TestRemainingDeadline(t *testing.T) {
+	client, cleanup := newSimpleGRPCClient(t, &simpleSvc{}, GRPCOptions{})
+	defer cleanup()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	stream := openSimpleStream(ctx, t, client, "BidiStream")
+
+	last, ok := RemainingDeadline(stream)
+	require.True(t, ok)
+	assert.True(t, last <= 10*time.Second, "remaining %v should not exceed the timeout", last)
+
+	const numMessages = 3
+	var sent, received int
+	require.NoError(t, SendStream(context.Background(), stream, func() ([]byte, error) {
+		if sent >= numMessages {
+			return nil, io.EOF
+		}
+		sent++
+		return nil, nil
+	}, nil))
+	require.NoError(t, stream.Close(ctx))
+
+	// Receive using a context without a deadline, which shouldn't affect the
+	// time remaining on the stream.
+	err := ReceiveStream(context.Background(), stream, func(io.Reader) error {
+		received++
+		time.Sleep(10 * time.Millisecond)
+		remaining, ok := RemainingDeadline(stream)
+		require.True(t, ok)
+		assert.True(t, remaining < last, "remaining %v should be less than %v", remaining, last)
+		last = remaining
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, numMessages, received)
+
+	// The peer is connected by now, so the stream can be opened without
+	// waiting on a deadline.
+	t.Run("no deadline", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		stream := openSimpleStream(ctx, t, client, "BidiStream")
+		_, ok := RemainingDeadline(stream)
+		assert.False(t, ok)
+	})
+}
+
+func TestGRPCStreamCancelledWhenDone(t *testing.T) {
+	client, cleanup := newSimpleGRPCClient(t, &simpleSvc{}, GRPCOptions{})
+	defer cleanup()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	isDone := func(stream *transport.ClientStream) bool {
+		select {
+		case <-stream.Context().Done():
+			return true
+		default:
+			return false
+		}
+	}
+
+	t.Run("received EOF", func(t *testing.T) {
+		stream := openSimpleStream(ctx, t, client, "BidiStream")
+		require.NoError(t, stream.Close(ctx))
+		assert.False(t, isDone(stream), "half-closing the stream should not cancel it")
+
+		_, err := stream.ReceiveMessage(ctx)
+		require.Equal(t, io.EOF, err)
+		assert.True(t, isDone(stream), "stream should be cancelled once it's done")
+	})
+
+	t.Run("receive failed", func(t *testing.T) {
+		stream := openSimpleStream(ctx, t, client, "ServerStream")
+		require.NoError(t, stream.SendMessage(ctx, &transport.StreamMessage{
+			Body: ioutil.NopCloser(bytes.NewReader([]byte("not a proto"))),
+		}))
+		require.NoError(t, stream.Close(ctx))
+
+		_, err := stream.ReceiveMessage(ctx)
+		require.Error(t, err)
+		require.NotEqual(t, io.EOF, err)
+		assert.True(t, isDone(stream), "stream should be cancelled once it fails")
+	})
+}
@@ -0,0 +1,110 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package transport
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/opentracing/opentracing-go/mocktracer"
+)
+
+// SpanExporter is implemented by tracers that keep the spans they finish
+// and can write them out themselves.
+type SpanExporter interface {
+	ExportSpans(w io.Writer) error
+}
+
+// SpanRecorder is implemented by tracers that keep the spans they finish,
+// such as the mocktracer.MockTracer. Their spans are exported as JSON.
+type SpanRecorder interface {
+	FinishedSpans() []*mocktracer.MockSpan
+}
+
+type exportedSpan struct {
+	OperationName string                 `json:"operationName"`
+	TraceID       int                    `json:"traceId"`
+	SpanID        int                    `json:"spanId"`
+	ParentID      int                    `json:"parentId,omitempty"`
+	StartTime     time.Time              `json:"startTime"`
+	FinishTime    time.Time              `json:"finishTime"`
+	DurationMs    float64                `json:"durationMs"`
+	Tags          map[string]interface{} `json:"tags,omitempty"`
+	Logs          []exportedLog          `json:"logs,omitempty"`
+}
+
+type exportedLog struct {
+	Timestamp time.Time         `json:"timestamp"`
+	Fields    map[string]string `json:"fields"`
+}
+
+// ExportTraces writes the spans finished by the transport's tracer so far.
+// The tracer must implement SpanExporter or SpanRecorder.
+func (t *grpcTransport) ExportTraces(w io.Writer) error {
+	return exportTraces(w, t.tracer)
+}
+
+func exportTraces(w io.Writer, tracer interface{}) error {
+	switch tracer := tracer.(type) {
+	case SpanExporter:
+		return tracer.ExportSpans(w)
+	case SpanRecorder:
+		return writeSpansJSON(w, tracer.FinishedSpans())
+	default:
+		return fmt.Errorf("unsupported tracer %T: it does not record spans to export", tracer)
+	}
+}
+
+func writeSpansJSON(w io.Writer, finished []*mocktracer.MockSpan) error {
+	spans := make([]exportedSpan, 0, len(finished))
+	for _, s := range finished {
+		span := exportedSpan{
+			OperationName: s.OperationName,
+			TraceID:       s.SpanContext.TraceID,
+			SpanID:        s.SpanContext.SpanID,
+			ParentID:      s.ParentID,
+			StartTime:     s.StartTime,
+			FinishTime:    s.FinishTime,
+			DurationMs:    float64(s.FinishTime.Sub(s.StartTime)) / float64(time.Millisecond),
+			Tags:          make(map[string]interface{}),
+		}
+		for k, v := range s.Tags() {
+			if err, ok := v.(error); ok {
+				v = err.Error()
+			}
+			span.Tags[k] = v
+		}
+		for _, l := range s.Logs() {
+			log := exportedLog{Timestamp: l.Timestamp, Fields: make(map[string]string, len(l.Fields))}
+			for _, f := range l.Fields {
+				log.Fields[f.Key] = f.ValueString
+			}
+			span.Logs = append(span.Logs, log)
+		}
+		spans = append(spans, span)
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(spans)
+}
@@ -0,0 +1,108 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package transport
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/mocktracer"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/uber/jaeger-client-go"
+)
+
+// countingTracer is a tracer that exports the number of spans it finished.
+type countingTracer struct {
+	*mocktracer.MockTracer
+}
+
+func (c countingTracer) ExportSpans(w io.Writer) error {
+	_, err := fmt.Fprintf(w, "%v spans", len(c.FinishedSpans()))
+	return err
+}
+
+func callForTraces(t *testing.T, tracer opentracing.Tracer) *grpcTransport {
+	client, cleanup := newSimpleGRPCClient(t, &simpleSvc{}, GRPCOptions{Tracer: tracer})
+	t.Cleanup(cleanup)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	_, err := client.Call(ctx, &Request{TargetService: "Bar", Method: "Bar::Baz", Body: []byte{}})
+	require.NoError(t, err)
+	return client
+}
+
+func TestGRPCExportTraces(t *testing.T) {
+	t.Run("mocktracer", func(t *testing.T) {
+		client := callForTraces(t, mocktracer.New())
+
+		var buf bytes.Buffer
+		require.NoError(t, client.ExportTraces(&buf))
+
+		var spans []exportedSpan
+		require.NoError(t, json.Unmarshal(buf.Bytes(), &spans), "exported traces should be JSON: %s", buf.String())
+		require.Len(t, spans, 1)
+		assert.Equal(t, "Bar::Baz", spans[0].OperationName)
+		assert.NotZero(t, spans[0].TraceID)
+		assert.True(t, spans[0].DurationMs >= 0)
+		assert.Equal(t, "client", spans[0].Tags["span.kind"])
+	})
+
+	t.Run("span exporter", func(t *testing.T) {
+		client := callForTraces(t, countingTracer{mocktracer.New()})
+
+		var buf bytes.Buffer
+		require.NoError(t, client.ExportTraces(&buf))
+		assert.Equal(t, "1 spans", buf.String())
+	})
+
+	t.Run("unsupported tracers", func(t *testing.T) {
+		jaegerTracer, closer := jaeger.NewTracer("yab", jaeger.NewConstSampler(true), jaeger.NewNullReporter())
+		defer closer.Close()
+
+		tests := []struct {
+			tracer  opentracing.Tracer
+			wantErr string
+		}{
+			{
+				tracer:  opentracing.NoopTracer{},
+				wantErr: "unsupported tracer opentracing.NoopTracer: it does not record spans to export",
+			},
+			{
+				tracer:  jaegerTracer,
+				wantErr: "unsupported tracer *jaeger.Tracer: it does not record spans to export",
+			},
+		}
+
+		for _, tt := range tests {
+			var buf bytes.Buffer
+			assert.EqualError(t, exportTraces(&buf, tt.tracer), tt.wantErr)
+			assert.Empty(t, buf.String(), "nothing should be written for %T", tt.tracer)
+		}
+	})
+}